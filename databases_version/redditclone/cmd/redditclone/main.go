@@ -3,23 +3,47 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/automod"
+	"redditclone/pkg/ban"
+	"redditclone/pkg/community"
+	"redditclone/pkg/feed"
+	"redditclone/pkg/follow"
 	"redditclone/pkg/handlers"
+	"redditclone/pkg/media"
+	"redditclone/pkg/notification"
 	"redditclone/pkg/post"
+	"redditclone/pkg/preview"
+	"redditclone/pkg/report"
+	"redditclone/pkg/role"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
+	"redditclone/pkg/views"
+	"redditclone/pkg/vote"
 
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func initUserDB() *sql.DB {
 	dsn := "root:love@tcp(localhost:3306)/golang?"
 	dsn += "&charset=utf8"
 	dsn += "&interpolateParams=true"
+	// иначе DATETIME из communities не сканируется в time.Time
+	dsn += "&parseTime=true"
 
 	db, err := sql.Open("mysql", dsn)
 
@@ -34,12 +58,75 @@ func initUserDB() *sql.DB {
 	return db
 }
 
-func initPostsDB() *mongo.Collection {
+// loadAutomod - правила из REDDITCLONE_AUTOMOD, по умолчанию automod.yaml в рабочей папке.
+// Файла нет - работаем без автомодератора, а битый файл роняет старт, чтобы не остаться без правил молча
+func loadAutomod(logger *zap.SugaredLogger) *automod.Engine {
+	path := os.Getenv("REDDITCLONE_AUTOMOD")
+	if path == "" {
+		path = "automod.yaml"
+	}
+	engine, err := automod.Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.Infof("No automod rules at %s, automod is off", path)
+		return nil
+	}
+	panicOnErr(err)
+	logger.Infof("Loaded %d automod rules from %s", engine.Len(), path)
+	return engine
+}
+
+// passwordCost - стоимость bcrypt из REDDITCLONE_BCRYPT_COST. Не задана или вне [bcrypt.MinCost, bcrypt.MaxCost] - bcrypt.DefaultCost.
+// Поменять можно в любой момент: пароли со старой стоимостью перехешируются при следующем логине
+func passwordCost(logger *zap.SugaredLogger) int {
+	raw := os.Getenv("REDDITCLONE_BCRYPT_COST")
+	if raw == "" {
+		return bcrypt.DefaultCost
+	}
+	cost, err := strconv.Atoi(raw)
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		logger.Warnf("Bad REDDITCLONE_BCRYPT_COST %q, want %d..%d, using %d", raw, bcrypt.MinCost, bcrypt.MaxCost, bcrypt.DefaultCost)
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
+
+// reportThreshold - сколько жалоб прячет пост из лент, из REDDITCLONE_REPORT_THRESHOLD. 0 - не прятать никогда.
+// Не задан или не число >= 0 - report.DefaultHideThreshold
+func reportThreshold(logger *zap.SugaredLogger) int {
+	raw := os.Getenv("REDDITCLONE_REPORT_THRESHOLD")
+	if raw == "" {
+		return report.DefaultHideThreshold
+	}
+	threshold, err := strconv.Atoi(raw)
+	if err != nil || threshold < 0 {
+		logger.Warnf("Bad REDDITCLONE_REPORT_THRESHOLD %q, want a number >= 0, using %d", raw, report.DefaultHideThreshold)
+		return report.DefaultHideThreshold
+	}
+	return threshold
+}
+
+// newBlobStore - S3-совместимое хранилище, если задан REDDITCLONE_S3_ENDPOINT, иначе папка uploads
+func newBlobStore(logger *zap.SugaredLogger) media.BlobStore {
+	endpoint := os.Getenv("REDDITCLONE_S3_ENDPOINT")
+	if endpoint == "" {
+		logger.Infof("Storing uploads in ./uploads")
+		return media.NewFileStore("uploads")
+	}
+	logger.Infof("Storing uploads in S3 at %s", endpoint)
+	return media.NewS3Store(media.S3Config{
+		Endpoint:  endpoint,
+		Region:    os.Getenv("REDDITCLONE_S3_REGION"),
+		Bucket:    os.Getenv("REDDITCLONE_S3_BUCKET"),
+		AccessKey: os.Getenv("REDDITCLONE_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("REDDITCLONE_S3_SECRET_KEY"),
+	})
+}
+
+func initPostsDB() *mongo.Database {
 	ctx := context.Background()
 	sess, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost"))
 	panicOnErr(err)
-	collection := sess.Database("golang").Collection("posts")
-	return collection
+	return sess.Database("golang")
 }
 
 // тут была реализация с redis.Conn, как было в примерах, но потом я погуглил и
@@ -70,31 +157,153 @@ func main() {
 	logger := zapLogger.Sugar()
 
 	userDB := initUserDB()
-	collectionPosts := initPostsDB()
+	postsDB := initPostsDB()
 	// redisConn := initSessRedis()
 	redisAddr := "localhost:6379"
 	sm := session.NewRedisSessionManager(redisAddr)
 
-	userRepo := user.NewMySQLRepo(userDB)
-	postRepo := post.NewMongoRepo(collectionPosts, logger)
+	userRepo := user.NewMySQLRepo(userDB, user.NewPasswordHasher(passwordCost(logger)), logger)
+	communityRepo := community.NewMySQLRepo(userDB)
+	followRepo := follow.NewMySQLRepo(userDB)
+	roleRepo := role.NewMySQLRepo(userDB)
+	banRepo := ban.NewMySQLRepo(userDB)
+	postRepo := post.NewMongoRepo(postsDB.Collection("posts"), logger)
+	voteRepo := vote.NewMongoRepo(postsDB.Collection("votes"), logger)
+	reportRepo := report.NewMongoRepo(postsDB.Collection("reports"), reportThreshold(logger), logger)
+	auditRepo := audit.NewMongoRepo(postsDB.Collection("audit"), logger)
+	notificationRepo := notification.NewMongoRepo(postsDB.Collection("notifications"), postsDB.Collection("notification_preferences"), logger)
+	panicOnErr(postRepo.EnsureIndexes())
+	panicOnErr(reportRepo.EnsureIndexes())
+	panicOnErr(auditRepo.EnsureIndexes())
+	panicOnErr(voteRepo.EnsureIndexes())
+	panicOnErr(notificationRepo.EnsureIndexes())
+	panicOnErr(postRepo.MigrateEmbeddedVotes(voteRepo))
+	panicOnErr(postRepo.BackfillRanks())
+	panicOnErr(postRepo.BackfillHosts())
+	panicOnErr(postRepo.BackfillLinkHashes())
+	panicOnErr(postRepo.BackfillHTML())
+
+	// фоновые задачи останавливаем после сервера, чтобы views напоследок сбросил и то, что насчитали последние запросы
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	viewCounter := views.NewRedisCounter(sm.Client, views.DedupWindow)
+	viewsDone := make(chan struct{})
+	go func() {
+		views.Run(jobs, viewCounter, postRepo, views.FlushInterval, logger)
+		close(viewsDone)
+	}()
+	go post.RunVoteReconciler(jobs, postRepo, voteRepo, post.VoteReconcileInterval, logger)
+
+	// карточки ссылок: миниатюры лежат в статике, REDDITCLONE_PREVIEW_BLOCKED - домены через запятую, куда не ходим
+	previewFetcher := preview.NewFetcher(preview.Options{Blocked: strings.Split(os.Getenv("REDDITCLONE_PREVIEW_BLOCKED"), ",")})
+	previewWorker := preview.NewWorker(previewFetcher, preview.NewFileStore("static/thumbs", "/static/thumbs"), postRepo, preview.DefaultQueueSize, logger)
+	go previewWorker.Run(jobs, 4)
+
+	notificationWorker := notification.NewWorker(notificationRepo, userRepo, notification.DefaultQueueSize, logger)
+	go notificationWorker.Run(jobs, 2)
+
+	feedService := feed.NewService(postRepo, communityRepo, followRepo, feed.NewRedisTimeline(sm.Client), logger)
 
 	userHandler := &handlers.UserHandler{
 		UserRepo: userRepo,
+		Follows:  followRepo,
+		Feed:     feedService,
 		Logger:   logger,
 		Sessions: sm,
+		Audit:    auditRepo,
 	}
 
+	automodEngine := loadAutomod(logger)
+	blobs := newBlobStore(logger)
+
 	postHandler := &handlers.PostHandler{
+		PostRepo:      postRepo,
+		VoteRepo:      voteRepo,
+		Communities:   communityRepo,
+		Roles:         roleRepo,
+		Bans:          banRepo,
+		Feed:          feedService,
+		Views:         viewCounter,
+		Audit:         auditRepo,
+		Automod:       automodEngine,
+		Users:         userRepo,
+		Reports:       reportRepo,
+		Previews:      previewWorker,
+		Media:         blobs,
+		Notifications: notificationWorker,
+		Logger:        logger,
+	}
+
+	communityHandler := &handlers.CommunityHandler{
+		CommunityRepo: communityRepo,
+		Roles:         roleRepo,
+		Feed:          feedService,
+		Audit:         auditRepo,
+		Logger:        logger,
+	}
+
+	reportHandler := &handlers.ReportHandler{
+		Reports:  reportRepo,
 		PostRepo: postRepo,
+		Roles:    roleRepo,
+		Audit:    auditRepo,
+		Media:    blobs,
 		Logger:   logger,
-		Sessions: sm,
+	}
+
+	banHandler := &handlers.BanHandler{
+		Bans:        banRepo,
+		Roles:       roleRepo,
+		Communities: communityRepo,
+		Sessions:    sm,
+		Audit:       auditRepo,
+		Logger:      logger,
+	}
+
+	auditHandler := &handlers.AuditHandler{
+		Audit:  auditRepo,
+		Roles:  roleRepo,
+		Logger: logger,
+	}
+
+	automodHandler := &handlers.AutomodHandler{
+		Automod: automodEngine,
+		Roles:   roleRepo,
+		Logger:  logger,
+	}
+
+	notificationHandler := &handlers.NotificationHandler{
+		Notifications: notificationRepo,
+		Logger:        logger,
 	}
 
 	port := "8080"
-	configuredRouter := handlers.ConfigureRoutes(userHandler, postHandler, logger)
+	configuredRouter := handlers.ConfigureRoutes(userHandler, postHandler, communityHandler, reportHandler, banHandler, auditHandler, automodHandler, notificationHandler, sm, logger)
 	fmt.Printf("Starting server at :%s", port)
-	if err := http.ListenAndServe(":"+port, configuredRouter); err != nil {
-		logger.Errorf("Server error: %v", err)
+	serve(":"+port, configuredRouter, logger)
+	stopJobs()
+	<-viewsDone
+}
+
+// serve отдает handler, пока не придет SIGINT или SIGTERM, и дожидается уже начатых запросов
+func serve(addr string, handler http.Handler, logger *zap.SugaredLogger) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Server error: %v", err)
+			stop()
+		}
+	}()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Errorf("Server shutdown error: %v", err)
 	}
 }
 
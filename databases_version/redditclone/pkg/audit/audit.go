@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"redditclone/pkg/utils"
+)
+
+type Action string
+
+const (
+	ActionRegister        Action = "register"
+	ActionLogin           Action = "login"
+	ActionLoginFailed     Action = "login_failed"
+	ActionLogout          Action = "logout"
+	ActionPostDelete      Action = "post_delete"
+	ActionCommentDelete   Action = "comment_delete"
+	ActionPostRemove      Action = "post_remove"
+	ActionCommentRemove   Action = "comment_remove"
+	ActionReportResolve   Action = "report_resolve"
+	ActionBan             Action = "ban"
+	ActionUnban           Action = "unban"
+	ActionModeratorAdd    Action = "moderator_add"
+	ActionModeratorRemove Action = "moderator_remove"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+var (
+	ErrBadRange = errors.New("bad time range")
+	ErrBadLimit = errors.New("bad limit")
+)
+
+// Event - запись журнала. Пишется один раз и больше не меняется.
+// Before и After - JSON того, что было до и стало после действия, если есть что показать
+type Event struct {
+	ID      string `json:"id" bson:"id"`
+	Action  Action `json:"action" bson:"action"`
+	Actor   string `json:"actor" bson:"actor"`
+	ActorID string `json:"actorId,omitempty" bson:"actor_id,omitempty"`
+	Target  string `json:"target" bson:"target"`
+	// Category - сообщество, в котором было действие, "" - весь сайт: логины, баны на весь сайт
+	Category string          `json:"category,omitempty" bson:"category,omitempty"`
+	Before   json.RawMessage `json:"before,omitempty" bson:"before,omitempty"`
+	After    json.RawMessage `json:"after,omitempty" bson:"after,omitempty"`
+	IP       string          `json:"ip,omitempty" bson:"ip,omitempty"`
+	Created  time.Time       `json:"created" bson:"created"`
+}
+
+func NewEvent(action Action, actor, actorID, target string, now time.Time) Event {
+	return Event{
+		ID:      utils.GenerateID(),
+		Action:  action,
+		Actor:   actor,
+		ActorID: actorID,
+		Target:  target,
+		Created: now,
+	}
+}
+
+// Snapshot - состояние объекта для Before и After. Не сериализовалось - значит без снимка,
+// событие важнее
+func Snapshot(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// цели событий - тип и id через двоеточие, чтобы по ним можно было фильтровать
+
+func PostTarget(postID string) string {
+	return "post:" + postID
+}
+
+func CommentTarget(postID, commentID string) string {
+	return "comment:" + postID + "/" + commentID
+}
+
+func UserTarget(username string) string {
+	return "user:" + username
+}
+
+func ReportTarget(itemID string) string {
+	return "report:" + itemID
+}
+
+// Query - фильтр журнала. Пустые поля не фильтруют, From и To включительно.
+// Админ видит все, модератор - только события своих сообществ
+type Query struct {
+	Actor       string
+	Target      string
+	From        time.Time
+	To          time.Time
+	All         bool
+	Communities []string
+	Limit       int
+}
+
+func (q Query) Validate() error {
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return ErrBadRange
+	}
+	if q.Limit < 0 || q.Limit > MaxLimit {
+		return ErrBadLimit
+	}
+	return nil
+}
+
+func (q Query) limit() int {
+	if q.Limit <= 0 {
+		return DefaultLimit
+	}
+	return q.Limit
+}
+
+// AuditRepo - журнал только дописывается: ни менять, ни удалять события нельзя.
+// Query отдает самые новые сначала
+type AuditRepo interface {
+	Record(event Event) error
+	Query(query Query) ([]Event, error)
+}
@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+
+	"redditclone/pkg/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	idKey       = "id"
+	actorKey    = "actor"
+	targetKey   = "target"
+	categoryKey = "category"
+	createdKey  = "created"
+)
+
+// AuditMongoRepo умеет только InsertOne и Find: методов на update и delete тут нет специально.
+// Для полной неизменяемости пользователю приложения в базе стоит оставить только insert и find на коллекцию
+type AuditMongoRepo struct {
+	collection *mongo.Collection
+	logger     *zap.SugaredLogger
+}
+
+func NewMongoRepo(collection *mongo.Collection, logger *zap.SugaredLogger) *AuditMongoRepo {
+	return &AuditMongoRepo{
+		collection: collection,
+		logger:     logger,
+	}
+}
+
+// EnsureIndexes - под фильтры журнала: по времени, по актору и по цели
+func (repo *AuditMongoRepo) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: idKey, Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: createdKey, Value: -1}}},
+		{Keys: bson.D{{Key: actorKey, Value: 1}, {Key: createdKey, Value: -1}}},
+		{Keys: bson.D{{Key: targetKey, Value: 1}, {Key: createdKey, Value: -1}}},
+	}
+	if _, err := repo.collection.Indexes().CreateMany(ctx, models); err != nil {
+		repo.logger.Errorf("Error creating audit indexes: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *AuditMongoRepo) Record(event Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := repo.collection.InsertOne(ctx, event); err != nil {
+		repo.logger.Errorf("Error recording audit event %s: %v", event.Action, err)
+		return err
+	}
+	return nil
+}
+
+func (repo *AuditMongoRepo) Query(query Query) ([]Event, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	filter := bson.M{}
+	if query.Actor != "" {
+		filter[actorKey] = query.Actor
+	}
+	if query.Target != "" {
+		filter[targetKey] = query.Target
+	}
+	created := bson.M{}
+	if !query.From.IsZero() {
+		created["$gte"] = query.From
+	}
+	if !query.To.IsZero() {
+		created["$lte"] = query.To
+	}
+	if len(created) > 0 {
+		filter[createdKey] = created
+	}
+	if !query.All {
+		communities := query.Communities
+		if communities == nil {
+			communities = []string{}
+		}
+		filter[categoryKey] = bson.M{"$in": communities}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: createdKey, Value: -1}}).
+		SetLimit(int64(query.limit()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	eventsFromDB, err := repo.collection.Find(ctx, filter, opts)
+	if err != nil {
+		repo.logger.Errorf("Error querying audit log: %v", err)
+		return nil, err
+	}
+
+	defer utils.HandleMongoCursorClose(eventsFromDB, ctx)
+
+	events := make([]Event, 0)
+	for eventsFromDB.Next(ctx) {
+		var event Event
+		if err := eventsFromDB.Decode(&event); err != nil {
+			repo.logger.Errorf("Error decoding audit event: %v", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, eventsFromDB.Err()
+}
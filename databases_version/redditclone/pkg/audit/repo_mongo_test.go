@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.uber.org/zap"
+)
+
+var (
+	nilLogger = zap.NewNop().Sugar()
+	now       = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func eventDoc(t *testing.T, event Event) bson.D {
+	t.Helper()
+	raw, err := bson.Marshal(event)
+	if err != nil {
+		t.Fatalf("marshal event: %v", err)
+	}
+	var doc bson.D
+	if err = bson.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("unmarshal event: %v", err)
+	}
+	return doc
+}
+
+func TestSnapshot(t *testing.T) {
+	if Snapshot(nil) != nil {
+		t.Error("expected no snapshot of nil")
+	}
+	if Snapshot(make(chan int)) != nil {
+		t.Error("expected no snapshot of unserializable value")
+	}
+	if got := string(Snapshot(map[string]int{"score": 1})); got != `{"score":1}` {
+		t.Errorf("unexpected snapshot %s", got)
+	}
+}
+
+func TestQueryValidate(t *testing.T) {
+	if err := (Query{From: now, To: now.Add(-time.Hour)}).Validate(); !errors.Is(err, ErrBadRange) {
+		t.Errorf("expected ErrBadRange, got %v", err)
+	}
+	if err := (Query{Limit: MaxLimit + 1}).Validate(); !errors.Is(err, ErrBadLimit) {
+		t.Errorf("expected ErrBadLimit, got %v", err)
+	}
+	if err := (Query{From: now, To: now}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("insert", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		event := NewEvent(ActionPostDelete, "alice", "1", PostTarget("p1"), now)
+		event.Before = Snapshot(map[string]string{"title": "hello"})
+		if err := repo.Record(event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		started := mt.GetStartedEvent()
+		if started.CommandName != "insert" {
+			t.Fatalf("expected insert, got %s", started.CommandName)
+		}
+		doc := started.Command.Lookup("documents").Array().Index(0).Value().Document()
+		if doc.Lookup(targetKey).StringValue() != "post:p1" || doc.Lookup(actorKey).StringValue() != "alice" {
+			t.Errorf("unexpected document %v", doc)
+		}
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if err := repo.Record(NewEvent(ActionLogin, "alice", "1", UserTarget("alice"), now)); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestQuery(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("admin filters", func(mt *mtest.T) {
+		event := NewEvent(ActionBan, "alice", "1", UserTarget("bob"), now)
+		event.After = Snapshot(map[string]string{"reason": "spam"})
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.audit", mtest.FirstBatch, eventDoc(t, event)))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		events, err := repo.Query(Query{Actor: "alice", From: now.Add(-time.Hour), All: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(events) != 1 || events[0].ID != event.ID {
+			t.Fatalf("unexpected events: %+v", events)
+		}
+		var after map[string]string
+		if err = json.Unmarshal(events[0].After, &after); err != nil || after["reason"] != "spam" {
+			t.Errorf("snapshot was not restored: %s", events[0].After)
+		}
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		if filter.Lookup(actorKey).StringValue() != "alice" {
+			t.Errorf("expected actor filter, got %v", filter)
+		}
+		if _, err = filter.Lookup(createdKey).Document().LookupErr("$gte"); err != nil {
+			t.Errorf("expected time filter, got %v", filter)
+		}
+		if _, err = filter.LookupErr(categoryKey); err == nil {
+			t.Errorf("admin should not be limited by category: %v", filter)
+		}
+	})
+
+	mt.Run("moderator sees own communities", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.audit", mtest.FirstBatch))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.Query(Query{Communities: []string{"music"}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		started := mt.GetStartedEvent().Command
+		in := started.Lookup("filter").Document().Lookup(categoryKey).Document().Lookup("$in").Array()
+		if values, _ := in.Values(); len(values) != 1 || values[0].StringValue() != "music" {
+			t.Errorf("unexpected category filter %v", in)
+		}
+		if limit := started.Lookup("limit").AsInt64(); limit != DefaultLimit {
+			t.Errorf("expected default limit, got %d", limit)
+		}
+	})
+
+	mt.Run("bad range", func(mt *mtest.T) {
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.Query(Query{From: now, To: now.Add(-time.Minute), All: true}); !errors.Is(err, ErrBadRange) {
+			t.Fatalf("expected ErrBadRange, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package automod
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testRules = `
+rules:
+  - name: shorteners
+    match:
+      domains: [bit.ly]
+    action: reject
+    message: no shorteners
+  - name: newbie-links
+    type: post
+    match:
+      domains: [youtube.com]
+      account_age_days_below: 3
+    action: hold
+    message: checked by moderators
+  - name: low-karma
+    match:
+      karma_below: 0
+    action: remove
+    message: negative karma
+  - name: music-question
+    categories: [Music]
+    type: post
+    match:
+      title: (?i)\?$
+    action: flair
+    flair: question
+  - name: spam-comments
+    type: comment
+    match:
+      body: (?i)buy now
+    action: remove
+    message: spam
+`
+
+func TestParse(t *testing.T) {
+	engine, err := Parse([]byte(testRules))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if engine.Len() != 5 {
+		t.Errorf("expected 5 rules, got %d", engine.Len())
+	}
+
+	engine, err = Parse(nil)
+	if err != nil || engine.Len() != 0 {
+		t.Errorf("expected empty engine, got %d rules, %v", engine.Len(), err)
+	}
+
+	bad := map[string]string{
+		"unknown field":     "rules:\n  - name: a\n    match: {body: x}\n    action: remove\n    mesage: typo\n",
+		"bad regexp":        "rules:\n  - name: a\n    match: {title: '('}\n    action: remove\n    message: m\n",
+		"no conditions":     "rules:\n  - name: a\n    action: remove\n    message: m\n",
+		"no message":        "rules:\n  - name: a\n    match: {body: x}\n    action: hold\n",
+		"unknown action":    "rules:\n  - name: a\n    match: {body: x}\n    action: ban\n    message: m\n",
+		"flair on comments": "rules:\n  - name: a\n    match: {body: x}\n    action: flair\n    flair: f\n",
+		"title on comments": "rules:\n  - name: a\n    type: comment\n    match: {title: x}\n    action: remove\n    message: m\n",
+		"duplicate name":    "rules:\n  - {name: a, match: {body: x}, action: remove, message: m}\n  - {name: a, match: {body: y}, action: remove, message: m}\n",
+		"no name":           "rules:\n  - match: {body: x}\n    action: remove\n    message: m\n",
+	}
+	for name, config := range bad {
+		if _, err := Parse([]byte(config)); !errors.Is(err, ErrBadRule) {
+			t.Errorf("%s: expected ErrBadRule, got %v", name, err)
+		}
+	}
+}
+
+func TestLoadExample(t *testing.T) {
+	engine, err := Load("../../automod.example.yaml")
+	if err != nil {
+		t.Fatalf("example config is broken: %v", err)
+	}
+	if engine.Len() == 0 {
+		t.Error("expected rules in example config")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	engine, err := Parse([]byte(testRules))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	old := 30 * 24 * time.Hour
+	cases := []struct {
+		name    string
+		subject Subject
+		action  Action
+		reason  string
+		flair   string
+		hits    []string
+	}{
+		{
+			name:    "clean post",
+			subject: Subject{Kind: KindPost, Category: "music", Title: "new album", URL: "https://example.com/a", AccountAge: old},
+			hits:    []string{},
+		},
+		{
+			name:    "shortener in body",
+			subject: Subject{Kind: KindPost, Category: "news", Body: "see (https://bit.ly/x)", AccountAge: old},
+			action:  ActionReject,
+			reason:  "no shorteners",
+			hits:    []string{"shorteners"},
+		},
+		{
+			name:    "subdomain of new account",
+			subject: Subject{Kind: KindPost, Category: "music", Title: "listen?", URL: "https://m.YouTube.com/watch", AccountAge: time.Hour},
+			action:  ActionHold,
+			reason:  "checked by moderators",
+			flair:   "question",
+			hits:    []string{"newbie-links", "music-question"},
+		},
+		{
+			name:    "old account is not held",
+			subject: Subject{Kind: KindPost, Category: "music", URL: "https://youtube.com/watch", AccountAge: old},
+			hits:    []string{},
+		},
+		{
+			name:    "strictest action wins",
+			subject: Subject{Kind: KindPost, Category: "news", URL: "https://bit.ly/x", Karma: -5, AccountAge: old},
+			action:  ActionReject,
+			reason:  "no shorteners",
+			hits:    []string{"shorteners", "low-karma"},
+		},
+		{
+			name:    "comment rule skips posts",
+			subject: Subject{Kind: KindPost, Category: "news", Body: "BUY NOW", AccountAge: old},
+			hits:    []string{},
+		},
+		{
+			name:    "spam comment",
+			subject: Subject{Kind: KindComment, Category: "news", Body: "buy now!"},
+			action:  ActionRemove,
+			reason:  "spam",
+			hits:    []string{"spam-comments"},
+		},
+		{
+			name:    "flair only in its category",
+			subject: Subject{Kind: KindPost, Category: "news", Title: "why?", AccountAge: old},
+			hits:    []string{},
+		},
+	}
+	for _, c := range cases {
+		verdict := engine.Evaluate(c.subject)
+		hits := make([]string, 0, len(verdict.Hits))
+		for _, hit := range verdict.Hits {
+			hits = append(hits, hit.Rule)
+		}
+		if !reflect.DeepEqual(hits, c.hits) {
+			t.Errorf("%s: expected hits %v, got %v", c.name, c.hits, hits)
+		}
+		if verdict.Action != c.action || verdict.Reason != c.reason || verdict.Flair != c.flair {
+			t.Errorf("%s: unexpected verdict %+v", c.name, verdict)
+		}
+	}
+}
+
+func TestEngineNeeds(t *testing.T) {
+	var none *Engine
+	if none.Covers(KindPost) || none.NeedsAuthor(KindPost, "music") || len(none.Evaluate(Subject{}).Hits) != 0 {
+		t.Error("nil engine should have no rules")
+	}
+
+	engine, err := Parse([]byte(testRules))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !engine.Covers(KindComment) {
+		t.Error("expected rules for comments")
+	}
+	if !engine.NeedsAuthor(KindComment, "news") {
+		t.Error("karma rule applies to comments too")
+	}
+
+	posts, err := NewEngine([]Rule{{Name: "a", Type: KindPost, Match: Conditions{Body: "x"}, Action: ActionRemove, Message: "m"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if posts.Covers(KindComment) || posts.NeedsAuthor(KindPost, "news") {
+		t.Error("post-only rule without author conditions")
+	}
+}
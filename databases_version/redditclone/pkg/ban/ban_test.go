@@ -0,0 +1,72 @@
+package ban
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestNewBan(t *testing.T) {
+	tests := []struct {
+		name    string
+		request NewBanRequest
+		err     error
+	}{
+		{"permanent", NewBanRequest{Reason: "spam"}, nil},
+		{"temporary in category", NewBanRequest{Category: "music", Reason: "spam", Days: 3}, nil},
+		{"no reason", NewBanRequest{Reason: " "}, ErrNoReason},
+		{"negative days", NewBanRequest{Reason: "spam", Days: -1}, ErrBadDuration},
+		{"too long", NewBanRequest{Reason: "spam", Days: MaxDays + 1}, ErrBadDuration},
+		{"shadow in category", NewBanRequest{Category: "music", Reason: "spam", Shadow: true}, ErrShadowCategory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBan(tt.request, "mod", now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if tt.request.Days == 0 && b.Expires != nil {
+				t.Errorf("expected permanent ban, got expiry %v", b.Expires)
+			}
+			if tt.request.Days > 0 && !b.Expires.Equal(now.AddDate(0, 0, tt.request.Days)) {
+				t.Errorf("unexpected expiry %v", b.Expires)
+			}
+		})
+	}
+}
+
+func TestSuspension(t *testing.T) {
+	expired := now.Add(-time.Hour)
+	bans := []Ban{
+		{Category: "music", Reason: "spam"},
+		{Category: "news", Reason: "old", Expires: &expired},
+	}
+	if Suspension(bans, "Music", now) == nil {
+		t.Error("expected category ban to apply case-insensitively")
+	}
+	if Suspension(bans, "news", now) != nil {
+		t.Error("expired ban should not apply")
+	}
+	if Suspension(bans, "funny", now) != nil {
+		t.Error("category ban should not apply to other categories")
+	}
+	if Suspension([]Ban{{Reason: "spam"}}, "funny", now) == nil {
+		t.Error("site-wide ban should apply everywhere")
+	}
+	if Suspension([]Ban{{Reason: "spam", Shadow: true}}, "funny", now) != nil {
+		t.Error("shadowban should not block writes")
+	}
+
+	shadowbanned := Shadowbanned{"sid": true}
+	if !shadowbanned.Hides("sid", "") || !shadowbanned.Hides("sid", "other") {
+		t.Error("shadowbanned content should be hidden from others")
+	}
+	if shadowbanned.Hides("sid", "sid") || shadowbanned.Hides("uid", "") {
+		t.Error("content should be visible to its author and for regular users")
+	}
+}
@@ -0,0 +1,100 @@
+package ban
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const selectBan = "SELECT user_id, username, category, shadow, reason, banned_by, created, expires FROM user_bans"
+
+type BanMySQLRepo struct {
+	db *sql.DB
+}
+
+func NewMySQLRepo(db *sql.DB) *BanMySQLRepo {
+	return &BanMySQLRepo{db: db}
+}
+
+func (repo *BanMySQLRepo) Ban(username string, ban Ban) (*Ban, error) {
+	err := repo.db.QueryRow("SELECT id, username FROM users WHERE username = ?", username).Scan(&ban.UserID, &ban.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoUser
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = repo.db.Exec("REPLACE INTO user_bans (user_id, username, category, shadow, reason, banned_by, created, expires) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		ban.UserID, ban.Username, ban.Category, ban.Shadow, ban.Reason, ban.By, ban.Created, ban.Expires)
+	if err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+func (repo *BanMySQLRepo) Unban(username, category string) error {
+	res, err := repo.db.Exec("DELETE FROM user_bans WHERE username = ? AND category = ?", username, category)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNoBan
+	}
+	return nil
+}
+
+func (repo *BanMySQLRepo) Active(userID string) ([]Ban, error) {
+	return repo.query(selectBan+" WHERE user_id = ? AND (expires IS NULL OR expires > ?)", userID, time.Now().UTC())
+}
+
+func (repo *BanMySQLRepo) List(username string) ([]Ban, error) {
+	return repo.query(selectBan+" WHERE username = ? ORDER BY created DESC", username)
+}
+
+func (repo *BanMySQLRepo) Shadowbanned() (Shadowbanned, error) {
+	rows, err := repo.db.Query("SELECT user_id FROM user_bans WHERE shadow = 1 AND (expires IS NULL OR expires > ?)", time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	shadowbanned := make(Shadowbanned)
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		shadowbanned[userID] = true
+	}
+	return shadowbanned, rows.Err()
+}
+
+func (repo *BanMySQLRepo) query(query string, args ...interface{}) ([]Ban, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	bans := make([]Ban, 0)
+	for rows.Next() {
+		var b Ban
+		var expires sql.NullTime
+		if err := rows.Scan(&b.UserID, &b.Username, &b.Category, &b.Shadow, &b.Reason, &b.By, &b.Created, &expires); err != nil {
+			return nil, err
+		}
+		if expires.Valid {
+			b.Expires = &expires.Time
+		}
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
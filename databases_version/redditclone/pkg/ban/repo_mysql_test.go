@@ -0,0 +1,83 @@
+package ban
+
+import (
+	"testing"
+	"time"
+
+	"redditclone/pkg/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var banColumns = []string{"user_id", "username", "category", "shadow", "reason", "banned_by", "created", "expires"}
+
+func TestBanMySQLRepo_Ban(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+	repo := NewMySQLRepo(db)
+	b, err := NewBan(NewBanRequest{Category: "music", Reason: "spam", Days: 1}, "mod", now)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery("SELECT id, username FROM users").
+		WithArgs("Bob").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("bid", "bob"))
+	mock.ExpectExec("REPLACE INTO user_bans").
+		WithArgs("bid", "bob", "music", false, "spam", "mod", now, b.Expires).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	created, err := repo.Ban("Bob", b)
+	assert.NoError(t, err)
+	assert.Equal(t, "bid", created.UserID)
+	assert.Equal(t, "bob", created.Username)
+
+	mock.ExpectQuery("SELECT id, username FROM users").
+		WithArgs("ghost").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}))
+	_, err = repo.Ban("ghost", b)
+	assert.ErrorIs(t, err, ErrNoUser)
+
+	mock.ExpectExec("DELETE FROM user_bans").
+		WithArgs("bob", "music").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.Unban("bob", "music"))
+
+	mock.ExpectExec("DELETE FROM user_bans").
+		WithArgs("bob", "").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, repo.Unban("bob", ""), ErrNoBan)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBanMySQLRepo_Active(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+	repo := NewMySQLRepo(db)
+	expires := now.Add(24 * time.Hour)
+
+	mock.ExpectQuery("SELECT (.+) FROM user_bans WHERE user_id = \\? AND \\(expires IS NULL OR expires > \\?\\)").
+		WithArgs("bid", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(banColumns).
+			AddRow("bid", "bob", "", false, "spam", "admin", now, nil).
+			AddRow("bid", "bob", "music", false, "rude", "mod", now, expires))
+	bans, err := repo.Active("bid")
+	assert.NoError(t, err)
+	assert.Len(t, bans, 2)
+	assert.Nil(t, bans[0].Expires)
+	assert.True(t, bans[1].Expires.Equal(expires))
+
+	mock.ExpectQuery("SELECT user_id FROM user_bans WHERE shadow = 1").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("sid"))
+	shadowbanned, err := repo.Shadowbanned()
+	assert.NoError(t, err)
+	assert.Equal(t, Shadowbanned{"sid": true}, shadowbanned)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
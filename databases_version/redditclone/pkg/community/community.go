@@ -0,0 +1,58 @@
+package community
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrNoCommunity   = errors.New("community not found")
+	ErrAlreadyExists = errors.New("community already exists")
+	ErrBadName       = errors.New("community name must be 3-21 letters, digits or underscores")
+)
+
+// имя сообщества - это и есть Post.Category, так что в нем только то, что нормально ляжет в урл
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9_]{3,21}$`)
+
+type Creator struct {
+	Username string `json:"username"`
+	ID       string `json:"id"`
+}
+
+type Community struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Creator     Creator   `json:"creator"`
+	Rules       []string  `json:"rules"`
+	Created     time.Time `json:"created"`
+	Subscribers int       `json:"subscribers"`
+
+	// подписан ли тот, кто запрашивает. Заполняется в хендлере
+	Subscribed bool `json:"subscribed"`
+}
+
+type NewCommunityRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Rules       []string `json:"rules"`
+}
+
+func (r NewCommunityRequest) Validate() error {
+	if !nameRe.MatchString(r.Name) {
+		return ErrBadName
+	}
+	return nil
+}
+
+type CommunityRepo interface {
+	Create(request NewCommunityRequest, username, userID string) (*Community, error)
+	// Get ищет без учета регистра и возвращает имя так, как его завели
+	Get(name string) (*Community, error)
+	List() ([]Community, error)
+	// Subscribe и Unsubscribe идемпотентны, как голоса: повторный вызов ничего не меняет
+	Subscribe(name, userID string) (*Community, error)
+	Unsubscribe(name, userID string) (*Community, error)
+	// UserSubscriptions - имена сообществ, на которые подписан юзер
+	UserSubscriptions(userID string) ([]string, error)
+}
@@ -0,0 +1,189 @@
+package community
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const errDuplicateEntry = 1062
+
+const selectCommunity = "SELECT name, description, creator_id, creator_username, rules, created, subscribers FROM communities"
+
+type CommunityMySQLRepo struct {
+	db *sql.DB
+}
+
+func NewMySQLRepo(db *sql.DB) *CommunityMySQLRepo {
+	return &CommunityMySQLRepo{db: db}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCommunity(row rowScanner) (*Community, error) {
+	var c Community
+	var rules string
+	err := row.Scan(&c.Name, &c.Description, &c.Creator.ID, &c.Creator.Username, &rules, &c.Created, &c.Subscribers)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(rules), &c.Rules); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Create заводит сообщество, и создатель сразу же на него подписан
+func (repo *CommunityMySQLRepo) Create(request NewCommunityRequest, username, userID string) (*Community, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	c := &Community{
+		Name:        request.Name,
+		Description: request.Description,
+		Creator:     Creator{Username: username, ID: userID},
+		Rules:       request.Rules,
+		Created:     time.Now().UTC().Truncate(time.Second),
+		Subscribers: 1,
+		Subscribed:  true,
+	}
+	if c.Rules == nil {
+		c.Rules = []string{}
+	}
+	rules, err := json.Marshal(c.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec("INSERT INTO communities (name, description, creator_id, creator_username, rules, created, subscribers) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		c.Name, c.Description, c.Creator.ID, c.Creator.Username, string(rules), c.Created, c.Subscribers)
+	if err != nil {
+		// имя - первичный ключ, а колляция регистронезависимая, так что Music и music не уживутся
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+			return nil, ErrAlreadyExists
+		}
+		return nil, err
+	}
+	_, err = tx.Exec("INSERT INTO community_subscriptions (community, user_id) VALUES (?, ?)", c.Name, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (repo *CommunityMySQLRepo) Get(name string) (*Community, error) {
+	c, err := scanCommunity(repo.db.QueryRow(selectCommunity+" WHERE name = ?", name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoCommunity
+	}
+	return c, err
+}
+
+func (repo *CommunityMySQLRepo) List() ([]Community, error) {
+	rows, err := repo.db.Query(selectCommunity + " ORDER BY subscribers DESC, name")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	communities := make([]Community, 0)
+	for rows.Next() {
+		c, err := scanCommunity(rows)
+		if err != nil {
+			return nil, err
+		}
+		communities = append(communities, *c)
+	}
+	return communities, rows.Err()
+}
+
+func (repo *CommunityMySQLRepo) Subscribe(name, userID string) (*Community, error) {
+	return repo.setSubscription(name, userID, true)
+}
+
+func (repo *CommunityMySQLRepo) Unsubscribe(name, userID string) (*Community, error) {
+	return repo.setSubscription(name, userID, false)
+}
+
+// setSubscription двигает счетчик, только если подписка правда появилась или пропала -
+// повторный запрос уткнется в первичный ключ (или ничего не удалит) и счетчик не тронет
+func (repo *CommunityMySQLRepo) setSubscription(name, userID string, subscribe bool) (*Community, error) {
+	c, err := repo.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var res sql.Result
+	delta := 1
+	if subscribe {
+		res, err = tx.Exec("INSERT IGNORE INTO community_subscriptions (community, user_id) VALUES (?, ?)", c.Name, userID)
+	} else {
+		res, err = tx.Exec("DELETE FROM community_subscriptions WHERE community = ? AND user_id = ?", c.Name, userID)
+		delta = -1
+	}
+	if err != nil {
+		return nil, err
+	}
+	changed, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if changed > 0 {
+		if _, err = tx.Exec("UPDATE communities SET subscribers = subscribers + ? WHERE name = ?", delta, c.Name); err != nil {
+			return nil, err
+		}
+		c.Subscribers += delta
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	c.Subscribed = subscribe
+	return c, nil
+}
+
+func (repo *CommunityMySQLRepo) UserSubscriptions(userID string) ([]string, error) {
+	rows, err := repo.db.Query("SELECT community FROM community_subscriptions WHERE user_id = ? ORDER BY community", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,162 @@
+package community
+
+import (
+	"testing"
+	"time"
+
+	"redditclone/pkg/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+var communityColumns = []string{"name", "description", "creator_id", "creator_username", "rules", "created", "subscribers"}
+
+func TestCommunityMySQLRepo_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+	repo := NewMySQLRepo(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO communities").
+		WithArgs("golang", "gophers", "uid", "u", `["be nice"]`, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO community_subscriptions").
+		WithArgs("golang", "uid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, err := repo.Create(NewCommunityRequest{Name: "golang", Description: "gophers", Rules: []string{"be nice"}}, "u", "uid")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c.Subscribers)
+	assert.True(t, c.Subscribed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommunityMySQLRepo_Create_Errors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+	repo := NewMySQLRepo(db)
+
+	_, err = repo.Create(NewCommunityRequest{Name: "no spaces"}, "u", "uid")
+	assert.ErrorIs(t, err, ErrBadName)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO communities").
+		WillReturnError(&mysql.MySQLError{Number: errDuplicateEntry, Message: "Duplicate entry"})
+	mock.ExpectRollback()
+
+	_, err = repo.Create(NewCommunityRequest{Name: "Music"}, "u", "uid")
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommunityMySQLRepo_Get(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+	repo := NewMySQLRepo(db)
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT (.+) FROM communities WHERE name = ?").
+		WithArgs("Music").
+		WillReturnRows(sqlmock.NewRows(communityColumns).AddRow("music", "", "", "", "[]", created, 3))
+	mock.ExpectQuery("SELECT (.+) FROM communities WHERE name = ?").
+		WithArgs("nope").
+		WillReturnRows(sqlmock.NewRows(communityColumns))
+
+	c, err := repo.Get("Music")
+	assert.NoError(t, err)
+	assert.Equal(t, "music", c.Name)
+	assert.Equal(t, []string{}, c.Rules)
+	assert.Equal(t, 3, c.Subscribers)
+
+	_, err = repo.Get("nope")
+	assert.ErrorIs(t, err, ErrNoCommunity)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommunityMySQLRepo_Subscribe(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+	repo := NewMySQLRepo(db)
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	row := func() *sqlmock.Rows {
+		return sqlmock.NewRows(communityColumns).AddRow("music", "", "", "", "[]", created, 3)
+	}
+
+	// новая подписка двигает счетчик
+	mock.ExpectQuery("SELECT (.+) FROM communities").WithArgs("music").WillReturnRows(row())
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT IGNORE INTO community_subscriptions").
+		WithArgs("music", "uid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE communities SET subscribers = subscribers \\+ \\?").
+		WithArgs(1, "music").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, err := repo.Subscribe("music", "uid")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, c.Subscribers)
+	assert.True(t, c.Subscribed)
+
+	// повторная - нет
+	mock.ExpectQuery("SELECT (.+) FROM communities").WithArgs("music").WillReturnRows(row())
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT IGNORE INTO community_subscriptions").
+		WithArgs("music", "uid").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	c, err = repo.Subscribe("music", "uid")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, c.Subscribers)
+
+	mock.ExpectQuery("SELECT (.+) FROM communities").WithArgs("music").WillReturnRows(row())
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM community_subscriptions").
+		WithArgs("music", "uid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE communities SET subscribers = subscribers \\+ \\?").
+		WithArgs(-1, "music").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, err = repo.Unsubscribe("music", "uid")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, c.Subscribers)
+	assert.False(t, c.Subscribed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommunityMySQLRepo_UserSubscriptions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+	repo := NewMySQLRepo(db)
+
+	mock.ExpectQuery("SELECT community FROM community_subscriptions WHERE user_id = ?").
+		WithArgs("uid").
+		WillReturnRows(sqlmock.NewRows([]string{"community"}).AddRow("golang").AddRow("music"))
+
+	names, err := repo.UserSubscriptions("uid")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"golang", "music"}, names)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,224 @@
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"redditclone/pkg/post"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/utils/mocks"
+
+	"github.com/golang/mock/gomock"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeTimeline - таймлайны в памяти; err, если задан, возвращают все методы
+type fakeTimeline struct {
+	timelines map[string][]string
+	sources   map[string]Sources
+	published []string
+	dropped   []string
+	err       error
+}
+
+func newFakeTimeline() *fakeTimeline {
+	return &fakeTimeline{timelines: map[string][]string{}, sources: map[string]Sources{}}
+}
+
+func (f *fakeTimeline) Posts(userID string) ([]string, bool, error) {
+	ids, ok := f.timelines[userID]
+	return ids, ok, f.err
+}
+
+func (f *fakeTimeline) Build(userID string, sources Sources, posts []post.Post) error {
+	if f.err != nil {
+		return f.err
+	}
+	ids := make([]string, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+	f.timelines[userID] = ids
+	f.sources[userID] = sources
+	return nil
+}
+
+func (f *fakeTimeline) Publish(p *post.Post) error {
+	f.published = append(f.published, p.ID)
+	return f.err
+}
+
+func (f *fakeTimeline) Drop(userID string) error {
+	delete(f.timelines, userID)
+	f.dropped = append(f.dropped, userID)
+	return f.err
+}
+
+type feedMocks struct {
+	posts       *mocks.MockPostRepo
+	communities *mocks.MockCommunityRepo
+	follows     *mocks.MockFollowRepo
+}
+
+func newTestService(t *testing.T, timeline Timeline) (*Service, feedMocks) {
+	ctrl := gomock.NewController(t)
+	m := feedMocks{
+		posts:       mocks.NewMockPostRepo(ctrl),
+		communities: mocks.NewMockCommunityRepo(ctrl),
+		follows:     mocks.NewMockFollowRepo(ctrl),
+	}
+	return NewService(m.posts, m.communities, m.follows, timeline, zaptest.NewLogger(t).Sugar()), m
+}
+
+// names - n имен с префиксом, чтобы набрать нужное число подписок
+func names(prefix string, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return out
+}
+
+func TestPage_GlobalFallback(t *testing.T) {
+	service, m := newTestService(t, newFakeTimeline())
+	query := post.ListQuery{Sort: ranking.SortHot, Limit: 10}
+	global := &post.PostsPage{Posts: []post.Post{{ID: "p1"}}}
+
+	m.posts.EXPECT().ListPosts(query).Return(global, nil)
+	page, err := service.Page("", query)
+	if err != nil || page != global {
+		t.Errorf("expected global feed for anonymous, got %+v (%v)", page, err)
+	}
+
+	m.communities.EXPECT().UserSubscriptions("uid").Return(nil, nil)
+	m.follows.EXPECT().Following("uid").Return(nil, nil)
+	m.posts.EXPECT().ListPosts(query).Return(global, nil)
+	page, err = service.Page("uid", query)
+	if err != nil || page != global {
+		t.Errorf("expected global feed without subscriptions, got %+v (%v)", page, err)
+	}
+
+	m.communities.EXPECT().UserSubscriptions("uid").Return(nil, errors.New("mysql is down"))
+	if _, err = service.Page("uid", query); err == nil {
+		t.Errorf("expected error when subscriptions can't be loaded")
+	}
+}
+
+func TestPage_FanOutOnRead(t *testing.T) {
+	timeline := newFakeTimeline()
+	service, m := newTestService(t, timeline)
+	communities := names("c", TimelineThreshold-2)
+
+	m.communities.EXPECT().UserSubscriptions("uid").Return(communities, nil)
+	m.follows.EXPECT().Following("uid").Return([]string{"author"}, nil)
+	m.posts.EXPECT().ListPosts(post.ListQuery{
+		Feed:  &post.FeedFilter{Categories: communities, Authors: []string{"author"}},
+		Limit: 10,
+	}).Return(&post.PostsPage{}, nil)
+
+	if _, err := service.Page("uid", post.ListQuery{Limit: 10}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(timeline.timelines) != 0 {
+		t.Errorf("expected no timeline below threshold, got %v", timeline.timelines)
+	}
+}
+
+func TestPage_TimelineBuiltOnMiss(t *testing.T) {
+	timeline := newFakeTimeline()
+	service, m := newTestService(t, timeline)
+	communities := names("c", TimelineThreshold-1)
+	authors := []string{"author"}
+	filter := &post.FeedFilter{Categories: communities, Authors: authors}
+
+	m.communities.EXPECT().UserSubscriptions("uid").Return(communities, nil).Times(2)
+	m.follows.EXPECT().Following("uid").Return(authors, nil).Times(2)
+	gomock.InOrder(
+		// сборка идет по всем страницам источников, от новых к старым
+		m.posts.EXPECT().ListPosts(post.ListQuery{Feed: filter, Sort: ranking.SortNew, Limit: post.MaxPageLimit}).
+			Return(&post.PostsPage{Posts: []post.Post{{ID: "p3"}, {ID: "p2"}}, After: "cursor"}, nil),
+		m.posts.EXPECT().ListPosts(post.ListQuery{Feed: filter, Sort: ranking.SortNew, Limit: post.MaxPageLimit, After: "cursor"}).
+			Return(&post.PostsPage{Posts: []post.Post{{ID: "p1"}}}, nil),
+		m.posts.EXPECT().ListPosts(post.ListQuery{IDs: []string{"p3", "p2", "p1"}, Sort: ranking.SortTop}).
+			Return(&post.PostsPage{}, nil),
+		// второй раз таймлайн уже готов
+		m.posts.EXPECT().ListPosts(post.ListQuery{IDs: []string{"p3", "p2", "p1"}}).
+			Return(&post.PostsPage{}, nil),
+	)
+
+	if _, err := service.Page("uid", post.ListQuery{Sort: ranking.SortTop}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := timeline.sources["uid"]; len(got.Communities) != len(communities) || len(got.Authors) != 1 {
+		t.Errorf("expected sources to be saved with the timeline, got %+v", got)
+	}
+	if _, err := service.Page("uid", post.ListQuery{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPage_EmptyTimeline(t *testing.T) {
+	timeline := newFakeTimeline()
+	timeline.timelines["uid"] = []string{}
+	service, m := newTestService(t, timeline)
+
+	m.communities.EXPECT().UserSubscriptions("uid").Return(names("c", TimelineThreshold), nil)
+	m.follows.EXPECT().Following("uid").Return(nil, nil)
+
+	page, err := service.Page("uid", post.ListQuery{})
+	if err != nil || page == nil || len(page.Posts) != 0 {
+		t.Errorf("expected empty page without touching posts, got %+v (%v)", page, err)
+	}
+}
+
+func TestPage_TimelineError(t *testing.T) {
+	timeline := newFakeTimeline()
+	timeline.err = errors.New("redis is down")
+	service, m := newTestService(t, timeline)
+	communities := names("c", TimelineThreshold)
+
+	m.communities.EXPECT().UserSubscriptions("uid").Return(communities, nil)
+	m.follows.EXPECT().Following("uid").Return(nil, nil)
+	m.posts.EXPECT().ListPosts(post.ListQuery{Feed: &post.FeedFilter{Categories: communities}}).Return(&post.PostsPage{}, nil)
+
+	if _, err := service.Page("uid", post.ListQuery{}); err != nil {
+		t.Errorf("expected fallback to fan-out-on-read, got %v", err)
+	}
+}
+
+func TestPage_NoTimeline(t *testing.T) {
+	service, m := newTestService(t, nil)
+	communities := names("c", TimelineThreshold)
+
+	m.communities.EXPECT().UserSubscriptions("uid").Return(communities, nil)
+	m.follows.EXPECT().Following("uid").Return(nil, nil)
+	m.posts.EXPECT().ListPosts(post.ListQuery{Feed: &post.FeedFilter{Categories: communities}}).Return(&post.PostsPage{}, nil)
+
+	if _, err := service.Page("uid", post.ListQuery{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service.Publish(&post.Post{ID: "p1"})
+	service.SourcesChanged("uid")
+}
+
+func TestPublishAndSourcesChanged(t *testing.T) {
+	timeline := newFakeTimeline()
+	timeline.timelines["uid"] = []string{"p1"}
+	service, _ := newTestService(t, timeline)
+
+	service.Publish(&post.Post{ID: "p2"})
+	if len(timeline.published) != 1 || timeline.published[0] != "p2" {
+		t.Errorf("expected post to be published, got %v", timeline.published)
+	}
+
+	service.SourcesChanged("uid")
+	if _, ok := timeline.timelines["uid"]; ok || len(timeline.dropped) != 1 {
+		t.Errorf("expected timeline to be dropped, got %v", timeline.timelines)
+	}
+
+	// ошибки таймлайна только логируются
+	timeline.err = errors.New("redis is down")
+	service.Publish(&post.Post{ID: "p3"})
+	service.SourcesChanged("uid")
+}
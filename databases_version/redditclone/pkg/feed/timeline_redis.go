@@ -0,0 +1,118 @@
+package feed
+
+import (
+	"context"
+	"time"
+
+	"redditclone/pkg/post"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// zset id постов со временем создания в качестве score
+	timelineKeyPrefix = "feed:timeline:"
+	// источники юзера - ключи readers-сетов, в которые он записан
+	sourcesKeyPrefix = "feed:sources:"
+	// кто из владельцев таймлайнов читает сообщество или автора
+	communityReadersPrefix = "feed:readers:c:"
+	authorReadersPrefix    = "feed:readers:u:"
+)
+
+type RedisTimeline struct {
+	client *redis.Client
+}
+
+func NewRedisTimeline(client *redis.Client) *RedisTimeline {
+	return &RedisTimeline{client: client}
+}
+
+func (t *RedisTimeline) Posts(userID string) ([]string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// таймлайн без постов - тоже таймлайн, поэтому есть он или нет, смотрим по источникам
+	exists, err := t.client.Exists(ctx, sourcesKeyPrefix+userID).Result()
+	if err != nil || exists == 0 {
+		return nil, false, err
+	}
+	ids, err := t.client.ZRevRange(ctx, timelineKeyPrefix+userID, 0, TimelineSize-1).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	return ids, true, nil
+}
+
+func (t *RedisTimeline) Build(userID string, sources Sources, posts []post.Post) error {
+	if err := t.Drop(userID); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	readerKeys := make([]string, 0, sources.Len())
+	for _, name := range sources.Communities {
+		readerKeys = append(readerKeys, communityReadersPrefix+name)
+	}
+	for _, username := range sources.Authors {
+		readerKeys = append(readerKeys, authorReadersPrefix+username)
+	}
+	_, err := t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range readerKeys {
+			pipe.SAdd(ctx, key, userID)
+		}
+		pipe.SAdd(ctx, sourcesKeyPrefix+userID, readerKeys)
+		if len(posts) > 0 {
+			members := make([]redis.Z, 0, len(posts))
+			for _, p := range posts {
+				members = append(members, redis.Z{Score: timelineScore(&p), Member: p.ID})
+			}
+			pipe.ZAdd(ctx, timelineKeyPrefix+userID, members...)
+		}
+		return nil
+	})
+	return err
+}
+
+// Publish кладет пост всем, кто читает его сообщество или автора, и обрезает таймлайны до TimelineSize
+func (t *RedisTimeline) Publish(p *post.Post) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	readers, err := t.client.SUnion(ctx, communityReadersPrefix+p.Category, authorReadersPrefix+p.Author.Username).Result()
+	if err != nil || len(readers) == 0 {
+		return err
+	}
+	_, err = t.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, userID := range readers {
+			key := timelineKeyPrefix + userID
+			pipe.ZAdd(ctx, key, redis.Z{Score: timelineScore(p), Member: p.ID})
+			pipe.ZRemRangeByRank(ctx, key, 0, -TimelineSize-1)
+		}
+		return nil
+	})
+	return err
+}
+
+func (t *RedisTimeline) Drop(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	readerKeys, err := t.client.SMembers(ctx, sourcesKeyPrefix+userID).Result()
+	if err != nil {
+		return err
+	}
+	_, err = t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range readerKeys {
+			pipe.SRem(ctx, key, userID)
+		}
+		pipe.Del(ctx, sourcesKeyPrefix+userID, timelineKeyPrefix+userID)
+		return nil
+	})
+	return err
+}
+
+// миллисекунды, а не наносекунды: score - float64, и наносекунды в него уже не влезают без потерь
+func timelineScore(p *post.Post) float64 {
+	return float64(p.Created.UnixMilli())
+}
@@ -0,0 +1,140 @@
+package feed
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"redditclone/pkg/post"
+	"redditclone/pkg/utils/redistest"
+)
+
+func postAt(id, category, author string, created time.Time) post.Post {
+	p := post.Post{ID: id, Category: category, Created: created}
+	p.Author.Username = author
+	return p
+}
+
+func TestRedisTimeline_BuildAndPosts(t *testing.T) {
+	client, server := redistest.NewClient()
+	timeline := NewRedisTimeline(client)
+	now := time.Now()
+
+	if _, ok, err := timeline.Posts("uid"); err != nil || ok {
+		t.Fatalf("expected no timeline yet, got ok=%v (%v)", ok, err)
+	}
+
+	sources := Sources{Communities: []string{"golang"}, Authors: []string{"rob"}}
+	posts := []post.Post{postAt("old", "golang", "ken", now.Add(-time.Hour)), postAt("new", "misc", "rob", now)}
+	if err := timeline.Build("uid", sources, posts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ids, ok, err := timeline.Posts("uid")
+	if err != nil || !ok || len(ids) != 2 || ids[0] != "new" || ids[1] != "old" {
+		t.Errorf("expected newest first, got %v ok=%v (%v)", ids, ok, err)
+	}
+	if readers := server.Members(communityReadersPrefix + "golang"); len(readers) != 1 || readers[0] != "uid" {
+		t.Errorf("expected uid to read golang, got %v", readers)
+	}
+
+	// таймлайн без постов все равно есть - иначе его собирали бы на каждом запросе
+	if err := timeline.Build("empty", sources, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids, ok, err := timeline.Posts("empty"); err != nil || !ok || len(ids) != 0 {
+		t.Errorf("expected empty timeline, got %v ok=%v (%v)", ids, ok, err)
+	}
+}
+
+func TestRedisTimeline_Publish(t *testing.T) {
+	client, _ := redistest.NewClient()
+	timeline := NewRedisTimeline(client)
+	now := time.Now()
+
+	if err := timeline.Build("reader", Sources{Communities: []string{"golang"}}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := timeline.Build("fan", Sources{Authors: []string{"rob"}}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p := postAt("p1", "golang", "rob", now)
+	if err := timeline.Publish(&p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, userID := range []string{"reader", "fan"} {
+		if ids, _, _ := timeline.Posts(userID); len(ids) != 1 || ids[0] != "p1" {
+			t.Errorf("expected p1 in timeline of %s, got %v", userID, ids)
+		}
+	}
+
+	// без читателей Publish ничего не пишет
+	other := postAt("p2", "misc", "ken", now)
+	if err := timeline.Publish(&other); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids, _, _ := timeline.Posts("reader"); len(ids) != 1 {
+		t.Errorf("expected p2 not to reach reader, got %v", ids)
+	}
+}
+
+func TestRedisTimeline_PublishTrims(t *testing.T) {
+	client, server := redistest.NewClient()
+	timeline := NewRedisTimeline(client)
+	start := time.Now().Add(-time.Hour)
+
+	posts := make([]post.Post, 0, TimelineSize)
+	for i := 0; i < TimelineSize; i++ {
+		posts = append(posts, postAt(fmt.Sprintf("p%d", i), "golang", "rob", start.Add(time.Duration(i)*time.Second)))
+	}
+	if err := timeline.Build("uid", Sources{Communities: []string{"golang"}}, posts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fresh := postAt("fresh", "golang", "rob", time.Now())
+	if err := timeline.Publish(&fresh); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	members := server.ZMembers(timelineKeyPrefix + "uid")
+	if len(members) != TimelineSize {
+		t.Fatalf("expected timeline trimmed to %d, got %d", TimelineSize, len(members))
+	}
+	if members[0] != "p1" || members[len(members)-1] != "fresh" {
+		t.Errorf("expected oldest post to be dropped, got %s..%s", members[0], members[len(members)-1])
+	}
+}
+
+func TestRedisTimeline_Drop(t *testing.T) {
+	client, server := redistest.NewClient()
+	timeline := NewRedisTimeline(client)
+
+	sources := Sources{Communities: []string{"golang"}, Authors: []string{"rob"}}
+	p := postAt("p1", "golang", "rob", time.Now())
+	if err := timeline.Build("uid", sources, []post.Post{p}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := timeline.Build("other", sources, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := timeline.Drop("uid"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok, _ := timeline.Posts("uid"); ok {
+		t.Errorf("expected timeline to be dropped")
+	}
+	if server.Exists(timelineKeyPrefix + "uid") {
+		t.Errorf("expected timeline posts to be deleted")
+	}
+	if readers := server.Members(authorReadersPrefix + "rob"); len(readers) != 1 || readers[0] != "other" {
+		t.Errorf("expected uid to stop reading rob, got %v", readers)
+	}
+
+	// пересборка сначала выкидывает старые источники
+	if err := timeline.Build("other", Sources{Communities: []string{"misc"}}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if server.Exists(communityReadersPrefix + "golang") {
+		t.Errorf("expected old sources of other to be forgotten")
+	}
+}
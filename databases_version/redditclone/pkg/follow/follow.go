@@ -0,0 +1,16 @@
+package follow
+
+import "errors"
+
+var (
+	ErrNoUser     = errors.New("user not found")
+	ErrSelfFollow = errors.New("can't follow yourself")
+)
+
+// FollowRepo - на кого подписан юзер. Подписываются по username: авторов постов лента ищет по нему же
+type FollowRepo interface {
+	// Follow и Unfollow идемпотентны, как подписки на сообщества
+	Follow(followerID, username string) error
+	Unfollow(followerID, username string) error
+	Following(followerID string) ([]string, error)
+}
@@ -0,0 +1,56 @@
+package follow
+
+import (
+	"database/sql"
+	"errors"
+)
+
+type FollowMySQLRepo struct {
+	db *sql.DB
+}
+
+func NewMySQLRepo(db *sql.DB) *FollowMySQLRepo {
+	return &FollowMySQLRepo{db: db}
+}
+
+func (repo *FollowMySQLRepo) Follow(followerID, username string) error {
+	var followeeID string
+	err := repo.db.QueryRow("SELECT id, username FROM users WHERE username = ?", username).Scan(&followeeID, &username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoUser
+	}
+	if err != nil {
+		return err
+	}
+	if followeeID == followerID {
+		return ErrSelfFollow
+	}
+	_, err = repo.db.Exec("INSERT IGNORE INTO user_follows (follower_id, followee_id, followee_username) VALUES (?, ?, ?)",
+		followerID, followeeID, username)
+	return err
+}
+
+func (repo *FollowMySQLRepo) Unfollow(followerID, username string) error {
+	_, err := repo.db.Exec("DELETE FROM user_follows WHERE follower_id = ? AND followee_username = ?", followerID, username)
+	return err
+}
+
+func (repo *FollowMySQLRepo) Following(followerID string) ([]string, error) {
+	rows, err := repo.db.Query("SELECT followee_username FROM user_follows WHERE follower_id = ? ORDER BY followee_username", followerID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	usernames := make([]string, 0)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
@@ -0,0 +1,70 @@
+package follow
+
+import (
+	"testing"
+
+	"redditclone/pkg/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollowMySQLRepo_Follow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+	repo := NewMySQLRepo(db)
+
+	// регистр имени берем из базы, а не из запроса
+	mock.ExpectQuery("SELECT id, username FROM users").
+		WithArgs("Bob").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("bid", "bob"))
+	mock.ExpectExec("INSERT IGNORE INTO user_follows").
+		WithArgs("uid", "bid", "bob").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.Follow("uid", "Bob"))
+
+	mock.ExpectQuery("SELECT id, username FROM users").
+		WithArgs("ghost").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}))
+	assert.ErrorIs(t, repo.Follow("uid", "ghost"), ErrNoUser)
+
+	mock.ExpectQuery("SELECT id, username FROM users").
+		WithArgs("u").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("uid", "u"))
+	assert.ErrorIs(t, repo.Follow("uid", "u"), ErrSelfFollow)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFollowMySQLRepo_UnfollowAndFollowing(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+	repo := NewMySQLRepo(db)
+
+	mock.ExpectExec("DELETE FROM user_follows").
+		WithArgs("uid", "bob").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.Unfollow("uid", "bob"))
+
+	mock.ExpectQuery("SELECT followee_username FROM user_follows").
+		WithArgs("uid").
+		WillReturnRows(sqlmock.NewRows([]string{"followee_username"}).AddRow("alice").AddRow("bob"))
+	usernames, err := repo.Following("uid")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, usernames)
+
+	mock.ExpectQuery("SELECT followee_username FROM user_follows").
+		WithArgs("nobody").
+		WillReturnRows(sqlmock.NewRows([]string{"followee_username"}))
+	usernames, err = repo.Following("nobody")
+	assert.NoError(t, err)
+	assert.Empty(t, usernames)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/automod"
+	"redditclone/pkg/post"
+	"redditclone/pkg/report"
+	"redditclone/pkg/role"
+	"redditclone/pkg/session"
+	"redditclone/pkg/utils"
+	"time"
+)
+
+// automodVerdict прогоняет правила автомодератора. Возраст аккаунта и карму достаем, только если
+// их спрашивает какое-то правило. ok = false - ответ уже записан: правило отклонило или не достали автора
+func (h *PostHandler) automodVerdict(w http.ResponseWriter, subject automod.Subject, userID string) (automod.Verdict, bool) {
+	if h.Automod.NeedsAuthor(subject.Kind, subject.Category) {
+		author, err := h.Users.GetUser(userID)
+		if err != nil {
+			h.Logger.Errorf("failed to get user %s for automod: %v", userID, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+			return automod.Verdict{}, false
+		}
+		karma, err := h.PostRepo.Karma(userID)
+		if err != nil {
+			h.Logger.Errorf("failed to get karma of %s for automod: %v", userID, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+			return automod.Verdict{}, false
+		}
+		subject.AccountAge = time.Since(author.Created)
+		subject.Karma = karma
+	}
+	verdict := h.Automod.Evaluate(subject)
+	if verdict.Action == automod.ActionReject {
+		h.Logger.Infof("automod rejected %s of %s in %s: %v", subject.Kind, userID, subject.Category, verdict.Hits)
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"message": verdict.Reason})
+		return verdict, false
+	}
+	return verdict, true
+}
+
+// applyAutomod убирает или придерживает только что созданный или исправленный пост (commentID пустой) или коммент.
+// Придержанный пост прячется из лент, коммент - только попадает в очередь модератора.
+// Запись уже создана, так что ошибки только логируем - в худшем случае она останется видна
+func (h *PostHandler) applyAutomod(r *http.Request, p *post.Post, commentID string, verdict automod.Verdict) *post.Post {
+	now := time.Now().UTC()
+	switch verdict.Action {
+	case automod.ActionRemove:
+		removal, err := post.NewRemoval(automod.Moderator, verdict.Reason, now)
+		if err != nil {
+			h.Logger.Errorf("bad automod removal reason %q: %v", verdict.Reason, err)
+			return p
+		}
+		action, target := audit.ActionPostRemove, audit.PostTarget(p.ID)
+		var removed *post.Post
+		if commentID == "" {
+			removed, err = h.PostRepo.RemovePost(p.ID, removal)
+		} else {
+			action, target = audit.ActionCommentRemove, audit.CommentTarget(p.ID, commentID)
+			removed, err = h.PostRepo.RemoveComment(p.ID, commentID, removal)
+		}
+		if err != nil {
+			h.Logger.Errorf("automod failed to remove %s: %v", target, err)
+			return p
+		}
+		event := audit.NewEvent(action, automod.Moderator, "", target, now)
+		event.Category = p.Category
+		event.Before = contentSnapshot(*p, commentID)
+		event.After = contentSnapshot(*removed, commentID)
+		recordAudit(h.Audit, h.Logger, r, event)
+		return removed
+
+	case automod.ActionHold:
+		target, err := reportTarget(*p, commentID)
+		if err != nil {
+			h.Logger.Errorf("automod failed to hold %s/%s: %v", p.ID, commentID, err)
+			return p
+		}
+		held := report.Report{Reporter: automod.Moderator, Reason: verdict.Reason, Created: now, Hold: true}
+		item, err := h.Reports.Report(target, held)
+		if err != nil {
+			h.Logger.Errorf("automod failed to hold %s/%s: %v", p.ID, commentID, err)
+			return p
+		}
+		if item.Hidden && !p.Hidden {
+			if err = h.PostRepo.SetHidden(p.ID, true); err != nil {
+				h.Logger.Errorf("failed to hide held post %s: %v", p.ID, err)
+				return p
+			}
+			p.Hidden = true
+		}
+	}
+	return p
+}
+
+// automodComment проверяет коммент к посту postID. Категорию берем из поста, так что без правил
+// на комменты в базу не ходим. ok = false - ответ уже записан
+func (h *PostHandler) automodComment(w http.ResponseWriter, postID, userID, body string) (automod.Verdict, bool) {
+	if !h.Automod.Covers(automod.KindComment) {
+		return automod.Verdict{}, true
+	}
+	p, err := h.PostRepo.GetPost(postID)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		return automod.Verdict{}, false
+	}
+	subject := automod.Subject{Kind: automod.KindComment, Category: p.Category, Body: body}
+	return h.automodVerdict(w, subject, userID)
+}
+
+// automodEdit проверяет пост таким, каким он станет после правки: пустые поля запроса берем из поста.
+// Иначе правило обходилось бы чистым постом, в который спам дописывают потом. ok = false - ответ уже записан
+func (h *PostHandler) automodEdit(w http.ResponseWriter, postID, userID string, request post.EditPostRequest) (automod.Verdict, bool) {
+	if !h.Automod.Covers(automod.KindPost) {
+		return automod.Verdict{}, true
+	}
+	p, err := h.PostRepo.GetPost(postID)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		return automod.Verdict{}, false
+	}
+	subject := automod.Subject{Kind: automod.KindPost, Category: p.Category, Title: p.Title, Body: p.Text, URL: p.URL}
+	if request.Title != "" {
+		subject.Title = request.Title
+	}
+	if request.Text != "" {
+		subject.Body = request.Text
+	}
+	return h.automodVerdict(w, subject, userID)
+}
+
+// lastCommentID - id только что добавленного коммента: AddComment и AddReply дописывают в конец
+func lastCommentID(p *post.Post) string {
+	if len(p.Comments) == 0 {
+		return ""
+	}
+	return p.Comments[len(p.Comments)-1].ID
+}
+
+type AutomodHandler struct {
+	Automod *automod.Engine
+	Roles   role.RoleRepo
+	Logger  *zap.SugaredLogger
+}
+
+// dryRunRequest - пример поста или коммента. Автора нет, его возраст и карму задают руками
+type dryRunRequest struct {
+	Type           automod.Kind `json:"type"`
+	Category       string       `json:"category"`
+	Title          string       `json:"title"`
+	Text           string       `json:"text"`
+	URL            string       `json:"url"`
+	AccountAgeDays int          `json:"accountAgeDays"`
+	Karma          int          `json:"karma"`
+}
+
+// DryRun - POST /api/automod/dryrun: какие правила сработали бы на пример, ничего не создает.
+// Для модераторов категории примера и админов
+func (h *AutomodHandler) DryRun(w http.ResponseWriter, r *http.Request) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	var req dryRunRequest
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		return
+	}
+	if req.Type == "" {
+		req.Type = automod.KindPost
+	}
+	if req.Type != automod.KindPost && req.Type != automod.KindComment {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "type must be post or comment"})
+		return
+	}
+
+	roles, ok := requireModerator(w, h.Roles, h.Logger, currentSession.UserID, "only moderators can test automod rules")
+	if !ok {
+		return
+	}
+	if req.Category != "" && !roles.CanModerate(req.Category) {
+		utils.WriteJSON(w, http.StatusForbidden, map[string]interface{}{"message": "only moderators can test automod rules"})
+		return
+	}
+
+	verdict := h.Automod.Evaluate(automod.Subject{
+		Kind:       req.Type,
+		Category:   req.Category,
+		Title:      req.Title,
+		Body:       req.Text,
+		URL:        req.URL,
+		AccountAge: time.Duration(req.AccountAgeDays) * 24 * time.Hour,
+		Karma:      req.Karma,
+	})
+	utils.WriteJSON(w, http.StatusOK, verdict)
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/ban"
+	"redditclone/pkg/community"
+	"redditclone/pkg/post"
+	"redditclone/pkg/role"
+	"redditclone/pkg/session"
+	"redditclone/pkg/utils"
+	"time"
+)
+
+// checkBan - можно ли юзеру писать в пост: создавать, комментить, голосовать. Категорию поста достаем,
+// только если у юзера есть баны по категориям - у подавляющего большинства банов нет вовсе.
+// ok = false - ответ уже записан
+func (h *PostHandler) checkBan(w http.ResponseWriter, userID, postID, category string) bool {
+	bans, err := h.Bans.Active(userID)
+	if err != nil {
+		h.Logger.Errorf("failed to get bans of %s: %v", userID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		return false
+	}
+	if len(bans) == 0 {
+		return true
+	}
+	now := time.Now().UTC()
+	if category == "" && ban.Suspension(bans, "", now) == nil {
+		p, err := h.PostRepo.GetPost(postID)
+		if err != nil {
+			// поста нет - пусть об этом скажет сама запись
+			return true
+		}
+		category = p.Category
+	}
+	if suspension := ban.Suspension(bans, category, now); suspension != nil {
+		utils.WriteJSON(w, http.StatusForbidden, map[string]interface{}{"message": "you are banned", "ban": suspension})
+		return false
+	}
+	return true
+}
+
+// shadowbanned - авторы, чьи посты и комменты текущий юзер не видит, и id самого юзера.
+// Если список не достали - показываем все: лента важнее
+func (h *PostHandler) shadowbanned(r *http.Request) (ban.Shadowbanned, string) {
+	var viewerID string
+	if currentSession, err := session.SessionFromContext(r.Context()); err == nil {
+		viewerID = currentSession.UserID
+	}
+	shadowbanned, err := h.Bans.Shadowbanned()
+	if err != nil {
+		h.Logger.Errorf("failed to get shadowbanned users: %v", err)
+		return nil, viewerID
+	}
+	return shadowbanned, viewerID
+}
+
+func (h *PostHandler) hideShadowbanned(r *http.Request, posts []post.Post) []post.Post {
+	shadowbanned, viewerID := h.shadowbanned(r)
+	if len(shadowbanned) == 0 {
+		return posts
+	}
+	visible := posts[:0]
+	for _, p := range posts {
+		if !shadowbanned.Hides(p.Author.ID, viewerID) {
+			visible = append(visible, p)
+		}
+	}
+	return visible
+}
+
+func (h *PostHandler) hideShadowbannedPointers(r *http.Request, posts []*post.Post) []*post.Post {
+	shadowbanned, viewerID := h.shadowbanned(r)
+	if len(shadowbanned) == 0 {
+		return posts
+	}
+	visible := posts[:0]
+	for _, p := range posts {
+		if !shadowbanned.Hides(p.Author.ID, viewerID) {
+			visible = append(visible, p)
+		}
+	}
+	return visible
+}
+
+// visiblePost - пост глазами текущего юзера, как в GetPost: автор в теневом бане - поста для него нет,
+// комменты из теневого бана прячутся. Так отдаем пост из любого хендлера. ok = false - ответ уже записан
+func (h *PostHandler) visiblePost(w http.ResponseWriter, r *http.Request, p *post.Post) bool {
+	shadowbanned, viewerID := h.shadowbanned(r)
+	if shadowbanned.Hides(p.Author.ID, viewerID) {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		return false
+	}
+	p.Comments = hideShadowbannedComments(p.Comments, shadowbanned, viewerID)
+	return true
+}
+
+// hideShadowbannedComments убирает комменты из теневого бана. Если под скрытым есть видимые ответы,
+// вместо него остается надгробие, как у удаленного, см. post.Comment.Tombstone - иначе ветка осталась бы без корня.
+// Подходит и для плоского списка поста, и для дерева из GetCommentTree
+func hideShadowbannedComments(comments []post.Comment, shadowbanned ban.Shadowbanned, viewerID string) []post.Comment {
+	if len(shadowbanned) == 0 {
+		return comments
+	}
+	hidden := func(c post.Comment) bool {
+		return shadowbanned.Hides(c.Author.ID, viewerID)
+	}
+
+	// в плоском списке ответ ссылается на родителя по ParentID: от каждого видимого коммента помечаем скрытых предков
+	index := make(map[string]int, len(comments))
+	for i, c := range comments {
+		index[c.ID] = i
+	}
+	hasVisibleReplies := make([]bool, len(comments))
+	for _, c := range comments {
+		if hidden(c) {
+			continue
+		}
+		for j, ok := index[c.ParentID]; ok && !hasVisibleReplies[j]; j, ok = index[comments[j].ParentID] {
+			hasVisibleReplies[j] = true
+		}
+	}
+
+	visible := make([]post.Comment, 0, len(comments))
+	for i, c := range comments {
+		// в дереве ответы уже вложены в Replies. Что прячется в MoreReplies, не знаем - считаем, что там есть видимые
+		c.Replies = hideShadowbannedComments(c.Replies, shadowbanned, viewerID)
+		if hidden(c) {
+			if !hasVisibleReplies[i] && len(c.Replies) == 0 && c.MoreReplies == 0 {
+				continue
+			}
+			c = c.Tombstone()
+		}
+		visible = append(visible, c)
+	}
+	return visible
+}
+
+type BanHandler struct {
+	Bans        ban.BanRepo
+	Roles       role.RoleRepo
+	Communities community.CommunityRepo
+	Sessions    session.SessionManager
+	Audit       audit.AuditRepo
+	Logger      *zap.SugaredLogger
+}
+
+func (h *BanHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ban.ErrNoUser), errors.Is(err, ban.ErrNoBan), errors.Is(err, community.ErrNoCommunity):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": err.Error()})
+	case errors.Is(err, ban.ErrNoReason), errors.Is(err, ban.ErrBadDuration), errors.Is(err, ban.ErrShadowCategory):
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+	default:
+		h.Logger.Errorf("ban error: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+	}
+}
+
+// canBan - на весь сайт банит админ, в категории - ее модератор. ok = false - ответ уже записан
+func (h *BanHandler) canBan(w http.ResponseWriter, r *http.Request, category string) (moderator *session.Session, ok bool) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return nil, false
+	}
+	roles, err := h.Roles.Roles(currentSession.UserID)
+	if err != nil {
+		h.writeError(w, err)
+		return nil, false
+	}
+	if (category == "" && !roles.Admin) || !roles.CanModerate(category) {
+		utils.WriteJSON(w, http.StatusForbidden, map[string]interface{}{"message": "only moderators can ban"})
+		return nil, false
+	}
+	return currentSession, true
+}
+
+// category - каноничное имя сообщества, "" - весь сайт
+func (h *BanHandler) category(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	found, err := h.Communities.Get(name)
+	if err != nil {
+		return "", err
+	}
+	return found.Name, nil
+}
+
+// BanUser - POST /api/user/{username}/ban: {"category", "reason", "days", "shadow"}
+func (h *BanHandler) BanUser(w http.ResponseWriter, r *http.Request) {
+	var req ban.NewBanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		return
+	}
+	category, err := h.category(req.Category)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	req.Category = category
+	moderator, ok := h.canBan(w, r, category)
+	if !ok {
+		return
+	}
+	newBan, err := ban.NewBan(req, moderator.Username, time.Now().UTC())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	created, err := h.Bans.Ban(mux.Vars(r)["username"], newBan)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	// о теневом бане юзер знать не должен, так что из сессий его не выкидываем
+	if created.SiteWide() && !created.Shadow {
+		if err = h.Sessions.DestroyUser(created.UserID); err != nil {
+			h.Logger.Errorf("failed to revoke sessions of %s: %v", created.Username, err)
+		}
+	}
+	event := audit.NewEvent(audit.ActionBan, moderator.Username, moderator.UserID, audit.UserTarget(created.Username), created.Created)
+	event.Category = category
+	event.After = audit.Snapshot(created)
+	recordAudit(h.Audit, h.Logger, r, event)
+	utils.WriteJSON(w, http.StatusCreated, created)
+	h.Logger.Infof("%s banned %s in %q (shadow: %v): %s", moderator.Username, created.Username, category, created.Shadow, created.Reason)
+}
+
+// UnbanUser - DELETE /api/user/{username}/ban?category=
+func (h *BanHandler) UnbanUser(w http.ResponseWriter, r *http.Request) {
+	category, err := h.category(r.URL.Query().Get(paramCategory))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	moderator, ok := h.canBan(w, r, category)
+	if !ok {
+		return
+	}
+	username := mux.Vars(r)["username"]
+	if err = h.Bans.Unban(username, category); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	event := audit.NewEvent(audit.ActionUnban, moderator.Username, moderator.UserID, audit.UserTarget(username), time.Now().UTC())
+	event.Category = category
+	recordAudit(h.Audit, h.Logger, r, event)
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"message": "success"})
+	h.Logger.Infof("%s unbanned %s in %q", moderator.Username, username, category)
+}
+
+// UserBans - GET /api/user/{username}/bans: для модераторов любого сообщества, вместе с истекшими
+func (h *BanHandler) UserBans(w http.ResponseWriter, r *http.Request) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+	if _, ok := requireModerator(w, h.Roles, h.Logger, currentSession.UserID, "only moderators can see bans"); !ok {
+		return
+	}
+	bans, err := h.Bans.List(mux.Vars(r)["username"])
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, bans)
+}
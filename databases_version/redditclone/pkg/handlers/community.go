@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/community"
+	"redditclone/pkg/feed"
+	"redditclone/pkg/role"
+	"redditclone/pkg/session"
+	"redditclone/pkg/utils"
+	"time"
+)
+
+type CommunityHandler struct {
+	CommunityRepo community.CommunityRepo
+	Feed          feed.Feed
+	Roles         role.RoleRepo
+	Audit         audit.AuditRepo
+	Logger        *zap.SugaredLogger
+}
+
+func (h *CommunityHandler) CreateCommunity(w http.ResponseWriter, r *http.Request) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	var request community.NewCommunityRequest
+	if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		return
+	}
+	created, err := h.CommunityRepo.Create(request, currentSession.Username, currentSession.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, community.ErrBadName):
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		case errors.Is(err, community.ErrAlreadyExists):
+			utils.WriteJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"message": err.Error()})
+		default:
+			h.Logger.Errorf("failed to create community %s: %v", request.Name, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error creating community"})
+		}
+		return
+	}
+	// создатель сразу модерирует свое сообщество. Если не вышло, назначит админ, само сообщество уже есть
+	if err = h.Roles.AddModerator(created.Name, currentSession.Username); err != nil {
+		h.Logger.Errorf("failed to make %s a moderator of %s: %v", currentSession.Username, created.Name, err)
+	}
+	h.Feed.SourcesChanged(currentSession.UserID)
+	utils.WriteJSON(w, http.StatusCreated, created)
+	h.Logger.Infof("created community %s by %s", created.Name, currentSession.Username)
+}
+
+func (h *CommunityHandler) ListCommunities(w http.ResponseWriter, r *http.Request) {
+	communities, err := h.CommunityRepo.List()
+	if err != nil {
+		h.Logger.Errorf("failed to list communities: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error listing communities"})
+		return
+	}
+	h.fillSubscribed(r, communities)
+	utils.WriteJSON(w, http.StatusOK, communities)
+}
+
+func (h *CommunityHandler) GetCommunity(w http.ResponseWriter, r *http.Request) {
+	found, err := h.CommunityRepo.Get(mux.Vars(r)["name"])
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	communities := []community.Community{*found}
+	h.fillSubscribed(r, communities)
+	utils.WriteJSON(w, http.StatusOK, communities[0])
+}
+
+// fillSubscribed отмечает сообщества, на которые подписан залогиненный юзер
+func (h *CommunityHandler) fillSubscribed(r *http.Request, communities []community.Community) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil || len(communities) == 0 {
+		return
+	}
+	names, err := h.CommunityRepo.UserSubscriptions(currentSession.UserID)
+	if err != nil {
+		h.Logger.Errorf("failed to get subscriptions of %s: %v", currentSession.UserID, err)
+		return
+	}
+	subscribed := make(map[string]bool, len(names))
+	for _, name := range names {
+		subscribed[name] = true
+	}
+	for i := range communities {
+		communities[i].Subscribed = subscribed[communities[i].Name]
+	}
+}
+
+func (h *CommunityHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	h.setSubscription(w, r, true)
+}
+
+func (h *CommunityHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	h.setSubscription(w, r, false)
+}
+
+func (h *CommunityHandler) setSubscription(w http.ResponseWriter, r *http.Request, subscribe bool) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	var updated *community.Community
+	if subscribe {
+		updated, err = h.CommunityRepo.Subscribe(name, currentSession.UserID)
+	} else {
+		updated, err = h.CommunityRepo.Unsubscribe(name, currentSession.UserID)
+	}
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.Feed.SourcesChanged(currentSession.UserID)
+	utils.WriteJSON(w, http.StatusOK, updated)
+	h.Logger.Infof("%s subscription of %s to %s: %v", currentSession.Username, currentSession.UserID, updated.Name, subscribe)
+}
+
+// Moderators - GET /api/community/{name}/moderators
+func (h *CommunityHandler) Moderators(w http.ResponseWriter, r *http.Request) {
+	found, err := h.CommunityRepo.Get(mux.Vars(r)["name"])
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	moderators, err := h.Roles.Moderators(found.Name)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"community": found.Name, "moderators": moderators})
+}
+
+// AddModerator - POST /api/community/{name}/moderators: {"username"}, только для админов
+func (h *CommunityHandler) AddModerator(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		return
+	}
+	h.setModerator(w, r, req.Username, true)
+}
+
+// RemoveModerator - DELETE /api/community/{name}/moderators/{username}
+func (h *CommunityHandler) RemoveModerator(w http.ResponseWriter, r *http.Request) {
+	h.setModerator(w, r, mux.Vars(r)["username"], false)
+}
+
+func (h *CommunityHandler) setModerator(w http.ResponseWriter, r *http.Request, username string, moderates bool) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+	roles, err := h.Roles.Roles(currentSession.UserID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if !roles.Admin {
+		utils.WriteJSON(w, http.StatusForbidden, map[string]interface{}{"message": "only admins can change moderators"})
+		return
+	}
+
+	found, err := h.CommunityRepo.Get(mux.Vars(r)["name"])
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if moderates {
+		err = h.Roles.AddModerator(found.Name, username)
+	} else {
+		err = h.Roles.RemoveModerator(found.Name, username)
+	}
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	action := audit.ActionModeratorAdd
+	if !moderates {
+		action = audit.ActionModeratorRemove
+	}
+	event := audit.NewEvent(action, currentSession.Username, currentSession.UserID, audit.UserTarget(username), time.Now().UTC())
+	event.Category = found.Name
+	recordAudit(h.Audit, h.Logger, r, event)
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"community": found.Name, "username": username, "moderator": moderates})
+	h.Logger.Infof("admin %s set moderator %s of %s: %v", currentSession.Username, username, found.Name, moderates)
+}
+
+func (h *CommunityHandler) writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, community.ErrNoCommunity) {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "community not found"})
+		return
+	}
+	if errors.Is(err, role.ErrNoUser) {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "user not found"})
+		return
+	}
+	h.Logger.Errorf("community request failed: %v", err)
+	utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"redditclone/pkg/post"
+	"redditclone/pkg/utils"
+)
+
+// ?resubmit=true - запостить ссылку, даже если она уже есть в сообществе
+const paramResubmit = "resubmit"
+
+// duplicates - другие видимые посты с той же ссылкой. Спрятанные до модератора не показываем, как и в лентах
+func (h *PostHandler) duplicates(r *http.Request, linkHash, category, excludeID string) ([]post.Post, error) {
+	found, err := h.PostRepo.PostsByLink(linkHash, category)
+	if err != nil {
+		return nil, err
+	}
+	posts := make([]post.Post, 0, len(found))
+	for _, p := range found {
+		if p.ID != excludeID && !p.Hidden {
+			posts = append(posts, p)
+		}
+	}
+	return h.hideShadowbanned(r, posts), nil
+}
+
+// checkDuplicate не дает запостить ссылку, которая уже есть в сообществе: отдает 409 с найденными постами.
+// ok = false - ответ уже записан
+func (h *PostHandler) checkDuplicate(w http.ResponseWriter, r *http.Request, request post.NewPostRequest) bool {
+	if request.Type != "link" || r.URL.Query().Get(paramResubmit) == "true" {
+		return true
+	}
+	linkHash := post.LinkHash(request.URL)
+	if linkHash == "" {
+		return true
+	}
+	posts, err := h.duplicates(r, linkHash, request.Category, "")
+	if err != nil {
+		h.Logger.Errorf("failed to find duplicates of %s: %v", request.URL, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error creating post"})
+		return false
+	}
+	if len(posts) > 0 {
+		h.fillUserVotes(r, postPointers(posts)...)
+		utils.WriteJSON(w, http.StatusConflict, map[string]interface{}{
+			"message":    "this link was already submitted, add ?resubmit=true to post it anyway",
+			"duplicates": posts,
+		})
+		return false
+	}
+	return true
+}
+
+// Duplicates - GET /api/duplicates/{post_id}: другие посты с той же ссылкой во всех сообществах
+func (h *PostHandler) Duplicates(w http.ResponseWriter, r *http.Request) {
+	postID := mux.Vars(r)["post_id"]
+	p, err := h.PostRepo.GetPost(postID)
+	switch {
+	case errors.Is(err, post.ErrPostNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		return
+	case err != nil:
+		h.Logger.Errorf("failed to get post %s: %v", postID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		return
+	}
+	// спрятанный или из теневого бана пост в ленте не виден - и по его повторам не должно быть видно, что он есть
+	if p.Hidden {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		return
+	}
+	if !h.visiblePost(w, r, &p) {
+		return
+	}
+	posts := make([]post.Post, 0)
+	if p.LinkHash != "" {
+		if posts, err = h.duplicates(r, p.LinkHash, "", p.ID); err != nil {
+			h.Logger.Errorf("failed to find duplicates of post %s: %v", postID, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+			return
+		}
+	}
+	h.fillUserVotes(r, postPointers(posts)...)
+	utils.WriteJSON(w, http.StatusOK, posts)
+}
@@ -2,20 +2,38 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"redditclone/pkg/utils"
 	"redditclone/pkg/utils/mocks"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap/zaptest"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/automod"
+	"redditclone/pkg/ban"
+	"redditclone/pkg/community"
+	"redditclone/pkg/follow"
+	"redditclone/pkg/media"
+	"redditclone/pkg/notification"
 	"redditclone/pkg/post"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/report"
+	"redditclone/pkg/role"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
 )
@@ -28,6 +46,7 @@ func TestPostHandler_ListPosts(t *testing.T) {
 	mockRepo.EXPECT().GetPosts().Return(sample)
 
 	handler := &PostHandler{
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
@@ -60,6 +79,7 @@ func TestPostHandler_ListPostsByCategory(t *testing.T) {
 	mockRepo.EXPECT().GetPostsByCategory("fun").Return(sample)
 
 	handler := &PostHandler{
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
@@ -83,15 +103,8 @@ func TestPostHandler_ListPostsByCategory(t *testing.T) {
 }
 
 func TestPostHandler_CreatePost_Unauthorized(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	mockSess := mocks.NewMockSessionManager(ctrl)
-	mockSess.EXPECT().Check(gomock.Any()).Return((*session.Session)(nil), errors.New("no session"))
-
 	handler := &PostHandler{
-		Sessions: mockSess,
-		Logger:   zaptest.NewLogger(t).Sugar(),
+		Logger: zaptest.NewLogger(t).Sugar(),
 	}
 
 	req := httptest.NewRequest(http.MethodPost, "/posts", bytes.NewBufferString(`{}`))
@@ -107,14 +120,13 @@ func TestPostHandler_CreatePost_Success(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockRepo := mocks.NewMockPostRepo(ctrl)
-	mockSess := mocks.NewMockSessionManager(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
 
 	sess := &session.Session{Username: "u", UserID: "uid"}
-	mockSess.EXPECT().Check(gomock.Any()).Return(sess, nil)
-	mockSess.EXPECT().UpdateCookie(gomock.Any(), gomock.Any()).Return(nil)
 
+	// сообщество ищется без учета регистра, а пост ложится под каноничное имя
 	reqBody := post.NewPostRequest{
-		Category: "fun",
+		Category: "Fun",
 		Type:     "text",
 		Title:    "Title",
 		Text:     "body",
@@ -128,16 +140,24 @@ func TestPostHandler_CreatePost_Success(t *testing.T) {
 		CreatePost(post.NewPostRequest{Category: "fun", Type: "text", Title: "Title", Text: "body"}, "u", "uid").
 		Return(newP)
 
+	mockVotes.EXPECT().SetVote("new1", "uid", 1).Return(0, nil)
+	mockCommunities := mocks.NewMockCommunityRepo(ctrl)
+	mockCommunities.EXPECT().Get("Fun").Return(&community.Community{Name: "fun"}, nil)
+	mockFeed := mocks.NewMockFeed(ctrl)
+	mockFeed.EXPECT().Publish(newP)
 	handler := &PostHandler{
-		PostRepo: mockRepo,
-		Sessions: mockSess,
-		Logger:   zaptest.NewLogger(t).Sugar(),
+		Bans:        noBans(ctrl),
+		PostRepo:    mockRepo,
+		VoteRepo:    mockVotes,
+		Communities: mockCommunities,
+		Feed:        mockFeed,
+		Logger:      zaptest.NewLogger(t).Sugar(),
 	}
 
 	req := httptest.NewRequest(http.MethodPost, "/posts", bytes.NewBuffer(marshalledBody))
 	w := httptest.NewRecorder()
 
-	handler.CreatePost(w, req)
+	handler.CreatePost(w, withSession(req, sess))
 	if w.Result().StatusCode != http.StatusCreated {
 		t.Errorf("expected 201, got %d", w.Result().StatusCode)
 	}
@@ -156,11 +176,15 @@ func TestPostHandler_GetPost(t *testing.T) {
 	defer ctrl.Finish()
 	mockRepo := mocks.NewMockPostRepo(ctrl)
 
+	mockViews := mocks.NewMockCounter(ctrl)
+
 	mockRepo.EXPECT().
 		GetPost("42").
 		Return(post.Post{}, post.ErrPostNotFound)
 	handler := &PostHandler{
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
+		Views:    mockViews,
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
 	req1 := mux.SetURLVars(httptest.NewRequest("GET", "/posts/42", nil), map[string]string{"post_id": "42"})
@@ -170,10 +194,12 @@ func TestPostHandler_GetPost(t *testing.T) {
 		t.Errorf("expected 404, got %d", w1.Result().StatusCode)
 	}
 
-	sample := post.Post{ID: "42", Title: "Test"}
+	sample := post.Post{ID: "42", Title: "Test", Views: 5}
 	mockRepo.EXPECT().
 		GetPost("42").
 		Return(sample, nil)
+	// аноним - по IP из RemoteAddr, которое проставляет httptest
+	mockViews.EXPECT().Record("42", "ip:192.0.2.1").Return(3, nil)
 	req2 := mux.SetURLVars(httptest.NewRequest("GET", "/posts/42", nil), map[string]string{"post_id": "42"})
 	w2 := httptest.NewRecorder()
 	handler.GetPost(w2, req2)
@@ -188,6 +214,9 @@ func TestPostHandler_GetPost(t *testing.T) {
 	if got.ID != "42" || got.Title != "Test" {
 		t.Errorf("unexpected body: %+v", got)
 	}
+	if got.Views != 8 {
+		t.Errorf("expected stored and pending views summed to 8, got %d", got.Views)
+	}
 }
 
 func TestPostHandler_AddComment(t *testing.T) {
@@ -195,18 +224,18 @@ func TestPostHandler_AddComment(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockPostRepo(ctrl)
-	mockSess := mocks.NewMockSessionManager(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
 	sess := &session.Session{Username: "user", UserID: "uid"}
-	mockSess.EXPECT().Check(gomock.Any()).Return(sess, nil)
-	mockSess.EXPECT().UpdateCookie(gomock.Any(), gomock.Any()).Return(nil)
 
 	commentReq := "Good Post"
 	expectedPost := &post.Post{ID: "1"}
 	mockRepo.EXPECT().AddComment("1", "user", "uid", commentReq).Return(expectedPost, nil)
 
+	mockVotes.EXPECT().UserVotes("uid", []string{"1"}).Return(map[string]int{"1": 1}, nil)
 	handler := &PostHandler{
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
-		Sessions: mockSess,
+		VoteRepo: mockVotes,
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
 
@@ -222,7 +251,7 @@ func TestPostHandler_AddComment(t *testing.T) {
 	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/posts/1/comments", bytes.NewBuffer(marshalledBody)), map[string]string{"post_id": "1"})
 	w := httptest.NewRecorder()
 
-	handler.AddComment(w, req)
+	handler.AddComment(w, withSession(req, sess))
 	if w.Result().StatusCode != http.StatusCreated {
 		t.Errorf("expected 201, got %d", w.Result().StatusCode)
 	}
@@ -233,27 +262,75 @@ func TestPostHandler_DeleteComment(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockPostRepo(ctrl)
-	mockSess := mocks.NewMockSessionManager(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
 	sess := &session.Session{Username: "user", UserID: "uid"}
-	mockSess.EXPECT().Check(gomock.Any()).Return(sess, nil)
-	mockSess.EXPECT().UpdateCookie(gomock.Any(), gomock.Any()).Return(nil)
 
-	expectedPost := &post.Post{ID: "1"}
-	mockRepo.EXPECT().DeleteComment("1", "c1", "uid").Return(expectedPost, nil)
+	before := post.Post{ID: "1", Category: "music", Comments: []post.Comment{{ID: "c1", Body: "first!"}}}
+	mockRepo.EXPECT().GetPost("1").Return(before, nil)
+	expectedPost := &post.Post{ID: "1", Category: "music"}
+	mockRepo.EXPECT().DeleteComment("1", "c1", role.Actor{UserID: "uid", Roles: &role.Roles{}}).Return(expectedPost, nil)
 
+	mockVotes.EXPECT().UserVotes("uid", []string{"1"}).Return(map[string]int{}, nil)
+	var event audit.Event
 	handler := &PostHandler{
+		Roles:    noRoles(ctrl),
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
-		Sessions: mockSess,
+		VoteRepo: mockVotes,
+		Audit:    expectAudit(t, ctrl, audit.ActionCommentDelete, &event),
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
 
 	req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/posts/1/comments/c1", nil), map[string]string{"post_id": "1", "comment_id": "c1"})
 	w := httptest.NewRecorder()
 
-	handler.DeleteComment(w, req)
+	handler.DeleteComment(w, withSession(req, sess))
 	if w.Result().StatusCode != http.StatusOK {
 		t.Errorf("expected 200, got %d", w.Result().StatusCode)
 	}
+	if event.Target != "comment:1/c1" || event.Category != "music" || !strings.Contains(string(event.Before), "first!") {
+		t.Errorf("unexpected audit event: %+v", event)
+	}
+}
+
+func TestPostHandler_DeleteComment_Moderator(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockRoles := mocks.NewMockRoleRepo(ctrl)
+	sess := &session.Session{Username: "mod", UserID: "mid"}
+
+	// права решает репозиторий по ролям, хендлер только их загружает
+	roles := &role.Roles{Moderates: []string{"music"}}
+	mockRoles.EXPECT().Roles("mid").Return(roles, nil)
+	mockRepo.EXPECT().GetPost("1").Return(post.Post{ID: "1", Category: "music"}, nil)
+	mockRepo.EXPECT().DeleteComment("1", "c1", role.Actor{UserID: "mid", Roles: roles}).Return(&post.Post{ID: "1", Category: "music"}, nil)
+	mockVotes.EXPECT().UserVotes("mid", []string{"1"}).Return(map[string]int{}, nil)
+	mockRoles.EXPECT().Roles("mid").Return(nil, errors.New("mysql is down"))
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Roles:    mockRoles,
+		Audit:    expectAudit(t, ctrl, audit.ActionCommentDelete, nil),
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	vars := map[string]string{"post_id": "1", "comment_id": "c1"}
+
+	w := httptest.NewRecorder()
+	handler.DeleteComment(w, withSession(mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/api/post/1/c1", nil), vars), sess))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.DeleteComment(w, withSession(mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/api/post/1/c1", nil), vars), sess))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 when roles can't be loaded, got %d", w.Code)
+	}
 }
 
 func TestPostHandler_UpvotePost(t *testing.T) {
@@ -261,23 +338,23 @@ func TestPostHandler_UpvotePost(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockPostRepo(ctrl)
-	mockSess := mocks.NewMockSessionManager(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
 	sess := &session.Session{Username: "user", UserID: "uid"}
-	mockSess.EXPECT().Check(gomock.Any()).Return(sess, nil)
-	mockSess.EXPECT().UpdateCookie(gomock.Any(), gomock.Any()).Return(nil)
 	expectedPost := &post.Post{ID: "1", Score: 1}
-	mockRepo.EXPECT().VotePost("1", "uid", 1).Return(expectedPost, nil)
+	mockRepo.EXPECT().VotePost("1", 0, 1).Return(expectedPost, nil)
 
+	mockVotes.EXPECT().SetVote("1", "uid", 1).Return(0, nil)
 	handler := &PostHandler{
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
-		Sessions: mockSess,
+		VoteRepo: mockVotes,
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
 
 	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/posts/1/upvote", nil), map[string]string{"post_id": "1"})
 	w := httptest.NewRecorder()
 
-	handler.UpvotePost(w, req)
+	handler.UpvotePost(w, withSession(req, sess))
 	if w.Result().StatusCode != http.StatusOK {
 		t.Errorf("expected 200, got %d", w.Result().StatusCode)
 	}
@@ -288,23 +365,23 @@ func TestPostHandler_DownvotePost(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockPostRepo(ctrl)
-	mockSess := mocks.NewMockSessionManager(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
 	sess := &session.Session{Username: "user", UserID: "uid"}
-	mockSess.EXPECT().Check(gomock.Any()).Return(sess, nil)
-	mockSess.EXPECT().UpdateCookie(gomock.Any(), gomock.Any()).Return(nil)
 	expectedPost := &post.Post{ID: "1", Score: -1}
-	mockRepo.EXPECT().VotePost("1", "uid", -1).Return(expectedPost, nil)
+	mockRepo.EXPECT().VotePost("1", 1, -1).Return(expectedPost, nil)
 
+	mockVotes.EXPECT().SetVote("1", "uid", -1).Return(1, nil)
 	handler := &PostHandler{
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
-		Sessions: mockSess,
+		VoteRepo: mockVotes,
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
 
 	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/posts/1/downvote", nil), map[string]string{"post_id": "1"})
 	w := httptest.NewRecorder()
 
-	handler.DownvotePost(w, req)
+	handler.DownvotePost(w, withSession(req, sess))
 	if w.Result().StatusCode != http.StatusOK {
 		t.Errorf("expected 200, got %d", w.Result().StatusCode)
 	}
@@ -315,23 +392,23 @@ func TestPostHandler_UnvotePost(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockPostRepo(ctrl)
-	mockSess := mocks.NewMockSessionManager(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
 	sess := &session.Session{Username: "user", UserID: "uid"}
-	mockSess.EXPECT().Check(gomock.Any()).Return(sess, nil)
-	mockSess.EXPECT().UpdateCookie(gomock.Any(), gomock.Any()).Return(nil)
 	expectedPost := &post.Post{ID: "1", Score: 0}
-	mockRepo.EXPECT().VotePost("1", "uid", 0).Return(expectedPost, nil)
+	mockRepo.EXPECT().VotePost("1", -1, 0).Return(expectedPost, nil)
 
+	mockVotes.EXPECT().SetVote("1", "uid", 0).Return(-1, nil)
 	handler := &PostHandler{
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
-		Sessions: mockSess,
+		VoteRepo: mockVotes,
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
 
 	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/posts/1/unvote", nil), map[string]string{"post_id": "1"})
 	w := httptest.NewRecorder()
 
-	handler.UnvotePost(w, req)
+	handler.UnvotePost(w, withSession(req, sess))
 	if w.Result().StatusCode != http.StatusOK {
 		t.Errorf("expected 200, got %d", w.Result().StatusCode)
 	}
@@ -349,18 +426,19 @@ func TestUserHandler_Register(t *testing.T) {
 		u := &user.User{ID: "id1", Username: "u"}
 		mockRepo.EXPECT().Register("u", "p").Return(u, nil)
 		mockSess.EXPECT().Create(gomock.Any(), "id1", "u").
-			Return(&session.Session{UserID: "id1", Username: "u"}, nil)
+			Return(&session.Session{ID: "sid1", UserID: "id1", Username: "u"}, nil)
 		jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 			"user": map[string]string{
 				"user_id":  u.ID,
 				"username": u.Username,
 			},
 		})
-		mockRepo.EXPECT().GenerateUserToken(*u).Return(jwtToken)
+		mockRepo.EXPECT().GenerateUserToken(*u, "sid1").Return(jwtToken)
 
 		handler := &UserHandler{
 			UserRepo: mockRepo,
 			Sessions: mockSess,
+			Audit:    expectAudit(t, ctrl, audit.ActionRegister, nil),
 			Logger:   logger,
 		}
 
@@ -395,15 +473,17 @@ func TestUserHandler_Login(t *testing.T) {
 
 	userObj := &user.User{ID: "id", Username: "user", Password: "pass"}
 	mockRepo.EXPECT().Authorize("user", "pass").Return(userObj, nil)
-	mockSess.EXPECT().Create(gomock.Any(), "id", "user").Return(&session.Session{UserID: "id", Username: "user"}, nil)
+	mockSess.EXPECT().Create(gomock.Any(), "id", "user").Return(&session.Session{ID: "sid", UserID: "id", Username: "user"}, nil)
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user": map[string]string{"user_id": userObj.ID, "username": userObj.Username},
 	})
-	mockRepo.EXPECT().GenerateUserToken(*userObj).Return(jwtToken)
+	mockRepo.EXPECT().GenerateUserToken(*userObj, "sid").Return(jwtToken)
 
+	var event audit.Event
 	handler := &UserHandler{
 		UserRepo: mockRepo,
 		Sessions: mockSess,
+		Audit:    expectAudit(t, ctrl, audit.ActionLogin, &event),
 		Logger:   logger,
 	}
 
@@ -421,6 +501,9 @@ func TestUserHandler_Login(t *testing.T) {
 	if w.Result().StatusCode != http.StatusOK {
 		t.Errorf("expected 200, got %d", w.Result().StatusCode)
 	}
+	if event.Actor != "user" || event.ActorID != "id" || event.Target != "user:user" || event.IP != "192.0.2.1" {
+		t.Errorf("unexpected audit event: %+v", event)
+	}
 }
 
 func TestUserHandler_Login_BadJSON(t *testing.T) {
@@ -439,10 +522,12 @@ func TestUserHandler_Logout(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockSess := mocks.NewMockSessionManager(ctrl)
+	mockSess.EXPECT().Check(gomock.Any()).Return(&session.Session{ID: "sid", UserID: "id", Username: "user"}, nil)
 	mockSess.EXPECT().Destroy(gomock.Any(), gomock.Any()).Return(nil)
 
 	handler := &UserHandler{
 		Sessions: mockSess,
+		Audit:    expectAudit(t, ctrl, audit.ActionLogout, nil),
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
 	req := httptest.NewRequest(http.MethodGet, "/logout", nil)
@@ -458,28 +543,38 @@ func TestPostHandler_DeletePost_Success(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockPostRepo(ctrl)
-	mockSess := mocks.NewMockSessionManager(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
 	sess := &session.Session{Username: "user", UserID: "uid1"}
 
-	mockSess.EXPECT().Check(gomock.Any()).Return(sess, nil)
-	mockSess.EXPECT().UpdateCookie(gomock.Any(), gomock.Any()).Return(nil)
-
-	mockRepo.EXPECT().DeletePost("1", "uid1").Return(true, nil)
+	mockRepo.EXPECT().GetPost("1").Return(post.Post{ID: "1", Title: "hello", Category: "music", Comments: []post.Comment{{ID: "c1"}}}, nil)
+	mockRepo.EXPECT().DeletePost("1", role.Actor{UserID: "uid1", Roles: &role.Roles{}}).Return(true, nil)
 
+	mockVotes.EXPECT().DeletePostVotes("1").Return(nil)
+	var event audit.Event
 	handler := &PostHandler{
+		Roles:    noRoles(ctrl),
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
-		Sessions: mockSess,
+		VoteRepo: mockVotes,
+		Audit:    expectAudit(t, ctrl, audit.ActionPostDelete, &event),
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
 
 	req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/posts/1", nil), map[string]string{"post_id": "1"})
 	w := httptest.NewRecorder()
 
-	handler.DeletePost(w, req)
+	handler.DeletePost(w, withSession(req, sess))
 	res := w.Result()
 	if res.StatusCode != http.StatusOK {
 		t.Errorf("expected 200, got %d", res.StatusCode)
 	}
+	var snapshot map[string]interface{}
+	if err := json.Unmarshal(event.Before, &snapshot); err != nil || snapshot["title"] != "hello" || snapshot["comments"] != nil {
+		t.Errorf("unexpected post snapshot: %s", event.Before)
+	}
+	if event.Actor != "user" || event.Target != "post:1" || event.Category != "music" {
+		t.Errorf("unexpected audit event: %+v", event)
+	}
 }
 
 func TestPostHandler_DeletePost_NotFound(t *testing.T) {
@@ -487,23 +582,22 @@ func TestPostHandler_DeletePost_NotFound(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockPostRepo(ctrl)
-	mockSess := mocks.NewMockSessionManager(ctrl)
 	sess := &session.Session{Username: "user", UserID: "uid1"}
-	mockSess.EXPECT().Check(gomock.Any()).Return(sess, nil)
-	mockSess.EXPECT().UpdateCookie(gomock.Any(), gomock.Any()).Return(nil)
 
-	mockRepo.EXPECT().DeletePost("1", "uid1").Return(false, post.ErrPostNotFound)
+	mockRepo.EXPECT().GetPost("1").Return(post.Post{}, post.ErrPostNotFound)
+	mockRepo.EXPECT().DeletePost("1", role.Actor{UserID: "uid1", Roles: &role.Roles{}}).Return(false, post.ErrPostNotFound)
 
 	handler := &PostHandler{
+		Roles:    noRoles(ctrl),
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
-		Sessions: mockSess,
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
 
 	req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/posts/1", nil), map[string]string{"post_id": "1"})
 	w := httptest.NewRecorder()
 
-	handler.DeletePost(w, req)
+	handler.DeletePost(w, withSession(req, sess))
 	res := w.Result()
 	if res.StatusCode != http.StatusNotFound {
 		t.Errorf("expected 404, got %d", res.StatusCode)
@@ -515,23 +609,22 @@ func TestPostHandler_DeletePost_Unauthorized(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockPostRepo(ctrl)
-	mockSess := mocks.NewMockSessionManager(ctrl)
 	sess := &session.Session{Username: "user", UserID: "uid1"}
-	mockSess.EXPECT().Check(gomock.Any()).Return(sess, nil)
-	mockSess.EXPECT().UpdateCookie(gomock.Any(), gomock.Any()).Return(nil)
 
-	mockRepo.EXPECT().DeletePost("1", "uid1").Return(false, post.ErrUnauthorized)
+	mockRepo.EXPECT().GetPost("1").Return(post.Post{ID: "1"}, nil)
+	mockRepo.EXPECT().DeletePost("1", role.Actor{UserID: "uid1", Roles: &role.Roles{}}).Return(false, post.ErrUnauthorized)
 
 	handler := &PostHandler{
+		Roles:    noRoles(ctrl),
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
-		Sessions: mockSess,
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
 
 	req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/posts/1", nil), map[string]string{"post_id": "1"})
 	w := httptest.NewRecorder()
 
-	handler.DeletePost(w, req)
+	handler.DeletePost(w, withSession(req, sess))
 	res := w.Result()
 	if res.StatusCode != http.StatusUnauthorized {
 		t.Errorf("expected 401, got %d", res.StatusCode)
@@ -550,6 +643,7 @@ func TestPostHandler_PostsByUser(t *testing.T) {
 	mockRepo.EXPECT().PostsByUser("testuser").Return(expectedPosts)
 
 	handler := &PostHandler{
+		Bans:     noBans(ctrl),
 		PostRepo: mockRepo,
 		Logger:   zaptest.NewLogger(t).Sugar(),
 	}
@@ -628,3 +722,2111 @@ func TestUserHandler_Register_InvalidJSON(t *testing.T) {
 		t.Errorf("expected 400 bad request, got %d", res.StatusCode)
 	}
 }
+
+// noBans - никто не забанен
+func noBans(ctrl *gomock.Controller) *mocks.MockBanRepo {
+	bans := mocks.NewMockBanRepo(ctrl)
+	bans.EXPECT().Active(gomock.Any()).Return(nil, nil).AnyTimes()
+	bans.EXPECT().Shadowbanned().Return(ban.Shadowbanned{}, nil).AnyTimes()
+	return bans
+}
+
+// noRoles - ни у кого нет ролей
+func noRoles(ctrl *gomock.Controller) *mocks.MockRoleRepo {
+	roles := mocks.NewMockRoleRepo(ctrl)
+	roles.EXPECT().Roles(gomock.Any()).Return(&role.Roles{}, nil).AnyTimes()
+	return roles
+}
+
+// expectAudit - журнал, который ждет ровно одно событие action. Записанное событие отдает в event, если он не nil
+func expectAudit(t *testing.T, ctrl *gomock.Controller, action audit.Action, event *audit.Event) *mocks.MockAuditRepo {
+	repo := mocks.NewMockAuditRepo(ctrl)
+	repo.EXPECT().Record(gomock.Any()).DoAndReturn(func(e audit.Event) error {
+		if e.Action != action {
+			t.Errorf("expected audit event %s, got %s", action, e.Action)
+		}
+		if event != nil {
+			*event = e
+		}
+		return nil
+	})
+	return repo
+}
+
+func withSession(r *http.Request, sess *session.Session) *http.Request {
+	return r.WithContext(session.ContextWithSession(r.Context(), sess))
+}
+
+func TestPostHandler_ListPosts_Paged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+
+	page := &post.PostsPage{Posts: []post.Post{{ID: "1"}}, After: "next"}
+	mockRepo.EXPECT().ListPosts(post.ListQuery{
+		Category: "fun", Sort: ranking.SortTop, Period: ranking.PeriodWeek, Limit: 1, After: "cur",
+	}).Return(page, nil)
+	mockRepo.EXPECT().ListPosts(post.ListQuery{
+		Author: "bob", Sort: ranking.SortHot, Period: ranking.PeriodDay, After: "bad",
+	}).Return(nil, post.ErrBadCursor)
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/posts/fun?limit=1&after=cur&sort=top&t=week", nil),
+		map[string]string{"category": "fun"})
+	w := httptest.NewRecorder()
+	handler.ListPostsByCategory(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var got post.PostsPage
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(got.Posts) != 1 || got.After != "next" {
+		t.Errorf("unexpected page: %+v", got)
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/user/bob?after=bad", nil),
+		map[string]string{"username": "bob"})
+	w = httptest.NewRecorder()
+	handler.PostsByUser(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad cursor, got %d", w.Code)
+	}
+
+	for _, target := range []string{
+		"/api/posts?limit=0", "/api/posts?limit=abc", "/api/posts?after=a&before=b",
+		"/api/posts?sort=best", "/api/posts?sort=top&t=decade",
+	} {
+		w = httptest.NewRecorder()
+		handler.ListPosts(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestPostHandler_ListPosts_UserVotes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+
+	mockRepo.EXPECT().GetPosts().Return([]*post.Post{{ID: "1"}, {ID: "2"}})
+	mockVotes.EXPECT().UserVotes("uid", []string{"1", "2"}).Return(map[string]int{"2": -1}, nil)
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+
+	w := httptest.NewRecorder()
+	handler.ListPosts(w, withSession(httptest.NewRequest(http.MethodGet, "/api/posts", nil), &session.Session{UserID: "uid"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var got []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(got) != 2 || got[0]["vote"] != float64(0) || got[1]["vote"] != float64(-1) {
+		t.Errorf("unexpected votes: %+v", got)
+	}
+	if _, ok := got[0]["votes"]; ok {
+		t.Errorf("voter list must not be exposed: %+v", got[0])
+	}
+}
+
+func TestPostHandler_VotePost_Rollback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+
+	gomock.InOrder(
+		mockVotes.EXPECT().SetVote("1", "uid", 1).Return(-1, nil),
+		mockRepo.EXPECT().VotePost("1", -1, 1).Return(nil, post.ErrConflict),
+		mockVotes.EXPECT().SetVote("1", "uid", -1).Return(1, nil),
+	)
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1/upvote", nil), map[string]string{"post_id": "1"})
+	w := httptest.NewRecorder()
+	handler.UpvotePost(w, withSession(req, &session.Session{UserID: "uid"}))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", w.Code)
+	}
+}
+
+func TestPostHandler_UnexpectedRepoErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	dbErr := errors.New("connection reset")
+
+	mockVotes.EXPECT().SetVote("1", "uid", 1).Return(0, nil)
+	mockRepo.EXPECT().VotePost("1", 0, 1).Return(nil, dbErr)
+	mockVotes.EXPECT().SetVote("1", "uid", 0).Return(1, nil)
+	mockVotes.EXPECT().SetCommentVote("1", "c1", "uid", 1).Return(0, nil)
+	mockRepo.EXPECT().VoteComment("1", "c1", 0, 1).Return(nil, dbErr)
+	mockVotes.EXPECT().SetCommentVote("1", "c1", "uid", 0).Return(1, nil)
+	mockRepo.EXPECT().GetRevisions("1", "").Return(nil, dbErr)
+	mockRepo.EXPECT().AddComment("1", "", "uid", "hi").Return(nil, dbErr)
+	mockRepo.EXPECT().AddReply("1", "c1", "", "uid", "hi").Return(nil, dbErr)
+	mockRepo.EXPECT().GetCommentTree("1", "c1", gomock.Any()).Return(nil, dbErr)
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{UserID: "uid"}
+	vars := map[string]string{"post_id": "1", "comment_id": "c1"}
+
+	w := httptest.NewRecorder()
+	handler.UpvotePost(w, withSession(mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1/upvote", nil), vars), sess))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("vote post: expected 500, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.UpvoteComment(w, withSession(mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1/c1/upvote", nil), vars), sess))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("vote comment: expected 500, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.PostRevisions(w, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1/revisions", nil), vars))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("revisions: expected 500, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.AddComment(w, withSession(mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/post/1", strings.NewReader(`{"comment":"hi"}`)), vars), sess))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("comment: expected 500, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.AddReply(w, withSession(mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/post/1/c1/reply", strings.NewReader(`{"comment":"hi"}`)), vars), sess))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("reply: expected 500, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.CommentReplies(w, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1/c1/replies", nil), vars))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("replies: expected 500, got %d", w.Code)
+	}
+}
+
+func TestPostHandler_CommentThreads(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+
+	root := post.Comment{ID: "c1"}
+	reply := post.Comment{ID: "c2", ParentID: "c1"}
+	mockRepo.EXPECT().GetPost("1").Return(post.Post{ID: "1", Comments: []post.Comment{root, reply}}, nil)
+	mockRepo.EXPECT().AddReply("1", "c1", "user", "uid", "reply").Return(&post.Post{ID: "1"}, nil)
+	mockRepo.EXPECT().AddReply("1", "gone", "user", "uid", "reply").Return(nil, post.ErrCommentNotFound)
+	mockRepo.EXPECT().GetCommentTree("1", "c1", post.DefaultCommentDepth).Return([]post.Comment{reply}, nil)
+	mockVotes.EXPECT().UserVotes("uid", []string{"1"}).Return(map[string]int{}, nil)
+	mockViews := mocks.NewMockCounter(ctrl)
+	mockViews.EXPECT().Record("1", gomock.Any()).Return(0, nil).AnyTimes()
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Views:    mockViews,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{Username: "user", UserID: "uid"}
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1?depth=1", nil), map[string]string{"post_id": "1"})
+	w := httptest.NewRecorder()
+	handler.GetPost(w, req)
+	var got post.Post
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(got.Comments) != 1 || got.Comments[0].MoreReplies != 1 {
+		t.Errorf("expected one root with one more reply, got %+v", got.Comments)
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1?depth=100", nil), map[string]string{"post_id": "1"})
+	w = httptest.NewRecorder()
+	handler.GetPost(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad depth, got %d", w.Code)
+	}
+
+	for parentID, want := range map[string]int{"c1": http.StatusCreated, "gone": http.StatusNotFound} {
+		req = mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/post/1/"+parentID+"/reply", bytes.NewBufferString(`{"comment":"reply"}`)),
+			map[string]string{"post_id": "1", "comment_id": parentID})
+		w = httptest.NewRecorder()
+		handler.AddReply(w, withSession(req, sess))
+		if w.Code != want {
+			t.Errorf("reply to %s: expected %d, got %d", parentID, want, w.Code)
+		}
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1/c1/replies", nil), map[string]string{"post_id": "1", "comment_id": "c1"})
+	w = httptest.NewRecorder()
+	handler.CommentReplies(w, req)
+	var replies []post.Comment
+	if err := json.NewDecoder(w.Body).Decode(&replies); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if w.Code != http.StatusOK || len(replies) != 1 || replies[0].ID != "c2" {
+		t.Errorf("unexpected replies: %d %+v", w.Code, replies)
+	}
+}
+
+func TestPostHandler_VoteComment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+
+	voted := &post.Post{ID: "1", Comments: []post.Comment{{ID: "c1", Score: 1}, {ID: "c2", Score: 5}}}
+	mockVotes.EXPECT().SetCommentVote("1", "c1", "uid", 1).Return(0, nil)
+	mockRepo.EXPECT().VoteComment("1", "c1", 0, 1).Return(voted, nil)
+	mockVotes.EXPECT().UserVotes("uid", []string{"1"}).Return(map[string]int{}, nil)
+	mockVotes.EXPECT().UserCommentVotes("uid", "1").Return(map[string]int{"c1": 1}, nil)
+
+	mockVotes.EXPECT().SetCommentVote("1", "gone", "uid", -1).Return(0, nil)
+	mockRepo.EXPECT().VoteComment("1", "gone", 0, -1).Return(nil, post.ErrCommentNotFound)
+	mockVotes.EXPECT().SetCommentVote("1", "gone", "uid", 0).Return(-1, nil)
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{Username: "user", UserID: "uid"}
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1/c1/upvote", nil), map[string]string{"post_id": "1", "comment_id": "c1"})
+	w := httptest.NewRecorder()
+	handler.UpvoteComment(w, withSession(req, sess))
+	var got post.Post
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if w.Code != http.StatusOK || got.Comments[0].Vote != 1 || got.Comments[1].Vote != 0 {
+		t.Errorf("unexpected response: %d %+v", w.Code, got.Comments)
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1/gone/downvote", nil), map[string]string{"post_id": "1", "comment_id": "gone"})
+	w = httptest.NewRecorder()
+	handler.DownvoteComment(w, withSession(req, sess))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestPostHandler_GetPost_CommentSort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+
+	mockRepo.EXPECT().GetPost("1").Return(post.Post{ID: "1", Comments: []post.Comment{
+		{ID: "low", Score: 1}, {ID: "high", Score: 10},
+	}}, nil)
+	mockViews := mocks.NewMockCounter(ctrl)
+	mockViews.EXPECT().Record("1", gomock.Any()).Return(0, nil)
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		Views:    mockViews,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1?sort=top", nil), map[string]string{"post_id": "1"})
+	w := httptest.NewRecorder()
+	handler.GetPost(w, req)
+	var got post.Post
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(got.Comments) != 2 || got.Comments[0].ID != "high" {
+		t.Errorf("expected top comment first, got %+v", got.Comments)
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1?sort=hot", nil), map[string]string{"post_id": "1"})
+	w = httptest.NewRecorder()
+	handler.GetPost(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for post-only sort, got %d", w.Code)
+	}
+}
+
+func TestPostHandler_EditPost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+
+	edited := &post.Post{ID: "1", Title: "new title"}
+	mockRepo.EXPECT().EditPost("1", role.Actor{UserID: "uid"}, post.EditPostRequest{Title: "new title"}).Return(edited, nil)
+	mockVotes.EXPECT().UserVotes("uid", []string{"1"}).Return(map[string]int{"1": 1}, nil)
+	mockRepo.EXPECT().EditPost("1", role.Actor{UserID: "uid"}, post.EditPostRequest{Title: "late"}).Return(nil, post.ErrEditWindowClosed)
+	mockRepo.EXPECT().EditPost("1", role.Actor{UserID: "uid"}, post.EditPostRequest{Title: "voted"}).Return(nil, post.ErrPollVoted)
+	mockRepo.EXPECT().GetRevisions("1", "").Return([]post.Revision{{Title: "old title"}}, nil)
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{Username: "user", UserID: "uid"}
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/api/post/1", strings.NewReader(`{"title":"new title"}`)), map[string]string{"post_id": "1"})
+	w := httptest.NewRecorder()
+	handler.EditPost(w, withSession(req, sess))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "new title") {
+		t.Errorf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/api/post/1", strings.NewReader(`{"title":"late"}`)), map[string]string{"post_id": "1"})
+	w = httptest.NewRecorder()
+	handler.EditPost(w, withSession(req, sess))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 after the edit window, got %d", w.Code)
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/api/post/1", strings.NewReader(`{"title":"voted"}`)), map[string]string{"post_id": "1"})
+	w = httptest.NewRecorder()
+	handler.EditPost(w, withSession(req, sess))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a poll with votes, got %d", w.Code)
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1/revisions", nil), map[string]string{"post_id": "1"})
+	w = httptest.NewRecorder()
+	handler.PostRevisions(w, req)
+	var revisions []post.Revision
+	if err := json.NewDecoder(w.Body).Decode(&revisions); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(revisions) != 1 || revisions[0].Title != "old title" {
+		t.Errorf("unexpected revisions: %+v", revisions)
+	}
+}
+
+func TestPostHandler_GetPost_ViewerKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockViews := mocks.NewMockCounter(ctrl)
+
+	mockRepo.EXPECT().GetPost("1").Return(post.Post{ID: "1", Views: 1}, nil).Times(2)
+	mockVotes.EXPECT().UserVotes("uid", []string{"1"}).Return(map[string]int{}, nil)
+	mockViews.EXPECT().Record("1", "user:uid").Return(1, nil)
+	mockViews.EXPECT().Record("1", "ip:192.0.2.1").Return(0, errors.New("redis is down"))
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Views:    mockViews,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1", nil), map[string]string{"post_id": "1"})
+	w := httptest.NewRecorder()
+	handler.GetPost(w, withSession(req, &session.Session{Username: "user", UserID: "uid"}))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"views":2`) {
+		t.Errorf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	// счетчик лег - пост все равно отдаем, с тем, что есть в базе
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/1", nil), map[string]string{"post_id": "1"})
+	w = httptest.NewRecorder()
+	handler.GetPost(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"views":1`) {
+		t.Errorf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPostHandler_CreatePost_UnknownCommunity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockCommunities := mocks.NewMockCommunityRepo(ctrl)
+	mockCommunities.EXPECT().Get("musik").Return(nil, community.ErrNoCommunity)
+
+	// до репозитория постов дело дойти не должно - мок без ожиданий упадет на любом вызове
+	handler := &PostHandler{
+		Bans:        noBans(ctrl),
+		PostRepo:    mocks.NewMockPostRepo(ctrl),
+		Communities: mockCommunities,
+		Logger:      zaptest.NewLogger(t).Sugar(),
+	}
+	body := `{"category":"musik","type":"text","title":"t","text":"x"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.CreatePost(w, withSession(req, &session.Session{Username: "u", UserID: "uid"}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown community, got %d", w.Code)
+	}
+}
+
+func TestCommunityHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockCommunities := mocks.NewMockCommunityRepo(ctrl)
+
+	mockFeed := mocks.NewMockFeed(ctrl)
+	// создание сообщества и отписка меняют источники ленты, 404 - нет
+	mockFeed.EXPECT().SourcesChanged("uid").Times(2)
+	mockRoles := mocks.NewMockRoleRepo(ctrl)
+	mockRoles.EXPECT().AddModerator("golang", "u").Return(nil)
+
+	handler := &CommunityHandler{
+		CommunityRepo: mockCommunities,
+		Feed:          mockFeed,
+		Roles:         mockRoles,
+		Logger:        zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{Username: "u", UserID: "uid"}
+
+	mockCommunities.EXPECT().Create(community.NewCommunityRequest{Name: "golang", Rules: []string{"be nice"}}, "u", "uid").
+		Return(&community.Community{Name: "golang", Subscribers: 1, Subscribed: true}, nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/communities", strings.NewReader(`{"name":"golang","rules":["be nice"]}`))
+	w := httptest.NewRecorder()
+	handler.CreateCommunity(w, withSession(req, sess))
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", w.Code)
+	}
+
+	mockCommunities.EXPECT().Create(gomock.Any(), "u", "uid").Return(nil, community.ErrAlreadyExists)
+	req = httptest.NewRequest(http.MethodPost, "/api/communities", strings.NewReader(`{"name":"Golang"}`))
+	w = httptest.NewRecorder()
+	handler.CreateCommunity(w, withSession(req, sess))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a taken name, got %d", w.Code)
+	}
+
+	mockCommunities.EXPECT().List().Return([]community.Community{{Name: "golang"}, {Name: "music"}}, nil)
+	mockCommunities.EXPECT().UserSubscriptions("uid").Return([]string{"music"}, nil)
+	req = httptest.NewRequest(http.MethodGet, "/api/communities", nil)
+	w = httptest.NewRecorder()
+	handler.ListCommunities(w, withSession(req, sess))
+	var listed []community.Community
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(listed) != 2 || listed[0].Subscribed || !listed[1].Subscribed {
+		t.Errorf("unexpected subscriptions: %+v", listed)
+	}
+
+	mockCommunities.EXPECT().Subscribe("nope", "uid").Return(nil, community.ErrNoCommunity)
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/community/nope/subscribe", nil), map[string]string{"name": "nope"})
+	w = httptest.NewRecorder()
+	handler.Subscribe(w, withSession(req, sess))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+
+	mockCommunities.EXPECT().Unsubscribe("music", "uid").Return(&community.Community{Name: "music"}, nil)
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/community/music/unsubscribe", nil), map[string]string{"name": "music"})
+	w = httptest.NewRecorder()
+	handler.Unsubscribe(w, withSession(req, sess))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+func TestPostHandler_HomeFeed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockFeed := mocks.NewMockFeed(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+
+	mockFeed.EXPECT().Page("uid", post.ListQuery{Sort: ranking.SortNew, Period: ranking.PeriodDay, Limit: 10}).
+		Return(&post.PostsPage{Posts: []post.Post{{ID: "1"}}, After: "next"}, nil)
+	mockVotes.EXPECT().UserVotes("uid", []string{"1"}).Return(map[string]int{"1": 1}, nil)
+	gomock.InOrder(
+		mockFeed.EXPECT().Page("", gomock.Any()).Return(&post.PostsPage{Posts: []post.Post{}}, nil),
+		mockFeed.EXPECT().Page("", gomock.Any()).Return(nil, post.ErrBadCursor),
+	)
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		VoteRepo: mockVotes,
+		Feed:     mockFeed,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/feed?sort=new&limit=10", nil)
+	w := httptest.NewRecorder()
+	handler.HomeFeed(w, withSession(req, &session.Session{Username: "u", UserID: "uid"}))
+	var page post.PostsPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(page.Posts) != 1 || page.Posts[0].Vote != 1 || page.After != "next" {
+		t.Errorf("unexpected page: %+v", page)
+	}
+
+	// аноним получает страницу общей ленты, а не голый массив, как у /api/posts
+	req = httptest.NewRequest(http.MethodGet, "/api/feed", nil)
+	w = httptest.NewRecorder()
+	handler.HomeFeed(w, req)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "{") {
+		t.Errorf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/feed?after=garbage", nil)
+	w = httptest.NewRecorder()
+	handler.HomeFeed(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad cursor, got %d", w.Code)
+	}
+}
+
+func TestUserHandler_Follow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockFollows := mocks.NewMockFollowRepo(ctrl)
+	mockFeed := mocks.NewMockFeed(ctrl)
+
+	mockFollows.EXPECT().Follow("uid", "bob").Return(nil)
+	mockFollows.EXPECT().Follow("uid", "ghost").Return(follow.ErrNoUser)
+	mockFollows.EXPECT().Follow("uid", "u").Return(follow.ErrSelfFollow)
+	mockFollows.EXPECT().Unfollow("uid", "bob").Return(nil)
+	mockFeed.EXPECT().SourcesChanged("uid").Times(2)
+
+	handler := &UserHandler{
+		Follows: mockFollows,
+		Feed:    mockFeed,
+		Logger:  zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{Username: "u", UserID: "uid"}
+
+	tests := []struct {
+		username string
+		handle   http.HandlerFunc
+		status   int
+	}{
+		{"bob", handler.FollowUser, http.StatusOK},
+		{"ghost", handler.FollowUser, http.StatusNotFound},
+		{"u", handler.FollowUser, http.StatusBadRequest},
+		{"bob", handler.UnfollowUser, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/user/"+tt.username+"/follow", nil), map[string]string{"username": tt.username})
+		w := httptest.NewRecorder()
+		tt.handle(w, withSession(req, sess))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.username, tt.status, w.Code)
+		}
+	}
+}
+
+func TestPostHandler_Search(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+
+	day := time.Date(2025, 5, 5, 0, 0, 0, 0, time.UTC)
+	mockRepo.EXPECT().Search(post.SearchQuery{Text: "go tips", Author: "bob", Type: "text", From: day, To: day.AddDate(0, 0, 1), Limit: 5}).
+		Return([]post.Post{{ID: "1"}}, nil)
+	mockVotes.EXPECT().UserVotes("uid", []string{"1"}).Return(map[string]int{"1": -1}, nil)
+	mockRepo.EXPECT().Search(post.SearchQuery{Text: "!!"}).Return(nil, post.ErrEmptySearch)
+
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/search?q=go+tips&author=bob&type=text&from=2025-05-05&to=2025-05-05&limit=5", nil)
+	w := httptest.NewRecorder()
+	handler.Search(w, withSession(req, &session.Session{Username: "u", UserID: "uid"}))
+	var posts []post.Post
+	if err := json.NewDecoder(w.Body).Decode(&posts); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(posts) != 1 || posts[0].Vote != -1 {
+		t.Errorf("unexpected posts: %+v", posts)
+	}
+
+	for _, target := range []string{"/api/search?q=!!", "/api/search?q=go&type=image", "/api/search?q=go&from=yesterday", "/api/search?q=go&limit=0"} {
+		w = httptest.NewRecorder()
+		handler.Search(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestPostHandler_RemovePost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockRoles := mocks.NewMockRoleRepo(ctrl)
+
+	var event audit.Event
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Roles:    mockRoles,
+		Audit:    expectAudit(t, ctrl, audit.ActionPostRemove, &event),
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	moderator := &session.Session{Username: "mod", UserID: "mid"}
+	remove := func(body string, sess *session.Session) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/post/p1/remove", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"post_id": "p1"})
+		w := httptest.NewRecorder()
+		handler.RemovePost(w, withSession(req, sess))
+		return w
+	}
+
+	mockRepo.EXPECT().GetPost("p1").Return(post.Post{ID: "p1", Category: "news"}, nil).Times(2)
+	mockRoles.EXPECT().Roles("mid").Return(&role.Roles{Moderates: []string{"news"}}, nil)
+	mockRepo.EXPECT().RemovePost("p1", gomock.Any()).DoAndReturn(func(postID string, removal post.Removal) (*post.Post, error) {
+		if removal.Moderator != "mod" || removal.Reason != "spam" {
+			t.Errorf("unexpected removal: %+v", removal)
+		}
+		return &post.Post{ID: "p1", Removed: &removal}, nil
+	})
+	mockVotes.EXPECT().UserVotes("mid", []string{"p1"}).Return(map[string]int{}, nil)
+	mockVotes.EXPECT().UserCommentVotes("mid", "p1").Return(map[string]int{}, nil).AnyTimes()
+	if w := remove(`{"reason":"spam"}`, moderator); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if event.Actor != "mod" || event.ActorID != "mid" || event.Category != "news" ||
+		strings.Contains(string(event.Before), "spam") || !strings.Contains(string(event.After), "spam") {
+		t.Errorf("unexpected audit event: %+v", event)
+	}
+
+	mockRoles.EXPECT().Roles("uid").Return(&role.Roles{Moderates: []string{"music"}}, nil)
+	if w := remove(`{"reason":"spam"}`, &session.Session{Username: "u", UserID: "uid"}); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a moderator of another community, got %d", w.Code)
+	}
+
+	if w := remove(`{"reason":" "}`, moderator); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a reason, got %d", w.Code)
+	}
+}
+
+func TestCommunityHandler_Moderators(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockCommunities := mocks.NewMockCommunityRepo(ctrl)
+	mockRoles := mocks.NewMockRoleRepo(ctrl)
+
+	mockAudit := mocks.NewMockAuditRepo(ctrl)
+	handler := &CommunityHandler{
+		CommunityRepo: mockCommunities,
+		Roles:         mockRoles,
+		Audit:         mockAudit,
+		Logger:        zaptest.NewLogger(t).Sugar(),
+	}
+	admin := &session.Session{Username: "admin", UserID: "aid"}
+	mockAudit.EXPECT().Record(gomock.Any()).DoAndReturn(func(event audit.Event) error {
+		if event.Actor != "admin" || event.Target != "user:bob" || event.Category != "golang" {
+			t.Errorf("unexpected audit event: %+v", event)
+		}
+		return nil
+	}).Times(2)
+	mockRoles.EXPECT().Roles("aid").Return(&role.Roles{Admin: true}, nil).AnyTimes()
+	mockRoles.EXPECT().Roles("uid").Return(&role.Roles{Moderates: []string{"golang"}}, nil)
+	mockCommunities.EXPECT().Get("Golang").Return(&community.Community{Name: "golang"}, nil).AnyTimes()
+
+	mockRoles.EXPECT().AddModerator("golang", "bob").Return(nil)
+	mockRoles.EXPECT().AddModerator("golang", "ghost").Return(role.ErrNoUser)
+	mockRoles.EXPECT().RemoveModerator("golang", "bob").Return(nil)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		vars   map[string]string
+		sess   *session.Session
+		status int
+	}{
+		{"admin adds", http.MethodPost, `{"username":"bob"}`, map[string]string{"name": "Golang"}, admin, http.StatusOK},
+		{"unknown user", http.MethodPost, `{"username":"ghost"}`, map[string]string{"name": "Golang"}, admin, http.StatusNotFound},
+		{"moderator is not admin", http.MethodPost, `{"username":"bob"}`, map[string]string{"name": "Golang"}, &session.Session{UserID: "uid"}, http.StatusForbidden},
+		{"no username", http.MethodPost, `{}`, map[string]string{"name": "Golang"}, admin, http.StatusBadRequest},
+		{"admin removes", http.MethodDelete, "", map[string]string{"name": "Golang", "username": "bob"}, admin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := mux.SetURLVars(httptest.NewRequest(tt.method, "/api/community/Golang/moderators", strings.NewReader(tt.body)), tt.vars)
+		w := httptest.NewRecorder()
+		if tt.method == http.MethodPost {
+			handler.AddModerator(w, withSession(req, tt.sess))
+		} else {
+			handler.RemoveModerator(w, withSession(req, tt.sess))
+		}
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.status, w.Code)
+		}
+	}
+
+	mockRoles.EXPECT().Moderators("golang").Return([]string{"bob"}, nil)
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/community/Golang/moderators", nil), map[string]string{"name": "Golang"})
+	w := httptest.NewRecorder()
+	handler.Moderators(w, req)
+	if !strings.Contains(w.Body.String(), `"moderators":["bob"]`) {
+		t.Errorf("unexpected response: %s", w.Body.String())
+	}
+}
+
+func TestReportHandler_Report(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockPosts := mocks.NewMockPostRepo(ctrl)
+	mockReports := mocks.NewMockReportRepo(ctrl)
+
+	handler := &ReportHandler{
+		Reports:  mockReports,
+		PostRepo: mockPosts,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	reporter := &session.Session{Username: "u", UserID: "uid"}
+	stored := post.Post{ID: "p1", Category: "news", Title: "title", Text: "text", Comments: []post.Comment{
+		{ID: "c1", Body: "rude"},
+		{ID: "c2", Body: "[removed: spam]", Removed: &post.Removal{Reason: "spam"}},
+	}}
+	reportItem := func(vars map[string]string, body string, sess *session.Session) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/post/p1/report", strings.NewReader(body))
+		req = mux.SetURLVars(req, vars)
+		w := httptest.NewRecorder()
+		if vars["comment_id"] == "" {
+			handler.ReportPost(w, withSession(req, sess))
+		} else {
+			handler.ReportComment(w, withSession(req, sess))
+		}
+		return w
+	}
+	mockPosts.EXPECT().GetPost("p1").Return(stored, nil).AnyTimes()
+
+	mockReports.EXPECT().Report(report.Target{PostID: "p1", Category: "news", Title: "title", Excerpt: "text"}, gomock.Any()).
+		Return(&report.Item{ID: "p1", Hidden: true}, nil)
+	mockPosts.EXPECT().SetHidden("p1", true).Return(nil)
+	if w := reportItem(map[string]string{"post_id": "p1"}, `{"reason":"spam"}`, reporter); w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	mockReports.EXPECT().Report(gomock.Any(), gomock.Any()).DoAndReturn(func(target report.Target, r report.Report) (*report.Item, error) {
+		if target.CommentID != "c1" || target.Excerpt != "rude" || r.ReporterID != "uid" || r.Reason != "rude" {
+			t.Errorf("unexpected report: %+v %+v", target, r)
+		}
+		return nil, report.ErrAlreadyReported
+	})
+	if w := reportItem(map[string]string{"post_id": "p1", "comment_id": "c1"}, `{"reason":"rude"}`, reporter); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 on a repeated report, got %d", w.Code)
+	}
+
+	if w := reportItem(map[string]string{"post_id": "p1", "comment_id": "c2"}, `{"reason":"spam"}`, reporter); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for removed comment, got %d", w.Code)
+	}
+	if w := reportItem(map[string]string{"post_id": "p1", "comment_id": "c3"}, `{"reason":"spam"}`, reporter); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown comment, got %d", w.Code)
+	}
+	if w := reportItem(map[string]string{"post_id": "p1"}, `{"reason":""}`, reporter); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a reason, got %d", w.Code)
+	}
+	if w := reportItem(map[string]string{"post_id": "p1"}, `{"reason":"spam"}`, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
+
+func TestReportHandler_ModQueue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockPosts := mocks.NewMockPostRepo(ctrl)
+	mockReports := mocks.NewMockReportRepo(ctrl)
+	mockRoles := mocks.NewMockRoleRepo(ctrl)
+
+	mockAudit := mocks.NewMockAuditRepo(ctrl)
+	var events []audit.Event
+	mockAudit.EXPECT().Record(gomock.Any()).DoAndReturn(func(event audit.Event) error {
+		events = append(events, event)
+		return nil
+	}).AnyTimes()
+
+	handler := &ReportHandler{
+		Reports:  mockReports,
+		PostRepo: mockPosts,
+		Roles:    mockRoles,
+		Audit:    mockAudit,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	admin := &session.Session{Username: "admin", UserID: "aid"}
+	moderator := &session.Session{Username: "mod", UserID: "mid"}
+	mockRoles.EXPECT().Roles("aid").Return(&role.Roles{Admin: true}, nil).AnyTimes()
+	mockRoles.EXPECT().Roles("mid").Return(&role.Roles{Moderates: []string{"news"}}, nil).AnyTimes()
+	mockRoles.EXPECT().Roles("uid").Return(&role.Roles{}, nil).AnyTimes()
+
+	queue := func(sess *session.Session) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ModQueue(w, withSession(httptest.NewRequest(http.MethodGet, "/api/modqueue", nil), sess))
+		return w
+	}
+	mockReports.EXPECT().Queue(report.QueueQuery{All: true}).Return([]report.Item{{ID: "p1"}}, nil)
+	if w := queue(admin); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for admin, got %d", w.Code)
+	}
+	mockReports.EXPECT().Queue(report.QueueQuery{Communities: []string{"news"}}).Return([]report.Item{}, nil)
+	if w := queue(moderator); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for moderator, got %d", w.Code)
+	}
+	if w := queue(&session.Session{Username: "u", UserID: "uid"}); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a regular user, got %d", w.Code)
+	}
+
+	resolve := func(itemID, action, body string, sess *session.Session) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/modqueue/"+itemID+"/"+action, strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"item_id": itemID, "action": action})
+		w := httptest.NewRecorder()
+		handler.ResolveItem(w, withSession(req, sess))
+		return w
+	}
+	hiddenPost := &report.Item{ID: "p1", PostID: "p1", Category: "news", Status: report.StatusOpen, Hidden: true,
+		Reports: []report.Report{{Reason: "spam"}}}
+	comment := &report.Item{ID: "p2:c1", PostID: "p2", CommentID: "c1", Category: "music", Status: report.StatusOpen,
+		Reports: []report.Report{{Reason: "rude"}}}
+	mockReports.EXPECT().Get("p1").Return(hiddenPost, nil).AnyTimes()
+	mockReports.EXPECT().Get("p2:c1").Return(comment, nil).AnyTimes()
+
+	mockPosts.EXPECT().RemovePost("p1", gomock.Any()).DoAndReturn(func(postID string, removal post.Removal) (*post.Post, error) {
+		if removal.Moderator != "mod" || removal.Reason != "spam" {
+			t.Errorf("unexpected removal: %+v", removal)
+		}
+		return &post.Post{ID: "p1"}, nil
+	})
+	mockReports.EXPECT().Resolve("p1", report.StatusRemoved, "mod").Return(&report.Item{ID: "p1", PostID: "p1", Status: report.StatusRemoved}, nil)
+	mockPosts.EXPECT().SetHidden("p1", false).Return(nil)
+	if w := resolve("p1", "remove", "", moderator); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := resolve("p2:c1", "approve", "", moderator); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another community, got %d", w.Code)
+	}
+	mockPosts.EXPECT().RemoveComment("p2", "c1", gomock.Any()).DoAndReturn(func(postID, commentID string, removal post.Removal) (*post.Post, error) {
+		if removal.Reason != "harassment" {
+			t.Errorf("expected reason from the body, got %+v", removal)
+		}
+		return nil, post.ErrRemoved
+	})
+	mockReports.EXPECT().Resolve("p2:c1", report.StatusRemoved, "admin").Return(&report.Item{ID: "p2:c1", Status: report.StatusRemoved}, nil)
+	if w := resolve("p2:c1", "remove", `{"reason":"harassment"}`, admin); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for content already removed directly, got %d: %s", w.Code, w.Body.String())
+	}
+	// убранный мимо очереди коммент в журнале уже есть, второй раз его не пишем
+	var actions []audit.Action
+	for _, event := range events {
+		actions = append(actions, event.Action)
+	}
+	if !reflect.DeepEqual(actions, []audit.Action{audit.ActionPostRemove, audit.ActionReportResolve, audit.ActionReportResolve}) {
+		t.Errorf("unexpected audit events: %v", actions)
+	}
+	if events[1].Target != "report:p1" || !strings.Contains(string(events[1].Before), `"status":"open"`) ||
+		!strings.Contains(string(events[1].After), `"status":"removed"`) {
+		t.Errorf("unexpected resolution event: %+v", events[1])
+	}
+
+	if w := resolve("p1", "delete", "", moderator); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown action, got %d", w.Code)
+	}
+	mockReports.EXPECT().Get("p3").Return(nil, report.ErrNoItem)
+	if w := resolve("p3", "ignore", "", admin); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestPostHandler_Bans(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockCommunities := mocks.NewMockCommunityRepo(ctrl)
+	mockBans := mocks.NewMockBanRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockVotes.EXPECT().UserVotes("mid", []string{"p2"}).Return(map[string]int{}, nil)
+
+	handler := &PostHandler{
+		PostRepo:    mockRepo,
+		VoteRepo:    mockVotes,
+		Communities: mockCommunities,
+		Bans:        mockBans,
+		Logger:      zaptest.NewLogger(t).Sugar(),
+	}
+	suspended := &session.Session{Username: "s", UserID: "sid"}
+	musicBanned := &session.Session{Username: "m", UserID: "mid"}
+	mockBans.EXPECT().Active("sid").Return([]ban.Ban{{Reason: "spam"}}, nil).AnyTimes()
+	mockBans.EXPECT().Active("mid").Return([]ban.Ban{{Category: "music", Reason: "rude"}}, nil).AnyTimes()
+	mockBans.EXPECT().Shadowbanned().Return(ban.Shadowbanned{}, nil).AnyTimes()
+
+	mockCommunities.EXPECT().Get("news").Return(&community.Community{Name: "news"}, nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(`{"category":"news","type":"text","title":"t","text":"x"}`))
+	w := httptest.NewRecorder()
+	handler.CreatePost(w, withSession(req, suspended))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a site-wide ban, got %d", w.Code)
+	}
+
+	comment := func(postID string, sess *session.Session) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/post/"+postID, strings.NewReader(`{"comment":"hi"}`))
+		req = mux.SetURLVars(req, map[string]string{"post_id": postID})
+		w := httptest.NewRecorder()
+		handler.AddComment(w, withSession(req, sess))
+		return w.Code
+	}
+	mockRepo.EXPECT().GetPost("p1").Return(post.Post{ID: "p1", Category: "Music"}, nil)
+	if code := comment("p1", musicBanned); code != http.StatusForbidden {
+		t.Errorf("expected 403 for a category ban, got %d", code)
+	}
+	mockRepo.EXPECT().GetPost("p2").Return(post.Post{ID: "p2", Category: "news"}, nil)
+	mockRepo.EXPECT().AddComment("p2", "m", "mid", "hi").Return(&post.Post{ID: "p2"}, nil)
+	if code := comment("p2", musicBanned); code != http.StatusCreated {
+		t.Errorf("expected 201 outside of the banned category, got %d", code)
+	}
+
+	vote := httptest.NewRequest(http.MethodGet, "/api/post/p1/upvote", nil)
+	vote = mux.SetURLVars(vote, map[string]string{"post_id": "p1"})
+	w = httptest.NewRecorder()
+	handler.UpvotePost(w, withSession(vote, suspended))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 on vote, got %d", w.Code)
+	}
+
+	// правка - тоже запись: забаненный не может переписать старые посты и комменты
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/api/post/p1", strings.NewReader(`{"title":"spam"}`)), map[string]string{"post_id": "p1"})
+	w = httptest.NewRecorder()
+	handler.EditPost(w, withSession(req, suspended))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 on post edit, got %d", w.Code)
+	}
+	req = httptest.NewRequest(http.MethodPut, "/api/post/p1/c1", strings.NewReader(`{"comment":"spam"}`))
+	req = mux.SetURLVars(req, map[string]string{"post_id": "p1", "comment_id": "c1"})
+	w = httptest.NewRecorder()
+	handler.EditComment(w, withSession(req, suspended))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 on comment edit, got %d", w.Code)
+	}
+}
+
+func TestPostHandler_Shadowban(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockBans := mocks.NewMockBanRepo(ctrl)
+	mockViews := mocks.NewMockCounter(ctrl)
+
+	handler := &PostHandler{
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Bans:     mockBans,
+		Views:    mockViews,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	mockBans.EXPECT().Shadowbanned().Return(ban.Shadowbanned{"sid": true}, nil).AnyTimes()
+	mockViews.EXPECT().Record(gomock.Any(), gomock.Any()).Return(0, nil).AnyTimes()
+	mockVotes.EXPECT().UserVotes(gomock.Any(), gomock.Any()).Return(map[string]int{}, nil).AnyTimes()
+	mockVotes.EXPECT().UserCommentVotes(gomock.Any(), gomock.Any()).Return(map[string]int{}, nil).AnyTimes()
+	shadowbanned := &session.Session{Username: "s", UserID: "sid"}
+
+	shadowPost := post.Post{ID: "p1", Author: post.Author{ID: "sid"}}
+	regularPost := post.Post{ID: "p2", Author: post.Author{ID: "uid"}, Comments: []post.Comment{{ID: "c1", Author: struct {
+		Username string `json:"username"`
+		ID       string `json:"id"`
+	}{"s", "sid"}}, {ID: "c2"}}}
+
+	getPost := func(postID string, sess *session.Session) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/"+postID, nil), map[string]string{"post_id": postID})
+		if sess != nil {
+			req = withSession(req, sess)
+		}
+		w := httptest.NewRecorder()
+		handler.GetPost(w, req)
+		return w
+	}
+	mockRepo.EXPECT().GetPost("p1").Return(shadowPost, nil).Times(2)
+	if w := getPost("p1", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for others, got %d", w.Code)
+	}
+	if w := getPost("p1", shadowbanned); w.Code != http.StatusOK {
+		t.Errorf("expected author to see own post, got %d", w.Code)
+	}
+
+	mockRepo.EXPECT().GetPost("p2").Return(regularPost, nil)
+	var got post.Post
+	_ = json.NewDecoder(getPost("p2", nil).Body).Decode(&got)
+	if len(got.Comments) != 1 || got.Comments[0].ID != "c2" {
+		t.Errorf("expected shadowbanned comment hidden, got %+v", got.Comments)
+	}
+
+	mockRepo.EXPECT().GetPostsByCategory("news").Return([]post.Post{shadowPost, regularPost})
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/posts/news", nil), map[string]string{"category": "news"})
+	w := httptest.NewRecorder()
+	handler.ListPostsByCategory(w, req)
+	var posts []post.Post
+	_ = json.NewDecoder(w.Body).Decode(&posts)
+	if len(posts) != 1 || posts[0].ID != "p2" {
+		t.Errorf("expected only regular post in listing, got %+v", posts)
+	}
+}
+
+func TestPostHandler_Shadowban_Responses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockBans := mocks.NewMockBanRepo(ctrl)
+
+	handler := &PostHandler{
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Bans:     mockBans,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	mockBans.EXPECT().Active(gomock.Any()).Return(nil, nil).AnyTimes()
+	mockBans.EXPECT().Shadowbanned().Return(ban.Shadowbanned{"sid": true}, nil).AnyTimes()
+	mockVotes.EXPECT().SetVote(gomock.Any(), "uid", 1).Return(0, nil).AnyTimes()
+	user := &session.Session{Username: "u", UserID: "uid"}
+	shadowbanned := &session.Session{Username: "s", UserID: "sid"}
+
+	hiddenComment := post.Comment{ID: "c1"}
+	hiddenComment.Author.ID = "sid"
+	regularPost := post.Post{ID: "p2", Author: post.Author{ID: "uid"}, Comments: []post.Comment{hiddenComment, {ID: "c2"}}}
+	shadowPost := post.Post{ID: "p1", Author: post.Author{ID: "sid"}}
+
+	upvote := func(postID string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/"+postID+"/upvote", nil), map[string]string{"post_id": postID})
+		w := httptest.NewRecorder()
+		handler.UpvotePost(w, withSession(req, user))
+		return w
+	}
+	// голос не открывает комменты из теневого бана
+	votedPost := regularPost
+	mockRepo.EXPECT().VotePost("p2", 0, 1).Return(&votedPost, nil)
+	var got post.Post
+	_ = json.NewDecoder(upvote("p2").Body).Decode(&got)
+	if len(got.Comments) != 1 || got.Comments[0].ID != "c2" {
+		t.Errorf("expected shadowbanned comment hidden after vote, got %+v", got.Comments)
+	}
+	// и пост в теневом бане, как и в GetPost, не найден
+	votedShadowPost := shadowPost
+	mockRepo.EXPECT().VotePost("p1", 0, 1).Return(&votedShadowPost, nil)
+	if w := upvote("p1"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 on vote for shadowbanned post, got %d", w.Code)
+	}
+
+	revisions := func(postID, commentID string, sess *session.Session) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/post/"+postID+"/revisions", nil)
+		req = mux.SetURLVars(req, map[string]string{"post_id": postID, "comment_id": commentID})
+		w := httptest.NewRecorder()
+		if commentID == "" {
+			handler.PostRevisions(w, withSession(req, sess))
+		} else {
+			handler.CommentRevisions(w, withSession(req, sess))
+		}
+		return w.Code
+	}
+	mockRepo.EXPECT().GetPost("p1").Return(shadowPost, nil).Times(2)
+	mockRepo.EXPECT().GetPost("p2").Return(regularPost, nil).Times(2)
+	if code := revisions("p1", "", user); code != http.StatusNotFound {
+		t.Errorf("expected 404 for revisions of shadowbanned post, got %d", code)
+	}
+	if code := revisions("p2", "c1", user); code != http.StatusNotFound {
+		t.Errorf("expected 404 for revisions of shadowbanned comment, got %d", code)
+	}
+	mockRepo.EXPECT().GetRevisions("p1", "").Return([]post.Revision{{Title: "old"}}, nil)
+	mockRepo.EXPECT().GetRevisions("p2", "c1").Return([]post.Revision{{Text: "old"}}, nil)
+	if code := revisions("p1", "", shadowbanned); code != http.StatusOK {
+		t.Errorf("expected author to see own revisions, got %d", code)
+	}
+	if code := revisions("p2", "c1", shadowbanned); code != http.StatusOK {
+		t.Errorf("expected author to see own comment revisions, got %d", code)
+	}
+}
+
+func TestPostHandler_Shadowban_Replies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockBans := mocks.NewMockBanRepo(ctrl)
+	mockViews := mocks.NewMockCounter(ctrl)
+
+	handler := &PostHandler{
+		PostRepo: mockRepo,
+		Bans:     mockBans,
+		Views:    mockViews,
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	mockBans.EXPECT().Shadowbanned().Return(ban.Shadowbanned{"sid": true}, nil).AnyTimes()
+	mockViews.EXPECT().Record(gomock.Any(), gomock.Any()).Return(0, nil).AnyTimes()
+
+	comment := func(id, parentID, authorID string) post.Comment {
+		c := post.Comment{ID: id, ParentID: parentID, Body: "text of " + id}
+		c.Author.ID = authorID
+		c.Author.Username = authorID
+		return c
+	}
+	// c1 в теневом бане, но на него ответил обычный юзер. c4 в бане и отвечал на него только он сам
+	comments := []post.Comment{
+		comment("c1", "", "sid"), comment("c2", "", "uid"), comment("c3", "c1", "uid"),
+		comment("c4", "", "sid"), comment("c5", "c4", "sid"),
+	}
+	mockRepo.EXPECT().GetPost("p1").Return(post.Post{ID: "p1", Author: post.Author{ID: "uid"}, Comments: comments}, nil)
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/p1?depth=5", nil), map[string]string{"post_id": "p1"})
+	w := httptest.NewRecorder()
+	handler.GetPost(w, req)
+	var got post.Post
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(got.Comments) != 2 || got.Comments[0].ID != "c1" || got.Comments[1].ID != "c2" {
+		t.Fatalf("expected c1 as a placeholder and c2, got %+v", got.Comments)
+	}
+	placeholder := got.Comments[0]
+	if !placeholder.Deleted || placeholder.Body != "[deleted]" || placeholder.Author.ID != "" {
+		t.Errorf("expected shadowbanned comment to be a [deleted] placeholder, got %+v", placeholder)
+	}
+	if len(placeholder.Replies) != 1 || placeholder.Replies[0].ID != "c3" {
+		t.Errorf("expected the reply to stay under the placeholder, got %+v", placeholder.Replies)
+	}
+
+	// догрузка ветки приходит деревом
+	tree := comment("c1", "", "sid")
+	tree.Replies = []post.Comment{comment("c3", "c1", "uid")}
+	hiddenOnly := comment("c4", "", "sid")
+	hiddenOnly.Replies = []post.Comment{comment("c5", "c4", "sid")}
+	mockRepo.EXPECT().GetCommentTree("p1", "", gomock.Any()).Return([]post.Comment{tree, hiddenOnly}, nil)
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/p1/replies", nil), map[string]string{"post_id": "p1", "comment_id": ""})
+	w = httptest.NewRecorder()
+	handler.CommentReplies(w, req)
+	var replies []post.Comment
+	if err := json.NewDecoder(w.Body).Decode(&replies); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(replies) != 1 || !replies[0].Deleted || len(replies[0].Replies) != 1 || replies[0].Replies[0].ID != "c3" {
+		t.Errorf("expected placeholder with the visible reply, got %+v", replies)
+	}
+}
+
+func TestBanHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockBans := mocks.NewMockBanRepo(ctrl)
+	mockRoles := mocks.NewMockRoleRepo(ctrl)
+	mockCommunities := mocks.NewMockCommunityRepo(ctrl)
+	mockSess := mocks.NewMockSessionManager(ctrl)
+	mockAudit := mocks.NewMockAuditRepo(ctrl)
+	var events []audit.Event
+	mockAudit.EXPECT().Record(gomock.Any()).DoAndReturn(func(event audit.Event) error {
+		events = append(events, event)
+		return nil
+	}).AnyTimes()
+
+	handler := &BanHandler{
+		Bans:        mockBans,
+		Roles:       mockRoles,
+		Communities: mockCommunities,
+		Sessions:    mockSess,
+		Audit:       mockAudit,
+		Logger:      zaptest.NewLogger(t).Sugar(),
+	}
+	admin := &session.Session{Username: "admin", UserID: "aid"}
+	moderator := &session.Session{Username: "mod", UserID: "mid"}
+	mockRoles.EXPECT().Roles("aid").Return(&role.Roles{Admin: true}, nil).AnyTimes()
+	mockRoles.EXPECT().Roles("mid").Return(&role.Roles{Moderates: []string{"music"}}, nil).AnyTimes()
+	mockCommunities.EXPECT().Get("Music").Return(&community.Community{Name: "music"}, nil).AnyTimes()
+	mockCommunities.EXPECT().Get("news").Return(&community.Community{Name: "news"}, nil).AnyTimes()
+
+	banUser := func(body string, sess *session.Session) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/bob/ban", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"username": "bob"})
+		w := httptest.NewRecorder()
+		handler.BanUser(w, withSession(req, sess))
+		return w
+	}
+
+	mockBans.EXPECT().Ban("bob", gomock.Any()).DoAndReturn(func(username string, b ban.Ban) (*ban.Ban, error) {
+		if b.Category != "music" || b.By != "mod" || b.Expires == nil {
+			t.Errorf("unexpected ban: %+v", b)
+		}
+		b.UserID, b.Username = "bid", "bob"
+		return &b, nil
+	})
+	if w := banUser(`{"category":"Music","reason":"rude","days":3}`, moderator); w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := banUser(`{"category":"news","reason":"rude"}`, moderator); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 in another community, got %d", w.Code)
+	}
+	if w := banUser(`{"reason":"rude"}`, moderator); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a site-wide ban by moderator, got %d", w.Code)
+	}
+
+	// бан на весь сайт выкидывает из сессий, теневой - нет
+	mockBans.EXPECT().Ban("bob", gomock.Any()).DoAndReturn(func(username string, b ban.Ban) (*ban.Ban, error) {
+		b.UserID, b.Username = "bid", "bob"
+		return &b, nil
+	}).Times(2)
+	mockSess.EXPECT().DestroyUser("bid").Return(nil)
+	if w := banUser(`{"reason":"spam"}`, admin); w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", w.Code)
+	}
+	if w := banUser(`{"reason":"spam","shadow":true}`, admin); w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", w.Code)
+	}
+	if w := banUser(`{"category":"news","reason":"spam","shadow":true}`, admin); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a category shadowban, got %d", w.Code)
+	}
+
+	unban := func(category string, sess *session.Session) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/bob/ban?category="+category, nil)
+		req = mux.SetURLVars(req, map[string]string{"username": "bob"})
+		w := httptest.NewRecorder()
+		handler.UnbanUser(w, withSession(req, sess))
+		return w
+	}
+	mockBans.EXPECT().Unban("bob", "music").Return(nil)
+	if w := unban("Music", moderator); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+	mockBans.EXPECT().Unban("bob", "").Return(ban.ErrNoBan)
+	if w := unban("", admin); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+
+	// три бана и один разбан, отказы в журнал не пишутся
+	if len(events) != 4 || events[3].Action != audit.ActionUnban {
+		t.Fatalf("unexpected audit events: %+v", events)
+	}
+	if events[0].Action != audit.ActionBan || events[0].Actor != "mod" || events[0].Category != "music" ||
+		events[0].Target != "user:bob" || !strings.Contains(string(events[0].After), "rude") {
+		t.Errorf("unexpected ban event: %+v", events[0])
+	}
+}
+
+func TestUserHandler_Login_Failed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockUserRepo(ctrl)
+	mockRepo.EXPECT().Authorize("user", "wrong").Return(nil, user.ErrBadPass)
+
+	var event audit.Event
+	handler := &UserHandler{
+		UserRepo: mockRepo,
+		Audit:    expectAudit(t, ctrl, audit.ActionLoginFailed, &event),
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"username":"user","password":"wrong"}`))
+	w := httptest.NewRecorder()
+	handler.Login(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+	if event.Actor != "user" || event.ActorID != "" || event.IP != "192.0.2.1" {
+		t.Errorf("unexpected audit event: %+v", event)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAudit := mocks.NewMockAuditRepo(ctrl)
+	mockRoles := mocks.NewMockRoleRepo(ctrl)
+
+	handler := &AuditHandler{
+		Audit:  mockAudit,
+		Roles:  mockRoles,
+		Logger: zaptest.NewLogger(t).Sugar(),
+	}
+	mockRoles.EXPECT().Roles("aid").Return(&role.Roles{Admin: true}, nil).AnyTimes()
+	mockRoles.EXPECT().Roles("mid").Return(&role.Roles{Moderates: []string{"music"}}, nil).AnyTimes()
+	mockRoles.EXPECT().Roles("uid").Return(&role.Roles{}, nil).AnyTimes()
+	mockRoles.EXPECT().Roles("broken").Return(nil, errors.New("mysql is down")).AnyTimes()
+	auditLog := func(target string, sess *session.Session) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.AuditLog(w, withSession(httptest.NewRequest(http.MethodGet, target, nil), sess))
+		return w
+	}
+
+	from := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 5, 2, 0, 0, 0, 0, time.UTC)
+	mockAudit.EXPECT().Query(audit.Query{Actor: "mod", Target: "post:p1", From: from, To: to, All: true, Limit: 10}).
+		Return([]audit.Event{{ID: "e1", Action: audit.ActionPostRemove}}, nil)
+	w := auditLog("/api/audit?actor=mod&target=post:p1&from=2025-05-01T00:00:00Z&to=2025-05-02T00:00:00Z&limit=10", &session.Session{Username: "admin", UserID: "aid"})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "e1") {
+		t.Errorf("expected events for admin, got %d: %s", w.Code, w.Body.String())
+	}
+
+	mockAudit.EXPECT().Query(audit.Query{Communities: []string{"music"}}).Return([]audit.Event{}, nil)
+	if w = auditLog("/api/audit", &session.Session{Username: "mod", UserID: "mid"}); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for moderator, got %d", w.Code)
+	}
+
+	if w = auditLog("/api/audit", &session.Session{Username: "u", UserID: "uid"}); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a regular user, got %d", w.Code)
+	}
+	if w = auditLog("/api/audit", &session.Session{Username: "b", UserID: "broken"}); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 when roles can't be loaded, got %d", w.Code)
+	}
+	for _, target := range []string{"/api/audit?from=yesterday", "/api/audit?from=2025-05-02T00:00:00Z&to=2025-05-01T00:00:00Z", "/api/audit?limit=0", "/api/audit?limit=5000"} {
+		if w = auditLog(target, &session.Session{Username: "admin", UserID: "aid"}); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, w.Code)
+		}
+	}
+}
+
+const testAutomodRules = `
+rules:
+  - name: shorteners
+    match:
+      domains: [bit.ly]
+    action: reject
+    message: no shorteners
+  - name: newbie-links
+    type: post
+    match:
+      domains: [youtube.com]
+      account_age_days_below: 3
+    action: hold
+    message: checked by moderators
+  - name: spam
+    match:
+      body: (?i)buy now
+    action: remove
+    message: spam
+  - name: video
+    type: post
+    match:
+      domains: [youtube.com]
+    action: flair
+    flair: video
+`
+
+func testAutomod(t *testing.T) *automod.Engine {
+	t.Helper()
+	engine, err := automod.Parse([]byte(testAutomodRules))
+	if err != nil {
+		t.Fatalf("bad test rules: %v", err)
+	}
+	return engine
+}
+
+func TestPostHandler_Automod_Edit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockUsers := mocks.NewMockUserRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockVotes.EXPECT().UserVotes("uid", gomock.Any()).Return(map[string]int{}, nil).AnyTimes()
+	mockVotes.EXPECT().UserCommentVotes("uid", gomock.Any()).Return(map[string]int{}, nil).AnyTimes()
+	handler := &PostHandler{
+		Bans:     noBans(ctrl),
+		PostRepo: mockRepo,
+		VoteRepo: mockVotes,
+		Automod:  testAutomod(t),
+		Users:    mockUsers,
+		Audit:    expectAudit(t, ctrl, audit.ActionCommentRemove, nil),
+		Logger:   zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{Username: "u", UserID: "uid"}
+	mockUsers.EXPECT().GetUser("uid").Return(&user.User{ID: "uid", Created: time.Now().Add(-time.Hour)}, nil).AnyTimes()
+	mockRepo.EXPECT().Karma("uid").Return(0, nil).AnyTimes()
+	clean := post.Post{ID: "p1", Category: "fun", Title: "hello", Text: "clean text", Author: post.Author{ID: "uid"}}
+	mockRepo.EXPECT().GetPost("p1").Return(clean, nil).AnyTimes()
+
+	// чистый пост не дает потом дописать в него то, что правило отклонило бы сразу. EditPost не зовется
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/api/post/p1", strings.NewReader(`{"text":"now at https://bit.ly/x"}`)), map[string]string{"post_id": "p1"})
+	w := httptest.NewRecorder()
+	handler.EditPost(w, withSession(req, sess))
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "no shorteners") {
+		t.Errorf("expected 422 from automod on edit, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// заголовок проверяется вместе с прежним текстом
+	edited := clean
+	edited.Title = "new title"
+	mockRepo.EXPECT().EditPost("p1", role.Actor{UserID: "uid"}, post.EditPostRequest{Title: "new title"}).Return(&edited, nil)
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/api/post/p1", strings.NewReader(`{"title":"new title"}`)), map[string]string{"post_id": "p1"})
+	w = httptest.NewRecorder()
+	handler.EditPost(w, withSession(req, sess))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected clean edit to pass, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// исправленный коммент, как и новый, убирается правилом
+	commented := clean
+	commented.Comments = []post.Comment{{ID: "c1", Body: "buy now"}}
+	removed := commented
+	removed.Comments = []post.Comment{{ID: "c1", Body: "[removed]", Removed: &post.Removal{Moderator: automod.Moderator, Reason: "spam"}}}
+	mockRepo.EXPECT().EditComment("p1", "c1", role.Actor{UserID: "uid"}, "buy now").Return(&commented, nil)
+	mockRepo.EXPECT().RemoveComment("p1", "c1", gomock.Any()).Return(&removed, nil)
+	req = httptest.NewRequest(http.MethodPut, "/api/post/p1/c1", strings.NewReader(`{"comment":"buy now"}`))
+	req = mux.SetURLVars(req, map[string]string{"post_id": "p1", "comment_id": "c1"})
+	w = httptest.NewRecorder()
+	handler.EditComment(w, withSession(req, sess))
+	var got post.Post
+	_ = json.NewDecoder(w.Body).Decode(&got)
+	if w.Code != http.StatusOK || len(got.Comments) != 1 || got.Comments[0].Removed == nil {
+		t.Errorf("expected edited comment to be removed by automod, got %d %+v", w.Code, got.Comments)
+	}
+}
+
+func TestPostHandler_Automod(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockUsers := mocks.NewMockUserRepo(ctrl)
+	mockReports := mocks.NewMockReportRepo(ctrl)
+	mockCommunities := mocks.NewMockCommunityRepo(ctrl)
+	mockCommunities.EXPECT().Get("fun").Return(&community.Community{Name: "fun"}, nil).AnyTimes()
+	mockVotes.EXPECT().SetVote(gomock.Any(), "uid", 1).Return(0, nil).AnyTimes()
+	mockVotes.EXPECT().UserVotes("uid", gomock.Any()).Return(map[string]int{}, nil).AnyTimes()
+	mockVotes.EXPECT().UserCommentVotes("uid", gomock.Any()).Return(map[string]int{}, nil).AnyTimes()
+	// Feed без ожиданий: убранное и придержанное в ленты не попадает
+	handler := &PostHandler{
+		Bans:        noBans(ctrl),
+		PostRepo:    mockRepo,
+		VoteRepo:    mockVotes,
+		Communities: mockCommunities,
+		Feed:        mocks.NewMockFeed(ctrl),
+		Automod:     testAutomod(t),
+		Users:       mockUsers,
+		Reports:     mockReports,
+		Logger:      zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{Username: "u", UserID: "uid"}
+	createPost := func(request post.NewPostRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(request)
+		w := httptest.NewRecorder()
+		handler.CreatePost(w, withSession(httptest.NewRequest(http.MethodPost, "/api/posts", bytes.NewReader(body)), sess))
+		return w
+	}
+
+	// правило для новичков есть на все посты, так что автор нужен каждый раз
+	mockUsers.EXPECT().GetUser("uid").Return(&user.User{ID: "uid", Created: time.Now().Add(-time.Hour)}, nil).AnyTimes()
+	mockRepo.EXPECT().Karma("uid").Return(1, nil).AnyTimes()
+	mockRepo.EXPECT().PostsByLink(gomock.Any(), "fun").Return(nil, nil).AnyTimes()
+
+	w := createPost(post.NewPostRequest{Category: "fun", Type: "link", Title: "t", URL: "https://bit.ly/x"})
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "no shorteners") {
+		t.Errorf("expected rejection, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// новичок с ютубом: пост получает флейр и придерживается до модератора
+	request := post.NewPostRequest{Category: "fun", Type: "link", Title: "t", URL: "https://youtube.com/watch"}
+	flaired := request
+	flaired.Flair = "video"
+	heldPost := &post.Post{ID: "p1", Category: "fun", Type: "link", URL: request.URL, Flair: "video"}
+	mockRepo.EXPECT().CreatePost(flaired, "u", "uid").Return(heldPost)
+	mockReports.EXPECT().Report(report.Target{PostID: "p1", Category: "fun", Excerpt: request.URL}, gomock.Any()).
+		DoAndReturn(func(target report.Target, held report.Report) (*report.Item, error) {
+			if !held.Hold || held.Reporter != automod.Moderator || held.Reason != "checked by moderators" {
+				t.Errorf("unexpected automod report %+v", held)
+			}
+			return &report.Item{ID: "p1", Hidden: true}, nil
+		})
+	mockRepo.EXPECT().SetHidden("p1", true).Return(nil)
+	if w = createPost(request); w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"flair":"video"`) {
+		t.Errorf("expected held post, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var event audit.Event
+	handler.Audit = expectAudit(t, ctrl, audit.ActionPostRemove, &event)
+	spam := post.NewPostRequest{Category: "fun", Type: "text", Title: "t", Text: "Buy now!"}
+	spamPost := &post.Post{ID: "p2", Category: "fun", Text: spam.Text}
+	mockRepo.EXPECT().CreatePost(spam, "u", "uid").Return(spamPost)
+	mockRepo.EXPECT().RemovePost("p2", gomock.Any()).DoAndReturn(func(postID string, removal post.Removal) (*post.Post, error) {
+		if removal.Moderator != automod.Moderator || removal.Reason != "spam" {
+			t.Errorf("unexpected removal %+v", removal)
+		}
+		return &post.Post{ID: "p2", Category: "fun", Removed: &removal}, nil
+	})
+	if w = createPost(spam); w.Code != http.StatusCreated {
+		t.Errorf("expected 201 for removed post, got %d", w.Code)
+	}
+	if event.Actor != automod.Moderator || event.Target != "post:p2" || event.Category != "fun" {
+		t.Errorf("unexpected audit event %+v", event)
+	}
+
+	// коммент: категория берется из поста, новый коммент - последний
+	handler.Audit = expectAudit(t, ctrl, audit.ActionCommentRemove, &event)
+	commented := &post.Post{ID: "p3", Category: "fun", Comments: []post.Comment{{ID: "c0"}, {ID: "c1", Body: "buy now"}}}
+	mockRepo.EXPECT().GetPost("p3").Return(post.Post{ID: "p3", Category: "fun"}, nil)
+	mockRepo.EXPECT().AddComment("p3", "u", "uid", "buy now").Return(commented, nil)
+	mockRepo.EXPECT().RemoveComment("p3", "c1", gomock.Any()).Return(commented, nil)
+	body, _ := json.Marshal(map[string]string{"comment": "buy now"})
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/post/p3", bytes.NewReader(body)), map[string]string{"post_id": "p3"})
+	w = httptest.NewRecorder()
+	handler.AddComment(w, withSession(req, sess))
+	if w.Code != http.StatusCreated || event.Target != "comment:p3/c1" {
+		t.Errorf("expected removed comment, got %d, event %+v", w.Code, event)
+	}
+}
+
+func TestAutomodHandler_DryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRoles := mocks.NewMockRoleRepo(ctrl)
+	mockRoles.EXPECT().Roles("mid").Return(&role.Roles{Moderates: []string{"music"}}, nil).AnyTimes()
+	mockRoles.EXPECT().Roles("uid").Return(&role.Roles{}, nil).AnyTimes()
+	handler := &AutomodHandler{
+		Automod: testAutomod(t),
+		Roles:   mockRoles,
+		Logger:  zaptest.NewLogger(t).Sugar(),
+	}
+	dryRun := func(body string, sess *session.Session) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.DryRun(w, withSession(httptest.NewRequest(http.MethodPost, "/api/automod/dryrun", strings.NewReader(body)), sess))
+		return w
+	}
+	mod := &session.Session{Username: "mod", UserID: "mid"}
+
+	w := dryRun(`{"category":"music","url":"https://youtube.com/x","accountAgeDays":1}`, mod)
+	var verdict automod.Verdict
+	if err := json.NewDecoder(w.Body).Decode(&verdict); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected verdict, got %d (%v)", w.Code, err)
+	}
+	if verdict.Action != automod.ActionHold || verdict.Flair != "video" || len(verdict.Hits) != 2 {
+		t.Errorf("unexpected verdict %+v", verdict)
+	}
+
+	if w = dryRun(`{"category":"fun","text":"hi"}`, mod); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for foreign community, got %d", w.Code)
+	}
+	if w = dryRun(`{"text":"hi"}`, &session.Session{Username: "u", UserID: "uid"}); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a regular user, got %d", w.Code)
+	}
+	if w = dryRun(`{"type":"poll","category":"music"}`, mod); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown type, got %d", w.Code)
+	}
+}
+
+func TestPostHandler_DuplicateLinks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockCommunities := mocks.NewMockCommunityRepo(ctrl)
+	mockCommunities.EXPECT().Get("news").Return(&community.Community{Name: "news"}, nil).AnyTimes()
+	mockVotes.EXPECT().UserVotes("uid", gomock.Any()).Return(map[string]int{}, nil).AnyTimes()
+	mockFeed := mocks.NewMockFeed(ctrl)
+	handler := &PostHandler{
+		Bans:        noBans(ctrl),
+		PostRepo:    mockRepo,
+		VoteRepo:    mockVotes,
+		Communities: mockCommunities,
+		Feed:        mockFeed,
+		Logger:      zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{Username: "u", UserID: "uid"}
+	request := post.NewPostRequest{Category: "news", Type: "link", Title: "t", URL: "http://www.example.com/a/?utm_source=x"}
+	body, _ := json.Marshal(request)
+	linkHash := post.LinkHash("https://example.com/a")
+	existing := post.Post{ID: "p1", Category: "news", LinkHash: linkHash}
+	held := post.Post{ID: "p0", Category: "news", LinkHash: linkHash, Hidden: true}
+
+	mockRepo.EXPECT().PostsByLink(linkHash, "news").Return([]post.Post{existing, held}, nil)
+	w := httptest.NewRecorder()
+	handler.CreatePost(w, withSession(httptest.NewRequest(http.MethodPost, "/api/posts", bytes.NewReader(body)), sess))
+	var conflict struct {
+		Duplicates []post.Post `json:"duplicates"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&conflict); err != nil || w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d (%v)", w.Code, err)
+	}
+	if len(conflict.Duplicates) != 1 || conflict.Duplicates[0].ID != "p1" {
+		t.Errorf("expected only visible duplicate, got %+v", conflict.Duplicates)
+	}
+
+	// с ?resubmit=true повторы не ищем
+	newPost := &post.Post{ID: "p2", Category: "news"}
+	mockRepo.EXPECT().CreatePost(request, "u", "uid").Return(newPost)
+	mockVotes.EXPECT().SetVote("p2", "uid", 1).Return(0, nil)
+	mockFeed.EXPECT().Publish(newPost)
+	w = httptest.NewRecorder()
+	handler.CreatePost(w, withSession(httptest.NewRequest(http.MethodPost, "/api/posts?resubmit=true", bytes.NewReader(body)), sess))
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected 201 on resubmit, got %d", w.Code)
+	}
+
+	mockRepo.EXPECT().GetPost("p2").Return(post.Post{ID: "p2", LinkHash: linkHash}, nil)
+	mockRepo.EXPECT().PostsByLink(linkHash, "").Return([]post.Post{{ID: "p2", LinkHash: linkHash}, existing}, nil)
+	w = httptest.NewRecorder()
+	handler.Duplicates(w, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/duplicates/p2", nil), map[string]string{"post_id": "p2"}))
+	var duplicates []post.Post
+	if err := json.NewDecoder(w.Body).Decode(&duplicates); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%v)", w.Code, err)
+	}
+	if len(duplicates) != 1 || duplicates[0].ID != "p1" {
+		t.Errorf("expected other submissions only, got %+v", duplicates)
+	}
+
+	mockRepo.EXPECT().GetPost("text").Return(post.Post{ID: "text", Type: "text"}, nil)
+	w = httptest.NewRecorder()
+	handler.Duplicates(w, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/duplicates/text", nil), map[string]string{"post_id": "text"}))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("expected empty list for text post, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// по спрятанному посту и посту из теневого бана повторы не ищем, как будто поста нет
+	shadowBans := mocks.NewMockBanRepo(ctrl)
+	shadowBans.EXPECT().Shadowbanned().Return(ban.Shadowbanned{"sid": true}, nil).AnyTimes()
+	handler.Bans = shadowBans
+	mockRepo.EXPECT().GetPost("p0").Return(held, nil)
+	mockRepo.EXPECT().GetPost("shadow").Return(post.Post{ID: "shadow", LinkHash: linkHash, Author: post.Author{ID: "sid"}}, nil)
+	mockRepo.EXPECT().GetPost("broken").Return(post.Post{}, errors.New("mongo is down"))
+	for id, code := range map[string]int{"p0": http.StatusNotFound, "shadow": http.StatusNotFound, "broken": http.StatusInternalServerError} {
+		w = httptest.NewRecorder()
+		handler.Duplicates(w, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/duplicates/"+id, nil), map[string]string{"post_id": id}))
+		if w.Code != code {
+			t.Errorf("%s: expected %d, got %d", id, code, w.Code)
+		}
+	}
+}
+
+type previewQueue map[string]string
+
+func (q previewQueue) Enqueue(postID, rawURL string) { q[postID] = rawURL }
+
+func TestPostHandler_LinkPreview(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockCommunities := mocks.NewMockCommunityRepo(ctrl)
+	mockCommunities.EXPECT().Get("news").Return(&community.Community{Name: "news"}, nil).AnyTimes()
+	mockVotes.EXPECT().SetVote(gomock.Any(), "uid", 1).Return(0, nil).AnyTimes()
+	mockFeed := mocks.NewMockFeed(ctrl)
+	mockFeed.EXPECT().Publish(gomock.Any()).AnyTimes()
+	queue := previewQueue{}
+	handler := &PostHandler{
+		Bans:        noBans(ctrl),
+		PostRepo:    mockRepo,
+		VoteRepo:    mockVotes,
+		Communities: mockCommunities,
+		Feed:        mockFeed,
+		Previews:    queue,
+		Logger:      zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{Username: "u", UserID: "uid"}
+
+	for _, request := range []post.NewPostRequest{
+		{Category: "news", Type: "link", Title: "link", URL: "https://example.com/a"},
+		{Category: "news", Type: "text", Title: "text", Text: "https://example.com/b"},
+	} {
+		id := request.Title
+		mockRepo.EXPECT().PostsByLink(gomock.Any(), "news").Return(nil, nil).AnyTimes()
+		mockRepo.EXPECT().CreatePost(request, "u", "uid").Return(&post.Post{ID: id, Type: request.Type, URL: request.URL, Category: "news"})
+		body, _ := json.Marshal(request)
+		w := httptest.NewRecorder()
+		handler.CreatePost(w, withSession(httptest.NewRequest(http.MethodPost, "/api/posts", bytes.NewReader(body)), sess))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s: expected 201, got %d", id, w.Code)
+		}
+	}
+	// превью грузится в фоне и только для ссылок
+	if len(queue) != 1 || queue["link"] != "https://example.com/a" {
+		t.Errorf("unexpected preview queue: %v", queue)
+	}
+}
+
+func multipartUpload(t *testing.T, fields map[string]string, file []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	if file != nil {
+		part, _ := form.CreateFormFile("file", "photo.jpg")
+		part.Write(file)
+	}
+	form.Close()
+	r := httptest.NewRequest(http.MethodPost, "/api/posts/image", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+func TestPostHandler_ImagePost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockCommunities := mocks.NewMockCommunityRepo(ctrl)
+	mockCommunities.EXPECT().Get("pics").Return(&community.Community{Name: "pics"}, nil).AnyTimes()
+	mockFeed := mocks.NewMockFeed(ctrl)
+	blobs := media.NewFileStore(t.TempDir())
+	handler := &PostHandler{
+		Bans:        noBans(ctrl),
+		PostRepo:    mockRepo,
+		VoteRepo:    mockVotes,
+		Communities: mockCommunities,
+		Feed:        mockFeed,
+		Media:       blobs,
+		Roles:       noRoles(ctrl),
+		Logger:      zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{Username: "u", UserID: "uid"}
+	var upload bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	img.Set(1, 1, color.White)
+	if err := png.Encode(&upload, img); err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]string{"category": "pics", "title": "my cat", "text": "look"}
+
+	var created *post.Post
+	mockRepo.EXPECT().CreatePost(gomock.Any(), "u", "uid").DoAndReturn(func(request post.NewPostRequest, username, userID string) *post.Post {
+		if request.Type != "image" || request.Title != "my cat" || request.Media == nil || request.Media.Width != 640 {
+			t.Errorf("unexpected request: %+v", request)
+		}
+		created = &post.Post{ID: "p1", Type: "image", Title: request.Title, Text: request.Text, Category: "pics", Media: request.Media}
+		return created
+	})
+	mockVotes.EXPECT().SetVote("p1", "uid", 1).Return(0, nil)
+	mockFeed.EXPECT().Publish(gomock.Any())
+	w := httptest.NewRecorder()
+	handler.CreateImagePost(w, withSession(multipartUpload(t, fields, upload.Bytes()), sess))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Media struct {
+			URL          string `json:"url"`
+			ThumbnailURL string `json:"thumbnailUrl"`
+		} `json:"media"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if !strings.HasPrefix(response.Media.URL, media.URLPrefix) || !strings.HasSuffix(response.Media.ThumbnailURL, "_thumb.jpg") {
+		t.Errorf("unexpected media in response: %+v", response.Media)
+	}
+
+	// файл раздается с долгим кешем
+	key := strings.TrimPrefix(response.Media.URL, media.URLPrefix)
+	serve := func(key, etag string) *httptest.ResponseRecorder {
+		r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, media.URLPrefix+key, nil), map[string]string{"key": key})
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeMedia(w, r)
+		return w
+	}
+	w = serve(key, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || w.Header().Get("Cache-Control") != media.CacheControl {
+		t.Errorf("unexpected media response: %d %v", w.Code, w.Header())
+	}
+	if w = serve(key, w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", w.Code)
+	}
+	if w = serve("nope.png", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+
+	for name, tc := range map[string]struct {
+		file []byte
+		code int
+	}{
+		"not an image": {[]byte("<html>hi</html>"), http.StatusUnsupportedMediaType},
+		"no file":      {nil, http.StatusBadRequest},
+		"too large":    {make([]byte, media.MaxUpload+multipartMemory), http.StatusRequestEntityTooLarge},
+	} {
+		w = httptest.NewRecorder()
+		handler.CreateImagePost(w, withSession(multipartUpload(t, fields, tc.file), sess))
+		if w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d", name, tc.code, w.Code)
+		}
+	}
+	w = httptest.NewRecorder()
+	handler.CreatePost(w, withSession(httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(`{"category":"pics","type":"image","title":"t"}`)), sess))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("image post without upload: expected 400, got %d", w.Code)
+	}
+
+	// удаление поста убирает и файлы
+	mockRepo.EXPECT().GetPost("p1").Return(*created, nil)
+	mockRepo.EXPECT().DeletePost("p1", role.Actor{UserID: "uid", Roles: &role.Roles{}}).Return(true, nil)
+	mockVotes.EXPECT().DeletePostVotes("p1").Return(nil)
+	handler.Audit = expectAudit(t, ctrl, audit.ActionPostDelete, nil)
+	w = httptest.NewRecorder()
+	handler.DeletePost(w, withSession(mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/api/post/p1", nil), map[string]string{"post_id": "p1"}), sess))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	for _, key := range []string{created.Media.Key, created.Media.ThumbnailKey} {
+		if _, err := blobs.Get(context.Background(), key); !errors.Is(err, media.ErrNotFound) {
+			t.Errorf("%s should be deleted, got %v", key, err)
+		}
+	}
+}
+
+func TestPostHandler_Poll(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockCommunities := mocks.NewMockCommunityRepo(ctrl)
+	mockCommunities.EXPECT().Get("polls").Return(&community.Community{Name: "polls"}, nil).AnyTimes()
+	mockVotes.EXPECT().UserVotes("uid", gomock.Any()).Return(map[string]int{}, nil).AnyTimes()
+	mockVotes.EXPECT().UserCommentVotes("uid", gomock.Any()).Return(map[string]int{}, nil).AnyTimes()
+	mockViews := mocks.NewMockCounter(ctrl)
+	mockViews.EXPECT().Record(gomock.Any(), gomock.Any()).Return(0, nil).AnyTimes()
+	mockFeed := mocks.NewMockFeed(ctrl)
+	handler := &PostHandler{
+		Bans:        noBans(ctrl),
+		PostRepo:    mockRepo,
+		VoteRepo:    mockVotes,
+		Communities: mockCommunities,
+		Feed:        mockFeed,
+		Views:       mockViews,
+		Logger:      zaptest.NewLogger(t).Sugar(),
+	}
+	sess := &session.Session{Username: "u", UserID: "uid"}
+	decode := func(w *httptest.ResponseRecorder) post.Post {
+		t.Helper()
+		var got post.Post
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil || got.Poll == nil {
+			t.Fatalf("expected poll post, got %d (%v)", w.Code, err)
+		}
+		return got
+	}
+	poll := func(closes *time.Time) *post.Poll {
+		return &post.Poll{
+			Options: []post.PollOption{{Text: "yes", Votes: 3}, {Text: "no", Votes: 1}},
+			Voters:  4,
+			Closes:  closes,
+		}
+	}
+
+	w := httptest.NewRecorder()
+	body := `{"category":"polls","type":"poll","title":"?","poll":{"options":["only one"]}}`
+	handler.CreatePost(w, withSession(httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body)), sess))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for one option, got %d", w.Code)
+	}
+
+	created := &post.Post{ID: "p1", Type: "poll", Poll: poll(nil)}
+	mockRepo.EXPECT().CreatePost(gomock.Any(), "u", "uid").DoAndReturn(func(request post.NewPostRequest, _, _ string) *post.Post {
+		if request.Poll == nil || request.Poll.Options[0] != "yes" || !request.Poll.Multiple {
+			t.Errorf("poll was not passed to repo: %+v", request.Poll)
+		}
+		return created
+	})
+	mockVotes.EXPECT().SetVote("p1", "uid", 1).Return(0, nil)
+	mockFeed.EXPECT().Publish(created)
+	w = httptest.NewRecorder()
+	body = `{"category":"polls","type":"poll","title":"?","poll":{"options":[" yes ","no"],"multiple":true}}`
+	handler.CreatePost(w, withSession(httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body)), sess))
+	if w.Code != http.StatusCreated || strings.Contains(w.Body.String(), "results") || strings.Contains(w.Body.String(), "votes") {
+		t.Errorf("results should be hidden from the author before voting, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// аноним до закрытия результатов не видит, после - видит
+	closed := time.Now().Add(-time.Hour)
+	mockRepo.EXPECT().GetPost("open").Return(post.Post{ID: "open", Poll: poll(nil)}, nil)
+	mockRepo.EXPECT().GetPost("closed").Return(post.Post{ID: "closed", Poll: poll(&closed)}, nil)
+	for id, results := range map[string]int{"open": 0, "closed": 2} {
+		w = httptest.NewRecorder()
+		handler.GetPost(w, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/post/"+id, nil), map[string]string{"post_id": id}))
+		if got := decode(w); len(got.Poll.Results) != results {
+			t.Errorf("%s: expected %d results, got %v", id, results, got.Poll.Results)
+		}
+	}
+
+	vote := func(id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/post/"+id+"/poll", strings.NewReader(body)), map[string]string{"post_id": id})
+		handler.VotePoll(w, withSession(req, sess))
+		return w
+	}
+	voted := post.Post{ID: "p1", Poll: poll(nil)}
+	mockRepo.EXPECT().VotePoll("p1", "uid", []int{0}).Return(&voted, nil)
+	// свой выбор - из PollChoices: бюллетеней в постах из репозитория нет
+	mockRepo.EXPECT().PollChoices("uid", []string{"p1"}).Return(map[string][]int{"p1": {0}}, nil)
+	w = vote("p1", `{"choices":[0]}`)
+	if got := decode(w); w.Code != http.StatusOK || !reflect.DeepEqual(got.Poll.Results, []int{3, 1}) || !reflect.DeepEqual(got.Poll.Choices, []int{0}) || got.Vote != 0 {
+		t.Errorf("voter should see results and own choice, got %d: %+v", w.Code, got.Poll)
+	}
+
+	for err, code := range map[error]int{
+		post.ErrAlreadyVoted: http.StatusConflict,
+		post.ErrBadBallot:    http.StatusBadRequest,
+		post.ErrNotPoll:      http.StatusBadRequest,
+		post.ErrPollClosed:   http.StatusForbidden,
+		post.ErrPostNotFound: http.StatusNotFound,
+	} {
+		mockRepo.EXPECT().VotePoll("p1", "uid", []int{1}).Return(nil, err)
+		if w = vote("p1", `{"choices":[1]}`); w.Code != code {
+			t.Errorf("%v: expected %d, got %d", err, code, w.Code)
+		}
+	}
+	if w = vote("p1", `{"choices":"yes"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad payload, got %d", w.Code)
+	}
+}
+
+// notificationQueue копит рассылки вместо notification.Worker
+type notificationQueue struct {
+	deliveries []notification.Delivery
+}
+
+func (q *notificationQueue) Enqueue(d notification.Delivery) { q.deliveries = append(q.deliveries, d) }
+
+func TestPostHandler_Notifications(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPostRepo(ctrl)
+	mockVotes := mocks.NewMockVoteRepo(ctrl)
+	mockVotes.EXPECT().UserVotes(gomock.Any(), gomock.Any()).Return(map[string]int{}, nil).AnyTimes()
+	mockVotes.EXPECT().UserCommentVotes(gomock.Any(), gomock.Any()).Return(map[string]int{}, nil).AnyTimes()
+	queue := &notificationQueue{}
+
+	handler := &PostHandler{
+		Bans:          noBans(ctrl),
+		PostRepo:      mockRepo,
+		VoteRepo:      mockVotes,
+		Notifications: queue,
+		Logger:        zaptest.NewLogger(t).Sugar(),
+	}
+	bob := &session.Session{Username: "bob", UserID: "bob-id"}
+	comment := func(id, parentID, authorID, body string) post.Comment {
+		c := post.Comment{ID: id, ParentID: parentID, Body: body}
+		c.Author.ID = authorID
+		return c
+	}
+	root := comment("c1", "", "carol-id", "first")
+
+	// коммент к посту: автору поста и всем упомянутым - кого из них нет или кто сам автор, разберет Worker
+	body := "hi u/alice u/carol u/ghost u/bob"
+	commented := &post.Post{ID: "1", Title: "t", Author: post.Author{ID: "alice-id"}, Comments: []post.Comment{root, comment("c2", "", "bob-id", body)}}
+	mockRepo.EXPECT().AddComment("1", "bob", "bob-id", body).Return(commented, nil)
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/post/1", bytes.NewBufferString(`{"comment":"`+body+`"}`)), map[string]string{"post_id": "1"})
+	w := httptest.NewRecorder()
+	handler.AddComment(w, withSession(req, bob))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+	if len(queue.deliveries) != 1 {
+		t.Fatalf("expected one delivery, got %+v", queue.deliveries)
+	}
+	d := queue.deliveries[0]
+	if d.To != "alice-id" || d.Kind != notification.KindComment || d.ActorID != "bob-id" ||
+		!reflect.DeepEqual(d.Mentions, []string{"alice", "carol", "ghost", "bob"}) {
+		t.Errorf("unexpected delivery: %+v", d)
+	}
+	if d.Event.CommentID != "c2" || d.Event.Actor != "bob" || d.Event.Excerpt != body {
+		t.Errorf("unexpected event: %+v", d.Event)
+	}
+
+	// ответ: автору коммента как ответ, а не автору поста
+	queue.deliveries = nil
+	replied := &post.Post{ID: "1", Author: post.Author{ID: "alice-id"}, Comments: []post.Comment{root, comment("c3", "c1", "bob-id", "u/carol yes")}}
+	mockRepo.EXPECT().AddReply("1", "c1", "bob", "bob-id", "u/carol yes").Return(replied, nil)
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/post/1/c1/reply", bytes.NewBufferString(`{"comment":"u/carol yes"}`)),
+		map[string]string{"post_id": "1", "comment_id": "c1"})
+	w = httptest.NewRecorder()
+	handler.AddReply(w, withSession(req, bob))
+	if len(queue.deliveries) != 1 || queue.deliveries[0].To != "carol-id" || queue.deliveries[0].Kind != notification.KindReply {
+		t.Fatalf("unexpected deliveries: %+v", queue.deliveries)
+	}
+
+	// в теневом бане - молчим
+	queue.deliveries = nil
+	shadowBans := mocks.NewMockBanRepo(ctrl)
+	shadowBans.EXPECT().Active(gomock.Any()).Return(nil, nil).AnyTimes()
+	shadowBans.EXPECT().Shadowbanned().Return(ban.Shadowbanned{"bob-id": true}, nil).AnyTimes()
+	handler.Bans = shadowBans
+	mockRepo.EXPECT().AddReply("1", "c1", "bob", "bob-id", "u/carol yes").Return(replied, nil)
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/post/1/c1/reply", bytes.NewBufferString(`{"comment":"u/carol yes"}`)),
+		map[string]string{"post_id": "1", "comment_id": "c1"})
+	w = httptest.NewRecorder()
+	handler.AddReply(w, withSession(req, bob))
+	if w.Code != http.StatusCreated || len(queue.deliveries) != 0 {
+		t.Errorf("expected no deliveries from shadowbanned user, got %d %+v", w.Code, queue.deliveries)
+	}
+}
+
+func TestNotificationHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockNotifications := mocks.NewMockNotificationRepo(ctrl)
+	handler := &NotificationHandler{Notifications: mockNotifications, Logger: zaptest.NewLogger(t).Sugar()}
+	sess := &session.Session{Username: "user", UserID: "uid"}
+
+	inbox := &notification.Inbox{Notifications: []notification.Notification{{ID: "n1", Kind: notification.KindComment, Count: 3}}, Unread: 1}
+	mockNotifications.EXPECT().Inbox("uid", 10).Return(inbox, nil)
+	w := httptest.NewRecorder()
+	handler.Inbox(w, withSession(httptest.NewRequest(http.MethodGet, "/api/notifications?limit=10", nil), sess))
+	var got notification.Inbox
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if w.Code != http.StatusOK || got.Unread != 1 || len(got.Notifications) != 1 || got.Notifications[0].Count != 3 {
+		t.Errorf("unexpected inbox: %d %+v", w.Code, got)
+	}
+
+	w = httptest.NewRecorder()
+	handler.Inbox(w, withSession(httptest.NewRequest(http.MethodGet, "/api/notifications?limit=x", nil), sess))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad limit, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler.Inbox(w, httptest.NewRequest(http.MethodGet, "/api/notifications", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+
+	mockNotifications.EXPECT().MarkRead("uid", []string{"n1"}).Return(1, nil)
+	mockNotifications.EXPECT().MarkRead("uid", nil).Return(4, nil)
+	for body, want := range map[string]float64{`{"ids":["n1"]}`: 1, ``: 4} {
+		w = httptest.NewRecorder()
+		handler.MarkRead(w, withSession(httptest.NewRequest(http.MethodPost, "/api/notifications/read", strings.NewReader(body)), sess))
+		var resp map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if w.Code != http.StatusOK || resp["marked"] != want {
+			t.Errorf("%q: unexpected response %d %v", body, w.Code, resp)
+		}
+	}
+
+	// не указанные поля не трогаем
+	mockNotifications.EXPECT().Preferences("uid").Return(notification.DefaultPreferences(), nil)
+	mockNotifications.EXPECT().SetPreferences("uid", notification.Preferences{Comments: false, Replies: true, Mentions: true}).Return(nil)
+	w = httptest.NewRecorder()
+	handler.SetPreferences(w, withSession(httptest.NewRequest(http.MethodPost, "/api/notifications/preferences", strings.NewReader(`{"comments":false}`)), sess))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
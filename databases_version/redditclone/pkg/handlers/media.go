@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"redditclone/pkg/media"
+	"redditclone/pkg/post"
+	"redditclone/pkg/session"
+	"redditclone/pkg/utils"
+	"time"
+)
+
+// multipartMemory - сколько формы держим в памяти, остальное multipart кладет во временные файлы
+const multipartMemory = 1 << 20
+
+// CreateImagePost - POST /api/posts/image: multipart с полями category, title, text и картинкой в file
+func (h *PostHandler) CreateImagePost(w http.ResponseWriter, r *http.Request) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+	if h.Media == nil {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "image uploads are disabled"})
+		return
+	}
+
+	// запас сверху - на остальные поля и заголовки частей
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxUpload+multipartMemory)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{"message": media.ErrTooLarge.Error()})
+			return
+		}
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid multipart form"})
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "file is required"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxUpload+1))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid multipart form"})
+		return
+	}
+
+	img, err := media.Process(data)
+	switch {
+	case errors.Is(err, media.ErrTooLarge):
+		utils.WriteJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{"message": err.Error()})
+		return
+	case errors.Is(err, media.ErrUnsupported):
+		utils.WriteJSON(w, http.StatusUnsupportedMediaType, map[string]interface{}{"message": "only jpeg, png and gif images are supported"})
+		return
+	case err != nil:
+		h.Logger.Errorf("failed to process upload by %s: %v", currentSession.Username, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error creating post"})
+		return
+	}
+
+	request := post.NewPostRequest{
+		Category: r.FormValue("category"),
+		Type:     "image",
+		Title:    r.FormValue("title"),
+		Text:     r.FormValue("text"),
+	}
+	h.createPost(w, r, currentSession, request, img)
+}
+
+// ServeMedia - GET /media/{key}: файлы image-постов из BlobStore. Под ключом файл никогда не меняется,
+// так что браузер может кешировать его навсегда
+func (h *PostHandler) ServeMedia(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if h.Media == nil || !media.ValidKey(key) {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "file not found"})
+		return
+	}
+	etag := `"` + key + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	blob, err := h.Media.Get(r.Context(), key)
+	if errors.Is(err, media.ErrNotFound) {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "file not found"})
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("failed to get media %s: %v", key, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		return
+	}
+	w.Header().Set("Content-Type", blob.ContentType)
+	w.Header().Set("Cache-Control", media.CacheControl)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(blob.Data))
+}
+
+// deleteMedia убирает файлы поста. Пост к этому моменту уже удален, так что ошибку только логируем -
+// в худшем случае файл останется лежать без ссылок на него
+func deleteMedia(ctx context.Context, blobs media.BlobStore, logger *zap.SugaredLogger, m *media.Media) {
+	if blobs == nil || m == nil {
+		return
+	}
+	if err := media.Delete(ctx, blobs, m); err != nil {
+		logger.Errorf("failed to delete media %s: %v", m.Key, err)
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"redditclone/pkg/notification"
+	"redditclone/pkg/post"
+	"redditclone/pkg/session"
+	"redditclone/pkg/utils"
+	"strconv"
+)
+
+type NotificationHandler struct {
+	Notifications notification.NotificationRepo
+	Logger        *zap.SugaredLogger
+}
+
+// Inbox - ?limit= последних уведомлений и счетчик непрочитанных для значка
+func (h *NotificationHandler) Inbox(w http.ResponseWriter, r *http.Request) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	limit := notification.DefaultInboxLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "bad limit"})
+			return
+		}
+	}
+	inbox, err := h.Notifications.Inbox(currentSession.UserID, limit)
+	if err != nil {
+		h.Logger.Errorf("failed to get notifications of %s: %v", currentSession.Username, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, inbox)
+}
+
+// MarkRead - {"ids": [...]} отмечает прочитанными эти уведомления, пустое тело или без ids - все
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		return
+	}
+	marked, err := h.Notifications.MarkRead(currentSession.UserID, req.IDs)
+	if err != nil {
+		h.Logger.Errorf("failed to mark notifications of %s read: %v", currentSession.Username, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"marked": marked})
+}
+
+func (h *NotificationHandler) Preferences(w http.ResponseWriter, r *http.Request) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	prefs, err := h.Notifications.Preferences(currentSession.UserID)
+	if err != nil {
+		h.Logger.Errorf("failed to get notification preferences of %s: %v", currentSession.Username, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, prefs)
+}
+
+// SetPreferences - поля, которых нет в запросе, остаются как были
+func (h *NotificationHandler) SetPreferences(w http.ResponseWriter, r *http.Request) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	prefs, err := h.Notifications.Preferences(currentSession.UserID)
+	if err != nil {
+		h.Logger.Errorf("failed to get notification preferences of %s: %v", currentSession.Username, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		return
+	}
+	if err = json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		return
+	}
+	if err = h.Notifications.SetPreferences(currentSession.UserID, prefs); err != nil {
+		h.Logger.Errorf("failed to save notification preferences of %s: %v", currentSession.Username, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, prefs)
+	h.Logger.Infof("%s changed notification preferences: %+v", currentSession.Username, prefs)
+}
+
+// notifyComment - автору поста или коммента, на который ответили, и упомянутым в комменте.
+// Рассылает notification.Worker в фоне, здесь только собираем, кому
+func (h *PostHandler) notifyComment(p *post.Post, commentID string, actor *session.Session) {
+	if h.Notifications == nil {
+		return
+	}
+	comment := findComment(p, commentID)
+	// убранное автомодератором никто, кроме модераторов, не увидит - и звать к нему незачем
+	if comment == nil || comment.Removed != nil || h.actorHidden(actor) {
+		return
+	}
+
+	delivery := notification.Delivery{
+		Event: notification.Event{
+			Actor:     actor.Username,
+			PostID:    p.ID,
+			CommentID: comment.ID,
+			Category:  p.Category,
+			Title:     p.Title,
+			Excerpt:   comment.Body,
+			Created:   comment.Created,
+		},
+		ActorID:  actor.UserID,
+		Mentions: notification.Mentions(comment.Body),
+	}
+	if comment.ParentID == "" {
+		delivery.To, delivery.Kind = p.Author.ID, notification.KindComment
+	} else if parent := findComment(p, comment.ParentID); parent != nil && !parent.Deleted {
+		delivery.To, delivery.Kind = parent.Author.ID, notification.KindReply
+	}
+	h.Notifications.Enqueue(delivery)
+}
+
+func findComment(p *post.Post, commentID string) *post.Comment {
+	for i := range p.Comments {
+		if p.Comments[i].ID == commentID {
+			return &p.Comments[i]
+		}
+	}
+	return nil
+}
+
+// notifyPost - упомянутым в тексте нового поста
+func (h *PostHandler) notifyPost(p *post.Post, actor *session.Session) {
+	if h.Notifications == nil || p.Text == "" || h.actorHidden(actor) {
+		return
+	}
+	h.Notifications.Enqueue(notification.Delivery{
+		Event: notification.Event{
+			Actor:    actor.Username,
+			PostID:   p.ID,
+			Category: p.Category,
+			Title:    p.Title,
+			Excerpt:  p.Text,
+			Created:  p.Created,
+		},
+		ActorID:  actor.UserID,
+		Mentions: notification.Mentions(p.Text),
+	})
+}
+
+// actorHidden - написанное юзером в теневом бане никто не видит, так что и уведомлять о нем нельзя.
+// Не смогли проверить - лучше промолчать
+func (h *PostHandler) actorHidden(actor *session.Session) bool {
+	shadowbanned, err := h.Bans.Shadowbanned()
+	if err != nil {
+		h.Logger.Errorf("failed to get shadowbanned users: %v", err)
+		return true
+	}
+	return shadowbanned[actor.UserID]
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"redditclone/pkg/post"
+	"redditclone/pkg/session"
+	"redditclone/pkg/utils"
+	"strings"
+	"time"
+)
+
+type pollVoteRequest struct {
+	// номера вариантов с нуля, больше одного - только в опросах с multiple
+	Choices []int `json:"choices"`
+}
+
+// fillPolls открывает результаты опросов тем, кто уже проголосовал, и всем - после закрытия. userID пустой - аноним.
+// Бюллетеней в постах из репозитория нет, выбор юзера - отдельным запросом, см. post.PostRepo.PollChoices
+func (h *PostHandler) fillPolls(userID string, posts ...*post.Post) {
+	pollIDs := make([]string, 0)
+	for _, p := range posts {
+		if p.Poll != nil {
+			pollIDs = append(pollIDs, p.ID)
+		}
+	}
+	if len(pollIDs) == 0 {
+		return
+	}
+	var choices map[string][]int
+	if userID != "" {
+		var err error
+		// при ошибке показываем опросы как не голосовавшему - ленту из-за этого не роняем
+		if choices, err = h.PostRepo.PollChoices(userID, pollIDs); err != nil {
+			h.Logger.Errorf("failed to get poll choices of %s: %v", userID, err)
+		}
+	}
+	now := time.Now().UTC()
+	for _, p := range posts {
+		if p.Poll != nil {
+			p.Poll.View(choices[p.ID], now)
+		}
+	}
+}
+
+// postBody - текст поста для автомодератора: у опроса это еще и варианты
+func postBody(request post.NewPostRequest) string {
+	if request.Type != "poll" || request.Poll == nil {
+		return request.Text
+	}
+	return strings.Join(append([]string{request.Text}, request.Poll.Options...), "\n")
+}
+
+// VotePoll - POST /api/post/{post_id}/poll. К апвоутам поста отношения не имеет, переголосовать нельзя
+func (h *PostHandler) VotePoll(w http.ResponseWriter, r *http.Request) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+	postID := mux.Vars(r)["post_id"]
+	var request pollVoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		return
+	}
+	if !h.checkBan(w, currentSession.UserID, postID, "") {
+		return
+	}
+
+	votedPost, err := h.PostRepo.VotePoll(postID, currentSession.UserID, request.Choices)
+	switch {
+	case errors.Is(err, post.ErrPostNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		return
+	case errors.Is(err, post.ErrNotPoll), errors.Is(err, post.ErrBadBallot):
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	case errors.Is(err, post.ErrPollClosed), errors.Is(err, post.ErrRemoved):
+		utils.WriteJSON(w, http.StatusForbidden, map[string]interface{}{"message": err.Error()})
+		return
+	case errors.Is(err, post.ErrAlreadyVoted):
+		utils.WriteJSON(w, http.StatusConflict, map[string]interface{}{"message": err.Error()})
+		return
+	case errors.Is(err, post.ErrConflict):
+		utils.WriteJSON(w, http.StatusConflict, map[string]interface{}{"message": "post is busy, try again"})
+		return
+	case err != nil:
+		h.Logger.Errorf("failed to vote poll of post %s: %v", postID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error voting poll"})
+		return
+	}
+	if !h.visiblePost(w, r, votedPost) {
+		return
+	}
+	h.fillPostVotes(r, votedPost)
+	utils.WriteJSON(w, http.StatusOK, votedPost)
+	h.Logger.Infof("Voted poll by %s, %s, %v", currentSession.UserID, postID, request.Choices)
+}
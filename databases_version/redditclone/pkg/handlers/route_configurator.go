@@ -4,27 +4,77 @@ import (
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"net/http"
+	"redditclone/pkg/session"
 	"redditclone/pkg/utils/middleware"
 )
 
-func ConfigureRoutes(userHandler *UserHandler, postHandler *PostHandler, logger *zap.SugaredLogger) http.Handler {
+func ConfigureRoutes(userHandler *UserHandler, postHandler *PostHandler, communityHandler *CommunityHandler, reportHandler *ReportHandler, banHandler *BanHandler, auditHandler *AuditHandler, automodHandler *AutomodHandler, notificationHandler *NotificationHandler, sm session.SessionManager, logger *zap.SugaredLogger) http.Handler {
+	// auth - только для залогиненных, optAuth - аноним тоже пройдет, но без сессии в контексте
+	auth := func(h http.HandlerFunc) http.Handler {
+		return middleware.Auth(sm, logger, h)
+	}
+	optAuth := func(h http.HandlerFunc) http.Handler {
+		return middleware.OptionalAuth(sm, logger, h)
+	}
+
 	router := mux.NewRouter().StrictSlash(true)
 	router.HandleFunc("/api/register", userHandler.Register).Methods(http.MethodPost)
 	router.HandleFunc("/api/login", userHandler.Login).Methods(http.MethodPost)
 	router.HandleFunc("/logout", userHandler.Logout).Methods(http.MethodGet)
 
-	router.HandleFunc("/api/posts", postHandler.CreatePost).Methods(http.MethodPost)
-	router.HandleFunc("/api/posts", postHandler.ListPosts).Methods(http.MethodGet)
-	router.HandleFunc("/api/posts/{category}", postHandler.ListPostsByCategory).Methods(http.MethodGet)
-	router.HandleFunc("/api/post/{post_id}", postHandler.GetPost).Methods(http.MethodGet)
-	router.HandleFunc("/api/post/{post_id}", postHandler.AddComment).Methods(http.MethodPost)
-	router.HandleFunc("/api/post/{post_id}/{comment_id}", postHandler.DeleteComment).Methods(http.MethodDelete)
-	router.HandleFunc("/api/post/{post_id}/upvote", postHandler.UpvotePost).Methods(http.MethodGet)
-	router.HandleFunc("/api/post/{post_id}/downvote", postHandler.DownvotePost).Methods(http.MethodGet)
-	router.HandleFunc("/api/post/{post_id}/unvote", postHandler.UnvotePost).Methods(http.MethodGet)
-	router.HandleFunc("/api/post/{post_id}", postHandler.DeletePost).Methods(http.MethodDelete)
-	router.HandleFunc("/api/user/{username}", postHandler.PostsByUser).Methods(http.MethodGet)
+	router.Handle("/api/posts", auth(postHandler.CreatePost)).Methods(http.MethodPost)
+	router.Handle("/api/posts/image", auth(postHandler.CreateImagePost)).Methods(http.MethodPost)
+	router.Handle("/api/posts", optAuth(postHandler.ListPosts)).Methods(http.MethodGet)
+	router.Handle("/api/posts/{category}", optAuth(postHandler.ListPostsByCategory)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}", optAuth(postHandler.GetPost)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}", auth(postHandler.AddComment)).Methods(http.MethodPost)
+	router.Handle("/api/post/{post_id}", auth(postHandler.EditPost)).Methods(http.MethodPut)
+	router.HandleFunc("/api/post/{post_id}/revisions", postHandler.PostRevisions).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/{comment_id}", auth(postHandler.DeleteComment)).Methods(http.MethodDelete)
+	router.Handle("/api/post/{post_id}/{comment_id}", auth(postHandler.EditComment)).Methods(http.MethodPut)
+	router.HandleFunc("/api/post/{post_id}/{comment_id}/revisions", postHandler.CommentRevisions).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/{comment_id}/reply", auth(postHandler.AddReply)).Methods(http.MethodPost)
+	router.Handle("/api/post/{post_id}/{comment_id}/replies", optAuth(postHandler.CommentReplies)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/{comment_id}/upvote", auth(postHandler.UpvoteComment)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/{comment_id}/downvote", auth(postHandler.DownvoteComment)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/{comment_id}/unvote", auth(postHandler.UnvoteComment)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/upvote", auth(postHandler.UpvotePost)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/downvote", auth(postHandler.DownvotePost)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/unvote", auth(postHandler.UnvotePost)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/poll", auth(postHandler.VotePoll)).Methods(http.MethodPost)
+	router.Handle("/api/post/{post_id}", auth(postHandler.DeletePost)).Methods(http.MethodDelete)
+	router.Handle("/api/post/{post_id}/remove", auth(postHandler.RemovePost)).Methods(http.MethodPost)
+	router.Handle("/api/post/{post_id}/{comment_id}/remove", auth(postHandler.RemoveComment)).Methods(http.MethodPost)
+	router.Handle("/api/post/{post_id}/report", auth(reportHandler.ReportPost)).Methods(http.MethodPost)
+	router.Handle("/api/post/{post_id}/{comment_id}/report", auth(reportHandler.ReportComment)).Methods(http.MethodPost)
+	router.Handle("/api/modqueue", auth(reportHandler.ModQueue)).Methods(http.MethodGet)
+	router.Handle("/api/modqueue/{item_id}/{action}", auth(reportHandler.ResolveItem)).Methods(http.MethodPost)
+	router.Handle("/api/audit", auth(auditHandler.AuditLog)).Methods(http.MethodGet)
+	router.Handle("/api/automod/dryrun", auth(automodHandler.DryRun)).Methods(http.MethodPost)
+	router.Handle("/api/user/{username}", optAuth(postHandler.PostsByUser)).Methods(http.MethodGet)
+	router.Handle("/api/user/{username}/ban", auth(banHandler.BanUser)).Methods(http.MethodPost)
+	router.Handle("/api/user/{username}/ban", auth(banHandler.UnbanUser)).Methods(http.MethodDelete)
+	router.Handle("/api/user/{username}/bans", auth(banHandler.UserBans)).Methods(http.MethodGet)
+	router.Handle("/api/user/{username}/follow", auth(userHandler.FollowUser)).Methods(http.MethodPost)
+	router.Handle("/api/user/{username}/unfollow", auth(userHandler.UnfollowUser)).Methods(http.MethodPost)
+	router.Handle("/api/notifications", auth(notificationHandler.Inbox)).Methods(http.MethodGet)
+	router.Handle("/api/notifications/read", auth(notificationHandler.MarkRead)).Methods(http.MethodPost)
+	router.Handle("/api/notifications/preferences", auth(notificationHandler.Preferences)).Methods(http.MethodGet)
+	router.Handle("/api/notifications/preferences", auth(notificationHandler.SetPreferences)).Methods(http.MethodPost)
+	router.Handle("/api/feed", optAuth(postHandler.HomeFeed)).Methods(http.MethodGet)
+	router.Handle("/api/search", optAuth(postHandler.Search)).Methods(http.MethodGet)
+	router.Handle("/api/duplicates/{post_id}", optAuth(postHandler.Duplicates)).Methods(http.MethodGet)
+
+	router.Handle("/api/communities", auth(communityHandler.CreateCommunity)).Methods(http.MethodPost)
+	router.Handle("/api/communities", optAuth(communityHandler.ListCommunities)).Methods(http.MethodGet)
+	router.Handle("/api/community/{name}", optAuth(communityHandler.GetCommunity)).Methods(http.MethodGet)
+	router.Handle("/api/community/{name}/subscribe", auth(communityHandler.Subscribe)).Methods(http.MethodPost)
+	router.Handle("/api/community/{name}/unsubscribe", auth(communityHandler.Unsubscribe)).Methods(http.MethodPost)
+	router.Handle("/api/community/{name}/moderators", optAuth(communityHandler.Moderators)).Methods(http.MethodGet)
+	router.Handle("/api/community/{name}/moderators", auth(communityHandler.AddModerator)).Methods(http.MethodPost)
+	router.Handle("/api/community/{name}/moderators/{username}", auth(communityHandler.RemoveModerator)).Methods(http.MethodDelete)
 
+	router.HandleFunc("/media/{key}", postHandler.ServeMedia).Methods(http.MethodGet)
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static")))).Methods(http.MethodGet)
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "./static/html/index.html")
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"redditclone/pkg/post"
+	"redditclone/pkg/utils"
+	"strconv"
+	"time"
+)
+
+const (
+	paramQuery    = "q"
+	paramCategory = "category"
+	paramAuthor   = "author"
+	paramType     = "type"
+	paramFrom     = "from"
+	paramTo       = "to"
+
+	dateLayout = "2006-01-02"
+)
+
+var errBadSearchParams = errors.New("bad search params")
+
+// parseSearchTime принимает RFC3339 или просто дату. Дата в to - до конца этого дня включительно
+func parseSearchTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, errBadSearchParams
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// parseSearchQuery разбирает ?q=&category=&author=&type=&from=&to=&limit=
+func parseSearchQuery(r *http.Request) (query post.SearchQuery, err error) {
+	values := r.URL.Query()
+	query.Text = values.Get(paramQuery)
+	query.Category = values.Get(paramCategory)
+	query.Author = values.Get(paramAuthor)
+	query.Type = values.Get(paramType)
+	if query.Type != "" && query.Type != "text" && query.Type != "link" {
+		return query, errBadSearchParams
+	}
+	if query.From, err = parseSearchTime(values.Get(paramFrom), false); err != nil {
+		return query, err
+	}
+	if query.To, err = parseSearchTime(values.Get(paramTo), true); err != nil {
+		return query, err
+	}
+	if limit := values.Get(paramLimit); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 || query.Limit > post.MaxPageLimit {
+			return query, errBadSearchParams
+		}
+	}
+	return query, nil
+}
+
+// Search - GET /api/search, посты от самых релевантных
+func (h *PostHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query, err := parseSearchQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	posts, err := h.PostRepo.Search(query)
+	if err != nil {
+		if errors.Is(err, post.ErrEmptySearch) || errors.Is(err, post.ErrBadSearchRange) {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+			return
+		}
+		h.Logger.Errorf("failed to search posts by %q: %v", query.Text, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error searching posts"})
+		return
+	}
+	posts = h.hideShadowbanned(r, posts)
+	h.fillUserVotes(r, postPointers(posts)...)
+	utils.WriteJSON(w, http.StatusOK, posts)
+}
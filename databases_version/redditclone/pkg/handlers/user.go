@@ -3,17 +3,25 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"net/http"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/feed"
+	"redditclone/pkg/follow"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
 	"redditclone/pkg/utils"
+	"time"
 )
 
 type UserHandler struct {
 	UserRepo user.UserRepo
+	Follows  follow.FollowRepo
+	Feed     feed.Feed
 	Logger   *zap.SugaredLogger
 	Sessions session.SessionManager
+	Audit    audit.AuditRepo
 }
 
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -55,7 +63,7 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 	h.Logger.Infof("created session for %v", sess.UserID)
 
-	err = utils.SendJwtToken(w, h.UserRepo.GenerateUserToken(*u))
+	err = utils.SendJwtToken(w, h.UserRepo.GenerateUserToken(*u, sess.ID))
 	if err != nil {
 		h.Logger.Errorf("failed to send JWT token: %v", err)
 		err := h.Sessions.Destroy(w, r)
@@ -64,6 +72,7 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	recordAudit(h.Audit, h.Logger, r, audit.NewEvent(audit.ActionRegister, u.Username, u.ID, audit.UserTarget(u.Username), time.Now().UTC()))
 	h.Logger.Infof("Logged in user %s", request.Username)
 }
 
@@ -75,6 +84,10 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 	u, err := h.UserRepo.Authorize(request.Username, request.Password)
 	if err != nil {
+		// подбор паролей тоже видно по журналу
+		if errors.Is(err, user.ErrNoUser) || errors.Is(err, user.ErrBadPass) {
+			recordAudit(h.Audit, h.Logger, r, audit.NewEvent(audit.ActionLoginFailed, request.Username, "", audit.UserTarget(request.Username), time.Now().UTC()))
+		}
 		if errors.Is(err, user.ErrNoUser) {
 			utils.WriteJSON(w, http.StatusUnauthorized, map[string]interface{}{"message": "user not found"})
 		}
@@ -91,7 +104,7 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 	h.Logger.Infof("created session for %v", sess.UserID)
 
-	err = utils.SendJwtToken(w, h.UserRepo.GenerateUserToken(*u))
+	err = utils.SendJwtToken(w, h.UserRepo.GenerateUserToken(*u, sess.ID))
 	if err != nil {
 		h.Logger.Errorf("failed to send JWT token: %v", err)
 		err := h.Sessions.Destroy(w, r)
@@ -100,13 +113,57 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	recordAudit(h.Audit, h.Logger, r, audit.NewEvent(audit.ActionLogin, u.Username, u.ID, audit.UserTarget(u.Username), time.Now().UTC()))
 	h.Logger.Infof("Logged in user %s", request.Username)
 }
 
 func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	// после Destroy сессии уже не будет, а в журнал надо записать, кто вышел
+	sess, checkErr := h.Sessions.Check(r)
 	err := h.Sessions.Destroy(w, r)
 	if err != nil {
 		return
 	}
+	if checkErr == nil {
+		recordAudit(h.Audit, h.Logger, r, audit.NewEvent(audit.ActionLogout, sess.Username, sess.UserID, audit.UserTarget(sess.Username), time.Now().UTC()))
+	}
 	http.Redirect(w, r, "/", http.StatusFound)
 }
+
+func (h *UserHandler) FollowUser(w http.ResponseWriter, r *http.Request) {
+	h.setFollow(w, r, true)
+}
+
+func (h *UserHandler) UnfollowUser(w http.ResponseWriter, r *http.Request) {
+	h.setFollow(w, r, false)
+}
+
+func (h *UserHandler) setFollow(w http.ResponseWriter, r *http.Request, follows bool) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	username := mux.Vars(r)["username"]
+	if follows {
+		err = h.Follows.Follow(currentSession.UserID, username)
+	} else {
+		err = h.Follows.Unfollow(currentSession.UserID, username)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, follow.ErrNoUser):
+			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "user not found"})
+		case errors.Is(err, follow.ErrSelfFollow):
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		default:
+			h.Logger.Errorf("failed to change follow of %s to %s: %v", currentSession.UserID, username, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		}
+		return
+	}
+	h.Feed.SourcesChanged(currentSession.UserID)
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"username": username, "following": follows})
+	h.Logger.Infof("%s follows %s: %v", currentSession.Username, username, follows)
+}
@@ -0,0 +1,660 @@
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// spoilerClass - класс спойлера >!...!<, текст под ним прячет фронт
+const spoilerClass = "md-spoiler"
+
+var (
+	entityRe      = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	autolinkRe    = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.\-]{1,31}:[^\s<>]*)>`)
+	emailRe       = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_{|}~\-]+@[a-zA-Z0-9\-]+(?:\.[a-zA-Z0-9\-]+)*)>`)
+	bareURLRe     = regexp.MustCompile(`^https?://[^\s<>"\[\]]+`)
+	userLinkRe    = regexp.MustCompile(`^/?u/([A-Za-z0-9_\-]+)`)
+	communityLink = regexp.MustCompile(`^/?r/([A-Za-z0-9_]+)`)
+)
+
+// node - кусок строки после разбора. У разделителей выделения и спойлеров html пустой, что из них вышло -
+// решает processEmphasis
+type node struct {
+	html string
+
+	// '*', '_', '~' или '!' - спойлер, 0 - не разделитель
+	delim byte
+	lit   string
+	// сколько символов разделителя еще не ушло в теги и orig - сколько было изначально
+	count, orig       int
+	canOpen, canClose bool
+	// открывающие теги после разделителя, снаружи внутрь, и закрывающие перед ним, изнутри наружу
+	opens, closes []string
+
+	// ссылка или ее тег: внутри другой ссылки выводится текстом, вложенных <a> не бывает
+	link     bool
+	linkText string
+}
+
+func (n *node) write(b *strings.Builder) {
+	for _, tag := range n.closes {
+		b.WriteString(tag)
+	}
+	b.WriteString(n.html)
+	if n.count > 0 {
+		b.WriteString(html.EscapeString(strings.Repeat(n.lit, n.count)))
+	}
+	for _, tag := range n.opens {
+		b.WriteString(tag)
+	}
+}
+
+type bracket struct {
+	node  int
+	image bool
+}
+
+type inlineParser struct {
+	src   string
+	pos   int
+	depth int
+	nodes []*node
+	// текст, который еще не экранирован и не стал узлом
+	text     []byte
+	brackets []bracket
+	// "[" ниже этого места в стеке уже не откроют ссылку: ссылка в ссылке не бывает. Картинки при этом
+	// открыть можно, images - сколько их "![" сейчас в стеке
+	noLinksBelow int
+	images       int
+	// ряды обратных кавычек: длина -> позиции по возрастанию, см. codeSpan
+	ticks map[int][]int
+}
+
+func renderInline(s string, depth int) string {
+	p := &inlineParser{src: s, depth: depth}
+	p.parse()
+	p.processEmphasis(0)
+	var b strings.Builder
+	for _, n := range p.nodes {
+		n.write(&b)
+	}
+	return b.String()
+}
+
+func (p *inlineParser) parse() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\\':
+			p.backslash()
+		case c == '`':
+			p.codeSpan()
+		case c == '*' || c == '_' || c == '~':
+			p.delimRun(c)
+		case c == '[':
+			p.openBracket(false, 1)
+		case c == '!' && p.peek(1) == '[' && p.images < maxNesting:
+			p.openBracket(true, 2)
+		case c == '!' && p.peek(1) == '<':
+			p.addDelim(&node{delim: '!', lit: "!<", count: 1, orig: 1, canClose: true})
+			p.pos += 2
+		case c == '>' && p.peek(1) == '!':
+			p.addDelim(&node{delim: '!', lit: ">!", count: 1, orig: 1, canOpen: true})
+			p.pos += 2
+		case c == ']':
+			p.closeBracket()
+		case c == '<':
+			p.angle()
+		case c == '&':
+			p.entity()
+		case c == '^':
+			p.superscript()
+		case c == '\n':
+			p.lineBreak()
+		case p.wordStart() && p.autolink():
+		default:
+			p.text = append(p.text, c)
+			p.pos++
+		}
+	}
+	p.flush()
+}
+
+func (p *inlineParser) peek(k int) byte {
+	if p.pos+k < len(p.src) {
+		return p.src[p.pos+k]
+	}
+	return 0
+}
+
+func (p *inlineParser) flush() {
+	if len(p.text) > 0 {
+		p.nodes = append(p.nodes, &node{html: html.EscapeString(string(p.text))})
+		p.text = p.text[:0]
+	}
+}
+
+func (p *inlineParser) addHTML(s string) {
+	p.flush()
+	p.nodes = append(p.nodes, &node{html: s})
+}
+
+func (p *inlineParser) addDelim(n *node) {
+	p.flush()
+	p.nodes = append(p.nodes, n)
+}
+
+func (p *inlineParser) literal(n int) {
+	p.text = append(p.text, p.src[p.pos:p.pos+n]...)
+	p.pos += n
+}
+
+func (p *inlineParser) backslash() {
+	switch next := p.peek(1); {
+	case isPunct(next):
+		p.text = append(p.text, next)
+		p.pos += 2
+	case next == '\n':
+		p.addHTML("<br>\n")
+		p.pos += 2
+	default:
+		p.literal(1)
+	}
+}
+
+func (p *inlineParser) lineBreak() {
+	spaces := 0
+	for len(p.text) > 0 && p.text[len(p.text)-1] == ' ' {
+		p.text = p.text[:len(p.text)-1]
+		spaces++
+	}
+	if spaces >= 2 {
+		p.addHTML("<br>\n")
+	} else {
+		p.text = append(p.text, '\n')
+	}
+	p.pos++
+}
+
+// codeSpan - `код`: закрывается рядом обратных кавычек той же длины. Ряды ищутся один раз на всю строку,
+// иначе строка из сотен непарных кавычек разбиралась бы за квадрат
+func (p *inlineParser) codeSpan() {
+	n := runLength(p.src, p.pos, '`')
+	if p.ticks == nil {
+		p.ticks = make(map[int][]int)
+		for i := 0; i < len(p.src); {
+			if p.src[i] != '`' {
+				i++
+				continue
+			}
+			size := runLength(p.src, i, '`')
+			p.ticks[size] = append(p.ticks[size], i)
+			i += size
+		}
+	}
+	positions := p.ticks[n]
+	k := sort.SearchInts(positions, p.pos+n)
+	if k == len(positions) {
+		p.literal(n)
+		return
+	}
+	end := positions[k]
+	code := strings.ReplaceAll(p.src[p.pos+n:end], "\n", " ")
+	if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+		code = code[1 : len(code)-1]
+	}
+	p.addHTML("<code>" + html.EscapeString(code) + "</code>")
+	p.pos = end + n
+}
+
+// delimRun - ряд *, _ или ~. Может ли он открывать и закрывать выделение, решают правила CommonMark
+// про соседние пробелы и пунктуацию
+func (p *inlineParser) delimRun(c byte) {
+	start := p.pos
+	n := runLength(p.src, start, c)
+	// зачеркивание - только ровно две тильды
+	if c == '~' && n != 2 {
+		p.literal(n)
+		return
+	}
+	p.pos += n
+	before, after := prevRune(p.src, start), nextRune(p.src, p.pos)
+	left := !unicode.IsSpace(after) && (!isPunctRune(after) || unicode.IsSpace(before) || isPunctRune(before))
+	right := !unicode.IsSpace(before) && (!isPunctRune(before) || unicode.IsSpace(after) || isPunctRune(after))
+	canOpen, canClose := left, right
+	// snake_case_words не курсив
+	if c == '_' {
+		canOpen = left && (!right || isPunctRune(before))
+		canClose = right && (!left || isPunctRune(after))
+	}
+	p.addDelim(&node{delim: c, lit: string(c), count: n, orig: n, canOpen: canOpen, canClose: canClose})
+}
+
+func (p *inlineParser) openBracket(image bool, n int) {
+	p.addHTML(html.EscapeString(p.src[p.pos : p.pos+n]))
+	p.brackets = append(p.brackets, bracket{node: len(p.nodes) - 1, image: image})
+	if image {
+		p.images++
+	}
+	p.pos += n
+}
+
+// closeBracket - "]": если за ней "(адрес)" и есть парная "[", собираем ссылку. Картинки выводим
+// ссылкой на них - чужие картинки в тексте не грузим
+func (p *inlineParser) closeBracket() {
+	if len(p.brackets) == 0 {
+		p.literal(1)
+		return
+	}
+	opener := p.brackets[len(p.brackets)-1]
+	p.brackets = p.brackets[:len(p.brackets)-1]
+	inactive := !opener.image && len(p.brackets) < p.noLinksBelow
+	p.noLinksBelow = min(p.noLinksBelow, len(p.brackets))
+	if opener.image {
+		p.images--
+	}
+	if inactive {
+		p.literal(1)
+		return
+	}
+	dest, title, end, ok := parseLinkTail(p.src, p.pos+1)
+	if !ok {
+		p.literal(1)
+		return
+	}
+	p.flush()
+	p.pos = end
+	p.processEmphasis(opener.node + 1)
+	for _, n := range p.nodes[opener.node+1:] {
+		if n.link {
+			n.html, n.link = n.linkText, false
+		}
+	}
+	if safeURL(dest) {
+		p.nodes[opener.node] = &node{html: openLink(dest, title), link: true}
+		p.nodes = append(p.nodes, &node{html: "</a>", link: true})
+	} else {
+		// небезопасная ссылка - остается только ее текст
+		p.nodes[opener.node] = &node{}
+	}
+	if !opener.image {
+		p.noLinksBelow = len(p.brackets)
+	}
+}
+
+// parseLinkTail разбирает "(адрес "заголовок")" начиная с s[i]. end - позиция сразу после ")"
+func parseLinkTail(s string, i int) (dest, title string, end int, ok bool) {
+	if i >= len(s) || s[i] != '(' {
+		return "", "", 0, false
+	}
+	i = skipSpace(s, i+1)
+	if i < len(s) && s[i] == '<' {
+		j := i + 1
+		for ; j < len(s) && s[j] != '>' && s[j] != '<' && s[j] != '\n' && j-i <= maxURLLength; j++ {
+			if s[j] == '\\' && j+1 < len(s) {
+				j++
+			}
+		}
+		if j >= len(s) || s[j] != '>' {
+			return "", "", 0, false
+		}
+		dest, i = s[i+1:j], j+1
+	} else {
+		j, parens := i, 0
+		for ; j < len(s); j++ {
+			c := s[j]
+			if j-i > maxURLLength {
+				return "", "", 0, false
+			}
+			if c == '\\' && j+1 < len(s) && isPunct(s[j+1]) {
+				j++
+				continue
+			}
+			if c <= ' ' || c == 0x7f {
+				break
+			}
+			if c == '(' {
+				parens++
+			}
+			if c == ')' {
+				if parens == 0 {
+					break
+				}
+				parens--
+			}
+		}
+		if parens != 0 {
+			return "", "", 0, false
+		}
+		dest, i = s[i:j], j
+	}
+	j := skipSpace(s, i)
+	if j > i && j < len(s) && (s[j] == '"' || s[j] == '\'' || s[j] == '(') {
+		closing := s[j]
+		if closing == '(' {
+			closing = ')'
+		}
+		k := j + 1
+		for ; k < len(s) && s[k] != closing && k-j <= maxURLLength; k++ {
+			if s[k] == '\\' && k+1 < len(s) {
+				k++
+			}
+		}
+		if k >= len(s) || s[k] != closing {
+			return "", "", 0, false
+		}
+		title, j = s[j+1:k], skipSpace(s, k+1)
+	}
+	if j >= len(s) || s[j] != ')' {
+		return "", "", 0, false
+	}
+	return unescape(dest), unescape(title), j + 1, true
+}
+
+// unescape снимает экранирование \ и HTML-сущности в адресе и заголовке ссылки
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') != -1 {
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]) {
+				i++
+			}
+			b.WriteByte(s[i])
+		}
+		s = b.String()
+	}
+	return html.UnescapeString(s)
+}
+
+// angle - "<": автоссылка <https://...> или <mail@host>, иначе просто символ. Теги из текста не пропускаем
+func (p *inlineParser) angle() {
+	rest := p.src[p.pos:]
+	if m := autolinkRe.FindStringSubmatch(rest); m != nil && safeURL(m[1]) {
+		p.addLink(m[1], m[1])
+		p.pos += len(m[0])
+		return
+	}
+	if m := emailRe.FindStringSubmatch(rest); m != nil {
+		p.addLink("mailto:"+m[1], m[1])
+		p.pos += len(m[0])
+		return
+	}
+	p.literal(1)
+}
+
+func (p *inlineParser) entity() {
+	if m := entityRe.FindString(p.src[p.pos:]); m != "" {
+		if decoded := html.UnescapeString(m); decoded != m {
+			p.text = append(p.text, decoded...)
+			p.pos += len(m)
+			return
+		}
+	}
+	p.literal(1)
+}
+
+// superscript - ^слово до пробела или ^(текст до парной скобки)
+func (p *inlineParser) superscript() {
+	start := p.pos + 1
+	if p.depth >= maxNesting {
+		p.literal(1)
+		return
+	}
+	if p.peek(1) == '(' {
+		parens := 0
+		for j := start; j < len(p.src) && p.src[j] != '\n' && j-start <= maxURLLength; j++ {
+			switch p.src[j] {
+			case '(':
+				parens++
+			case ')':
+				parens--
+			}
+			if parens == 0 {
+				p.addHTML("<sup>" + renderInline(p.src[start+1:j], p.depth+1) + "</sup>")
+				p.pos = j + 1
+				return
+			}
+		}
+		p.literal(1)
+		return
+	}
+	end := start
+	for end < len(p.src) && p.src[end] != ' ' && p.src[end] != '\t' && p.src[end] != '\n' {
+		end++
+	}
+	if end == start {
+		p.literal(1)
+		return
+	}
+	p.addHTML("<sup>" + renderInline(p.src[start:end], p.depth+1) + "</sup>")
+	p.pos = end
+}
+
+// wordStart - здесь может начаться голая ссылка, u/ или r/: не посреди слова и не внутри пути
+func (p *inlineParser) wordStart() bool {
+	switch p.src[p.pos] {
+	case 'h', 'u', 'r', '/':
+	default:
+		return false
+	}
+	prev := prevRune(p.src, p.pos)
+	return !unicode.IsLetter(prev) && !unicode.IsDigit(prev) && prev != '_' && prev != '/'
+}
+
+func (p *inlineParser) autolink() bool {
+	rest := p.src[p.pos:]
+	if rest[0] == 'h' {
+		raw := bareURLRe.FindString(rest)
+		m := trimURL(raw)
+		if m == "" {
+			return false
+		}
+		// слишком длинный или кривой адрес - весь текстом, чтобы не разбирать его заново с каждого "http" внутри
+		if !safeURL(m) {
+			p.literal(len(raw))
+			return true
+		}
+		p.addLink(m, m)
+		p.pos += len(m)
+		return true
+	}
+	// сообщества на фронте живут по /a/, см. static
+	if m := userLinkRe.FindStringSubmatch(rest); m != nil && len(m[1]) <= 32 {
+		p.addLink("/u/"+m[1], m[0])
+		p.pos += len(m[0])
+		return true
+	}
+	if m := communityLink.FindStringSubmatch(rest); m != nil && len(m[1]) >= 3 && len(m[1]) <= 21 {
+		p.addLink("/a/"+m[1], m[0])
+		p.pos += len(m[0])
+		return true
+	}
+	return false
+}
+
+// trimURL - точка в конце предложения и закрывающая скобка вокруг ссылки в адрес не входят
+func trimURL(u string) string {
+	opened, closed := strings.Count(u, "("), strings.Count(u, ")")
+	for len(u) > 0 {
+		switch last := u[len(u)-1]; {
+		case strings.IndexByte(".,:;!?'*_~", last) != -1:
+		case last == ')' && closed > opened:
+			closed--
+		default:
+			return u
+		}
+		u = u[:len(u)-1]
+	}
+	return u
+}
+
+func (p *inlineParser) addLink(href, text string) {
+	escaped := html.EscapeString(text)
+	p.flush()
+	p.nodes = append(p.nodes, &node{html: openLink(href, "") + escaped + "</a>", link: true, linkText: escaped})
+}
+
+// openLink - <a>. Внешним ссылкам rel="nofollow ugc": ссылки пишут юзеры, и поисковикам это стоит знать
+func openLink(href, title string) string {
+	var b strings.Builder
+	b.WriteString(`<a href="` + html.EscapeString(href) + `"`)
+	if title != "" {
+		b.WriteString(` title="` + html.EscapeString(title) + `"`)
+	}
+	if u, err := url.Parse(href); err == nil && (u.Scheme != "" || strings.HasPrefix(href, "//")) {
+		b.WriteString(` rel="nofollow ugc"`)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// processEmphasis - алгоритм разделителей из CommonMark: каждому закрывающему ряду ищем ближайший
+// подходящий открывающий ниже по стеку, начиная с узла bottom. Стек - двусвязный список: использованные
+// разделители и все, что оказалось между парой, из него выкидываются, а openersBottom запоминает, ниже чего
+// для такого вида закрывающих искать уже бесполезно. Иначе ">!>!>!...!<!<!<" разбирался бы за квадрат
+func (p *inlineParser) processEmphasis(bottom int) {
+	var stack []int
+	for i := bottom; i < len(p.nodes); i++ {
+		if n := p.nodes[i]; n.delim != 0 && (n.canOpen || n.canClose) {
+			stack = append(stack, i)
+		}
+	}
+	prev, next := make([]int, len(stack)), make([]int, len(stack))
+	for k := range stack {
+		prev[k], next[k] = k-1, k+1
+	}
+	unlink := func(k int) {
+		if prev[k] >= 0 {
+			next[prev[k]] = next[k]
+		}
+		if next[k] < len(stack) {
+			prev[next[k]] = prev[k]
+		}
+	}
+
+	openersBottom := make(map[int]int)
+	for k := 0; k < len(stack); k = next[k] {
+		closer := p.nodes[stack[k]]
+		if !closer.canClose {
+			continue
+		}
+		for closer.count > 0 {
+			key := int(closer.delim)<<3 | closer.orig%3<<1
+			if closer.canOpen {
+				key |= 1
+			}
+			floor, ok := openersBottom[key]
+			if !ok {
+				floor = -1
+			}
+			o := -1
+			for j := prev[k]; j > floor; j = prev[j] {
+				if n := p.nodes[stack[j]]; n.delim == closer.delim && n.canOpen && pairs(n, closer) {
+					o = j
+					break
+				}
+			}
+			if o < 0 {
+				openersBottom[key] = prev[k]
+				if !closer.canOpen {
+					unlink(k)
+				}
+				break
+			}
+			opener := p.nodes[stack[o]]
+			n := 1
+			if opener.count >= 2 && closer.count >= 2 {
+				n = 2
+			}
+			open, closeTag := emphasisTags(closer.delim, n)
+			opener.opens = append([]string{open}, opener.opens...)
+			closer.closes = append(closer.closes, closeTag)
+			opener.count -= n
+			closer.count -= n
+			// разделители между парой остаются текстом
+			next[o], prev[k] = k, o
+			if opener.count == 0 {
+				unlink(o)
+			}
+		}
+		if closer.count == 0 {
+			unlink(k)
+		}
+	}
+	// оставшиеся разделители больше никого не закрывают: текст ссылки вокруг них уже собран
+	for _, n := range p.nodes[bottom:] {
+		n.canOpen, n.canClose = false, false
+	}
+}
+
+func pairs(opener, closer *node) bool {
+	switch closer.delim {
+	case '~':
+		return opener.count == 2 && closer.count == 2
+	case '!':
+		return true
+	}
+	// правило трех из CommonMark: в "*foo**bar*" середина не закрывает
+	if (opener.canClose || closer.canOpen) && (opener.orig+closer.orig)%3 == 0 &&
+		!(opener.orig%3 == 0 && closer.orig%3 == 0) {
+		return false
+	}
+	return true
+}
+
+func emphasisTags(delim byte, n int) (string, string) {
+	switch {
+	case delim == '~':
+		return "<del>", "</del>"
+	case delim == '!':
+		return `<span class="` + spoilerClass + `">`, "</span>"
+	case n == 2:
+		return "<strong>", "</strong>"
+	}
+	return "<em>", "</em>"
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// prevRune и nextRune - соседи ряда разделителей, край строки считается пробелом
+func prevRune(s string, i int) rune {
+	if i == 0 {
+		return ' '
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return r
+}
+
+func nextRune(s string, i int) rune {
+	if i >= len(s) {
+		return ' '
+	}
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return r
+}
+
+func isPunct(c byte) bool {
+	return c != 0 && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) != -1
+}
+
+func isPunctRune(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
@@ -0,0 +1,473 @@
+// Package markdown переводит тексты постов и комментов в HTML. Поддерживается подмножество CommonMark:
+// абзацы, заголовки, цитаты, списки, код, ссылки, выделение - и расширения реддита: спойлеры >!...!<,
+// верхний индекс ^слово и ^(несколько слов), зачеркивание ~~...~~, ссылки u/юзер и r/сообщество.
+// Сырой HTML из исходника не пропускается никогда - он выводится текстом, а готовый результат
+// еще раз проходит через Sanitize
+package markdown
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+const (
+	// глубже вложенные цитаты, списки и ^(...) разбираются как обычный текст, чтобы злой ввод не уводил рекурсию вглубь
+	maxNesting = 16
+	// длиннее ссылки выводим текстом
+	maxURLLength = 2048
+	tabWidth     = 4
+)
+
+// Render - Markdown в HTML, который можно вставлять на страницу как есть
+func Render(source string) string {
+	source = strings.ToValidUTF8(source, "�")
+	source = strings.ReplaceAll(source, "\x00", "�")
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	if strings.Trim(source, " \t\n") == "" {
+		return ""
+	}
+	lines := strings.Split(source, "\n")
+	for i, line := range lines {
+		lines[i] = expandIndent(line)
+	}
+	var b strings.Builder
+	renderBlocks(&b, parseBlocks(lines, 0), false)
+	return Sanitize(b.String())
+}
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	headingBlock
+	quoteBlock
+	listBlock
+	codeBlock
+	ruleBlock
+)
+
+type block struct {
+	kind blockKind
+	// абзац и заголовок - строка Markdown, код - как есть
+	text  string
+	level int
+	// содержимое цитаты
+	children []*block
+	// пункты списка
+	items   [][]*block
+	ordered bool
+	start   int
+	// между пунктами были пустые строки - абзацы в пунктах оборачиваются в <p>
+	loose bool
+}
+
+func parseBlocks(lines []string, depth int) []*block {
+	var blocks []*block
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if isBlank(line) {
+			i++
+			continue
+		}
+		indent := indentOf(line)
+		rest := line[indent:]
+		var b *block
+		n := 1
+		switch {
+		case indent >= 4:
+			b, n = parseIndentedCode(lines[i:])
+		case isFence(rest):
+			b, n = parseFence(lines[i:], indent)
+		case headingLevel(rest) > 0:
+			b = parseHeading(rest)
+		case isRule(rest):
+			b = &block{kind: ruleBlock}
+		case depth < maxNesting && isQuote(rest):
+			b, n = parseQuote(lines[i:], depth)
+		case depth < maxNesting && isListItem(rest):
+			b, n = parseList(lines[i:], depth)
+		default:
+			b, n = parseParagraph(lines[i:], depth)
+		}
+		blocks = append(blocks, b)
+		i += n
+	}
+	return blocks
+}
+
+func parseParagraph(lines []string, depth int) (*block, int) {
+	text := []string{strings.TrimLeft(lines[0], " ")}
+	n := 1
+	for ; n < len(lines); n++ {
+		line := lines[n]
+		if isBlank(line) {
+			break
+		}
+		if indent := indentOf(line); indent < 4 {
+			rest := line[indent:]
+			if level := setextLevel(rest); level > 0 {
+				return &block{kind: headingBlock, level: level, text: joinParagraph(text)}, n + 1
+			}
+			if interrupts(rest, depth) {
+				break
+			}
+		}
+		text = append(text, strings.TrimLeft(line, " "))
+	}
+	return &block{kind: paragraphBlock, text: joinParagraph(text)}, n
+}
+
+func joinParagraph(lines []string) string {
+	return strings.TrimRight(strings.Join(lines, "\n"), " \t")
+}
+
+// interrupts - строка начинает новый блок и обрывает абзац. Список обрывает абзац, только если пункт не пустой,
+// а нумерация с единицы - иначе "2024. был годом" в середине абзаца стал бы списком
+func interrupts(s string, depth int) bool {
+	if isFence(s) || headingLevel(s) > 0 || isRule(s) {
+		return true
+	}
+	if depth >= maxNesting {
+		return false
+	}
+	if isQuote(s) {
+		return true
+	}
+	m, ok := listMarker(s)
+	return ok && !m.empty && (!m.ordered || m.start == 1)
+}
+
+// headingLevel - уровень ATX-заголовка "# ...", 0 - не заголовок
+func headingLevel(s string) int {
+	n := 0
+	for n < len(s) && s[n] == '#' {
+		n++
+	}
+	if n == 0 || n > 6 || (n < len(s) && s[n] != ' ' && s[n] != '\t') {
+		return 0
+	}
+	return n
+}
+
+func parseHeading(s string) *block {
+	level := headingLevel(s)
+	text := strings.Trim(s[level:], " \t")
+	// закрывающие # убираем, только если они отделены пробелом: "C#" остается как есть
+	if t := strings.TrimRight(text, "#"); t == "" || strings.HasSuffix(t, " ") || strings.HasSuffix(t, "\t") {
+		text = strings.TrimRight(t, " \t")
+	}
+	return &block{kind: headingBlock, level: level, text: text}
+}
+
+// setextLevel - подчеркивание заголовка под абзацем: "===" - h1, "---" - h2
+func setextLevel(s string) int {
+	s = strings.TrimRight(s, " \t")
+	switch {
+	case s == "":
+		return 0
+	case strings.Trim(s, "=") == "":
+		return 1
+	case strings.Trim(s, "-") == "":
+		return 2
+	}
+	return 0
+}
+
+func isRule(s string) bool {
+	var mark byte
+	count := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+		case (c == '-' || c == '*' || c == '_') && (mark == 0 || mark == c):
+			mark = c
+			count++
+		default:
+			return false
+		}
+	}
+	return count >= 3
+}
+
+// fence - открывающий забор кода ``` или ~~~: символ и длина
+func fence(s string) (byte, int) {
+	if len(s) < 3 || (s[0] != '`' && s[0] != '~') {
+		return 0, 0
+	}
+	c, n := s[0], 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	if n < 3 || (c == '`' && strings.IndexByte(s[n:], '`') != -1) {
+		return 0, 0
+	}
+	return c, n
+}
+
+func isFence(s string) bool {
+	_, n := fence(s)
+	return n > 0
+}
+
+func parseFence(lines []string, indent int) (*block, int) {
+	mark, size := fence(lines[0][indent:])
+	var code []string
+	n := 1
+	for ; n < len(lines); n++ {
+		line := lines[n]
+		if li := indentOf(line); li < 4 && isClosingFence(line[li:], mark, size) {
+			n++
+			break
+		}
+		code = append(code, stripIndent(line, indent))
+	}
+	return &block{kind: codeBlock, text: strings.Join(code, "\n")}, n
+}
+
+func isClosingFence(s string, mark byte, size int) bool {
+	n := 0
+	for n < len(s) && s[n] == mark {
+		n++
+	}
+	return n >= size && strings.Trim(s[n:], " \t") == ""
+}
+
+func parseIndentedCode(lines []string) (*block, int) {
+	var code []string
+	n := 0
+	for ; n < len(lines); n++ {
+		if !isBlank(lines[n]) && indentOf(lines[n]) < 4 {
+			break
+		}
+		code = append(code, stripIndent(lines[n], 4))
+	}
+	// пустые строки после кода - уже не код
+	for len(code) > 0 && isBlank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+	return &block{kind: codeBlock, text: strings.Join(code, "\n")}, n
+}
+
+// isQuote - строка цитаты. ">!" в начале - это спойлер реддита, а не цитата
+func isQuote(s string) bool {
+	return strings.HasPrefix(s, ">") && !strings.HasPrefix(s, ">!")
+}
+
+func parseQuote(lines []string, depth int) (*block, int) {
+	var inner []string
+	n := 0
+	for ; n < len(lines); n++ {
+		line := lines[n]
+		if isBlank(line) {
+			break
+		}
+		indent := indentOf(line)
+		rest := line[indent:]
+		if indent < 4 && isQuote(rest) {
+			rest = strings.TrimPrefix(rest[1:], " ")
+			inner = append(inner, rest)
+			continue
+		}
+		// строка без ">" продолжает абзац цитаты, если сама не начинает новый блок
+		if isBlank(inner[len(inner)-1]) || interrupts(rest, depth) {
+			break
+		}
+		inner = append(inner, rest)
+	}
+	return &block{kind: quoteBlock, children: parseBlocks(inner, depth+1)}, n
+}
+
+type marker struct {
+	ordered bool
+	// '-', '+', '*' или разделитель после номера: '.' или ')'
+	char  byte
+	start int
+	// с какой колонки начинается текст пункта, считая от маркера
+	width int
+	empty bool
+}
+
+func listMarker(s string) (marker, bool) {
+	var m marker
+	i := 0
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+' || s[0] == '*') {
+		m.char, i = s[0], 1
+	} else {
+		for i < len(s) && i < 9 && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i >= len(s) || (s[i] != '.' && s[i] != ')') {
+			return m, false
+		}
+		m.ordered = true
+		m.start, _ = strconv.Atoi(s[:i])
+		m.char = s[i]
+		i++
+	}
+	if i < len(s) && s[i] != ' ' && s[i] != '\t' {
+		return m, false
+	}
+	spaces := 0
+	for i+spaces < len(s) && s[i+spaces] == ' ' {
+		spaces++
+	}
+	m.empty = strings.Trim(s[i:], " \t") == ""
+	// больше четырех пробелов после маркера - это уже код внутри пункта
+	if spaces == 0 || spaces > 4 || m.empty {
+		spaces = 1
+	}
+	m.width = i + spaces
+	return m, true
+}
+
+func isListItem(s string) bool {
+	_, ok := listMarker(s)
+	return ok
+}
+
+func parseList(lines []string, depth int) (*block, int) {
+	first, _ := listMarker(lines[0][indentOf(lines[0]):])
+	list := &block{kind: listBlock, ordered: first.ordered, start: first.start}
+	var item []string
+	contentIndent := 0
+	afterBlank := false
+	flush := func() {
+		if item != nil {
+			list.items = append(list.items, parseBlocks(item, depth+1))
+		}
+	}
+
+	n := 0
+	for ; n < len(lines); n++ {
+		line := lines[n]
+		if isBlank(line) {
+			if item != nil {
+				item = append(item, "")
+			}
+			afterBlank = true
+			continue
+		}
+		indent := indentOf(line)
+		if item != nil && indent >= contentIndent {
+			// пустая строка между блоками одного пункта тоже делает список "свободным"
+			if afterBlank {
+				list.loose = true
+			}
+			item = append(item, line[contentIndent:])
+			afterBlank = false
+			continue
+		}
+		rest := line[indent:]
+		if m, ok := listMarker(rest); ok && indent < 4 && m.ordered == first.ordered && m.char == first.char && !isRule(rest) {
+			if item != nil && afterBlank {
+				list.loose = true
+			}
+			flush()
+			contentIndent = indent + m.width
+			item = []string{""}
+			if m.width < len(rest) {
+				item[0] = rest[m.width:]
+			}
+			afterBlank = false
+			continue
+		}
+		// ленивое продолжение абзаца пункта без отступа
+		if item != nil && !afterBlank && !interrupts(rest, depth) {
+			item = append(item, rest)
+			continue
+		}
+		break
+	}
+	flush()
+	return list, n
+}
+
+func renderBlocks(b *strings.Builder, blocks []*block, tight bool) {
+	for i, bl := range blocks {
+		switch bl.kind {
+		case paragraphBlock:
+			// в плотном списке текст пункта идет без <p>
+			if tight {
+				b.WriteString(renderInline(bl.text, 0))
+				if i < len(blocks)-1 {
+					b.WriteByte('\n')
+				}
+				continue
+			}
+			b.WriteString("<p>" + renderInline(bl.text, 0) + "</p>\n")
+		case headingBlock:
+			tag := "h" + strconv.Itoa(bl.level)
+			b.WriteString("<" + tag + ">" + renderInline(bl.text, 0) + "</" + tag + ">\n")
+		case quoteBlock:
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, bl.children, false)
+			b.WriteString("</blockquote>\n")
+		case listBlock:
+			tag := "ul"
+			if bl.ordered {
+				tag = "ol"
+			}
+			b.WriteString("<" + tag)
+			if bl.ordered && bl.start != 1 {
+				b.WriteString(` start="` + strconv.Itoa(bl.start) + `"`)
+			}
+			b.WriteString(">\n")
+			for _, item := range bl.items {
+				b.WriteString("<li>")
+				if bl.loose {
+					b.WriteByte('\n')
+				}
+				renderBlocks(b, item, !bl.loose)
+				b.WriteString("</li>\n")
+			}
+			b.WriteString("</" + tag + ">\n")
+		case codeBlock:
+			b.WriteString("<pre><code>" + html.EscapeString(bl.text))
+			if bl.text != "" {
+				b.WriteByte('\n')
+			}
+			b.WriteString("</code></pre>\n")
+		case ruleBlock:
+			b.WriteString("<hr>\n")
+		}
+	}
+}
+
+func isBlank(line string) bool {
+	return strings.Trim(line, " \t") == ""
+}
+
+func indentOf(line string) int {
+	n := 0
+	for n < len(line) && line[n] == ' ' {
+		n++
+	}
+	return n
+}
+
+func stripIndent(line string, n int) string {
+	if indent := indentOf(line); indent < n {
+		n = indent
+	}
+	return line[n:]
+}
+
+// expandIndent меняет табы в отступе строки на пробелы, дальше отступы считаются только пробелами
+func expandIndent(line string) string {
+	col, i := 0, 0
+	tabs := false
+	for ; i < len(line) && (line[i] == ' ' || line[i] == '\t'); i++ {
+		if line[i] == '\t' {
+			col += tabWidth - col%tabWidth
+			tabs = true
+		} else {
+			col++
+		}
+	}
+	if !tabs {
+		return line
+	}
+	return strings.Repeat(" ", col) + line[i:]
+}
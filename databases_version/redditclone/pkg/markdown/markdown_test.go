@@ -0,0 +1,195 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRender(t *testing.T) {
+	cases := map[string]struct {
+		source, expected string
+	}{
+		"empty":      {" \n\t", ""},
+		"paragraphs": {"one\ntwo\n\nthree", "<p>one\ntwo</p>\n<p>three</p>\n"},
+		"headings":   {"# One #\n## C#\nSetext\n---", "<h1>One</h1>\n<h2>C#</h2>\n<h2>Setext</h2>\n"},
+		"emphasis": {
+			"*em* _em_ **strong** __strong__ ***both*** ~~del~~ snake_case_word 2*3*4",
+			"<p><em>em</em> <em>em</em> <strong>strong</strong> <strong>strong</strong> <em><strong>both</strong></em> <del>del</del> snake_case_word 2<em>3</em>4</p>\n",
+		},
+		"unmatched": {"**a* ~one~ ~~~three~~~", "<p>*<em>a</em> ~one~ ~~~three~~~</p>\n"},
+		"superscript": {
+			"x^2 ^(two words) ^a^b",
+			"<p>x<sup>2</sup> <sup>two words</sup> <sup>a<sup>b</sup></sup></p>\n",
+		},
+		"spoiler":      {"so >!he *dies*!< ok", `<p>so <span class="md-spoiler">he <em>dies</em></span> ok</p>` + "\n"},
+		"spoiler line": {">!not a quote!<", `<p><span class="md-spoiler">not a quote</span></p>` + "\n"},
+		"code": {
+			"`a <b>` ``x`y``\n\n```go\nif a < b {}\n```\n\n    indented\n      more",
+			"<p><code>a &lt;b&gt;</code> <code>x`y</code></p>\n<pre><code>if a &lt; b {}\n</code></pre>\n<pre><code>indented\n  more\n</code></pre>\n",
+		},
+		"quote":      {"> one\nlazy\n> > nested", "<blockquote>\n<p>one\nlazy</p>\n<blockquote>\n<p>nested</p>\n</blockquote>\n</blockquote>\n"},
+		"tight list": {"- a\n- b\n  - c", "<ul>\n<li>a</li>\n<li>b\n<ul>\n<li>c</li>\n</ul>\n</li>\n</ul>\n"},
+		"loose list": {"3. a\n\n4. b", "<ol start=\"3\">\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n</li>\n</ol>\n"},
+		"not a list": {"In\n2024. was a year", "<p>In\n2024. was a year</p>\n"},
+		"rule":       {"a\n\n* * *\n\nb", "<p>a</p>\n<hr>\n<p>b</p>\n"},
+		"links": {
+			`[site](https://example.com "Title") [rel](/a/golang) <https://x.com> <me@mail.ru>`,
+			`<p><a href="https://example.com" title="Title" rel="nofollow ugc">site</a> <a href="/a/golang">rel</a> ` +
+				`<a href="https://x.com" rel="nofollow ugc">https://x.com</a> <a href="mailto:me@mail.ru" rel="nofollow ugc">me@mail.ru</a></p>` + "\n",
+		},
+		"bare url": {
+			"see https://example.com/a_b_(c). (https://x.com)",
+			`<p>see <a href="https://example.com/a_b_(c)" rel="nofollow ugc">https://example.com/a_b_(c)</a>. ` +
+				`(<a href="https://x.com" rel="nofollow ugc">https://x.com</a>)</p>` + "\n",
+		},
+		"users and communities": {
+			"u/bob /u/al-ice r/golang r/go me/u/no",
+			`<p><a href="/u/bob">u/bob</a> <a href="/u/al-ice">/u/al-ice</a> <a href="/a/golang">r/golang</a> r/go me/u/no</p>` + "\n",
+		},
+		"no nested links": {
+			"[r/golang ![img](/i.png)](https://x.com)",
+			`<p><a href="https://x.com" rel="nofollow ugc">r/golang img</a></p>` + "\n",
+		},
+		"link in link":  {"[a [b](/b) c](/a)", `<p>[a <a href="/b">b</a> c](/a)</p>` + "\n"},
+		"image as link": {"![cat](https://x.com/cat.png)", `<p><a href="https://x.com/cat.png" rel="nofollow ugc">cat</a></p>` + "\n"},
+		"breaks":        {"a  \nb\\\nc", "<p>a<br>\nb<br>\nc</p>\n"},
+		"entities":      {"&copy; &amp; &#60;b&#62; &nope; \\*", "<p>© &amp; &lt;b&gt; &amp;nope; *</p>\n"},
+		"raw html":      {"<b onclick=\"x\">hi</b>\n\n<script>alert(1)</script>", "<p>&lt;b onclick=&#34;x&#34;&gt;hi&lt;/b&gt;</p>\n<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		"bad links": {
+			"[a](javascript:alert(1)) [b](JaVaScRiPt&#58;alert(1)) [c](data:text/html,x) <javascript:alert(1)>",
+			"<p>a b c &lt;javascript:alert(1)&gt;</p>\n",
+		},
+	}
+	for name, c := range cases {
+		if got := Render(c.source); got != c.expected {
+			t.Errorf("%s:\nexpected %q\n     got %q", name, c.expected, got)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	cases := map[string]string{
+		`<p>ok</p><br>`: `<p>ok</p><br>`,
+		`<P>up</P>`:     `<p>up</p>`,
+		`<a href="https://x.com" rel="nofollow ugc">x</a>`: `<a href="https://x.com" rel="nofollow ugc">x</a>`,
+		`<a href="javascript:alert(1)">x</a>`:              `&lt;a href="javascript:alert(1)"&gt;x</a>`,
+		`<a href="java&#x09;script:alert(1)">x</a>`:        `&lt;a href="java&#x09;script:alert(1)"&gt;x</a>`,
+		`<a href='https://x.com'>x</a>`:                    `&lt;a href='https://x.com'&gt;x</a>`,
+		`<a href="/a" href="/b">x</a>`:                     `&lt;a href="/a" href="/b"&gt;x</a>`,
+		`<span class="evil">x</span>`:                      `&lt;span class="evil"&gt;x</span>`,
+		`<img src=x onerror=alert(1)>`:                     `&lt;img src=x onerror=alert(1)&gt;`,
+		`<p onclick="alert(1)">x</p>`:                      `&lt;p onclick="alert(1)"&gt;x</p>`,
+		`<ol start="3"><li>x</li></ol>`:                    `<ol start="3"><li>x</li></ol>`,
+		`<a title="&lt;&quot;" href="/x">x</a>`:            `<a title="&lt;&#34;" href="/x">x</a>`,
+		"a & b &amp; <br/> </br> <script>\x00":             "a &amp; b &amp; &lt;br/&gt; &lt;/br&gt; &lt;script&gt;�",
+	}
+	for input, expected := range cases {
+		if got := Sanitize(input); got != expected {
+			t.Errorf("%q:\nexpected %q\n     got %q", input, expected, got)
+		}
+	}
+}
+
+var (
+	tagRe  = regexp.MustCompile(`^<(/?)([a-z0-9]+)((?: [a-z]+="[^"<>]*")*)>`)
+	attrRe = regexp.MustCompile(` ([a-z]+)="([^"]*)"`)
+
+	safeTags = map[string]bool{
+		"p": true, "br": true, "hr": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"blockquote": true, "pre": true, "code": true, "ul": true, "ol": true, "li": true,
+		"em": true, "strong": true, "del": true, "sup": true, "a": true, "span": true,
+	}
+	safeAttrs = map[string]bool{"href": true, "title": true, "rel": true, "class": true, "start": true}
+)
+
+// checkSafe не доверяет парсеру из sanitize.go и проверяет вывод сам: каждый "<" - начало тега из списка,
+// атрибуты только разрешенные, в ссылках нет опасных схем
+func checkSafe(t *testing.T, input, out string) {
+	t.Helper()
+	if !utf8.ValidString(out) {
+		t.Fatalf("%q: invalid UTF-8 in %q", input, out)
+	}
+	for i := strings.IndexByte(out, '<'); i != -1; i = strings.IndexByte(out, '<') {
+		out = out[i:]
+		m := tagRe.FindStringSubmatch(out)
+		if m == nil || !safeTags[m[2]] {
+			t.Fatalf("%q: unexpected markup %.40q", input, out)
+		}
+		for _, attr := range attrRe.FindAllStringSubmatch(m[3], -1) {
+			if !safeAttrs[attr[1]] {
+				t.Fatalf("%q: unexpected attribute %q", input, attr[0])
+			}
+			if attr[1] != "href" {
+				continue
+			}
+			href := strings.Map(func(r rune) rune {
+				if r <= ' ' || r == 0x7f {
+					return -1
+				}
+				return r
+			}, strings.ToLower(html.UnescapeString(attr[2])))
+			for _, scheme := range []string{"javascript:", "vbscript:", "data:", "file:"} {
+				if strings.HasPrefix(href, scheme) {
+					t.Fatalf("%q: unsafe link %q", input, attr[2])
+				}
+			}
+		}
+		out = out[len(m[0]):]
+	}
+}
+
+var xssSeeds = []string{
+	"<script>alert(1)</script>",
+	"<img src=x onerror=alert(1)>",
+	"[x](javascript:alert(1))",
+	"[x](JAVASCRIPT:alert(1))",
+	"[x](java\\script:alert(1))",
+	"[x](&#106;avascript:alert(1))",
+	"[x](javascript&colon;alert(1))",
+	"[x](<javascript:alert(1)>)",
+	"[x](data:text/html;base64,PHNjcmlwdD4=)",
+	"[x](https://x.com \"\\\" onmouseover=\\\"alert(1)\")",
+	"![x](https://x.com/a.png\"onerror=\"alert(1))",
+	"<javascript:alert(1)>",
+	"<a href=\"javascript:alert(1)\">x</a>",
+	"`<script>`",
+	"&lt;script&gt;",
+	"&#60;script&#62;",
+	">!<script>!<",
+	"^(<svg onload=alert(1)>)",
+	"u/<script> r/<b>",
+	"https://x.com/\"onmouseover=alert(1)",
+	"- <b>\n  > <i>\n    ```\n    <s>\n    ```",
+	"[[[[x](/a)](/b)](/c)](javascript:alert(1))",
+	"***__~~>!^(x)!<~~__***",
+}
+
+func FuzzRender(f *testing.F) {
+	for _, seed := range xssSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, source string) {
+		out := Render(source)
+		checkSafe(t, source, out)
+		if again := Sanitize(out); again != out {
+			t.Fatalf("%q: sanitizer changed rendered output\n%q\n%q", source, out, again)
+		}
+	})
+}
+
+func FuzzSanitize(f *testing.F) {
+	for _, seed := range xssSeeds {
+		f.Add(seed)
+		f.Add(Render(seed))
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		out := Sanitize(input)
+		checkSafe(t, input, out)
+		if again := Sanitize(out); again != out {
+			t.Fatalf("%q: sanitizer is not idempotent\n%q\n%q", input, out, again)
+		}
+	})
+}
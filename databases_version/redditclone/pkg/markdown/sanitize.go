@@ -0,0 +1,176 @@
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// теги ссылок с экранированными адресом и заголовком длиннее не бывают, см. maxURLLength
+const maxTagLength = 12 * maxURLLength
+
+// allowedTags - что переживает Sanitize, с разрешенными атрибутами. Все остальное выводится текстом
+var allowedTags = map[string]map[string]bool{
+	"p": nil, "br": nil, "hr": nil,
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+	"blockquote": nil, "pre": nil, "code": nil,
+	"ul": nil, "ol": {"start": true}, "li": nil,
+	"em": nil, "strong": nil, "del": nil, "sup": nil,
+	"a":    {"href": true, "title": true, "rel": true},
+	"span": {"class": true},
+}
+
+var voidTags = map[string]bool{"br": true, "hr": true}
+
+// Sanitize оставляет в HTML только теги из allowedTags с проверенными атрибутами, остальное экранирует.
+// Render прогоняет через него свой вывод, так что ошибка в разборе Markdown не превращается в XSS
+func Sanitize(s string) string {
+	s = strings.ToValidUTF8(s, "�")
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '<':
+			if tag, n := parseTag(s[i:]); n > 0 {
+				b.WriteString(tag)
+				i += n - 1
+				continue
+			}
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '&':
+			if m := entityRe.FindString(s[i:]); m != "" {
+				b.WriteString(m)
+				i += len(m) - 1
+				continue
+			}
+			b.WriteString("&amp;")
+		case 0:
+			b.WriteString("�")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// parseTag разбирает тег в начале s и собирает его заново. n = 0 - тег не разрешен или записан не так,
+// как его пишет Render: атрибуты только в двойных кавычках, без повторов
+func parseTag(s string) (string, int) {
+	if len(s) > maxTagLength {
+		s = s[:maxTagLength]
+	}
+	i, closing := 1, false
+	if i < len(s) && s[i] == '/' {
+		i, closing = 2, true
+	}
+	start := i
+	for i < len(s) && isAlnum(s[i]) {
+		i++
+	}
+	name := strings.ToLower(s[start:i])
+	attrs, ok := allowedTags[name]
+	if !ok {
+		return "", 0
+	}
+	if closing {
+		if voidTags[name] || i >= len(s) || s[i] != '>' {
+			return "", 0
+		}
+		return "</" + name + ">", i + 1
+	}
+
+	var b strings.Builder
+	b.WriteString("<" + name)
+	seen := make(map[string]bool)
+	for {
+		j := i
+		for j < len(s) && (s[j] == ' ' || s[j] == '\t' || s[j] == '\n') {
+			j++
+		}
+		if j >= len(s) {
+			return "", 0
+		}
+		if s[j] == '>' {
+			b.WriteByte('>')
+			return b.String(), j + 1
+		}
+		// атрибуты отделяются пробелом
+		if j == i {
+			return "", 0
+		}
+		k := j
+		for k < len(s) && (isAlnum(s[k]) || s[k] == '-') {
+			k++
+		}
+		attr := strings.ToLower(s[j:k])
+		if !attrs[attr] || seen[attr] || k+1 >= len(s) || s[k] != '=' || s[k+1] != '"' {
+			return "", 0
+		}
+		end := strings.IndexByte(s[k+2:], '"')
+		if end < 0 {
+			return "", 0
+		}
+		// браузер снимет сущности перед тем, как переходить по ссылке, - проверяем то же, что увидит он
+		value := html.UnescapeString(s[k+2 : k+2+end])
+		if !allowedValue(attr, value) {
+			return "", 0
+		}
+		seen[attr] = true
+		b.WriteString(" " + attr + `="` + html.EscapeString(value) + `"`)
+		i = k + 2 + end + 1
+	}
+}
+
+func allowedValue(attr, value string) bool {
+	switch attr {
+	case "href":
+		return safeURL(value)
+	case "rel":
+		return value == "nofollow ugc"
+	case "class":
+		return value == spoilerClass
+	case "start":
+		n, err := strconv.Atoi(value)
+		return err == nil && n >= 0 && len(value) <= 9 && strconv.Itoa(n) == value
+	case "title":
+		for _, r := range value {
+			if (r < ' ' && r != '\n' && r != '\t') || r == 0x7f {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// safeURL - ссылки только на http(s), почту и относительные пути. Пробелы и управляющие символы не пускаем
+// вовсе: браузер выкидывает их из схемы, и "java\tscript:" для него - тот же javascript:
+func safeURL(raw string) bool {
+	if raw == "" || len(raw) > maxURLLength {
+		return false
+	}
+	for _, r := range raw {
+		if r <= ' ' || r == 0x7f || r == unicode.ReplacementChar || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto", "":
+		return true
+	}
+	return false
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,247 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"net/http"
+
+	// декодер регистрируется импортом
+	_ "image/png"
+)
+
+// Image - проверенная загрузка: метаданные вырезаны, миниатюра готова
+type Image struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+	Thumbnail   []byte
+}
+
+// Process проверяет загруженный файл по содержимому, а не по имени и заголовкам клиента,
+// и вырезает метаданные: в EXIF фоток с телефона лежат координаты
+func Process(data []byte) (*Image, error) {
+	if len(data) > MaxUpload {
+		return nil, ErrTooLarge
+	}
+	img := &Image{ContentType: http.DetectContentType(data)}
+	var err error
+	switch img.ContentType {
+	case "image/jpeg":
+		img.Ext = "jpg"
+		img.Data, err = stripJPEG(data)
+	case "image/png":
+		img.Ext = "png"
+		img.Data, err = stripPNG(data)
+	case "image/gif":
+		img.Ext = "gif"
+		img.Data, err = stripGIF(data)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, img.ContentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	img.Width, img.Height = config.Width, config.Height
+	if img.Thumbnail, err = Thumbnail(img.Data, ThumbnailSize); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// stripJPEG выкидывает сегменты с метаданными без перекодирования: APP1 (EXIF, XMP), APP13 (IPTC),
+// комментарии и прочие APPn. Оставляет JFIF, ICC-профиль и Adobe APP14 - без них поедут цвета.
+// Поворот из EXIF теряется вместе с ним
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrUnsupported
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	for i := 2; ; {
+		if i+1 >= len(data) || data[i] != 0xFF {
+			return nil, fmt.Errorf("%w: broken jpeg", ErrUnsupported)
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// заполнитель перед маркером
+			i++
+			continue
+		case marker == 0xD9:
+			// EOI, хвост после картинки тоже не нужен: туда телефоны дописывают вторые кадры со своим EXIF
+			out.Write(data[i : i+2])
+			return out.Bytes(), nil
+		case marker >= 0xD0 && marker <= 0xD7 || marker == 0x01:
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return nil, fmt.Errorf("%w: broken jpeg", ErrUnsupported)
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, fmt.Errorf("%w: broken jpeg", ErrUnsupported)
+		}
+		if marker == 0xDA {
+			// за SOS идут сжатые данные до следующего маркера, в progressive таких сканов несколько
+			out.Write(data[i:end])
+			i = scanEnd(data, end)
+			out.Write(data[end:i])
+			continue
+		}
+		if keepJPEGSegment(marker, data[i+4:end]) {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+}
+
+// scanEnd - где кончаются сжатые данные: внутри них 0xFF бывает только как FF00 и рестарт-маркеры
+func scanEnd(data []byte, i int) int {
+	for ; i+1 < len(data); i++ {
+		if data[i] != 0xFF {
+			continue
+		}
+		if next := data[i+1]; next != 0x00 && (next < 0xD0 || next > 0xD7) {
+			return i
+		}
+		i++
+	}
+	return len(data)
+}
+
+func keepJPEGSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == 0xE0 || marker == 0xEE:
+		return true
+	case marker == 0xE2:
+		return bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case marker >= 0xE1 && marker <= 0xEF, marker == 0xFE:
+		return false
+	}
+	return true
+}
+
+// pngKeep - чанки, нужные для отрисовки, вместе с анимацией APNG. Текст, eXIf и время - выкидываем
+var pngKeep = map[string]bool{
+	"IHDR": true, "PLTE": true, "IDAT": true, "IEND": true,
+	"tRNS": true, "gAMA": true, "cHRM": true, "sRGB": true, "iCCP": true, "sBIT": true, "bKGD": true, "pHYs": true,
+	"acTL": true, "fcTL": true, "fdAT": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, ErrUnsupported
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.WriteString(signature)
+	for i := len(signature); ; {
+		if i+8 > len(data) {
+			return nil, fmt.Errorf("%w: broken png", ErrUnsupported)
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if end > len(data) || end < i {
+			return nil, fmt.Errorf("%w: broken png", ErrUnsupported)
+		}
+		chunk := string(data[i+4 : i+8])
+		if pngKeep[chunk] {
+			out.Write(data[i:end])
+		}
+		if chunk == "IEND" {
+			return out.Bytes(), nil
+		}
+		i = end
+	}
+}
+
+// stripGIF перекодирует анимацию: комментарии и XMP в расширениях энкодер не пишет
+func stripGIF(data []byte) ([]byte, error) {
+	config, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	var out bytes.Buffer
+	if err := gif.EncodeAll(&out, g); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Thumbnail ужимает картинку так, чтобы большая сторона была не больше size, и отдает jpeg.
+// Маленькие не растягивает, но все равно перекодирует: чужой файл как есть не отдаем
+func Thumbnail(data []byte, size int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	width, height := config.Width, config.Height
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, downscale(src, width, height), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// downscale - усреднение по прямоугольнику исходных пикселей, попадающих в пиксель миниатюры.
+// Для уменьшения этого хватает, x/image ради одной функции не тянем
+func downscale(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// прозрачное кладем на белый фон: в jpeg альфы нет
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					b += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: 0xff})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,85 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+const (
+	// MaxUpload - больше не принимаем, да и в память целиком файл читается только до этого размера
+	MaxUpload = 10 << 20
+	// больше пикселей не декодируем: маленький png может развернуться в гигабайты памяти
+	MaxPixels     = 40_000_000
+	ThumbnailSize = 320
+	// URLPrefix - откуда файлы раздаются, см. handlers.PostHandler.ServeMedia
+	URLPrefix = "/media/"
+	// CacheControl - ключи случайные и файл под ключом не меняется, так что кешировать можно сколько угодно
+	CacheControl = "public, max-age=31536000, immutable"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported media type")
+	ErrTooLarge    = errors.New("file is too large")
+	ErrNotFound    = errors.New("blob not found")
+	ErrBadKey      = errors.New("bad blob key")
+)
+
+// Media - загруженный файл image-поста и его миниатюра
+type Media struct {
+	Key          string `json:"-" bson:"key"`
+	ThumbnailKey string `json:"-" bson:"thumbnail_key"`
+	URL          string `json:"url" bson:"url"`
+	ThumbnailURL string `json:"thumbnailUrl" bson:"thumbnail_url"`
+	ContentType  string `json:"contentType" bson:"content_type"`
+	Width        int    `json:"width" bson:"width"`
+	Height       int    `json:"height" bson:"height"`
+	Size         int    `json:"size" bson:"size"`
+}
+
+type Blob struct {
+	Data        []byte
+	ContentType string
+}
+
+// BlobStore - где лежат файлы: локальная папка или S3-совместимое хранилище
+type BlobStore interface {
+	Put(ctx context.Context, key string, blob Blob) error
+	// Get отдает ErrNotFound, если файла нет
+	Get(ctx context.Context, key string) (Blob, error)
+	// Delete несуществующего файла - не ошибка
+	Delete(ctx context.Context, key string) error
+}
+
+// ключи генерим сами, так что ничего похожего на путь в них быть не может
+var keyRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+\.(jpg|png|gif)$`)
+
+func ValidKey(key string) bool {
+	return keyRe.MatchString(key)
+}
+
+// Save кладет картинку и миниатюру под ключами от id. Если миниатюра не записалась, убирает и картинку
+func Save(ctx context.Context, blobs BlobStore, id string, img *Image) (*Media, error) {
+	m := &Media{
+		Key:          id + "." + img.Ext,
+		ThumbnailKey: id + "_thumb.jpg",
+		ContentType:  img.ContentType,
+		Width:        img.Width,
+		Height:       img.Height,
+		Size:         len(img.Data),
+	}
+	m.URL, m.ThumbnailURL = URLPrefix+m.Key, URLPrefix+m.ThumbnailKey
+	if err := blobs.Put(ctx, m.Key, Blob{Data: img.Data, ContentType: img.ContentType}); err != nil {
+		return nil, err
+	}
+	if err := blobs.Put(ctx, m.ThumbnailKey, Blob{Data: img.Thumbnail, ContentType: "image/jpeg"}); err != nil {
+		_ = blobs.Delete(ctx, m.Key)
+		return nil, err
+	}
+	return m, nil
+}
+
+// Delete убирает оба файла, даже если первый не удалился
+func Delete(ctx context.Context, blobs BlobStore, m *Media) error {
+	return errors.Join(blobs.Delete(ctx, m.Key), blobs.Delete(ctx, m.ThumbnailKey))
+}
@@ -0,0 +1,49 @@
+package notification
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	cases := map[string][]string{
+		"hi u/bob and /u/al-ice":           {"bob", "al-ice"},
+		"(u/bob), u/Bob u/bob":             {"bob"},
+		"me/u/no xu/no a//u/no":            nil,
+		"u/" + strings.Repeat("a", 33):     nil,
+		"просто текст без упоминаний":      nil,
+		"привет,u/вася u/vasya_99!":        {"vasya_99"},
+		"[link](/u/bob) https://x.com/u/z": {"bob"},
+	}
+	for text, expected := range cases {
+		if got := Mentions(text); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%q: expected %v, got %v", text, expected, got)
+		}
+	}
+
+	var many []string
+	for i := 0; i < MaxMentions+5; i++ {
+		many = append(many, fmt.Sprintf("u/user%d", i))
+	}
+	if got := Mentions(strings.Join(many, " ")); len(got) != MaxMentions {
+		t.Errorf("expected %d mentions, got %d", MaxMentions, len(got))
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	prefs := DefaultPreferences()
+	for _, kind := range []Kind{KindComment, KindReply, KindMention} {
+		if !prefs.Allows(kind) {
+			t.Errorf("expected %s allowed by default", kind)
+		}
+	}
+	prefs.Mentions = false
+	if prefs.Allows(KindMention) || !prefs.Allows(KindReply) {
+		t.Errorf("unexpected preferences: %+v", prefs)
+	}
+	if prefs.Allows("vote") {
+		t.Errorf("unknown kind must not be allowed")
+	}
+}
@@ -0,0 +1,199 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"time"
+
+	"redditclone/pkg/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	idKey        = "id"
+	userIDKey    = "user_id"
+	kindKey      = "kind"
+	postIDKey    = "post_id"
+	commentIDKey = "comment_id"
+	categoryKey  = "category"
+	titleKey     = "title"
+	excerptKey   = "excerpt"
+	actorKey     = "actor"
+	countKey     = "count"
+	readKey      = "read"
+	createdKey   = "created"
+	updatedKey   = "updated"
+
+	maxUpdateAttempts = 5
+)
+
+var ErrConflict = errors.New("notification is being updated concurrently")
+
+type NotificationMongoRepo struct {
+	collection  *mongo.Collection
+	preferences *mongo.Collection
+	logger      *zap.SugaredLogger
+}
+
+// NewMongoRepo - уведомления и настройки в разных коллекциях: настройки читаются на каждое событие
+func NewMongoRepo(collection, preferences *mongo.Collection, logger *zap.SugaredLogger) *NotificationMongoRepo {
+	return &NotificationMongoRepo{
+		collection:  collection,
+		preferences: preferences,
+		logger:      logger,
+	}
+}
+
+// EnsureIndexes - одно непрочитанное уведомление на вид и пост, входящие по времени обновления,
+// одни настройки на юзера
+func (repo *NotificationMongoRepo) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: idKey, Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys:    bson.D{{Key: userIDKey, Value: 1}, {Key: kindKey, Value: 1}, {Key: postIDKey, Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{readKey: false}),
+		},
+		{Keys: bson.D{{Key: userIDKey, Value: 1}, {Key: updatedKey, Value: -1}}},
+	}
+	if _, err := repo.collection.Indexes().CreateMany(ctx, models); err != nil {
+		repo.logger.Errorf("Error creating notification indexes: %v", err)
+		return err
+	}
+	prefsIndex := mongo.IndexModel{Keys: bson.D{{Key: userIDKey, Value: 1}}, Options: options.Index().SetUnique(true)}
+	if _, err := repo.preferences.Indexes().CreateOne(ctx, prefsIndex); err != nil {
+		repo.logger.Errorf("Error creating notification preferences index: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Notify одним upsert'ом либо заводит уведомление, либо доливает событие в непрочитанное. Два первых
+// события одновременно упрутся в уникальный индекс, и второе уйдет на новый круг уже обновлением
+func (repo *NotificationMongoRepo) Notify(event Event) error {
+	if !validKind(event.Kind) {
+		return ErrBadKind
+	}
+	prefs, err := repo.Preferences(event.UserID)
+	if err != nil {
+		return err
+	}
+	if !prefs.Allows(event.Kind) {
+		return nil
+	}
+
+	filter := bson.M{userIDKey: event.UserID, kindKey: event.Kind, postIDKey: event.PostID, readKey: false}
+	update := bson.M{
+		"$set": bson.M{
+			commentIDKey: event.CommentID,
+			categoryKey:  event.Category,
+			titleKey:     event.Title,
+			excerptKey:   event.excerpt(),
+			actorKey:     event.Actor,
+			updatedKey:   event.Created,
+		},
+		"$inc":         bson.M{countKey: 1},
+		"$setOnInsert": bson.M{idKey: utils.GenerateID(), createdKey: event.Created},
+	}
+	opts := options.Update().SetUpsert(true)
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err = repo.collection.UpdateOne(ctx, filter, update, opts)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			repo.logger.Errorf("Error saving %s notification for %s: %v", event.Kind, event.UserID, err)
+			return err
+		}
+	}
+	return ErrConflict
+}
+
+func (repo *NotificationMongoRepo) Inbox(userID string, limit int) (*Inbox, error) {
+	if limit <= 0 || limit > DefaultInboxLimit {
+		limit = DefaultInboxLimit
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: updatedKey, Value: -1}}).
+		SetLimit(int64(limit))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	notificationsFromDB, err := repo.collection.Find(ctx, bson.M{userIDKey: userID}, opts)
+	if err != nil {
+		repo.logger.Errorf("Error listing notifications of %s: %v", userID, err)
+		return nil, err
+	}
+
+	defer utils.HandleMongoCursorClose(notificationsFromDB, ctx)
+
+	inbox := &Inbox{Notifications: make([]Notification, 0)}
+	for notificationsFromDB.Next(ctx) {
+		var n Notification
+		if err := notificationsFromDB.Decode(&n); err != nil {
+			repo.logger.Errorf("Error decoding notification: %v", err)
+			continue
+		}
+		inbox.Notifications = append(inbox.Notifications, n)
+	}
+	if err = notificationsFromDB.Err(); err != nil {
+		return nil, err
+	}
+
+	unread, err := repo.collection.CountDocuments(ctx, bson.M{userIDKey: userID, readKey: false})
+	if err != nil {
+		repo.logger.Errorf("Error counting unread notifications of %s: %v", userID, err)
+		return nil, err
+	}
+	inbox.Unread = int(unread)
+	return inbox, nil
+}
+
+func (repo *NotificationMongoRepo) MarkRead(userID string, ids []string) (int, error) {
+	filter := bson.M{userIDKey: userID, readKey: false}
+	if len(ids) > 0 {
+		filter[idKey] = bson.M{"$in": ids}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := repo.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{readKey: true}})
+	if err != nil {
+		repo.logger.Errorf("Error marking notifications of %s read: %v", userID, err)
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
+
+func (repo *NotificationMongoRepo) Preferences(userID string) (Preferences, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var prefs Preferences
+	err := repo.preferences.FindOne(ctx, bson.M{userIDKey: userID}).Decode(&prefs)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return DefaultPreferences(), nil
+	}
+	if err != nil {
+		repo.logger.Errorf("Error finding notification preferences of %s: %v", userID, err)
+		return Preferences{}, err
+	}
+	return prefs, nil
+}
+
+func (repo *NotificationMongoRepo) SetPreferences(userID string, prefs Preferences) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	update := bson.M{"$set": prefs}
+	_, err := repo.preferences.UpdateOne(ctx, bson.M{userIDKey: userID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		repo.logger.Errorf("Error saving notification preferences of %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
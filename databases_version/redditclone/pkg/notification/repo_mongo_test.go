@@ -0,0 +1,164 @@
+package notification
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.uber.org/zap"
+)
+
+var (
+	nilLogger = zap.NewNop().Sugar()
+	now       = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func noPreferences() bson.D {
+	return mtest.CreateCursorResponse(0, "db.prefs", mtest.FirstBatch)
+}
+
+func updated(n int) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+// lastCommand - последняя команда, которую репо отправил в базу
+func lastCommand(mt *mtest.T) bson.Raw {
+	events := mt.GetAllStartedEvents()
+	return events[len(events)-1].Command
+}
+
+func TestNotify(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	event := Event{Kind: KindComment, UserID: "u1", Actor: "bob", PostID: "p1", CommentID: "c1", Title: "title", Excerpt: "hi", Created: now}
+
+	mt.Run("upsert into unread", func(mt *mtest.T) {
+		mt.AddMockResponses(noPreferences(), updated(1))
+		repo := NewMongoRepo(mt.Coll, mt.Coll, nilLogger)
+		if err := repo.Notify(event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		update := lastCommand(mt).Lookup("updates").Array().Index(0).Value().Document()
+		if !update.Lookup("upsert").Boolean() {
+			t.Errorf("expected upsert")
+		}
+		filter := update.Lookup("q").Document()
+		if filter.Lookup(readKey).Boolean() || filter.Lookup(postIDKey).StringValue() != "p1" || filter.Lookup(kindKey).StringValue() != "comment" {
+			t.Errorf("unexpected filter: %v", filter)
+		}
+		if inc := update.Lookup("u", "$inc", countKey).AsInt64(); inc != 1 {
+			t.Errorf("expected count increment, got %d", inc)
+		}
+		if actor := update.Lookup("u", "$set", actorKey).StringValue(); actor != "bob" {
+			t.Errorf("expected last actor bob, got %q", actor)
+		}
+	})
+
+	mt.Run("disabled by preferences", func(mt *mtest.T) {
+		prefs := bson.D{{Key: userIDKey, Value: "u1"}, {Key: "comments", Value: false}, {Key: "replies", Value: true}, {Key: "mentions", Value: true}}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.prefs", mtest.FirstBatch, prefs))
+		repo := NewMongoRepo(mt.Coll, mt.Coll, nilLogger)
+		if err := repo.Notify(event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if events := mt.GetAllStartedEvents(); len(events) != 1 {
+			t.Errorf("expected only preferences lookup, got %d commands", len(events))
+		}
+	})
+
+	mt.Run("retry on duplicate key", func(mt *mtest.T) {
+		duplicate := mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"})
+		mt.AddMockResponses(noPreferences(), duplicate, updated(1))
+		repo := NewMongoRepo(mt.Coll, mt.Coll, nilLogger)
+		if err := repo.Notify(event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	mt.Run("bad kind", func(mt *mtest.T) {
+		repo := NewMongoRepo(mt.Coll, mt.Coll, nilLogger)
+		bad := event
+		bad.Kind = "vote"
+		if err := repo.Notify(bad); err != ErrBadKind {
+			t.Fatalf("expected ErrBadKind, got %v", err)
+		}
+	})
+}
+
+func TestInbox(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("items and unread count", func(mt *mtest.T) {
+		doc := bson.D{
+			{Key: idKey, Value: "n1"}, {Key: userIDKey, Value: "u1"}, {Key: kindKey, Value: "reply"},
+			{Key: postIDKey, Value: "p1"}, {Key: actorKey, Value: "bob"}, {Key: countKey, Value: 3}, {Key: readKey, Value: false},
+		}
+		count := mtest.CreateCursorResponse(0, "db.notifications", mtest.FirstBatch, bson.D{{Key: "n", Value: 4}})
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.notifications", mtest.FirstBatch, doc), count)
+		repo := NewMongoRepo(mt.Coll, mt.Coll, nilLogger)
+		inbox, err := repo.Inbox("u1", 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if inbox.Unread != 4 || len(inbox.Notifications) != 1 {
+			t.Fatalf("unexpected inbox: %+v", inbox)
+		}
+		if n := inbox.Notifications[0]; n.ID != "n1" || n.Kind != KindReply || n.Count != 3 || n.Actor != "bob" {
+			t.Errorf("unexpected notification: %+v", n)
+		}
+	})
+}
+
+func TestMarkRead(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("selected", func(mt *mtest.T) {
+		mt.AddMockResponses(updated(2))
+		repo := NewMongoRepo(mt.Coll, mt.Coll, nilLogger)
+		n, err := repo.MarkRead("u1", []string{"n1", "n2"})
+		if err != nil || n != 2 {
+			t.Fatalf("expected 2 marked, got %d (%v)", n, err)
+		}
+		filter := lastCommand(mt).Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		if _, err = filter.LookupErr(idKey, "$in"); err != nil {
+			t.Errorf("expected filter by ids, got %v", filter)
+		}
+	})
+
+	mt.Run("all", func(mt *mtest.T) {
+		mt.AddMockResponses(updated(5))
+		repo := NewMongoRepo(mt.Coll, mt.Coll, nilLogger)
+		if _, err := repo.MarkRead("u1", nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		filter := lastCommand(mt).Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		if _, err := filter.LookupErr(idKey); err == nil {
+			t.Errorf("expected no filter by ids, got %v", filter)
+		}
+	})
+}
+
+func TestPreferencesRepo(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("defaults", func(mt *mtest.T) {
+		mt.AddMockResponses(noPreferences())
+		repo := NewMongoRepo(mt.Coll, mt.Coll, nilLogger)
+		prefs, err := repo.Preferences("u1")
+		if err != nil || prefs != DefaultPreferences() {
+			t.Fatalf("expected defaults, got %+v (%v)", prefs, err)
+		}
+	})
+
+	mt.Run("save", func(mt *mtest.T) {
+		mt.AddMockResponses(updated(1))
+		repo := NewMongoRepo(mt.Coll, mt.Coll, nilLogger)
+		if err := repo.SetPreferences("u1", Preferences{Replies: true}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		update := lastCommand(mt).Lookup("updates").Array().Index(0).Value().Document()
+		if !update.Lookup("upsert").Boolean() || update.Lookup("u", "$set", "mentions").Boolean() {
+			t.Errorf("unexpected update: %v", update)
+		}
+	})
+}
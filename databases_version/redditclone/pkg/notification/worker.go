@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"redditclone/pkg/user"
+
+	"go.uber.org/zap"
+)
+
+// Delivery - уведомления об одном посте или комменте. Хендлер собирает ее из того, что уже в памяти,
+// а искать упомянутых и писать во входящие ходит Worker
+type Delivery struct {
+	// Event без Kind и UserID - их Worker проставляет каждому адресату
+	Event Event
+	// ActorID - автор, себе он уведомлений не получает
+	ActorID string
+	// To получает уведомление Kind: автор поста или коммента, на который ответили. "" - никто
+	To   string
+	Kind Kind
+	// Mentions - упомянутые в тексте, см. Mentions. Тем, кто уже получил Kind, упоминание не шлем
+	Mentions []string
+}
+
+// Queue - то, что нужно хендлеру: отдать рассылку, не дожидаясь записи
+type Queue interface {
+	Enqueue(d Delivery)
+}
+
+// Worker рассылает уведомления в фоне: на упоминания уходит по запросу в базу на каждого, и ответ на коммент их ждать не должен
+type Worker struct {
+	notifications NotificationRepo
+	users         user.UserRepo
+	logger        *zap.SugaredLogger
+	deliveries    chan Delivery
+}
+
+func NewWorker(notifications NotificationRepo, users user.UserRepo, queueSize int, logger *zap.SugaredLogger) *Worker {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	return &Worker{
+		notifications: notifications,
+		users:         users,
+		logger:        logger,
+		deliveries:    make(chan Delivery, queueSize),
+	}
+}
+
+// Enqueue не блокирует: если очередь забита, уведомления об этом пропадут
+func (w *Worker) Enqueue(d Delivery) {
+	if w == nil {
+		return
+	}
+	select {
+	case w.deliveries <- d:
+	default:
+		w.logger.Warnf("Notification queue is full, skipping %s on post %s", d.Kind, d.Event.PostID)
+	}
+}
+
+// Run разбирает очередь в workers горутин, пока не отменят ctx. Недоделанное в очереди теряется
+func (w *Worker) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < max(1, workers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case d := <-w.deliveries:
+					w.Deliver(d)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Deliver - одна рассылка целиком. Каждому не больше одного уведомления: ответ важнее упоминания.
+// Запись уже сделана, так что ошибки только логируем
+func (w *Worker) Deliver(d Delivery) {
+	notified := map[string]bool{d.ActorID: true}
+	w.notify(d.Event, d.Kind, d.To, notified)
+	for _, name := range d.Mentions {
+		if strings.EqualFold(name, d.Event.Actor) {
+			continue
+		}
+		mentioned, err := w.users.GetUserByName(name)
+		if err != nil {
+			if !errors.Is(err, user.ErrNoUser) {
+				w.logger.Errorf("failed to get mentioned user %s: %v", name, err)
+			}
+			continue
+		}
+		w.notify(d.Event, KindMention, mentioned.ID, notified)
+	}
+}
+
+func (w *Worker) notify(event Event, kind Kind, userID string, notified map[string]bool) {
+	if userID == "" || notified[userID] {
+		return
+	}
+	notified[userID] = true
+	event.Kind, event.UserID = kind, userID
+	if err := w.notifications.Notify(event); err != nil {
+		w.logger.Errorf("failed to notify %s about %s on post %s: %v", userID, kind, event.PostID, err)
+	}
+}
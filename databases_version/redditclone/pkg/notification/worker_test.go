@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"redditclone/pkg/user"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeNotifications - только Notify, остальное Worker не трогает. Моки из utils/mocks тут дали бы цикл импортов
+type fakeNotifications struct {
+	NotificationRepo
+	mu     sync.Mutex
+	events []Event
+}
+
+func (f *fakeNotifications) Notify(e Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, e)
+	return nil
+}
+
+func (f *fakeNotifications) sent() []Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Event(nil), f.events...)
+}
+
+// fakeUsers - id по имени, без имени - user.ErrNoUser, "broken" - ошибка базы
+type fakeUsers struct {
+	user.UserRepo
+	ids     map[string]string
+	lookups int
+}
+
+func (f *fakeUsers) GetUserByName(name string) (*user.User, error) {
+	f.lookups++
+	if name == "broken" {
+		return nil, errors.New("mysql is down")
+	}
+	id, ok := f.ids[name]
+	if !ok {
+		return nil, user.ErrNoUser
+	}
+	return &user.User{ID: id, Username: name}, nil
+}
+
+func TestWorker_Deliver(t *testing.T) {
+	notifications := &fakeNotifications{}
+	users := &fakeUsers{ids: map[string]string{"alice": "alice-id", "carol": "carol-id", "bob": "bob-id"}}
+	worker := NewWorker(notifications, users, 0, zaptest.NewLogger(t).Sugar())
+
+	// автору поста - коммент, упомянутой carol - упоминание. Автор поста, сам пишущий и несуществующие второй раз не получают
+	worker.Deliver(Delivery{
+		Event:    Event{Actor: "bob", PostID: "p1", CommentID: "c1"},
+		ActorID:  "bob-id",
+		To:       "alice-id",
+		Kind:     KindComment,
+		Mentions: []string{"alice", "carol", "ghost", "broken", "Bob"},
+	})
+	events := notifications.sent()
+	if len(events) != 2 || events[0].UserID != "alice-id" || events[0].Kind != KindComment ||
+		events[1].UserID != "carol-id" || events[1].Kind != KindMention {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if events[1].PostID != "p1" || events[1].CommentID != "c1" || events[1].Actor != "bob" {
+		t.Errorf("expected event fields to be kept, got %+v", events[1])
+	}
+	if users.lookups != 4 {
+		t.Errorf("expected no lookup for the actor, got %d lookups", users.lookups)
+	}
+
+	// только упоминания, как у нового поста
+	notifications.events = nil
+	worker.Deliver(Delivery{Event: Event{Actor: "bob", PostID: "p2"}, ActorID: "bob-id", Mentions: []string{"carol"}})
+	if events = notifications.sent(); len(events) != 1 || events[0].UserID != "carol-id" || events[0].Kind != KindMention {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
+
+func TestWorker_Run(t *testing.T) {
+	notifications := &fakeNotifications{}
+	worker := NewWorker(notifications, &fakeUsers{}, 1, zaptest.NewLogger(t).Sugar())
+
+	worker.Enqueue(Delivery{Event: Event{PostID: "p1"}, To: "alice-id", Kind: KindComment})
+	// очередь на одну рассылку уже занята - вторая теряется, а не ждет
+	worker.Enqueue(Delivery{Event: Event{PostID: "p2"}, To: "alice-id", Kind: KindComment})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		worker.Run(ctx, 2)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for len(notifications.sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if events := notifications.sent(); len(events) != 1 || events[0].PostID != "p1" {
+		t.Errorf("expected only the first delivery, got %+v", events)
+	}
+
+	var nilWorker *Worker
+	nilWorker.Enqueue(Delivery{})
+}
@@ -0,0 +1,147 @@
+package post
+
+import (
+	"errors"
+	"redditclone/pkg/markdown"
+	"redditclone/pkg/role"
+	"time"
+)
+
+// у ссылки содержимое - сам URL, так что заголовок можно поправить только сразу после публикации,
+// пока никто не успел проголосовать за одно, а прочитать другое
+const LinkEditWindow = 5 * time.Minute
+
+// MaxRevisions - сколько прежних версий храним у поста и у каждого коммента. История лежит в самом посте,
+// так что без предела документ рос бы с каждой правкой - самые старые версии выкидываем
+const MaxRevisions = 20
+
+var (
+	ErrNothingToEdit    = errors.New("nothing to edit")
+	ErrURLNotEditable   = errors.New("url of a post can't be edited")
+	ErrEditWindowClosed = errors.New("link posts can only be edited within 5 minutes after posting")
+	ErrPollVoted        = errors.New("poll posts can't be edited once someone has voted")
+)
+
+type EditPostRequest struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	URL   string `json:"url"`
+}
+
+// edit меняет заголовок и текст поста, если actor может его править, см. role.CanEdit.
+// Пустое поле - оставить как было, прежняя версия уходит в Revisions
+func (p *Post) edit(request EditPostRequest, actor role.Actor, now time.Time) error {
+	if !role.CanEdit(actor, role.Target{AuthorID: p.Author.ID, Community: p.Category}) {
+		return ErrUnauthorized
+	}
+	if p.Removed != nil {
+		return ErrRemoved
+	}
+	if request.URL != "" && request.URL != p.URL {
+		return ErrURLNotEditable
+	}
+	if p.Type == "link" && now.Sub(p.Created) > LinkEditWindow {
+		return ErrEditWindowClosed
+	}
+	// как и со ссылкой: голосовали за один вопрос, а результаты висели бы под другим
+	if p.Poll != nil && p.Poll.Voters > 0 {
+		return ErrPollVoted
+	}
+	title, text := p.Title, p.Text
+	if request.Title != "" {
+		title = request.Title
+	}
+	if request.Text != "" {
+		text = request.Text
+	}
+	if title == p.Title && text == p.Text {
+		return ErrNothingToEdit
+	}
+
+	p.addRevision(Revision{Title: p.Title, Text: p.Text, Created: lastChange(p.Created, p.Edited)})
+	p.Title, p.Text = title, text
+	p.TextHTML = markdown.Render(text)
+	p.Edited = &now
+	return nil
+}
+
+func (p *Post) editComment(commentID string, actor role.Actor, body string, now time.Time) (int, error) {
+	i := p.findComment(commentID)
+	if i == -1 || p.Comments[i].Deleted {
+		return -1, ErrCommentNotFound
+	}
+	comment := &p.Comments[i]
+	if !role.CanEdit(actor, role.Target{AuthorID: comment.Author.ID, Community: p.Category}) {
+		return -1, ErrUnauthorized
+	}
+	if comment.Removed != nil {
+		return -1, ErrRemoved
+	}
+	if body == comment.Body {
+		return -1, ErrNothingToEdit
+	}
+
+	p.addRevision(Revision{CommentID: commentID, Text: comment.Body, Created: lastChange(comment.Created, comment.Edited)})
+	comment.Body = body
+	comment.BodyHTML = markdown.Render(body)
+	comment.Edited = &now
+	return i, nil
+}
+
+// addRevision дописывает прежнюю версию и выкидывает самые старые версии того же поста или коммента сверх MaxRevisions
+func (p *Post) addRevision(revision Revision) {
+	p.Revisions = append(p.Revisions, revision)
+	extra := -MaxRevisions
+	for _, r := range p.Revisions {
+		if r.CommentID == revision.CommentID {
+			extra++
+		}
+	}
+	if extra <= 0 {
+		return
+	}
+	kept := p.Revisions[:0]
+	for _, r := range p.Revisions {
+		if r.CommentID == revision.CommentID && extra > 0 {
+			extra--
+			continue
+		}
+		kept = append(kept, r)
+	}
+	p.Revisions = kept
+}
+
+// revisions - прежние версии поста (commentID == "") или коммента, от старых к новым
+func (p *Post) revisions(commentID string) ([]Revision, error) {
+	if commentID != "" {
+		i := p.findComment(commentID)
+		if i == -1 || p.Comments[i].Deleted {
+			return nil, ErrCommentNotFound
+		}
+	}
+	revisions := make([]Revision, 0)
+	for _, r := range p.Revisions {
+		if r.CommentID == commentID {
+			revisions = append(revisions, r)
+		}
+	}
+	return revisions, nil
+}
+
+// dropRevisions - у удаленного коммента не должно остаться способа прочитать, что там было
+func (p *Post) dropRevisions(commentID string) {
+	kept := p.Revisions[:0]
+	for _, r := range p.Revisions {
+		if r.CommentID != commentID {
+			kept = append(kept, r)
+		}
+	}
+	p.Revisions = kept
+}
+
+func lastChange(created time.Time, edited *time.Time) time.Time {
+	if edited != nil {
+		return *edited
+	}
+	return created
+}
@@ -0,0 +1,126 @@
+package post
+
+import (
+	"errors"
+	"fmt"
+	"redditclone/pkg/role"
+	"testing"
+	"time"
+)
+
+func TestEditPost(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	newPost := func(postType string) *Post {
+		p := &Post{ID: "p1", Type: postType, Title: "title", Created: created, Author: Author{ID: "author"}}
+		switch postType {
+		case "link":
+			p.URL = "https://example.com"
+		case "voted poll":
+			p.Type, p.Text, p.Poll = "poll", "text", &Poll{Voters: 1}
+		case "poll":
+			p.Text, p.Poll = "text", &Poll{}
+		default:
+			p.Text = "text"
+		}
+		return p
+	}
+
+	tests := []struct {
+		name     string
+		postType string
+		userID   string
+		request  EditPostRequest
+		after    time.Duration
+		err      error
+	}{
+		{"text post any time", "text", "author", EditPostRequest{Text: "new"}, 24 * time.Hour, nil},
+		{"not the author", "text", "other", EditPostRequest{Text: "new"}, time.Minute, ErrUnauthorized},
+		{"admin is not the author", "text", "admin", EditPostRequest{Text: "new"}, time.Minute, ErrUnauthorized},
+		{"nothing changed", "text", "author", EditPostRequest{Title: "title"}, time.Minute, ErrNothingToEdit},
+		{"link title within window", "link", "author", EditPostRequest{Title: "new"}, time.Minute, nil},
+		{"link after window", "link", "author", EditPostRequest{Title: "new"}, LinkEditWindow + time.Second, ErrEditWindowClosed},
+		{"link url", "link", "author", EditPostRequest{URL: "https://other.com"}, time.Minute, ErrURLNotEditable},
+		{"poll before votes", "poll", "author", EditPostRequest{Title: "new"}, 24 * time.Hour, nil},
+		{"poll after votes", "voted poll", "author", EditPostRequest{Title: "new"}, time.Minute, ErrPollVoted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPost(tt.postType)
+			before := *p
+			// роли права на правку не дают, см. role.CanEdit
+			actor := role.Actor{UserID: tt.userID, Roles: &role.Roles{Admin: tt.userID == "admin"}}
+			err := p.edit(tt.request, actor, created.Add(tt.after))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				if p.Edited != nil || len(p.Revisions) != 0 || p.Title != before.Title || p.Text != before.Text {
+					t.Errorf("failed edit changed the post: %+v", p)
+				}
+				return
+			}
+			if p.Edited == nil || len(p.Revisions) != 1 {
+				t.Fatalf("expected edited post with one revision, got %+v", p)
+			}
+			if r := p.Revisions[0]; r.Title != before.Title || r.Text != before.Text || !r.Created.Equal(created) {
+				t.Errorf("unexpected revision: %+v", r)
+			}
+		})
+	}
+}
+
+func TestEditCommentRevisions(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := &Post{ID: "p1", Comments: []Comment{
+		{ID: "c1", Body: "first", Created: created, Author: Author{ID: "u1"}},
+		{ID: "c2", Body: "reply", Created: created, Author: Author{ID: "u2"}, ParentID: "c1"},
+	}}
+
+	if _, err := p.editComment("c1", role.Actor{UserID: "u2"}, "hijack", created); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+	firstEdit := created.Add(time.Minute)
+	if _, err := p.editComment("c1", role.Actor{UserID: "u1"}, "second", firstEdit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := p.editComment("c1", role.Actor{UserID: "u1"}, "third", firstEdit.Add(time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	revisions, err := p.revisions("c1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Text != "first" || revisions[1].Text != "second" || !revisions[1].Created.Equal(firstEdit) {
+		t.Fatalf("unexpected revisions: %+v", revisions)
+	}
+	if postRevisions, _ := p.revisions(""); len(postRevisions) != 0 {
+		t.Errorf("comment edits leaked into post revisions: %+v", postRevisions)
+	}
+
+	// на c1 ответили - остается надгробие, но старые версии читать уже нельзя
+	if err := p.removeComment("c1", role.Actor{UserID: "u1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.Revisions) != 0 || p.Comments[0].Edited != nil {
+		t.Errorf("revisions of a deleted comment must be dropped: %+v", p.Revisions)
+	}
+	if _, err := p.revisions("c1"); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("expected ErrCommentNotFound, got %v", err)
+	}
+}
+
+func TestAddRevision(t *testing.T) {
+	p := &Post{Revisions: []Revision{{CommentID: "c1", Text: "comment"}}}
+	for i := 0; i <= MaxRevisions; i++ {
+		p.addRevision(Revision{Text: fmt.Sprintf("v%d", i)})
+	}
+	posts, _ := p.revisions("")
+	if len(posts) != MaxRevisions || posts[0].Text != "v1" || posts[len(posts)-1].Text != fmt.Sprintf("v%d", MaxRevisions) {
+		t.Errorf("expected the oldest post revision to be dropped, got %+v", posts)
+	}
+	// у коммента свой предел, правки поста его историю не вытесняют
+	if len(p.Revisions) != MaxRevisions+1 || p.Revisions[0].CommentID != "c1" {
+		t.Errorf("comment revision should stay: %+v", p.Revisions[0])
+	}
+}
@@ -0,0 +1,73 @@
+package post
+
+import (
+	"errors"
+	"redditclone/pkg/markdown"
+	"strings"
+	"time"
+)
+
+const maxReasonLength = 300
+
+var (
+	ErrRemoved  = errors.New("removed by a moderator")
+	ErrNoReason = errors.New("removal reason is required")
+)
+
+// Removal - пост или коммент убран модератором. Сам контент затирается, вместо него показывается причина
+type Removal struct {
+	Moderator string    `json:"moderator" bson:"moderator"`
+	Reason    string    `json:"reason" bson:"reason"`
+	Created   time.Time `json:"created" bson:"created"`
+}
+
+// NewRemoval проверяет причину: без нее автор не поймет, за что убрали
+func NewRemoval(moderator, reason string, now time.Time) (Removal, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len([]rune(reason)) > maxReasonLength {
+		return Removal{}, ErrNoReason
+	}
+	return Removal{Moderator: moderator, Reason: reason, Created: now}, nil
+}
+
+func (r Removal) text() string {
+	return "[removed: " + r.Reason + "]"
+}
+
+// remove - модераторское удаление поста: в отличие от удаления автором пост остается на месте вместе
+// с комментами, пропадают только текст, ссылка и история правок
+func (p *Post) remove(removal Removal) error {
+	if p.Removed != nil {
+		return ErrRemoved
+	}
+	p.Removed = &removal
+	p.Text = removal.text()
+	p.TextHTML = markdown.Render(p.Text)
+	p.URL = ""
+	p.Host = ""
+	// убранная ссылка не мешает запостить ее заново
+	p.LinkHash = ""
+	p.Preview = nil
+	p.Media = nil
+	p.Poll = nil
+	p.Edited = nil
+	p.dropRevisions("")
+	return nil
+}
+
+func (p *Post) removeCommentAsModerator(commentID string, removal Removal) (int, error) {
+	i := p.findComment(commentID)
+	if i == -1 || p.Comments[i].Deleted {
+		return -1, ErrCommentNotFound
+	}
+	comment := &p.Comments[i]
+	if comment.Removed != nil {
+		return -1, ErrRemoved
+	}
+	comment.Removed = &removal
+	comment.Body = removal.text()
+	comment.BodyHTML = markdown.Render(comment.Body)
+	comment.Edited = nil
+	p.dropRevisions(commentID)
+	return i, nil
+}
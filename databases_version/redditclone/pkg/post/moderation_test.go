@@ -0,0 +1,74 @@
+package post
+
+import (
+	"errors"
+	"redditclone/pkg/media"
+	"redditclone/pkg/preview"
+	"redditclone/pkg/role"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRemoval(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	removal, err := NewRemoval("mod", "  spam  ", now)
+	if err != nil || removal.Reason != "spam" || removal.Moderator != "mod" {
+		t.Errorf("unexpected removal: %+v, %v", removal, err)
+	}
+	for _, reason := range []string{"", "   ", strings.Repeat("x", maxReasonLength+1)} {
+		if _, err := NewRemoval("mod", reason, now); !errors.Is(err, ErrNoReason) {
+			t.Errorf("reason %q: expected ErrNoReason, got %v", reason, err)
+		}
+	}
+}
+
+func TestRemovePost(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	edited := now.Add(-time.Minute)
+	p := &Post{
+		ID: "p1", Type: "link", Title: "title", URL: "https://spam.com", Host: "spam.com", LinkHash: "h", Edited: &edited,
+		Preview:   &preview.Preview{Title: "buy now"},
+		Media:     &media.Media{Key: "spam.png"},
+		Author:    Author{ID: "author"},
+		Comments:  []Comment{{ID: "c1", Body: "buy now", Author: Author{ID: "spammer"}}},
+		Revisions: []Revision{{Title: "old"}, {CommentID: "c1", Text: "older"}},
+	}
+	removal := Removal{Moderator: "mod", Reason: "spam", Created: now}
+
+	if err := p.remove(removal); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.URL != "" || p.Host != "" || p.LinkHash != "" || p.Preview != nil || p.Media != nil || p.Edited != nil || !strings.Contains(p.Text, "spam") || p.Title != "title" {
+		t.Errorf("content is not replaced: %+v", p)
+	}
+	if p.TextHTML != "<p>[removed: spam]</p>\n" {
+		t.Errorf("rendered text is not replaced: %q", p.TextHTML)
+	}
+	if len(p.Revisions) != 1 || p.Revisions[0].CommentID != "c1" {
+		t.Errorf("post history should be dropped: %+v", p.Revisions)
+	}
+	if err := p.remove(removal); !errors.Is(err, ErrRemoved) {
+		t.Errorf("expected ErrRemoved on second removal, got %v", err)
+	}
+	if err := p.edit(EditPostRequest{Title: "new"}, role.Actor{UserID: "author"}, now); !errors.Is(err, ErrRemoved) {
+		t.Errorf("author should not edit a removed post, got %v", err)
+	}
+
+	i, err := p.removeCommentAsModerator("c1", removal)
+	if err != nil || i != 0 {
+		t.Fatalf("unexpected result: %d, %v", i, err)
+	}
+	if c := p.Comments[0]; c.Removed == nil || c.Body != removal.text() || c.BodyHTML != "<p>[removed: spam]</p>\n" || c.Author.ID != "spammer" {
+		t.Errorf("unexpected comment: %+v", c)
+	}
+	if len(p.Revisions) != 0 {
+		t.Errorf("comment history should be dropped: %+v", p.Revisions)
+	}
+	if _, err := p.editComment("c1", role.Actor{UserID: "spammer"}, "new", now); !errors.Is(err, ErrRemoved) {
+		t.Errorf("author should not edit a removed comment, got %v", err)
+	}
+	if _, err := p.removeCommentAsModerator("nope", removal); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("expected ErrCommentNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package post
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewPollRequest_Validate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	msk := time.FixedZone("MSK", 3*60*60)
+	closes := now.Add(time.Hour).In(msk).Add(123 * time.Microsecond)
+	request := &NewPollRequest{Options: []string{" yes ", "no"}, Closes: &closes}
+	if err := request.Validate(now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if request.Options[0] != "yes" || request.Closes.Location() != time.UTC || !request.Closes.Equal(now.Add(time.Hour)) {
+		t.Errorf("request is not normalized: %+v, %v", request, request.Closes)
+	}
+
+	past, far := now.Add(-time.Minute), now.Add(MaxPollDuration+time.Minute)
+	cases := map[string]struct {
+		request *NewPollRequest
+		err     error
+	}{
+		"nil":         {nil, ErrBadPoll},
+		"one option":  {&NewPollRequest{Options: []string{"yes"}}, ErrBadPoll},
+		"too many":    {&NewPollRequest{Options: strings.Split("a b c d e f g h i j k", " ")}, ErrBadPoll},
+		"blank":       {&NewPollRequest{Options: []string{"yes", "  "}}, ErrBadPoll},
+		"duplicate":   {&NewPollRequest{Options: []string{"yes", " yes"}}, ErrBadPoll},
+		"too long":    {&NewPollRequest{Options: []string{"yes", strings.Repeat("я", maxPollOptionLength+1)}}, ErrBadPoll},
+		"closed":      {&NewPollRequest{Options: []string{"yes", "no"}, Closes: &past}, ErrBadPollClose},
+		"too far off": {&NewPollRequest{Options: []string{"yes", "no"}, Closes: &far}, ErrBadPollClose},
+	}
+	for name, c := range cases {
+		if err := c.request.Validate(now); !errors.Is(err, c.err) {
+			t.Errorf("%s: expected %v, got %v", name, c.err, err)
+		}
+	}
+}
+
+func TestVotePoll(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	closes := now.Add(time.Hour)
+	request := &NewPollRequest{Options: []string{"a", "b", "c"}, Closes: &closes}
+	p := &Post{ID: "p1", Type: "poll", Score: 1, Poll: request.poll()}
+
+	ballot, err := p.votePoll("u1", []int{1}, now)
+	if err != nil || ballot.UserID != "u1" || p.Poll.Voters != 1 || p.Poll.Options[1].Votes != 1 {
+		t.Fatalf("unexpected vote: %+v, %+v, %v", ballot, p.Poll, err)
+	}
+	if p.Score != 1 || p.Ups != 0 {
+		t.Errorf("poll vote should not touch post score: %+v", p)
+	}
+
+	cases := map[string]struct {
+		userID  string
+		choices []int
+		at      time.Time
+		err     error
+	}{
+		"again":           {"u1", []int{2}, now, ErrAlreadyVoted},
+		"empty":           {"u2", nil, now, ErrBadBallot},
+		"out of range":    {"u2", []int{3}, now, ErrBadBallot},
+		"negative":        {"u2", []int{-1}, now, ErrBadBallot},
+		"single choice":   {"u2", []int{0, 1}, now, ErrBadBallot},
+		"after the close": {"u2", []int{0}, closes, ErrPollClosed},
+	}
+	for name, c := range cases {
+		if _, err := p.votePoll(c.userID, c.choices, c.at); !errors.Is(err, c.err) {
+			t.Errorf("%s: expected %v, got %v", name, c.err, err)
+		}
+	}
+
+	p.Poll.Multiple = true
+	if _, err := p.votePoll("u2", []int{2, 2}, now); !errors.Is(err, ErrBadBallot) {
+		t.Errorf("repeated choice: expected ErrBadBallot, got %v", err)
+	}
+	if ballot, err = p.votePoll("u2", []int{2, 0}, now); err != nil || !reflect.DeepEqual(ballot.Choices, []int{0, 2}) {
+		t.Fatalf("unexpected multiple vote: %+v, %v", ballot, err)
+	}
+	if p.Poll.Voters != 2 || p.Poll.Options[0].Votes != 1 || p.Poll.Options[2].Votes != 1 {
+		t.Errorf("unexpected counts: %+v", p.Poll)
+	}
+
+	if _, err := (&Post{}).votePoll("u1", []int{0}, now); !errors.Is(err, ErrNotPoll) {
+		t.Errorf("expected ErrNotPoll, got %v", err)
+	}
+	if err := p.remove(Removal{Reason: "spam"}); err != nil || p.Poll != nil {
+		t.Errorf("removal should drop the poll: %+v, %v", p.Poll, err)
+	}
+}
+
+func TestPollView(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	closes := now.Add(time.Hour)
+	poll := &Poll{
+		Options: []PollOption{{Text: "a", Votes: 2}, {Text: "b", Votes: 1}},
+		Closes:  &closes,
+		Ballots: []Ballot{{UserID: "u1", Choices: []int{0}}},
+	}
+
+	for _, userID := range []string{"", "u2"} {
+		poll.View(poll.ChoicesOf(userID), now)
+		if poll.Results != nil || poll.Choices != nil {
+			t.Errorf("%q: results should be hidden before voting: %+v", userID, poll)
+		}
+	}
+	poll.View(poll.ChoicesOf("u1"), now)
+	if !reflect.DeepEqual(poll.Results, []int{2, 1}) || !reflect.DeepEqual(poll.Choices, []int{0}) {
+		t.Errorf("voter should see results: %+v", poll)
+	}
+	poll.View(nil, closes)
+	if !reflect.DeepEqual(poll.Results, []int{2, 1}) || poll.Choices != nil {
+		t.Errorf("everyone should see results after the close: %+v", poll)
+	}
+}
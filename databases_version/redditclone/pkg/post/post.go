@@ -1,6 +1,9 @@
 package post
 
 import (
+	"redditclone/pkg/media"
+	"redditclone/pkg/preview"
+	"redditclone/pkg/role"
 	"time"
 )
 
@@ -10,13 +13,29 @@ type Comment struct {
 		Username string `json:"username"`
 		ID       string `json:"id"`
 	} `json:"author"`
-	Body    string    `json:"body"`
-	Created time.Time `json:"created"`
-}
+	Body string `json:"body"`
+	// Body в HTML, считается при записи, см. markdown.Render
+	BodyHTML string    `json:"bodyHtml,omitempty" bson:"body_html,omitempty"`
+	Created  time.Time `json:"created"`
+	// когда коммент последний раз правили, прежние версии - в Post.Revisions
+	Edited *time.Time `json:"edited,omitempty" bson:"edited,omitempty"`
+
+	// "" - коммент к самому посту, иначе id коммента, на который это ответ
+	ParentID string `json:"parentId,omitempty" bson:"parent_id,omitempty"`
+	// удаленный коммент, на который успели ответить, см. removeComment
+	Deleted bool `json:"deleted,omitempty" bson:"deleted,omitempty"`
+	// коммент убран модератором, см. removeCommentAsModerator
+	Removed *Removal `json:"removed,omitempty" bson:"removed,omitempty"`
+
+	// счет коммента и голос того, кто запрашивает пост, как у самого поста
+	Score int `json:"score" bson:"score"`
+	Vote  int `json:"vote" bson:"-"`
+	Ups   int `json:"-" bson:"ups"`
+	Downs int `json:"-" bson:"downs"`
 
-type Vote struct {
-	User string `json:"user"`
-	Vote int    `json:"vote"`
+	// заполняются только при выдаче деревом, см. CommentTree
+	Replies     []Comment `json:"replies,omitempty" bson:"-"`
+	MoreReplies int       `json:"moreReplies,omitempty" bson:"-"`
 }
 
 type Author struct {
@@ -25,19 +44,64 @@ type Author struct {
 }
 
 type Post struct {
-	Score            int       `json:"score"`
-	Views            int       `json:"views"`
-	Type             string    `json:"type"`
-	Title            string    `json:"title"`
-	URL              string    `json:"url"`
+	Score int    `json:"score"`
+	Views int    `json:"views"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	// хост ссылки - отдельным полем, чтобы он попал в текстовый индекс, см. EnsureIndexes
+	Host string `json:"-" bson:"host,omitempty"`
+	// хеш канонической ссылки, по нему ищутся повторы, см. CanonicalURL
+	LinkHash         string    `json:"-" bson:"link_hash,omitempty"`
 	Author           Author    `json:"author"`
 	Category         string    `json:"category"`
 	Text             string    `json:"text"`
-	Votes            []Vote    `json:"votes"`
 	Comments         []Comment `json:"comments"`
 	Created          time.Time `json:"created"`
 	UpvotePercentage int       `json:"upvotePercentage"`
 	ID               string    `json:"id"`
+	// Text в HTML, считается при записи, а не на каждой выдаче
+	TextHTML string `json:"textHtml,omitempty" bson:"text_html,omitempty"`
+	// когда пост последний раз правили
+	Edited *time.Time `json:"edited,omitempty" bson:"edited,omitempty"`
+	// пост убран модератором
+	Removed *Removal `json:"removed,omitempty" bson:"removed,omitempty"`
+	// на пост много жалоб, из лент и поиска он пропадает до решения модератора, см. report.ReportRepo
+	Hidden bool `json:"-" bson:"hidden,omitempty"`
+	// метка поста, пока ее ставит только автомодератор, см. automod.Engine
+	Flair string `json:"flair,omitempty" bson:"flair,omitempty"`
+	// карточка ссылки, у link-постов появляется не сразу, см. preview.Worker
+	Preview *preview.Preview `json:"preview,omitempty" bson:"preview,omitempty"`
+	// картинка image-поста, файлы - в media.BlobStore
+	Media *media.Media `json:"media,omitempty" bson:"media,omitempty"`
+	// опрос poll-поста, голоса в нем не связаны с Vote и Score
+	Poll *Poll `json:"poll,omitempty" bson:"poll,omitempty"`
+
+	// голос того, кто запрашивает пост: 1, -1 или 0. В базе не хранится, заполняется в хендлере
+	Vote int `json:"vote" bson:"-"`
+	// сколько апвоутов и даунвоутов, сами голоса - в vote.VoteRepo
+	Ups   int `json:"-" bson:"ups"`
+	Downs int `json:"-" bson:"downs"`
+
+	// посчитанные при записи ранги для сортировок ленты, см. refreshRank
+	Hot           float64 `json:"-" bson:"hot"`
+	Rising        float64 `json:"-" bson:"rising"`
+	Controversial float64 `json:"-" bson:"controversial"`
+
+	// прежние версии поста и его комментов, отдаются отдельной ручкой. Лежат в самом посте,
+	// чтобы правка и запись истории были одним апдейтом и уходили вместе с постом
+	Revisions []Revision `json:"-" bson:"revisions,omitempty"`
+
+	// растет на каждом изменении поста, по ней ловим параллельные апдейты, см. updatePost
+	Version int `json:"-" bson:"version"`
+}
+
+// Revision - версия поста или коммента до правки. Created - когда эта версия появилась
+type Revision struct {
+	CommentID string    `json:"commentId,omitempty" bson:"comment_id,omitempty"`
+	Title     string    `json:"title,omitempty" bson:"title,omitempty"`
+	Text      string    `json:"text" bson:"text"`
+	Created   time.Time `json:"created" bson:"created"`
 }
 
 type NewPostRequest struct {
@@ -46,6 +110,12 @@ type NewPostRequest struct {
 	Title    string `json:"title"`
 	Text     string `json:"text"`
 	URL      string `json:"url"`
+	// флейр ставит автомодератор, автор его не задает
+	Flair string `json:"-"`
+	// у image-постов - уже сохраненная картинка, JSON-ом ее не передать, только загрузкой
+	Media *media.Media `json:"-"`
+	// у poll-постов - варианты опроса, см. NewPollRequest.Validate
+	Poll *NewPollRequest `json:"poll,omitempty"`
 }
 
 type PostRepo interface {
@@ -54,8 +124,35 @@ type PostRepo interface {
 	GetPostsByCategory(category string) []Post
 	CreatePost(request NewPostRequest, username, userID string) *Post
 	AddComment(postID, username, userID, comment string) (*Post, error)
-	DeleteComment(postID, commentID, userID string) (*Post, error)
-	DeletePost(postID, userID string) (bool, error)
+	AddReply(postID, parentID, username, userID, comment string) (*Post, error)
+	GetCommentTree(postID, parentID string, depth int) ([]Comment, error)
+	// DeleteComment, DeletePost, EditPost и EditComment сами проверяют права actor, см. role.CanDelete и role.CanEdit
+	DeleteComment(postID, commentID string, actor role.Actor) (*Post, error)
+	DeletePost(postID string, actor role.Actor) (bool, error)
 	PostsByUser(username string) []Post
-	VotePost(postID, userID string, vote int) (*Post, error)
+	VotePost(postID string, oldVote, newVote int) (*Post, error)
+	VoteComment(postID, commentID string, oldVote, newVote int) (*Post, error)
+	ListPosts(query ListQuery) (*PostsPage, error)
+	EditPost(postID string, actor role.Actor, request EditPostRequest) (*Post, error)
+	EditComment(postID, commentID string, actor role.Actor, body string) (*Post, error)
+	GetRevisions(postID, commentID string) ([]Revision, error)
+	AddViews(views map[string]int) error
+	// Search - посты по релевантности, без пагинации: дальше первых страниц поиск все равно не листают
+	Search(query SearchQuery) ([]Post, error)
+	// RemovePost и RemoveComment - действия модератора, права проверяет вызывающий, см. role.Roles
+	RemovePost(postID string, removal Removal) (*Post, error)
+	RemoveComment(postID, commentID string, removal Removal) (*Post, error)
+	// SetHidden прячет пост из лент и поиска или возвращает обратно, по ссылке он открывается всегда
+	SetHidden(postID string, hidden bool) error
+	// PostsByLink - посты с той же ссылкой (см. LinkHash), сначала новые. category пустая - во всех сообществах
+	PostsByLink(linkHash, category string) ([]Post, error)
+	// Karma - сумма счетов постов и комментов юзера
+	Karma(userID string) (int, error)
+	// SetPreview сохраняет карточку ссылки, убранным модератором постам не ставится
+	SetPreview(postID string, p preview.Preview) error
+	// VotePoll записывает бюллетень userID в опрос поста, второй раз проголосовать не выйдет - ErrAlreadyVoted
+	VotePoll(postID, userID string, choices []int) (*Post, error)
+	// PollChoices - что userID выбрал в опросах переданных постов, постов без его голоса в мапе нет.
+	// Бюллетеней в постах из лент и GetPost нет, свой выбор юзер видит только через PollChoices
+	PollChoices(userID string, postIDs []string) (map[string][]int, error)
 }
@@ -0,0 +1,23 @@
+package post
+
+import "redditclone/pkg/ranking"
+
+// refreshRank пересчитывает ранги - вызывать после любого изменения голосов или комментов
+func (p *Post) refreshRank() {
+	p.Hot = ranking.Hot(p.Score, p.Created)
+	p.Rising = ranking.Rising(p.Score, len(p.Comments), p.Created)
+	p.Controversial = ranking.Controversy(p.Ups, p.Downs)
+}
+
+// sortKey - значение, по которому пост стоит в ленте с такой сортировкой (кроме new - там время)
+func (p *Post) sortKey(sort ranking.Sort) float64 {
+	switch sort {
+	case ranking.SortTop:
+		return float64(p.Score)
+	case ranking.SortRising:
+		return p.Rising
+	case ranking.SortControversial:
+		return p.Controversial
+	}
+	return p.Hot
+}
@@ -0,0 +1,102 @@
+package post
+
+import (
+	"context"
+	"maps"
+	"redditclone/pkg/vote"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Счетчики голосов в посте денормализованы: хендлер сначала пишет голос в vote.VoteRepo, а потом двигает счетчики
+// через VotePost/VoteComment. Если процесс упал между этими записями или откат после ошибки не прошел,
+// счетчики разъезжаются с голосами и сами уже не сойдутся - их пересчитывает ReconcileVotes
+
+const VoteReconcileInterval = 15 * time.Minute
+
+// Drift - расхождение, найденное проходом ReconcileVotes: версия поста и голоса на момент проверки
+type Drift struct {
+	Version int
+	Counts  vote.Counts
+}
+
+// VoteReconciler - см. PostMongoRepo.ReconcileVotes
+type VoteReconciler interface {
+	ReconcileVotes(votes vote.VoteRepo, suspects map[string]Drift) (map[string]Drift, error)
+}
+
+// RunVoteReconciler сверяет счетчики с голосами каждые every, пока не отменят ctx.
+// Расхождения одного прохода передаются в следующий, см. ReconcileVotes
+func RunVoteReconciler(ctx context.Context, reconciler VoteReconciler, votes vote.VoteRepo, every time.Duration, logger *zap.SugaredLogger) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	suspects := map[string]Drift{}
+	for {
+		select {
+		case <-ticker.C:
+			next, err := reconciler.ReconcileVotes(votes, suspects)
+			if err != nil {
+				logger.Errorf("Error reconciling votes: %v", err)
+				continue
+			}
+			suspects = next
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// confirmed - расхождение прошлого прохода подтвердилось: с тех пор пост не менялся и голоса те же.
+// Голос, который прямо сейчас между двумя записями хендлера, тоже выглядит как расхождение, но к следующему
+// проходу он уже дойдет до поста и поменяет версию - такой чинить нельзя, иначе он посчитается дважды
+func (d Drift) confirmed(version int, counts vote.Counts) bool {
+	return d.Version == version && d.Counts.Post == counts.Post && maps.Equal(d.Counts.Comments, counts.Comments)
+}
+
+// matchesCounts - сходятся ли счетчики поста и его комментов с голосами.
+// Голоса за комменты, которых в посте уже нет, не смотрим - их убирает orphanCommentVotes
+func (p *Post) matchesCounts(counts vote.Counts) bool {
+	if p.Ups != counts.Post.Ups || p.Downs != counts.Post.Downs {
+		return false
+	}
+	for _, c := range p.Comments {
+		tally := counts.Comments[c.ID]
+		if c.Ups != tally.Ups || c.Downs != tally.Downs {
+			return false
+		}
+	}
+	return true
+}
+
+// orphanCommentVotes - комменты, за которые есть голоса, но в посте их уже нет: удалены насовсем
+func (p *Post) orphanCommentVotes(counts vote.Counts) []string {
+	if len(counts.Comments) == 0 {
+		return nil
+	}
+	present := make(map[string]bool, len(p.Comments))
+	for _, c := range p.Comments {
+		present[c.ID] = true
+	}
+	var orphans []string
+	for commentID := range counts.Comments {
+		if !present[commentID] {
+			orphans = append(orphans, commentID)
+		}
+	}
+	return orphans
+}
+
+// setCounts ставит счетчики по голосам и пересчитывает то, что от них зависит
+func (p *Post) setCounts(counts vote.Counts) {
+	p.Ups, p.Downs = counts.Post.Ups, counts.Post.Downs
+	p.Score = p.Ups - p.Downs
+	p.refreshUpvotePercentage()
+	p.refreshRank()
+	for i := range p.Comments {
+		c := &p.Comments[i]
+		tally := counts.Comments[c.ID]
+		c.Ups, c.Downs = tally.Ups, tally.Downs
+		c.Score = c.Ups - c.Downs
+	}
+}
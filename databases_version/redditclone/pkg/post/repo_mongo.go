@@ -7,10 +7,16 @@ import (
 	"go.uber.org/zap"
 	"time"
 
+	"redditclone/pkg/markdown"
+	"redditclone/pkg/preview"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/role"
 	"redditclone/pkg/utils"
+	"redditclone/pkg/vote"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // По сути, можно было бы и без своего айди на постах обойтись, оставив чисто тот _id, что генерируется в монго
@@ -22,14 +28,62 @@ const (
 	commentsKey         = "comments"
 	scoreKey            = "score"
 	votesKey            = "votes"
+	upsKey              = "ups"
+	downsKey            = "downs"
 	upvotePercentageKey = "upvotePercentage"
 	authUsernameKey     = "author.username"
+	authIDKey           = "author.id"
+	createdKey          = "created"
+	hotKey              = "hot"
+	risingKey           = "rising"
+	controversialKey    = "controversial"
+	versionKey          = "version"
+	titleKey            = "title"
+	textKey             = "text"
+	textHTMLKey         = "text_html"
+	bodyKey             = "body"
+	bodyHTMLKey         = "body_html"
+	editedKey           = "edited"
+	revisionsKey        = "revisions"
+	viewsKey            = "views"
+	typeKey             = "type"
+	hostKey             = "host"
+	linkHashKey         = "link_hash"
+	searchScoreKey      = "search_score"
+	removedKey          = "removed"
+	urlKey              = "url"
+	hiddenKey           = "hidden"
+	previewKey          = "preview"
+	mediaKey            = "media"
+	pollKey             = "poll"
+	pollVotersKey       = "poll.voters"
+	pollBallotsKey      = "poll.ballots"
+	pollClosesKey       = "poll.closes"
+	ballotUserKey       = "poll.ballots.user_id"
+
+	maxUpdateAttempts = 5
 )
 
+// sortField - поле в монге, по которому сортируется лента
+func sortField(sort ranking.Sort) string {
+	switch sort {
+	case ranking.SortNew:
+		return createdKey
+	case ranking.SortTop:
+		return scoreKey
+	case ranking.SortRising:
+		return risingKey
+	case ranking.SortControversial:
+		return controversialKey
+	}
+	return hotKey
+}
+
 var (
 	ErrPostNotFound    = errors.New("post not found")
 	ErrCommentNotFound = errors.New("comment not found")
 	ErrUnauthorized    = errors.New("unauthorized")
+	ErrConflict        = errors.New("post is being updated concurrently")
 )
 
 type PostMongoRepo struct {
@@ -44,10 +98,40 @@ func NewMongoRepo(collection *mongo.Collection, logger *zap.SugaredLogger) *Post
 	}
 }
 
+// visible - фильтр лент и поиска: спрятанные по жалобам посты в них не попадают
+func visible(filter bson.M) bson.M {
+	filter[hiddenKey] = bson.M{"$ne": true}
+	return filter
+}
+
+// listingProjection - чего не отдаем в лентах и в GetPost: бюллетени опроса растут с каждым голосом,
+// а нужен из них только выбор того, кто смотрит, см. PollChoices. История правок - только через GetRevisions
+func listingProjection() bson.M {
+	return bson.M{pollBallotsKey: 0, revisionsKey: 0}
+}
+
+// revisionUpdate - запись новой версии в историю: обычно это $push, но если addRevision выкинул старые версии,
+// историю пишем целиком, от гонок спасает версия поста. before - сколько версий было до правки
+func revisionUpdate(post *Post, before int, update bson.M) bson.M {
+	if len(post.Revisions) == before+1 {
+		update["$push"] = bson.M{revisionsKey: post.Revisions[len(post.Revisions)-1]}
+		return update
+	}
+	update["$set"].(bson.M)[revisionsKey] = post.Revisions
+	return update
+}
+
+// старые ручки без пагинации отдают все посты, но хотя бы в порядке hot
+func hotFirst() *options.FindOptions {
+	return options.Find().
+		SetSort(bson.D{{Key: hotKey, Value: -1}, {Key: idKey, Value: -1}}).
+		SetProjection(listingProjection())
+}
+
 func (repo *PostMongoRepo) GetPosts() []*Post {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	postsFromDB, err := repo.collection.Find(ctx, bson.M{})
+	postsFromDB, err := repo.collection.Find(ctx, visible(bson.M{}), hotFirst())
 	if err != nil {
 		return nil
 	}
@@ -71,8 +155,8 @@ func (repo *PostMongoRepo) GetPosts() []*Post {
 func (repo *PostMongoRepo) GetPostsByCategory(category string) []Post {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	filter := bson.M{categoryKey: category}
-	postsFromDB, err := repo.collection.Find(ctx, filter)
+	filter := visible(bson.M{categoryKey: category})
+	postsFromDB, err := repo.collection.Find(ctx, filter, hotFirst())
 	if err != nil {
 		return nil
 	}
@@ -93,6 +177,326 @@ func (repo *PostMongoRepo) GetPostsByCategory(category string) []Post {
 	return posts
 }
 
+// EnsureIndexes создает индексы под ленты: на каждую сортировку общую и по категории, по автору - только new
+func (repo *PostMongoRepo) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: idKey, Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: authUsernameKey, Value: 1}, {Key: createdKey, Value: -1}, {Key: idKey, Value: -1}}},
+	}
+	for _, sort := range []ranking.Sort{ranking.SortHot, ranking.SortTop, ranking.SortNew, ranking.SortRising, ranking.SortControversial} {
+		field := sortField(sort)
+		models = append(models,
+			mongo.IndexModel{Keys: bson.D{{Key: field, Value: -1}, {Key: idKey, Value: -1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: categoryKey, Value: 1}, {Key: field, Value: -1}, {Key: idKey, Value: -1}}},
+		)
+	}
+	// повторы ссылок, у текстовых постов хеша нет - индекс разреженный
+	models = append(models, mongo.IndexModel{
+		Keys:    bson.D{{Key: linkHashKey, Value: 1}, {Key: createdKey, Value: -1}},
+		Options: options.Index().SetSparse(true),
+	})
+	// текстовый индекс на коллекцию может быть только один, так что все поля поиска - в нем
+	models = append(models, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: titleKey, Value: "text"},
+			{Key: textKey, Value: "text"},
+			{Key: hostKey, Value: "text"},
+			{Key: commentsKey + "." + bodyKey, Value: "text"},
+		},
+		Options: options.Index().SetName("search").SetWeights(bson.M{titleKey: 3}).SetDefaultLanguage("none"),
+	})
+	_, err := repo.collection.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		repo.logger.Errorf("Error creating indexes: %v", err)
+		return err
+	}
+	return nil
+}
+
+// BackfillRanks досчитывает ранги постам, созданным до того, как их начали хранить
+func (repo *PostMongoRepo) BackfillRanks() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	postsFromDB, err := repo.collection.Find(ctx, bson.M{hotKey: bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+
+	defer utils.HandleMongoCursorClose(postsFromDB, ctx)
+
+	updated := 0
+	for postsFromDB.Next(ctx) {
+		var post Post
+		if err := postsFromDB.Decode(&post); err != nil {
+			repo.logger.Errorf("Error decoding post: %v", err)
+			continue
+		}
+		post.refreshRank()
+		if _, err := repo.collection.UpdateOne(ctx, bson.M{idKey: post.ID}, bson.M{"$set": rankUpdate(&post)}); err != nil {
+			return err
+		}
+		updated++
+	}
+	repo.logger.Infof("Backfilled ranks for %d posts", updated)
+	return postsFromDB.Err()
+}
+
+// BackfillHosts проставляет хост ссылкам, созданным до поиска, иначе по хосту их не найти
+func (repo *PostMongoRepo) BackfillHosts() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	filter := bson.M{typeKey: "link", hostKey: bson.M{"$exists": false}}
+	postsFromDB, err := repo.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{idKey: 1, urlKey: 1}))
+	if err != nil {
+		return err
+	}
+
+	defer utils.HandleMongoCursorClose(postsFromDB, ctx)
+
+	updated := 0
+	for postsFromDB.Next(ctx) {
+		var post Post
+		if err := postsFromDB.Decode(&post); err != nil {
+			repo.logger.Errorf("Error decoding post: %v", err)
+			continue
+		}
+		if _, err := repo.collection.UpdateOne(ctx, bson.M{idKey: post.ID}, bson.M{"$set": bson.M{hostKey: urlHost(post.URL)}}); err != nil {
+			return err
+		}
+		updated++
+	}
+	repo.logger.Infof("Backfilled hosts for %d posts", updated)
+	return postsFromDB.Err()
+}
+
+// BackfillHTML переводит в HTML тексты постов и комментов, написанные до рендера Markdown
+func (repo *PostMongoRepo) BackfillHTML() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	filter := bson.M{"$or": bson.A{
+		bson.M{textKey: bson.M{"$nin": bson.A{nil, ""}}, textHTMLKey: bson.M{"$exists": false}},
+		bson.M{commentsKey: bson.M{"$elemMatch": bson.M{bodyHTMLKey: bson.M{"$exists": false}}}},
+	}}
+	projection := bson.M{idKey: 1, textKey: 1, commentsKey + "." + bodyKey: 1}
+	postsFromDB, err := repo.collection.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return err
+	}
+
+	defer utils.HandleMongoCursorClose(postsFromDB, ctx)
+
+	updated := 0
+	for postsFromDB.Next(ctx) {
+		var post Post
+		if err := postsFromDB.Decode(&post); err != nil {
+			repo.logger.Errorf("Error decoding post: %v", err)
+			continue
+		}
+		// бэкфилл идет до старта сервера, так что номера комментов не поплывут
+		set := bson.M{}
+		if post.Text != "" {
+			set[textHTMLKey] = markdown.Render(post.Text)
+		}
+		for i, comment := range post.Comments {
+			set[fmt.Sprintf("%s.%d.%s", commentsKey, i, bodyHTMLKey)] = markdown.Render(comment.Body)
+		}
+		if _, err := repo.collection.UpdateOne(ctx, bson.M{idKey: post.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		updated++
+	}
+	repo.logger.Infof("Backfilled HTML for %d posts", updated)
+	return postsFromDB.Err()
+}
+
+// BackfillLinkHashes проставляет хеш ссылкам, созданным до поиска повторов
+func (repo *PostMongoRepo) BackfillLinkHashes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	filter := bson.M{typeKey: "link", removedKey: nil, linkHashKey: bson.M{"$exists": false}}
+	postsFromDB, err := repo.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{idKey: 1, urlKey: 1}))
+	if err != nil {
+		return err
+	}
+
+	defer utils.HandleMongoCursorClose(postsFromDB, ctx)
+
+	updated := 0
+	for postsFromDB.Next(ctx) {
+		var post Post
+		if err := postsFromDB.Decode(&post); err != nil {
+			repo.logger.Errorf("Error decoding post: %v", err)
+			continue
+		}
+		hash := LinkHash(post.URL)
+		if hash == "" {
+			continue
+		}
+		if _, err := repo.collection.UpdateOne(ctx, bson.M{idKey: post.ID}, bson.M{"$set": bson.M{linkHashKey: hash}}); err != nil {
+			return err
+		}
+		updated++
+	}
+	repo.logger.Infof("Backfilled link hashes for %d posts", updated)
+	return postsFromDB.Err()
+}
+
+// MigrateEmbeddedVotes - разовая миграция со старой схемы, где голоса лежали массивом в посте:
+// переносит их в votes, считает счетчики и убирает массив. Повторный запуск ничего не найдет
+func (repo *PostMongoRepo) MigrateEmbeddedVotes(votes vote.VoteRepo) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	postsFromDB, err := repo.collection.Find(ctx, bson.M{votesKey: bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+
+	defer utils.HandleMongoCursorClose(postsFromDB, ctx)
+
+	migrated := 0
+	for postsFromDB.Next(ctx) {
+		var post Post
+		var embedded struct {
+			Votes []struct {
+				User string `bson:"user"`
+				Vote int    `bson:"vote"`
+			} `bson:"votes"`
+		}
+		if err := postsFromDB.Decode(&post); err != nil {
+			repo.logger.Errorf("Error decoding post: %v", err)
+			continue
+		}
+		if err := postsFromDB.Decode(&embedded); err != nil {
+			repo.logger.Errorf("Error decoding votes of post %s: %v", post.ID, err)
+			continue
+		}
+
+		post.Score, post.Ups, post.Downs = 0, 0, 0
+		for _, v := range embedded.Votes {
+			// SetVote с тем же голосом ничего не меняет, так что упавшую на середине миграцию можно просто перезапустить
+			if _, err := votes.SetVote(post.ID, v.User, v.Vote); err != nil {
+				return err
+			}
+			post.applyVote(0, v.Vote)
+		}
+		post.refreshRank()
+
+		set := rankUpdate(&post)
+		set[scoreKey] = post.Score
+		set[upsKey] = post.Ups
+		set[downsKey] = post.Downs
+		set[upvotePercentageKey] = post.UpvotePercentage
+		update := bson.M{"$set": set, "$unset": bson.M{votesKey: ""}}
+		if _, err := repo.collection.UpdateOne(ctx, bson.M{idKey: post.ID}, update); err != nil {
+			return err
+		}
+		migrated++
+	}
+	repo.logger.Infof("Moved embedded votes out of %d posts", migrated)
+	return postsFromDB.Err()
+}
+
+func rankUpdate(post *Post) bson.M {
+	return bson.M{
+		hotKey:           post.Hot,
+		risingKey:        post.Rising,
+		controversialKey: post.Controversial,
+	}
+}
+
+func (repo *PostMongoRepo) ListPosts(query ListQuery) (*PostsPage, error) {
+	if query.After != "" && query.Before != "" {
+		return nil, ErrBadCursor
+	}
+
+	filter := visible(bson.M{})
+	if query.Category != "" {
+		filter[categoryKey] = query.Category
+	}
+	if query.Author != "" {
+		filter[authUsernameKey] = query.Author
+	}
+	if query.Feed != nil {
+		// $or на верхнем уровне занят курсором
+		filter["$and"] = bson.A{bson.M{"$or": bson.A{
+			bson.M{categoryKey: bson.M{"$in": nonNil(query.Feed.Categories)}},
+			bson.M{authUsernameKey: bson.M{"$in": nonNil(query.Feed.Authors)}},
+		}}}
+	}
+	if query.IDs != nil {
+		filter[idKey] = bson.M{"$in": query.IDs}
+	}
+
+	// лента идет по убыванию (ключ сортировки, id). Для before идем от курсора в обратную сторону,
+	// а потом разворачиваем, чтобы на выходе порядок был как в ленте
+	sort := query.sort()
+	field := sortField(sort)
+	if since := query.since(time.Now()); !since.IsZero() {
+		filter[createdKey] = bson.M{"$gte": since}
+	}
+
+	order := -1
+	cursorStr, cmp := query.After, "$lt"
+	if query.Before != "" {
+		order = 1
+		cursorStr, cmp = query.Before, "$gt"
+	}
+	if cursorStr != "" {
+		c, err := decodeCursor(cursorStr, sort)
+		if err != nil {
+			return nil, err
+		}
+		var key interface{} = c.Key
+		if sort == ranking.SortNew {
+			key = c.Created
+		}
+		filter["$or"] = bson.A{
+			bson.M{field: bson.M{cmp: key}},
+			bson.M{field: key, idKey: bson.M{cmp: c.ID}},
+		}
+	}
+
+	limit := query.limit()
+	opts := options.Find().
+		SetSort(bson.D{{Key: field, Value: order}, {Key: idKey, Value: order}}).
+		SetProjection(listingProjection()).
+		SetLimit(int64(limit + 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	postsFromDB, err := repo.collection.Find(ctx, filter, opts)
+	if err != nil {
+		repo.logger.Errorf("Error listing posts: %v", err)
+		return nil, fmt.Errorf("fail ListPosts: %v", err)
+	}
+
+	defer utils.HandleMongoCursorClose(postsFromDB, ctx)
+
+	posts := make([]Post, 0, limit+1)
+	for postsFromDB.Next(ctx) {
+		var post Post
+		if err := postsFromDB.Decode(&post); err != nil {
+			repo.logger.Errorf("Error decoding post: %v", err)
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	hasMore := len(posts) > limit
+	if hasMore {
+		posts = posts[:limit]
+	}
+	if order == 1 {
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+	}
+	repo.logger.Infof("Fetched page of %d posts from DB", len(posts))
+	return newPostsPage(posts, query, hasMore), nil
+}
+
 func (repo *PostMongoRepo) CreatePost(request NewPostRequest, username, userID string) *Post {
 	postID := utils.GenerateID()
 	createdTime := time.Now().UTC()
@@ -102,17 +506,29 @@ func (repo *PostMongoRepo) CreatePost(request NewPostRequest, username, userID s
 		Category: request.Category,
 		Type:     request.Type,
 		Title:    request.Title,
-		Score:    1,
+		Flair:    request.Flair,
 		Views:    1,
-		Votes:    []Vote{{User: userID, Vote: 1}},
 		Comments: []Comment{},
 		Created:  createdTime,
 	}
+	// сам голос автора записывает хендлер в vote.VoteRepo, тут только счетчики
+	newPost.applyVote(0, 1)
+	newPost.Vote = 1
 	if request.Type == "link" {
 		newPost.URL = request.URL
+		newPost.Host = urlHost(request.URL)
+		newPost.LinkHash = LinkHash(request.URL)
 	} else {
 		newPost.Text = request.Text
+		newPost.TextHTML = markdown.Render(request.Text)
+	}
+	if request.Type == "image" {
+		newPost.Media = request.Media
 	}
+	if request.Type == "poll" && request.Poll != nil {
+		newPost.Poll = request.Poll.poll()
+	}
+	newPost.refreshRank()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -130,7 +546,8 @@ func (repo *PostMongoRepo) GetPost(id string) (Post, error) {
 	defer cancel()
 
 	var post Post
-	err := repo.collection.FindOne(ctx, bson.M{idKey: id}).Decode(&post)
+	opts := options.FindOne().SetProjection(listingProjection())
+	err := repo.collection.FindOne(ctx, bson.M{idKey: id}, opts).Decode(&post)
 
 	if err != nil {
 		repo.logger.Errorf("Error finding post: %v", err)
@@ -141,191 +558,340 @@ func (repo *PostMongoRepo) GetPost(id string) (Post, error) {
 	return post, nil
 }
 
-func (repo *PostMongoRepo) AddComment(postID, username, userID, comment string) (*Post, error) {
+// updatePost - оптимистичная блокировка: читаем пост, mutate меняет его в памяти и возвращает апдейт,
+// а записываем только если версия в базе не поменялась. Иначе кто-то успел раньше - перечитываем и пробуем снова
+func (repo *PostMongoRepo) updatePost(postID string, mutate func(post *Post) (bson.M, error)) (*Post, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	filter := bson.M{idKey: postID}
 
-	var post Post
-	err := repo.collection.FindOne(ctx, filter).Decode(&post)
-	if err != nil {
-		repo.logger.Errorf("Error finding post: %v", err)
-		return nil, ErrPostNotFound
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var post Post
+		err := repo.collection.FindOne(ctx, bson.M{idKey: postID}).Decode(&post)
+		if err != nil {
+			repo.logger.Errorf("Error finding post: %v", err)
+			return nil, ErrPostNotFound
+		}
+		repo.logger.Debugf("Successfully fetched post: %s", post.ID)
+
+		version := post.Version
+		update, err := mutate(&post)
+		if err != nil {
+			return nil, err
+		}
+		update["$inc"] = bson.M{versionKey: 1}
+
+		res, err := repo.collection.UpdateOne(ctx, versionFilter(postID, version), update)
+		if err != nil {
+			repo.logger.Errorf("Error updating post: %v", err)
+			return nil, fmt.Errorf("fail updatePost: %w", err)
+		}
+		if res.MatchedCount == 1 {
+			post.Version = version + 1
+			return &post, nil
+		}
+		repo.logger.Debugf("Post %s was updated concurrently, retrying", postID)
 	}
-	repo.logger.Debugf("Successfully fetched post: %s", post.ID)
+	repo.logger.Errorf("Gave up updating post %s after %d attempts", postID, maxUpdateAttempts)
+	return nil, ErrConflict
+}
 
-	newComment := Comment{
-		ID:      utils.GenerateID(),
-		Body:    comment,
-		Created: time.Now().UTC(),
-		Author:  Author{Username: username, ID: userID},
+// ReconcileVotes считает все голоса одним агрегатом и сверяет с ними счетчики постов. Расхождение чиним, только если оно
+// уже было в suspects с той же версией поста и теми же голосами, см. Drift.confirmed, а новые возвращаем
+// для следующего прохода. Запись - с проверкой версии: если пост успел поменяться, просто проверим его в следующий раз.
+// Голоса за комменты, которых в посте нет, удаляем: агрегат был до чтения постов, так что новых комментов среди них быть не может
+func (repo *PostMongoRepo) ReconcileVotes(votes vote.VoteRepo, suspects map[string]Drift) (map[string]Drift, error) {
+	allCounts, err := votes.AllCounts()
+	if err != nil {
+		return suspects, err
 	}
 
-	update := bson.M{"$push": bson.M{commentsKey: newComment}}
-	_, err = repo.collection.UpdateOne(ctx, filter, update)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	// для сверки и пересчета рейтингов хватает счетчиков, тексты и история правок не нужны
+	projection := bson.M{
+		idKey: 1, versionKey: 1, createdKey: 1, scoreKey: 1, upsKey: 1, downsKey: 1,
+		commentsKey + "." + idKey: 1, commentsKey + "." + upsKey: 1, commentsKey + "." + downsKey: 1,
+	}
+	postsFromDB, err := repo.collection.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
 	if err != nil {
-		repo.logger.Errorf("Error updating post with new comment: %v", err)
-		return nil, fmt.Errorf("fail AddComment: %v", err)
+		return suspects, err
 	}
-	repo.logger.Debugf("Successfully updated post with new comment: %s", post.ID)
 
-	post.Comments = append(post.Comments, newComment)
+	defer utils.HandleMongoCursorClose(postsFromDB, ctx)
 
-	return &post, nil
+	found := make(map[string]Drift)
+	fixed, orphans := 0, 0
+	for postsFromDB.Next(ctx) {
+		var post Post
+		if err := postsFromDB.Decode(&post); err != nil {
+			repo.logger.Errorf("Error decoding post: %v", err)
+			continue
+		}
+		counts := allCounts[post.ID]
+		if deleted := post.orphanCommentVotes(counts); len(deleted) > 0 {
+			if err := votes.DeleteCommentVotes(post.ID, deleted); err != nil {
+				return suspects, err
+			}
+			for _, commentID := range deleted {
+				delete(counts.Comments, commentID)
+			}
+			orphans += len(deleted)
+		}
+		if post.matchesCounts(counts) {
+			continue
+		}
+		if drift, ok := suspects[post.ID]; !ok || !drift.confirmed(post.Version, counts) {
+			found[post.ID] = Drift{Version: post.Version, Counts: counts}
+			continue
+		}
+
+		post.setCounts(counts)
+		set := rankUpdate(&post)
+		set[scoreKey] = post.Score
+		set[upsKey] = post.Ups
+		set[downsKey] = post.Downs
+		set[upvotePercentageKey] = post.UpvotePercentage
+		for i, c := range post.Comments {
+			prefix := fmt.Sprintf("%s.%d.", commentsKey, i)
+			set[prefix+scoreKey] = c.Score
+			set[prefix+upsKey] = c.Ups
+			set[prefix+downsKey] = c.Downs
+		}
+		update := bson.M{"$set": set, "$inc": bson.M{versionKey: 1}}
+		res, err := repo.collection.UpdateOne(ctx, versionFilter(post.ID, post.Version), update)
+		if err != nil {
+			return found, err
+		}
+		if res.MatchedCount == 1 {
+			repo.logger.Warnf("Fixed vote counters of post %s: ups %d, downs %d", post.ID, post.Ups, post.Downs)
+			fixed++
+		}
+	}
+	repo.logger.Infof("Reconciled votes: fixed %d posts, %d more look off, dropped votes of %d deleted comments", fixed, len(found), orphans)
+	return found, postsFromDB.Err()
 }
 
-func (repo *PostMongoRepo) DeleteComment(postID, commentID, userID string) (*Post, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	filter := bson.M{idKey: postID}
+// nil-слайс уходит в монгу как null, а $in нужен массив
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
 
-	var post Post
-	err := repo.collection.FindOne(ctx, filter).Decode(&post)
-	if err != nil {
-		repo.logger.Errorf("Error finding post: %v", err)
-		return nil, ErrPostNotFound
+// у постов, созданных до появления версий, поля нет вообще - {version: null} матчит и такие
+func versionFilter(postID string, version int) bson.M {
+	if version == 0 {
+		return bson.M{idKey: postID, versionKey: bson.M{"$in": bson.A{nil, 0}}}
 	}
-	repo.logger.Debugf("Successfully fetched post: %s", post.ID)
+	return bson.M{idKey: postID, versionKey: version}
+}
 
-	commentIndex := -1
-	for i, c := range post.Comments {
-		if c.ID == commentID {
-			commentIndex = i
-			break
-		}
+func (repo *PostMongoRepo) AddComment(postID, username, userID, comment string) (*Post, error) {
+	return repo.addComment(postID, "", username, userID, comment)
+}
+
+func (repo *PostMongoRepo) AddReply(postID, parentID, username, userID, comment string) (*Post, error) {
+	return repo.addComment(postID, parentID, username, userID, comment)
+}
+
+func (repo *PostMongoRepo) addComment(postID, parentID, username, userID, comment string) (*Post, error) {
+	newComment := Comment{
+		ID:       utils.GenerateID(),
+		Body:     comment,
+		BodyHTML: markdown.Render(comment),
+		Created:  time.Now().UTC(),
+		Author:   Author{Username: username, ID: userID},
+		ParentID: parentID,
 	}
 
-	if commentIndex == -1 || post.Comments[commentIndex].Author.ID != userID {
-		if commentIndex == -1 {
-			repo.logger.Errorf("Comment not found: %s", commentID)
-			return nil, ErrCommentNotFound
+	post, err := repo.updatePost(postID, func(post *Post) (bson.M, error) {
+		if err := post.addComment(newComment); err != nil {
+			return nil, err
 		}
-		repo.logger.Errorf("Unauthorized to delete comment: %s", commentID)
-		return nil, ErrUnauthorized
+		post.refreshRank()
+		return bson.M{
+			"$push": bson.M{commentsKey: newComment},
+			"$set":  rankUpdate(post),
+		}, nil
+	})
+	if err != nil {
+		repo.logger.Errorf("Error adding comment to post %s: %v", postID, err)
+		return nil, err
 	}
+	repo.logger.Debugf("Successfully updated post with new comment: %s", post.ID)
+
+	return post, nil
+}
 
-	update := bson.M{"$pull": bson.M{commentsKey: bson.M{idKey: commentID}}}
-	_, err = repo.collection.UpdateOne(ctx, filter, update)
+func (repo *PostMongoRepo) DeleteComment(postID, commentID string, actor role.Actor) (*Post, error) {
+	post, err := repo.updatePost(postID, func(post *Post) (bson.M, error) {
+		if err := post.removeComment(commentID, actor); err != nil {
+			repo.logger.Errorf("Error deleting comment %s: %v", commentID, err)
+			return nil, err
+		}
+		post.refreshRank()
+		// вместе с комментом могли уйти надгробия над ним, а мог остаться сам коммент надгробием -
+		// одним $pull это не выразить, поэтому пишем список целиком, от гонок спасает версия
+		set := rankUpdate(post)
+		set[commentsKey] = post.Comments
+		set[revisionsKey] = post.Revisions
+		return bson.M{"$set": set}, nil
+	})
 	if err != nil {
-		repo.logger.Errorf("Error deleting comment: %v", err)
-		return nil, fmt.Errorf("fail DeleteComment: %v", err)
+		return nil, err
 	}
 	repo.logger.Debugf("Successfully deleted comment: %s", commentID)
-	err = repo.collection.FindOne(ctx, filter).Decode(&post)
-	if err != nil {
-		repo.logger.Errorf("Error finding post after comment deletion: %v", err)
-		return nil, ErrPostNotFound
-	}
-	repo.logger.Debugf("Successfully fetched post after comment deletion: %s", post.ID)
-	return &post, nil
+	return post, nil
 }
 
-func (repo *PostMongoRepo) VotePost(postID, userID string, vote int) (*Post, error) {
+// GetCommentTree - ответы на коммент parentID деревом, для догрузки глубоких веток
+func (repo *PostMongoRepo) GetCommentTree(postID, parentID string, depth int) ([]Comment, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	filter := bson.M{idKey: postID}
 
 	var post Post
-	err := repo.collection.FindOne(ctx, filter).Decode(&post)
-	if err != nil {
+	opts := options.FindOne().SetProjection(bson.M{idKey: 1, commentsKey: 1})
+	if err := repo.collection.FindOne(ctx, bson.M{idKey: postID}, opts).Decode(&post); err != nil {
 		repo.logger.Errorf("Error finding post: %v", err)
 		return nil, ErrPostNotFound
 	}
-	repo.logger.Debugf("Successfully fetched post: %s", post.ID)
+	if parentID != "" && post.findComment(parentID) == -1 {
+		return nil, ErrCommentNotFound
+	}
+	return CommentTree(post.Comments, parentID, depth), nil
+}
 
-	existingIndex := -1
-	for i, v := range post.Votes {
-		if v.User == userID {
-			existingIndex = i
-			break
-		}
+// VotePost пересчитывает счетчики поста, когда голос юзера поменялся с oldVote на newVote.
+// Сам голос к этому моменту уже записан в vote.VoteRepo
+func (repo *PostMongoRepo) VotePost(postID string, oldVote, newVote int) (*Post, error) {
+	post, err := repo.updatePost(postID, func(post *Post) (bson.M, error) {
+		post.applyVote(oldVote, newVote)
+		post.refreshRank()
+		return bson.M{"$set": bson.M{
+			scoreKey:            post.Score,
+			upsKey:              post.Ups,
+			downsKey:            post.Downs,
+			upvotePercentageKey: post.UpvotePercentage,
+			hotKey:              post.Hot,
+			risingKey:           post.Rising,
+			controversialKey:    post.Controversial,
+		}}, nil
+	})
+	if err != nil {
+		repo.logger.Errorf("Error voting post %s: %v", postID, err)
+		return nil, err
 	}
+	repo.logger.Debugf("Successfully updated post: %s", post.ID)
+	return post, nil
+}
 
-	switch vote {
-	case 1:
-		// upvote
-		if existingIndex != -1 {
-			// уже был голос
-			if post.Votes[existingIndex].Vote != 1 {
-				post.Score += 2
-				post.Votes[existingIndex].Vote = 1
-			}
-		} else {
-			// новый голос
-			post.Score++
-			post.Votes = append(post.Votes, Vote{User: userID, Vote: 1})
-		}
-	case -1:
-		// downvote
-		if existingIndex != -1 {
-			// уже был голос
-			if post.Votes[existingIndex].Vote != -1 {
-				post.Score -= 2
-				post.Votes[existingIndex].Vote = -1
-			}
-		} else {
-			// новый голос
-			post.Score--
-			post.Votes = append(post.Votes, Vote{User: userID, Vote: -1})
-		}
-	case 0:
-		// unvote
-		if existingIndex != -1 {
-			// уже был голос
-			switch post.Votes[existingIndex].Vote {
-			case 1:
-				// unvote upvote
-				post.Score--
-			case -1:
-				// unvote downvote
-				post.Score++
-			}
-			post.Votes = append(post.Votes[:existingIndex], post.Votes[existingIndex+1:]...)
+// VoteComment - то же, что VotePost, но для счетчиков коммента. Индекс коммента в массиве между чтением
+// и записью не сдвинется: updatePost пишет только поверх той же версии поста
+func (repo *PostMongoRepo) VoteComment(postID, commentID string, oldVote, newVote int) (*Post, error) {
+	post, err := repo.updatePost(postID, func(post *Post) (bson.M, error) {
+		i := post.findComment(commentID)
+		if i == -1 || post.Comments[i].Deleted {
+			return nil, ErrCommentNotFound
 		}
+		comment := &post.Comments[i]
+		comment.applyVote(oldVote, newVote)
+		prefix := fmt.Sprintf("%s.%d.", commentsKey, i)
+		return bson.M{"$set": bson.M{
+			prefix + scoreKey: comment.Score,
+			prefix + upsKey:   comment.Ups,
+			prefix + downsKey: comment.Downs,
+		}}, nil
+	})
+	if err != nil {
+		repo.logger.Errorf("Error voting comment %s of post %s: %v", commentID, postID, err)
+		return nil, err
 	}
+	repo.logger.Debugf("Successfully voted comment: %s", commentID)
+	return post, nil
+}
 
-	repo.updateUpvotePercentage(&post)
-
-	update := bson.M{"$set": bson.M{
-		scoreKey:            post.Score,
-		votesKey:            post.Votes,
-		upvotePercentageKey: post.UpvotePercentage,
-	}}
-	_, err = repo.collection.UpdateOne(ctx, filter, update)
+// EditPost - правка поста автором, прежняя версия дописывается в revisions тем же апдейтом
+func (repo *PostMongoRepo) EditPost(postID string, actor role.Actor, request EditPostRequest) (*Post, error) {
+	post, err := repo.updatePost(postID, func(post *Post) (bson.M, error) {
+		before := len(post.Revisions)
+		if err := post.edit(request, actor, time.Now().UTC()); err != nil {
+			return nil, err
+		}
+		return revisionUpdate(post, before, bson.M{
+			"$set": bson.M{titleKey: post.Title, textKey: post.Text, textHTMLKey: post.TextHTML, editedKey: post.Edited},
+		}), nil
+	})
 	if err != nil {
-		repo.logger.Errorf("Error updating post: %v", err)
-		return nil, fmt.Errorf("fail VotePost: %v", err)
+		repo.logger.Errorf("Error editing post %s: %v", postID, err)
+		return nil, err
 	}
-	repo.logger.Debugf("Successfully updated post: %s", post.ID)
+	repo.logger.Debugf("Successfully edited post: %s", postID)
+	return post, nil
+}
 
-	err = repo.collection.FindOne(ctx, filter).Decode(&post)
+func (repo *PostMongoRepo) EditComment(postID, commentID string, actor role.Actor, body string) (*Post, error) {
+	post, err := repo.updatePost(postID, func(post *Post) (bson.M, error) {
+		before := len(post.Revisions)
+		i, err := post.editComment(commentID, actor, body, time.Now().UTC())
+		if err != nil {
+			return nil, err
+		}
+		prefix := fmt.Sprintf("%s.%d.", commentsKey, i)
+		return revisionUpdate(post, before, bson.M{
+			"$set": bson.M{
+				prefix + bodyKey:     post.Comments[i].Body,
+				prefix + bodyHTMLKey: post.Comments[i].BodyHTML,
+				prefix + editedKey:   post.Comments[i].Edited,
+			},
+		}), nil
+	})
 	if err != nil {
-		repo.logger.Errorf("Error finding post: %v", err)
-		return nil, ErrPostNotFound
+		repo.logger.Errorf("Error editing comment %s of post %s: %v", commentID, postID, err)
+		return nil, err
 	}
-	return &post, nil
+	repo.logger.Debugf("Successfully edited comment: %s", commentID)
+	return post, nil
 }
 
-func (repo *PostMongoRepo) updateUpvotePercentage(post *Post) {
-	totalVotes := len(post.Votes)
-	upvotes := 0
+// GetRevisions - прежние версии поста (commentID == "") или одного его коммента
+func (repo *PostMongoRepo) GetRevisions(postID, commentID string) ([]Revision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	for _, v := range post.Votes {
-		if v.Vote == 1 {
-			upvotes++
-		}
+	var post Post
+	opts := options.FindOne().SetProjection(bson.M{idKey: 1, commentsKey: 1, revisionsKey: 1})
+	if err := repo.collection.FindOne(ctx, bson.M{idKey: postID}, opts).Decode(&post); err != nil {
+		repo.logger.Errorf("Error finding post: %v", err)
+		return nil, ErrPostNotFound
 	}
+	return post.revisions(commentID)
+}
 
-	if totalVotes == 0 {
-		post.UpvotePercentage = 100
-	} else {
-		post.UpvotePercentage = int((float64(upvotes) / float64(totalVotes)) * 100)
+// AddViews прибавляет накопленные просмотры пачкой, см. views.Counter. Версию не трогает:
+// $inc не затирает ничьих изменений, а views никто не пишет целиком
+func (repo *PostMongoRepo) AddViews(views map[string]int) error {
+	if len(views) == 0 {
+		return nil
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	repo.logger.Debugf("Updated upvote percentage for post %s: %d", post.ID, post.UpvotePercentage)
+	models := make([]mongo.WriteModel, 0, len(views))
+	for postID, n := range views {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{idKey: postID}).
+			SetUpdate(bson.M{"$inc": bson.M{viewsKey: n}}))
+	}
+	if _, err := repo.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		repo.logger.Errorf("Error adding views: %v", err)
+		return err
+	}
+	repo.logger.Debugf("Successfully added views to %d posts", len(views))
+	return nil
 }
 
-func (repo *PostMongoRepo) DeletePost(postID, userID string) (bool, error) {
+func (repo *PostMongoRepo) DeletePost(postID string, actor role.Actor) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	filter := bson.M{idKey: postID}
@@ -338,7 +904,7 @@ func (repo *PostMongoRepo) DeletePost(postID, userID string) (bool, error) {
 	}
 	repo.logger.Debugf("Successfully fetched post: %s", post.ID)
 
-	if post.Author.ID != userID {
+	if !role.CanDelete(actor, role.Target{AuthorID: post.Author.ID, Community: post.Category}) {
 		repo.logger.Errorf("Unauthorized to delete post: %s", postID)
 		return false, ErrUnauthorized
 	}
@@ -362,7 +928,7 @@ func (repo *PostMongoRepo) PostsByUser(username string) []Post {
 	defer cancel()
 	filter := bson.M{authUsernameKey: username}
 
-	postsFromDB, err := repo.collection.Find(ctx, filter)
+	postsFromDB, err := repo.collection.Find(ctx, filter, hotFirst())
 	posts := make([]Post, 0)
 	if err != nil {
 		repo.logger.Errorf("Error finding posts by user: %v", err)
@@ -384,3 +950,319 @@ func (repo *PostMongoRepo) PostsByUser(username string) []Post {
 
 	return posts
 }
+
+func (repo *PostMongoRepo) PostsByLink(linkHash, category string) ([]Post, error) {
+	filter := bson.M{linkHashKey: linkHash}
+	if category != "" {
+		filter[categoryKey] = category
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: createdKey, Value: -1}}).
+		SetProjection(listingProjection()).
+		SetLimit(MaxDuplicates)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	postsFromDB, err := repo.collection.Find(ctx, filter, opts)
+	if err != nil {
+		repo.logger.Errorf("Error finding posts by link: %v", err)
+		return nil, err
+	}
+
+	defer utils.HandleMongoCursorClose(postsFromDB, ctx)
+
+	posts := make([]Post, 0)
+	for postsFromDB.Next(ctx) {
+		var post Post
+		if err := postsFromDB.Decode(&post); err != nil {
+			repo.logger.Errorf("Error decoding post: %v", err)
+			continue
+		}
+		posts = append(posts, post)
+	}
+	return posts, postsFromDB.Err()
+}
+
+// Search идет через текстовый индекс: монга сама режет запрос на слова и ранжирует по совпадениям,
+// посты находятся по любому из слов, выше те, где совпало больше
+func (repo *PostMongoRepo) Search(query SearchQuery) ([]Post, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+	filter := visible(bson.M{"$text": bson.M{"$search": query.Text}})
+	if query.Category != "" {
+		filter[categoryKey] = query.Category
+	}
+	if query.Author != "" {
+		filter[authUsernameKey] = query.Author
+	}
+	if query.Type != "" {
+		filter[typeKey] = query.Type
+	}
+	created := bson.M{}
+	if !query.From.IsZero() {
+		created["$gte"] = query.From
+	}
+	if !query.To.IsZero() {
+		created["$lt"] = query.To
+	}
+	if len(created) > 0 {
+		filter[createdKey] = created
+	}
+
+	textScore := bson.M{"$meta": "textScore"}
+	projection := listingProjection()
+	projection[searchScoreKey] = textScore
+	opts := options.Find().
+		SetProjection(projection).
+		SetSort(bson.D{{Key: searchScoreKey, Value: textScore}, {Key: createdKey, Value: -1}}).
+		SetLimit(int64(query.limit()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	postsFromDB, err := repo.collection.Find(ctx, filter, opts)
+	if err != nil {
+		repo.logger.Errorf("Error searching posts: %v", err)
+		return nil, err
+	}
+
+	defer utils.HandleMongoCursorClose(postsFromDB, ctx)
+
+	posts := make([]Post, 0)
+	for postsFromDB.Next(ctx) {
+		var post Post
+		if err := postsFromDB.Decode(&post); err != nil {
+			repo.logger.Errorf("Error decoding post: %v", err)
+			continue
+		}
+		posts = append(posts, post)
+	}
+	return posts, postsFromDB.Err()
+}
+
+func (repo *PostMongoRepo) RemovePost(postID string, removal Removal) (*Post, error) {
+	post, err := repo.updatePost(postID, func(post *Post) (bson.M, error) {
+		if err := post.remove(removal); err != nil {
+			return nil, err
+		}
+		return bson.M{
+			"$set": bson.M{
+				textKey:      post.Text,
+				textHTMLKey:  post.TextHTML,
+				urlKey:       post.URL,
+				removedKey:   post.Removed,
+				revisionsKey: post.Revisions,
+			},
+			"$unset": bson.M{hostKey: "", linkHashKey: "", previewKey: "", mediaKey: "", pollKey: "", editedKey: ""},
+		}, nil
+	})
+	if err != nil {
+		repo.logger.Errorf("Error removing post %s: %v", postID, err)
+		return nil, err
+	}
+	repo.logger.Debugf("Successfully removed post: %s", postID)
+	return post, nil
+}
+
+func (repo *PostMongoRepo) RemoveComment(postID, commentID string, removal Removal) (*Post, error) {
+	post, err := repo.updatePost(postID, func(post *Post) (bson.M, error) {
+		i, err := post.removeCommentAsModerator(commentID, removal)
+		if err != nil {
+			return nil, err
+		}
+		prefix := fmt.Sprintf("%s.%d.", commentsKey, i)
+		return bson.M{
+			"$set": bson.M{
+				prefix + bodyKey:     post.Comments[i].Body,
+				prefix + bodyHTMLKey: post.Comments[i].BodyHTML,
+				prefix + removedKey:  post.Comments[i].Removed,
+				revisionsKey:         post.Revisions,
+			},
+			"$unset": bson.M{prefix + editedKey: ""},
+		}, nil
+	})
+	if err != nil {
+		repo.logger.Errorf("Error removing comment %s of post %s: %v", commentID, postID, err)
+		return nil, err
+	}
+	repo.logger.Debugf("Successfully removed comment: %s", commentID)
+	return post, nil
+}
+
+// SetHidden без версии, как AddViews: трогает одно поле, которое updatePost не пишет
+func (repo *PostMongoRepo) SetHidden(postID string, hidden bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	update := bson.M{"$unset": bson.M{hiddenKey: ""}}
+	if hidden {
+		update = bson.M{"$set": bson.M{hiddenKey: true}}
+	}
+	res, err := repo.collection.UpdateOne(ctx, bson.M{idKey: postID}, update)
+	if err != nil {
+		repo.logger.Errorf("Error setting hidden=%v on post %s: %v", hidden, postID, err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrPostNotFound
+	}
+	repo.logger.Debugf("Successfully set hidden=%v on post %s", hidden, postID)
+	return nil
+}
+
+// Karma считается агрегацией на лету: индекса по авторам комментов нет, но нужна она только
+// автомодератору и только для правил с порогом кармы
+func (repo *PostMongoRepo) Karma(userID string) (int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{authIDKey: userID},
+			bson.M{commentsKey + "." + authIDKey: userID},
+		}}}},
+		{{Key: "$project", Value: bson.M{
+			"posts": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$" + authIDKey, userID}}, "$" + scoreKey, 0}},
+			"comments": bson.M{"$sum": bson.M{"$map": bson.M{
+				"input": bson.M{"$filter": bson.M{
+					"input": "$" + commentsKey,
+					"cond":  bson.M{"$eq": bson.A{"$$this." + authIDKey, userID}},
+				}},
+				"in": "$$this." + scoreKey,
+			}}},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   nil,
+			"karma": bson.M{"$sum": bson.M{"$add": bson.A{"$posts", "$comments"}}},
+		}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := repo.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		repo.logger.Errorf("Error counting karma of %s: %v", userID, err)
+		return 0, err
+	}
+
+	defer utils.HandleMongoCursorClose(cursor, ctx)
+
+	var result struct {
+		Karma int `bson:"karma"`
+	}
+	if cursor.Next(ctx) {
+		if err = cursor.Decode(&result); err != nil {
+			repo.logger.Errorf("Error decoding karma of %s: %v", userID, err)
+			return 0, err
+		}
+	}
+	return result.Karma, cursor.Err()
+}
+
+// SetPreview без версии, как SetHidden. Превью приходит позже создания поста,
+// модератор мог успеть убрать пост - тогда карточку с убранной ссылкой не ставим
+func (repo *PostMongoRepo) SetPreview(postID string, p preview.Preview) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.M{idKey: postID, removedKey: nil}
+	res, err := repo.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{previewKey: p}})
+	if err != nil {
+		repo.logger.Errorf("Error setting preview on post %s: %v", postID, err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrPostNotFound
+	}
+	repo.logger.Debugf("Successfully set preview on post %s", postID)
+	return nil
+}
+
+// VotePoll без версии, как SetHidden: бюллетень и счетчики пишутся одним апдейтом, а что юзер еще не голосовал,
+// проверяет фильтр. Так два параллельных голоса одного юзера оба не пройдут, а чужие голоса друг другу не мешают
+func (repo *PostMongoRepo) VotePoll(postID, userID string, choices []int) (*Post, error) {
+	post, err := repo.pollPost(postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	ballot, err := post.votePoll(userID, choices, now)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{idKey: postID, removedKey: nil, ballotUserKey: bson.M{"$ne": userID}}
+	if post.Poll.Closes != nil {
+		filter[pollClosesKey] = bson.M{"$gt": now}
+	}
+	inc := bson.M{pollVotersKey: 1}
+	for _, choice := range ballot.Choices {
+		inc[fmt.Sprintf("%s.options.%d.%s", pollKey, choice, votesKey)] = 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := repo.collection.UpdateOne(ctx, filter, bson.M{
+		"$push": bson.M{pollBallotsKey: ballot},
+		"$inc":  inc,
+	})
+	if err != nil {
+		repo.logger.Errorf("Error voting poll of post %s: %v", postID, err)
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		// между чтением и записью пост удалили, убрали или этот же юзер успел проголосовать - перечитываем, чтобы сказать, что именно
+		current, err := repo.pollPost(postID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = current.votePoll(userID, choices, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrConflict
+	}
+	repo.logger.Debugf("Successfully voted poll of post %s", postID)
+	return &post, nil
+}
+
+// pollPost - пост с бюллетенем userID, если тот уже голосовал: остальные бюллетени GetPost не отдает, см. listingProjection
+func (repo *PostMongoRepo) pollPost(postID, userID string) (Post, error) {
+	post, err := repo.GetPost(postID)
+	if err != nil || post.Poll == nil {
+		return post, err
+	}
+	choices, err := repo.PollChoices(userID, []string{postID})
+	if err != nil {
+		return Post{}, err
+	}
+	if c, ok := choices[postID]; ok {
+		post.Poll.Ballots = []Ballot{{UserID: userID, Choices: c}}
+	}
+	return post, nil
+}
+
+func (repo *PostMongoRepo) PollChoices(userID string, postIDs []string) (map[string][]int, error) {
+	choices := make(map[string][]int)
+	if len(postIDs) == 0 {
+		return choices, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.M{idKey: bson.M{"$in": postIDs}, ballotUserKey: userID}
+	// $ оставляет от бюллетеней только первый подошедший под фильтр - как раз бюллетень userID
+	opts := options.Find().SetProjection(bson.M{idKey: 1, pollBallotsKey + ".$": 1})
+	postsFromDB, err := repo.collection.Find(ctx, filter, opts)
+	if err != nil {
+		repo.logger.Errorf("Error finding poll choices of %s: %v", userID, err)
+		return nil, err
+	}
+
+	defer utils.HandleMongoCursorClose(postsFromDB, ctx)
+
+	for postsFromDB.Next(ctx) {
+		var post Post
+		if err := postsFromDB.Decode(&post); err != nil {
+			repo.logger.Errorf("Error decoding poll choices: %v", err)
+			return nil, err
+		}
+		if post.Poll != nil && len(post.Poll.Ballots) > 0 {
+			choices[post.ID] = post.Poll.Ballots[0].Choices
+		}
+	}
+	return choices, postsFromDB.Err()
+}
@@ -1,11 +1,24 @@
 package post
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
+	"os"
+	"redditclone/pkg/media"
+	"redditclone/pkg/preview"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/role"
+	"redditclone/pkg/utils"
+	"redditclone/pkg/vote"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -43,7 +56,6 @@ func TestGetPost_Found(t *testing.T) {
 				{Key: "views", Value: 10},
 				{Key: "author", Value: Author{Username: "alice", ID: "user42"}},
 				{Key: "text", Value: "This is a test post."},
-				{Key: "votes", Value: []Vote{}},
 				{Key: "comments", Value: []Comment{}},
 				{Key: "created", Value: time.Date(2025, 5, 5, 12, 0, 0, 0, time.UTC)},
 				{Key: "upvotePercentage", Value: 100},
@@ -134,11 +146,15 @@ func TestCreatePost_SuccessAndError(t *testing.T) {
 	mt.Run("success insert text", func(mt *mtest.T) {
 		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		req := NewPostRequest{Category: "c", Type: "text", Title: "T", Text: "body"}
+		req := NewPostRequest{Category: "c", Type: "text", Title: "T", Text: "*body*"}
 		p := repo.CreatePost(req, "user", "uid")
-		if p == nil || p.Title != "T" {
+		if p == nil || p.Title != "T" || p.TextHTML != "<p><em>body</em></p>\n" {
 			t.Fatalf("expected valid post, got %+v", p)
 		}
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if doc.Lookup(textHTMLKey).StringValue() != p.TextHTML {
+			t.Errorf("rendered text was not stored: %v", doc)
+		}
 	})
 	mt.Run("success insert link", func(mt *mtest.T) {
 		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
@@ -180,33 +196,7 @@ func TestAddComment(t *testing.T) {
 			mtest.NextBatch,
 		)
 		mt.AddMockResponses(initial, endInitial)
-		mt.AddMockResponses(mtest.CreateSuccessResponse())
-		updated := mtest.CreateCursorResponse(
-			1,
-			"db.coll",
-			mtest.FirstBatch,
-			bson.D{
-				{Key: "id", Value: "p1"},
-				{Key: "comments", Value: []Comment{
-					{
-						ID:   "new-comment",
-						Body: "nice post",
-						Author: Author{
-							Username: "bob",
-							ID:       "uid",
-						},
-					},
-				}},
-				{Key: "title", Value: "Post"},
-				{Key: "author", Value: Author{Username: "bob", ID: "uid"}},
-			},
-		)
-		endUpdated := mtest.CreateCursorResponse(
-			0,
-			"db.coll",
-			mtest.NextBatch,
-		)
-		mt.AddMockResponses(updated, endUpdated)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 		repo := NewMongoRepo(mt.Coll, nilLogger)
 		post, err := repo.AddComment("p1", "bob", "uid", "nice post")
 		if err != nil {
@@ -218,6 +208,9 @@ func TestAddComment(t *testing.T) {
 		if post.Comments[0].ID == "" {
 			t.Errorf("expected non-empty comment ID")
 		}
+		if post.Comments[0].BodyHTML != "<p>nice post</p>\n" {
+			t.Errorf("unexpected comment html: %q", post.Comments[0].BodyHTML)
+		}
 	})
 	mt.Run("post not found", func(mt *mtest.T) {
 		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
@@ -255,26 +248,9 @@ func TestDeleteComment(t *testing.T) {
 			mtest.NextBatch,
 		)
 		mt.AddMockResponses(initial, endInitial)
-		mt.AddMockResponses(mtest.CreateSuccessResponse())
-		updated := mtest.CreateCursorResponse(
-			1,
-			"db.coll",
-			mtest.FirstBatch,
-			bson.D{
-				{Key: "id", Value: "p2"},
-				{Key: "comments", Value: []Comment{}},
-				{Key: "title", Value: "Post2"},
-				{Key: "author", Value: Author{Username: "eve", ID: "uid2"}},
-			},
-		)
-		endUpdated := mtest.CreateCursorResponse(
-			0,
-			"db.coll",
-			mtest.NextBatch,
-		)
-		mt.AddMockResponses(updated, endUpdated)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		post, err := repo.DeleteComment("p2", "c1", "uid2")
+		post, err := repo.DeleteComment("p2", "c1", role.Actor{UserID: "uid2"})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -301,7 +277,7 @@ func TestDeleteComment(t *testing.T) {
 		)
 		mt.AddMockResponses(initial, endInitial)
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		_, err := repo.DeleteComment("p2", "nonexistent", "uid2")
+		_, err := repo.DeleteComment("p2", "nonexistent", role.Actor{UserID: "uid2"})
 		if !errors.Is(err, ErrCommentNotFound) {
 			t.Fatalf("expected ErrCommentNotFound, got %v", err)
 		}
@@ -330,7 +306,7 @@ func TestDeleteComment(t *testing.T) {
 		)
 		mt.AddMockResponses(initial, endInitial)
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		_, err := repo.DeleteComment("p3", "c2", "other")
+		_, err := repo.DeleteComment("p3", "c2", role.Actor{UserID: "other"})
 		if !errors.Is(err, ErrUnauthorized) {
 			t.Fatalf("expected ErrUnauthorized, got %v", err)
 		}
@@ -354,7 +330,6 @@ func TestVotePostBasic(t *testing.T) {
 				{Key: "views", Value: 1},
 				{Key: "author", Value: Author{Username: "alice", ID: "user42"}},
 				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{}},
 				{Key: "comments", Value: []Comment{}},
 				{Key: "created", Value: time.Now().UTC()},
 				{Key: "upvotePercentage", Value: 0},
@@ -367,40 +342,14 @@ func TestVotePostBasic(t *testing.T) {
 		)
 		mt.AddMockResponses(initial, end)
 
-		mt.AddMockResponses(mtest.CreateSuccessResponse())
-
-		updated := mtest.CreateCursorResponse(
-			1,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.FirstBatch,
-			bson.D{
-				{Key: "id", Value: "post123"},
-				{Key: "title", Value: "Test"},
-				{Key: "category", Value: "general"},
-				{Key: "type", Value: "text"},
-				{Key: "score", Value: 1},
-				{Key: "views", Value: 1},
-				{Key: "author", Value: Author{Username: "alice", ID: "user42"}},
-				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{{"user42", 1}}},
-				{Key: "comments", Value: []Comment{}},
-				{Key: "created", Value: time.Now().UTC()},
-				{Key: "upvotePercentage", Value: 100},
-			},
-		)
-		updatedEnd := mtest.CreateCursorResponse(
-			0,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.NextBatch,
-		)
-		mt.AddMockResponses(updated, updatedEnd)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		post, err := repo.VotePost("post123", "user42", 1)
+		post, err := repo.VotePost("post123", 0, 1)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
-		if post.Score != 1 || len(post.Votes) != 1 || post.UpvotePercentage != 100 {
+		if post.Score != 1 || post.Ups != 1 || post.UpvotePercentage != 100 {
 			t.Errorf("unexpected post state: %+v", post)
 		}
 	})
@@ -419,7 +368,6 @@ func TestVotePostBasic(t *testing.T) {
 				{Key: "views", Value: 1},
 				{Key: "author", Value: Author{Username: "bob", ID: "user43"}},
 				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{}},
 				{Key: "comments", Value: []Comment{}},
 				{Key: "created", Value: time.Now().UTC()},
 				{Key: "upvotePercentage", Value: 0},
@@ -432,40 +380,14 @@ func TestVotePostBasic(t *testing.T) {
 		)
 		mt.AddMockResponses(initial, end)
 
-		mt.AddMockResponses(mtest.CreateSuccessResponse())
-
-		updated := mtest.CreateCursorResponse(
-			1,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.FirstBatch,
-			bson.D{
-				{Key: "id", Value: "post124"},
-				{Key: "title", Value: "Test Downvote"},
-				{Key: "category", Value: "general"},
-				{Key: "type", Value: "text"},
-				{Key: "score", Value: -1},
-				{Key: "views", Value: 1},
-				{Key: "author", Value: Author{Username: "bob", ID: "user43"}},
-				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{{"user43", -1}}},
-				{Key: "comments", Value: bson.A{}},
-				{Key: "created", Value: time.Now().UTC()},
-				{Key: "upvotePercentage", Value: 0},
-			},
-		)
-		updatedEnd := mtest.CreateCursorResponse(
-			0,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.NextBatch,
-		)
-		mt.AddMockResponses(updated, updatedEnd)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		post, err := repo.VotePost("post124", "user43", -1)
+		post, err := repo.VotePost("post124", 0, -1)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
-		if post.Score != -1 || len(post.Votes) != 1 || post.UpvotePercentage != 0 {
+		if post.Score != -1 || post.Downs != 1 || post.UpvotePercentage != 0 {
 			t.Errorf("unexpected post state: %+v", post)
 		}
 	})
@@ -484,7 +406,7 @@ func TestVotePostBasic(t *testing.T) {
 				{Key: "views", Value: 1},
 				{Key: "author", Value: Author{Username: "carol", ID: "user44"}},
 				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{{"user44", 1}}},
+				{Key: "ups", Value: 1},
 				{Key: "comments", Value: []Comment{}},
 				{Key: "created", Value: time.Now().UTC()},
 				{Key: "upvotePercentage", Value: 100},
@@ -497,40 +419,14 @@ func TestVotePostBasic(t *testing.T) {
 		)
 		mt.AddMockResponses(initial, end)
 
-		mt.AddMockResponses(mtest.CreateSuccessResponse())
-
-		updated := mtest.CreateCursorResponse(
-			1,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.FirstBatch,
-			bson.D{
-				{Key: "id", Value: "post125"},
-				{Key: "title", Value: "Test Unvote"},
-				{Key: "category", Value: "general"},
-				{Key: "type", Value: "text"},
-				{Key: "score", Value: 0},
-				{Key: "views", Value: 1},
-				{Key: "author", Value: Author{Username: "carol", ID: "user44"}},
-				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{}},
-				{Key: "comments", Value: []Comment{}},
-				{Key: "created", Value: time.Now().UTC()},
-				{Key: "upvotePercentage", Value: 100},
-			},
-		)
-		updatedEnd := mtest.CreateCursorResponse(
-			0,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.NextBatch,
-		)
-		mt.AddMockResponses(updated, updatedEnd)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		post, err := repo.VotePost("post125", "user44", 0)
+		post, err := repo.VotePost("post125", 1, 0)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
-		if post.Score != 0 || len(post.Votes) != 0 || post.UpvotePercentage != 100 {
+		if post.Score != 0 || post.Ups+post.Downs != 0 || post.UpvotePercentage != 100 {
 			t.Errorf("unexpected post state: %+v", post)
 		}
 	})
@@ -553,9 +449,7 @@ func TestVotePostChange(t *testing.T) {
 				{Key: "views", Value: 1},
 				{Key: "author", Value: Author{Username: "alice", ID: "user42"}},
 				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{
-					{"user42", -1},
-				}},
+				{Key: "downs", Value: 1},
 				{Key: "comments", Value: []Comment{}},
 				{Key: "created", Value: time.Now().UTC()},
 				{Key: "upvotePercentage", Value: 0},
@@ -568,42 +462,14 @@ func TestVotePostChange(t *testing.T) {
 		)
 		mt.AddMockResponses(initial, endInitial)
 
-		mt.AddMockResponses(mtest.CreateSuccessResponse())
-
-		updated := mtest.CreateCursorResponse(
-			1,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.FirstBatch,
-			bson.D{
-				{Key: "id", Value: "post126"},
-				{Key: "title", Value: "Test Change Vote"},
-				{Key: "category", Value: "general"},
-				{Key: "type", Value: "text"},
-				{Key: "score", Value: 1},
-				{Key: "views", Value: 1},
-				{Key: "author", Value: Author{Username: "alice", ID: "user42"}},
-				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{
-					{"user42", 1},
-				}},
-				{Key: "comments", Value: []Comment{}},
-				{Key: "created", Value: time.Now().UTC()},
-				{Key: "upvotePercentage", Value: 100},
-			},
-		)
-		updatedEnd := mtest.CreateCursorResponse(
-			0,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.NextBatch,
-		)
-		mt.AddMockResponses(updated, updatedEnd)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		post, err := repo.VotePost("post126", "user42", 1)
+		post, err := repo.VotePost("post126", -1, 1)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
-		if post.Score != 1 || len(post.Votes) != 1 || post.Votes[0].Vote != 1 || post.UpvotePercentage != 100 {
+		if post.Score != 1 || post.Ups != 1 || post.Downs != 0 || post.UpvotePercentage != 100 {
 			t.Errorf("unexpected post state: %+v", post)
 		}
 	})
@@ -622,7 +488,7 @@ func TestVotePostChange(t *testing.T) {
 				{Key: "views", Value: 1},
 				{Key: "author", Value: Author{Username: "alice", ID: "user42"}},
 				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{{"user42", 1}}},
+				{Key: "ups", Value: 1},
 				{Key: "comments", Value: []Comment{}},
 				{Key: "created", Value: time.Now().UTC()},
 				{Key: "upvotePercentage", Value: 100},
@@ -635,40 +501,14 @@ func TestVotePostChange(t *testing.T) {
 		)
 		mt.AddMockResponses(initial, end)
 
-		mt.AddMockResponses(mtest.CreateSuccessResponse())
-
-		updated := mtest.CreateCursorResponse(
-			1,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.FirstBatch,
-			bson.D{
-				{Key: "id", Value: "post127"},
-				{Key: "title", Value: "Test Change Upvote"},
-				{Key: "category", Value: "general"},
-				{Key: "type", Value: "text"},
-				{Key: "score", Value: -1},
-				{Key: "views", Value: 1},
-				{Key: "author", Value: Author{Username: "alice", ID: "user42"}},
-				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{{"user42", -1}}},
-				{Key: "comments", Value: []Comment{}},
-				{Key: "created", Value: time.Now().UTC()},
-				{Key: "upvotePercentage", Value: 0},
-			},
-		)
-		updatedEnd := mtest.CreateCursorResponse(
-			0,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.NextBatch,
-		)
-		mt.AddMockResponses(updated, updatedEnd)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		post, err := repo.VotePost("post127", "user42", -1)
+		post, err := repo.VotePost("post127", 1, -1)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
-		if post.Score != -1 || len(post.Votes) != 1 || post.Votes[0].Vote != -1 || post.UpvotePercentage != 0 {
+		if post.Score != -1 || post.Ups != 0 || post.Downs != 1 || post.UpvotePercentage != 0 {
 			t.Errorf("unexpected post state: %+v", post)
 		}
 	})
@@ -687,7 +527,7 @@ func TestVotePostChange(t *testing.T) {
 				{Key: "views", Value: 1},
 				{Key: "author", Value: Author{Username: "dave", ID: "user45"}},
 				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{{"user45", -1}}},
+				{Key: "downs", Value: 1},
 				{Key: "comments", Value: []Comment{}},
 				{Key: "created", Value: time.Now().UTC()},
 				{Key: "upvotePercentage", Value: 0},
@@ -700,45 +540,138 @@ func TestVotePostChange(t *testing.T) {
 		)
 		mt.AddMockResponses(initial, endInitial)
 
-		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
-		updated := mtest.CreateCursorResponse(
-			1,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.FirstBatch,
-			bson.D{
-				{Key: "id", Value: "post128"},
-				{Key: "title", Value: "Test Unvote Downvote"},
-				{Key: "category", Value: "general"},
-				{Key: "type", Value: "text"},
-				{Key: "score", Value: 0},
-				{Key: "views", Value: 1},
-				{Key: "author", Value: Author{Username: "dave", ID: "user45"}},
-				{Key: "text", Value: "Body"},
-				{Key: "votes", Value: []Vote{}},
-				{Key: "comments", Value: []Comment{}},
-				{Key: "created", Value: time.Now().UTC()},
-				{Key: "upvotePercentage", Value: 100},
-			},
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		post, err := repo.VotePost("post128", -1, 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if post.Score != 0 || post.Ups+post.Downs != 0 || post.UpvotePercentage != 100 {
+			t.Errorf("unexpected post state: %+v", post)
+		}
+	})
+}
+
+// TestVotePostVersionConflict - сценарий гонки по шагам: mtest отвечает из одной очереди заранее заданных ответов
+// строго по порядку, так что настоящие параллельные горутины на нем не проверить. Их гоняет TestVotePostConcurrent
+func TestVotePostVersionConflict(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ns := func(mt *mtest.T) string { return fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()) }
+	postDoc := func(version, ups, downs int) bson.D {
+		return bson.D{
+			{Key: "id", Value: "post1"},
+			{Key: "title", Value: "Test"},
+			{Key: "score", Value: ups - downs},
+			{Key: "ups", Value: ups},
+			{Key: "downs", Value: downs},
+			{Key: "comments", Value: []Comment{}},
+			{Key: "created", Value: time.Now().UTC()},
+			{Key: "version", Value: version},
+		}
+	}
+
+	mt.Run("retry after concurrent vote", func(mt *mtest.T) {
+		// прочитали версию 1, но пока считали, кто-то проголосовал - апдейт ничего не сматчил
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, ns(mt), mtest.FirstBatch, postDoc(1, 0, 0)),
+			mtest.CreateCursorResponse(0, ns(mt), mtest.NextBatch),
 		)
-		endUpdated := mtest.CreateCursorResponse(
-			0,
-			fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name()),
-			mtest.NextBatch,
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, ns(mt), mtest.FirstBatch, postDoc(2, 0, 1)),
+			mtest.CreateCursorResponse(0, ns(mt), mtest.NextBatch),
 		)
-		mt.AddMockResponses(updated, endUpdated)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		post, err := repo.VotePost("post128", "user45", 0)
+		post, err := repo.VotePost("post1", 0, 1)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
-		if post.Score != 0 || len(post.Votes) != 0 || post.UpvotePercentage != 100 {
-			t.Errorf("unexpected post state: %+v", post)
+		if post.Score != 0 || post.Ups != 1 || post.Downs != 1 || post.UpvotePercentage != 50 {
+			t.Errorf("expected both votes counted, got %+v", post)
+		}
+		if post.Version != 3 {
+			t.Errorf("expected version 3, got %d", post.Version)
+		}
+	})
+
+	mt.Run("gives up after max attempts", func(mt *mtest.T) {
+		for i := 0; i < maxUpdateAttempts; i++ {
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(1, ns(mt), mtest.FirstBatch, postDoc(i, 0, 0)),
+				mtest.CreateCursorResponse(0, ns(mt), mtest.NextBatch),
+			)
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		}
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		_, err := repo.VotePost("post1", 0, 1)
+		if !errors.Is(err, ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
 		}
 	})
 }
 
+// TestVotePostConcurrent бьет в один пост из многих горутин через настоящую монгу.
+// Нужен живой сервер: REDDITCLONE_TEST_MONGO=mongodb://localhost, без него тест пропускается
+func TestVotePostConcurrent(t *testing.T) {
+	uri := os.Getenv("REDDITCLONE_TEST_MONGO")
+	if uri == "" {
+		t.Skip("REDDITCLONE_TEST_MONGO is not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer func() { _ = client.Disconnect(ctx) }()
+	coll := client.Database("redditclone_test").Collection("posts_" + utils.GenerateID())
+	defer func() { _ = coll.Drop(ctx) }()
+
+	repo := NewMongoRepo(coll, nilLogger)
+	created := repo.CreatePost(NewPostRequest{Category: "music", Type: "text", Title: "t", Text: "x"}, "author", "author-id")
+	if created == nil {
+		t.Fatal("failed to create post")
+	}
+
+	// каждый голосует один раз, четные за, нечетные против. ErrConflict - это просьба повторить, как и в хендлере
+	const voters = 40
+	var wg sync.WaitGroup
+	for i := 0; i < voters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			action := []int{1, -1}[i%2]
+			for {
+				_, err := repo.VotePost(created.ID, 0, action)
+				if errors.Is(err, ErrConflict) {
+					continue
+				}
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got, err := repo.GetPost(created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// плюс голос автора
+	ups, downs := voters/2+1, voters/2
+	if got.Ups != ups || got.Downs != downs || got.Score != ups-downs {
+		t.Errorf("expected ups=%d downs=%d score=%d, got ups=%d downs=%d score=%d", ups, downs, ups-downs, got.Ups, got.Downs, got.Score)
+	}
+	if got.UpvotePercentage != int(float64(ups)/float64(ups+downs)*100) {
+		t.Errorf("unexpected upvote percentage %d", got.UpvotePercentage)
+	}
+}
+
 func TestDeletePost(t *testing.T) {
 	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
 	mt.Run("successful deletion", func(mt *mtest.T) {
@@ -760,7 +693,7 @@ func TestDeletePost(t *testing.T) {
 		delResp := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1})
 		mt.AddMockResponses(delResp)
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		ok, err := repo.DeletePost("p4", "uid4")
+		ok, err := repo.DeletePost("p4", role.Actor{UserID: "uid4"})
 		if err != nil || ok != true {
 			t.Fatalf("expected deletion success, got ok=%v err=%v", ok, err)
 		}
@@ -768,7 +701,7 @@ func TestDeletePost(t *testing.T) {
 	mt.Run("post not found", func(mt *mtest.T) {
 		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		_, err := repo.DeletePost("p-no", "uid")
+		_, err := repo.DeletePost("p-no", role.Actor{UserID: "uid"})
 		if !errors.Is(err, ErrPostNotFound) {
 			t.Fatalf("expected ErrPostNotFound, got %v", err)
 		}
@@ -790,11 +723,25 @@ func TestDeletePost(t *testing.T) {
 		)
 		mt.AddMockResponses(findResp, findEnd)
 		repo := NewMongoRepo(mt.Coll, nilLogger)
-		ok, err := repo.DeletePost("p5", "other")
+		ok, err := repo.DeletePost("p5", role.Actor{UserID: "other"})
 		if !errors.Is(err, ErrUnauthorized) || ok {
 			t.Fatalf("expected unauthorized, got ok=%v err=%v", ok, err)
 		}
 	})
+	mt.Run("admin deletes someone else's post", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{
+			{Key: "id", Value: "p5"},
+			{Key: "category", Value: "music"},
+			{Key: "author", Value: Author{Username: "dave", ID: "uid4"}},
+		}))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		ok, err := repo.DeletePost("p5", role.Actor{UserID: "admin", Roles: &role.Roles{Admin: true}})
+		if err != nil || !ok {
+			t.Fatalf("expected deletion success, got ok=%v err=%v", ok, err)
+		}
+	})
 }
 
 func TestPostsByUser(t *testing.T) {
@@ -827,3 +774,939 @@ func TestPostsByUser(t *testing.T) {
 		}
 	})
 }
+
+func TestListPosts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	created := time.Date(2025, 5, 5, 12, 0, 0, 0, time.UTC)
+
+	mt.Run("first page has next cursor", func(mt *mtest.T) {
+		batch := mtest.CreateCursorResponse(
+			0,
+			"db.coll",
+			mtest.FirstBatch,
+			bson.D{{Key: "id", Value: "3"}, {Key: "created", Value: created.Add(2 * time.Minute)}},
+			bson.D{{Key: "id", Value: "2"}, {Key: "created", Value: created.Add(time.Minute)}},
+			bson.D{{Key: "id", Value: "1"}, {Key: "created", Value: created}},
+		)
+		mt.AddMockResponses(batch)
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		page, err := repo.ListPosts(ListQuery{Limit: 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page.Posts) != 2 || page.Posts[1].ID != "2" {
+			t.Fatalf("unexpected posts: %+v", page.Posts)
+		}
+		if page.Before != "" {
+			t.Errorf("first page should not have before cursor")
+		}
+		c, err := decodeCursor(page.After, ranking.SortHot)
+		if err != nil || c.ID != "2" {
+			t.Errorf("unexpected after cursor %q: %+v %v", page.After, c, err)
+		}
+	})
+
+	mt.Run("before keeps feed order", func(mt *mtest.T) {
+		// для before монга отдает посты по возрастанию, репо должно их развернуть
+		batch := mtest.CreateCursorResponse(
+			0,
+			"db.coll",
+			mtest.FirstBatch,
+			bson.D{{Key: "id", Value: "2"}, {Key: "created", Value: created.Add(time.Minute)}},
+			bson.D{{Key: "id", Value: "3"}, {Key: "created", Value: created.Add(2 * time.Minute)}},
+		)
+		mt.AddMockResponses(batch)
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		before := encodeCursor(Post{ID: "1", Created: created}, ranking.SortNew)
+		page, err := repo.ListPosts(ListQuery{Category: "news", Sort: ranking.SortNew, Limit: 5, Before: before})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page.Posts) != 2 || page.Posts[0].ID != "3" || page.Posts[1].ID != "2" {
+			t.Fatalf("unexpected posts: %+v", page.Posts)
+		}
+		if page.Before != "" || page.After == "" {
+			t.Errorf("unexpected cursors: %+v", page)
+		}
+	})
+
+	mt.Run("bad cursor", func(mt *mtest.T) {
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.ListPosts(ListQuery{After: "%%%"}); !errors.Is(err, ErrBadCursor) {
+			t.Errorf("expected ErrBadCursor, got %v", err)
+		}
+		if _, err := repo.ListPosts(ListQuery{After: "a", Before: "b"}); !errors.Is(err, ErrBadCursor) {
+			t.Errorf("expected ErrBadCursor, got %v", err)
+		}
+		// курсор от другой сортировки
+		top := encodeCursor(Post{ID: "1", Score: 10}, ranking.SortTop)
+		if _, err := repo.ListPosts(ListQuery{Sort: ranking.SortHot, After: top}); !errors.Is(err, ErrBadCursor) {
+			t.Errorf("expected ErrBadCursor, got %v", err)
+		}
+	})
+
+	mt.Run("feed and ids filters", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.ListPosts(ListQuery{Feed: &FeedFilter{Categories: []string{"music"}}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		or := filter.Lookup("$and").Array().Index(0).Value().Document().Lookup("$or").Array()
+		if cats := or.Index(0).Value().Document().Lookup("category", "$in").Array(); cats.Index(0).Value().StringValue() != "music" {
+			t.Errorf("unexpected category filter: %v", cats)
+		}
+		// nil авторы не должны превратиться в $in: null
+		if _, err := or.Index(1).Value().Document().Lookup("author.username", "$in").Array().Values(); err != nil {
+			t.Errorf("authors filter is not an array: %v", err)
+		}
+
+		if _, err := repo.ListPosts(ListQuery{IDs: []string{"1", "2"}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		filter = mt.GetStartedEvent().Command.Lookup("filter").Document()
+		if ids, _ := filter.Lookup("id", "$in").Array().Values(); len(ids) != 2 {
+			t.Errorf("unexpected ids filter: %v", filter)
+		}
+	})
+
+	mt.Run("find error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}, {Key: "errmsg", Value: "fail"}})
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.ListPosts(ListQuery{Author: "sam"}); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
+
+type fakeVotes map[string]int
+
+func (f fakeVotes) SetVote(postID, userID string, v int) (int, error) {
+	previous := f[postID+"/"+userID]
+	f[postID+"/"+userID] = v
+	return previous, nil
+}
+
+func (f fakeVotes) SetCommentVote(string, string, string, int) (int, error) { return 0, nil }
+
+func (f fakeVotes) UserVotes(string, []string) (map[string]int, error) { return nil, nil }
+
+func (f fakeVotes) UserCommentVotes(string, string) (map[string]int, error) { return nil, nil }
+
+func (f fakeVotes) DeletePostVotes(string) error { return nil }
+
+// голоса за комменты - под ключом "пост/коммент/юзер"
+func (f fakeVotes) DeleteCommentVotes(postID string, commentIDs []string) error {
+	for _, commentID := range commentIDs {
+		for key := range f {
+			if strings.HasPrefix(key, postID+"/"+commentID+"/") {
+				delete(f, key)
+			}
+		}
+	}
+	return nil
+}
+
+func (f fakeVotes) AllCounts() (map[string]vote.Counts, error) {
+	all := make(map[string]vote.Counts)
+	for key, v := range f {
+		parts := strings.Split(key, "/")
+		counts, ok := all[parts[0]]
+		if !ok {
+			counts = vote.Counts{Comments: map[string]vote.Tally{}}
+		}
+		tally := counts.Post
+		if len(parts) == 3 {
+			tally = counts.Comments[parts[1]]
+		}
+		if v > 0 {
+			tally.Ups++
+		} else if v < 0 {
+			tally.Downs++
+		}
+		if len(parts) == 3 {
+			counts.Comments[parts[1]] = tally
+		} else {
+			counts.Post = tally
+		}
+		all[parts[0]] = counts
+	}
+	return all, nil
+}
+
+func TestMigrateEmbeddedVotes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("moves votes out", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{
+				{Key: "id", Value: "p1"},
+				{Key: "score", Value: 1},
+				{Key: "votes", Value: bson.A{
+					bson.D{{Key: "user", Value: "u1"}, {Key: "vote", Value: 1}},
+					bson.D{{Key: "user", Value: "u2"}, {Key: "vote", Value: 1}},
+					bson.D{{Key: "user", Value: "u3"}, {Key: "vote", Value: -1}},
+				}},
+			}),
+		)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		votes := fakeVotes{}
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if err := repo.MigrateEmbeddedVotes(votes); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(votes) != 3 || votes["p1/u3"] != -1 {
+			t.Errorf("unexpected migrated votes: %v", votes)
+		}
+
+		started := mt.GetAllStartedEvents()
+		update := started[len(started)-1].Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		set := update.Lookup("$set").Document()
+		if set.Lookup("score").Int32() != 1 || set.Lookup("ups").Int32() != 2 || set.Lookup("downs").Int32() != 1 {
+			t.Errorf("unexpected counters: %v", set)
+		}
+		if _, err := update.LookupErr("$unset", "votes"); err != nil {
+			t.Errorf("expected votes to be unset: %v", update)
+		}
+	})
+}
+
+func TestReconcileVotes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	// c2 удален из поста насовсем, а голос за него остался
+	votes := fakeVotes{"p1/u1": 1, "p1/u2": 1, "p1/u3": -1, "p1/c2/u1": 1}
+	drifted := bson.D{
+		{Key: "id", Value: "p1"},
+		{Key: "score", Value: 2},
+		{Key: "ups", Value: 2},
+		{Key: "downs", Value: 0},
+		{Key: "version", Value: 7},
+		{Key: "comments", Value: bson.A{bson.D{{Key: "id", Value: "c1"}, {Key: "score", Value: 1}, {Key: "ups", Value: 1}}}},
+	}
+
+	mt.Run("first pass only remembers drift", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, drifted))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		suspects, err := repo.ReconcileVotes(votes, map[string]Drift{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(suspects) != 1 || suspects["p1"].Version != 7 || suspects["p1"].Counts.Post != (vote.Tally{Ups: 2, Downs: 1}) {
+			t.Errorf("unexpected suspects: %+v", suspects)
+		}
+		if _, ok := votes["p1/c2/u1"]; ok || len(suspects["p1"].Counts.Comments) != 0 {
+			t.Errorf("expected votes of deleted comment to be dropped, got %v", votes)
+		}
+		find := mt.GetStartedEvent().Command
+		if _, err := find.LookupErr("projection", "comments.ups"); err != nil {
+			t.Errorf("expected counters-only projection, got %v", find)
+		}
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName == "update" {
+				t.Errorf("expected no update on first pass")
+			}
+		}
+	})
+
+	mt.Run("second pass fixes confirmed drift", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, drifted))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		counts, _ := votes.AllCounts()
+		suspects, err := repo.ReconcileVotes(votes, map[string]Drift{"p1": {Version: 7, Counts: counts["p1"]}})
+		if err != nil || len(suspects) != 0 {
+			t.Fatalf("unexpected result: %v (%v)", suspects, err)
+		}
+
+		started := mt.GetAllStartedEvents()
+		update := started[len(started)-1].Command.Lookup("updates").Array().Index(0).Value().Document()
+		if update.Lookup("q", "version").Int32() != 7 {
+			t.Errorf("expected version filter, got %v", update.Lookup("q"))
+		}
+		set := update.Lookup("u", "$set").Document()
+		if set.Lookup("score").Int32() != 1 || set.Lookup("ups").Int32() != 2 || set.Lookup("downs").Int32() != 1 {
+			t.Errorf("unexpected post counters: %v", set)
+		}
+		if set.Lookup("comments.0.ups").Int32() != 0 || set.Lookup("comments.0.score").Int32() != 0 {
+			t.Errorf("unexpected comment counters: %v", set)
+		}
+	})
+
+	mt.Run("post changed since last pass", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, drifted))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		counts, _ := votes.AllCounts()
+		suspects, err := repo.ReconcileVotes(votes, map[string]Drift{"p1": {Version: 6, Counts: counts["p1"]}})
+		if err != nil || suspects["p1"].Version != 7 {
+			t.Fatalf("expected drift to be re-checked, got %+v (%v)", suspects, err)
+		}
+	})
+}
+
+func TestVoteComment(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	postWithComments := func() bson.D {
+		return bson.D{
+			{Key: "id", Value: "p1"},
+			{Key: "comments", Value: bson.A{
+				bson.D{{Key: "id", Value: "c1"}, {Key: "score", Value: 0}},
+				bson.D{{Key: "id", Value: "c2"}, {Key: "score", Value: 2}, {Key: "ups", Value: 2}},
+			}},
+			{Key: "version", Value: 3},
+		}
+	}
+
+	mt.Run("downvote", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, postWithComments()))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		post, err := repo.VoteComment("p1", "c2", 1, -1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if c := post.Comments[1]; c.Score != 0 || c.Ups != 1 || c.Downs != 1 {
+			t.Errorf("unexpected comment counters: %+v", c)
+		}
+
+		started := mt.GetAllStartedEvents()
+		set := started[len(started)-1].Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+		if _, err := set.LookupErr("comments.1.score"); err != nil {
+			t.Errorf("expected positional update of the comment, got %v", set)
+		}
+	})
+
+	mt.Run("comment not found", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, postWithComments()))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.VoteComment("p1", "nope", 0, 1); !errors.Is(err, ErrCommentNotFound) {
+			t.Fatalf("expected ErrCommentNotFound, got %v", err)
+		}
+	})
+}
+
+func TestEditPostAndComment(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	stored := func() bson.D {
+		return bson.D{
+			{Key: "id", Value: "p1"},
+			{Key: "type", Value: "text"},
+			{Key: "title", Value: "title"},
+			{Key: "text", Value: "text"},
+			{Key: "author", Value: bson.D{{Key: "id", Value: "u1"}}},
+			{Key: "comments", Value: bson.A{
+				bson.D{{Key: "id", Value: "c1"}, {Key: "body", Value: "old"}, {Key: "author", Value: bson.D{{Key: "id", Value: "u1"}}}},
+			}},
+			{Key: "version", Value: 1},
+		}
+	}
+	lastUpdate := func(mt *mtest.T) bson.Raw {
+		started := mt.GetAllStartedEvents()
+		return started[len(started)-1].Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+	}
+
+	mt.Run("edit post", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, stored()))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		post, err := repo.EditPost("p1", role.Actor{UserID: "u1"}, EditPostRequest{Text: "new"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if post.Text != "new" || post.Edited == nil {
+			t.Errorf("unexpected post: %+v", post)
+		}
+		update := lastUpdate(mt)
+		if text := update.Lookup("$set", "text").StringValue(); text != "new" {
+			t.Errorf("expected text to be set, got %q", text)
+		}
+		if textHTML := update.Lookup("$set", "text_html").StringValue(); textHTML != "<p>new</p>\n" {
+			t.Errorf("expected rendered text to be set, got %q", textHTML)
+		}
+		if old := update.Lookup("$push", "revisions", "text").StringValue(); old != "text" {
+			t.Errorf("expected old text in revision, got %q", old)
+		}
+	})
+
+	mt.Run("edit comment", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, stored()))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.EditComment("p1", "c1", role.Actor{UserID: "u1"}, "new"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		update := lastUpdate(mt)
+		if body := update.Lookup("$set", "comments.0.body").StringValue(); body != "new" {
+			t.Errorf("expected positional body update, got %q", body)
+		}
+		if bodyHTML := update.Lookup("$set", "comments.0.body_html").StringValue(); bodyHTML != "<p>new</p>\n" {
+			t.Errorf("expected positional rendered body update, got %q", bodyHTML)
+		}
+		if id := update.Lookup("$push", "revisions", "comment_id").StringValue(); id != "c1" {
+			t.Errorf("expected comment revision, got %q", id)
+		}
+	})
+
+	mt.Run("history is capped", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		revisions := bson.A{bson.D{{Key: "comment_id", Value: "c1"}, {Key: "text", Value: "older"}}}
+		for i := 0; i < MaxRevisions; i++ {
+			revisions = append(revisions, bson.D{{Key: "text", Value: fmt.Sprintf("v%d", i)}})
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, append(stored(), bson.E{Key: "revisions", Value: revisions})))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.EditPost("p1", role.Actor{UserID: "u1"}, EditPostRequest{Text: "new"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		update := lastUpdate(mt)
+		if _, err := update.LookupErr("$push"); err == nil {
+			t.Errorf("expected the trimmed history to be set, not pushed: %v", update)
+		}
+		written, _ := update.Lookup("$set", "revisions").Array().Values()
+		if len(written) != MaxRevisions+1 || written[0].Document().Lookup("comment_id").StringValue() != "c1" ||
+			written[1].Document().Lookup("text").StringValue() != "v1" {
+			t.Errorf("expected the oldest post revision to be dropped: %v", written)
+		}
+	})
+
+	mt.Run("not the author", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, stored()))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.EditPost("p1", role.Actor{UserID: "u2"}, EditPostRequest{Text: "new"}); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("expected ErrUnauthorized, got %v", err)
+		}
+	})
+
+	mt.Run("revisions", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		doc := append(stored(), bson.E{Key: "revisions", Value: bson.A{
+			bson.D{{Key: "text", Value: "v0"}},
+			bson.D{{Key: "comment_id", Value: "c1"}, {Key: "text", Value: "older"}},
+		}})
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, doc))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		revisions, err := repo.GetRevisions("p1", "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(revisions) != 1 || revisions[0].Text != "v0" {
+			t.Errorf("unexpected revisions: %+v", revisions)
+		}
+	})
+}
+
+func TestAddViews(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("bulk inc", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if err := repo.AddViews(map[string]int{"p1": 3, "p2": 1}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		updates := mt.GetStartedEvent().Command.Lookup("updates").Array()
+		values, _ := updates.Values()
+		if len(values) != 2 {
+			t.Fatalf("expected one batched update for both posts, got %d", len(values))
+		}
+		if _, err := values[0].Document().LookupErr("u", "$inc", "views"); err != nil {
+			t.Errorf("expected $inc of views, got %v", values[0])
+		}
+	})
+
+	mt.Run("nothing to add", func(mt *mtest.T) {
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if err := repo.AddViews(nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ev := mt.GetStartedEvent(); ev != nil {
+			t.Errorf("expected no command, got %s", ev.CommandName)
+		}
+	})
+}
+
+func TestSearch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("text and filters", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch,
+			bson.D{{Key: "id", Value: "1"}, {Key: "title", Value: "golang"}, {Key: "search_score", Value: 1.5}},
+		))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		posts, err := repo.Search(SearchQuery{Text: "golang", Category: "programming", Type: "link", From: from})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(posts) != 1 || posts[0].ID != "1" {
+			t.Fatalf("unexpected posts: %+v", posts)
+		}
+
+		command := mt.GetStartedEvent().Command
+		filter := command.Lookup("filter").Document()
+		if s := filter.Lookup("$text", "$search").StringValue(); s != "golang" {
+			t.Errorf("unexpected $search: %q", s)
+		}
+		if c := filter.Lookup("category").StringValue(); c != "programming" {
+			t.Errorf("unexpected category: %q", c)
+		}
+		if _, ok := filter.Lookup("created", "$gte").TimeOK(); !ok {
+			t.Errorf("expected created lower bound in %v", filter)
+		}
+		if _, err := filter.LookupErr("created", "$lt"); err == nil {
+			t.Errorf("unexpected created upper bound in %v", filter)
+		}
+		if limit := command.Lookup("limit").AsInt64(); limit != DefaultPageLimit {
+			t.Errorf("unexpected limit %d", limit)
+		}
+	})
+
+	mt.Run("validation", func(mt *mtest.T) {
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.Search(SearchQuery{Text: " ?! "}); !errors.Is(err, ErrEmptySearch) {
+			t.Errorf("expected ErrEmptySearch, got %v", err)
+		}
+		now := time.Now()
+		if _, err := repo.Search(SearchQuery{Text: "go", From: now, To: now.Add(-time.Hour)}); !errors.Is(err, ErrBadSearchRange) {
+			t.Errorf("expected ErrBadSearchRange, got %v", err)
+		}
+	})
+}
+
+func TestURLHost(t *testing.T) {
+	tests := map[string]string{
+		"https://www.Example.com/path?q=1": "example.com",
+		"http://blog.golang.org:8080/":     "blog.golang.org",
+		"not a url %%":                     "",
+	}
+	for raw, host := range tests {
+		if got := urlHost(raw); got != host {
+			t.Errorf("urlHost(%q) = %q, want %q", raw, got, host)
+		}
+	}
+}
+
+func TestRemovePostAndComment(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	stored := bson.D{
+		{Key: "id", Value: "p1"},
+		{Key: "type", Value: "link"},
+		{Key: "url", Value: "https://spam.com"},
+		{Key: "host", Value: "spam.com"},
+		{Key: "author", Value: bson.D{{Key: "id", Value: "u1"}}},
+		{Key: "comments", Value: bson.A{
+			bson.D{{Key: "id", Value: "c1"}, {Key: "body", Value: "buy now"}, {Key: "author", Value: bson.D{{Key: "id", Value: "u2"}}}},
+		}},
+		{Key: "version", Value: 1},
+	}
+	removal := Removal{Moderator: "mod", Reason: "spam", Created: time.Now().UTC()}
+	lastUpdate := func(mt *mtest.T) bson.Raw {
+		started := mt.GetAllStartedEvents()
+		return started[len(started)-1].Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+	}
+
+	mt.Run("remove post", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, stored))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		post, err := repo.RemovePost("p1", removal)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if post.Removed == nil || post.URL != "" {
+			t.Errorf("unexpected post: %+v", post)
+		}
+		update := lastUpdate(mt)
+		if reason := update.Lookup("$set", "removed", "reason").StringValue(); reason != "spam" {
+			t.Errorf("expected removal to be set, got %q", reason)
+		}
+		if _, err := update.LookupErr("$unset", "host"); err != nil {
+			t.Errorf("expected host to be unset: %v", update)
+		}
+	})
+
+	mt.Run("remove comment", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, stored))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.RemoveComment("p1", "c1", removal); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		update := lastUpdate(mt)
+		if body := update.Lookup("$set", "comments.0.body").StringValue(); body != "[removed: spam]" {
+			t.Errorf("unexpected body %q", body)
+		}
+		if moderator := update.Lookup("$set", "comments.0.removed", "moderator").StringValue(); moderator != "mod" {
+			t.Errorf("unexpected moderator %q", moderator)
+		}
+	})
+}
+
+func TestSetHidden(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	lastUpdate := func(mt *mtest.T) bson.Raw {
+		return mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+	}
+
+	mt.Run("hide", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if err := repo.SetHidden("p1", true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := lastUpdate(mt).LookupErr("$set", hiddenKey); err != nil {
+			t.Errorf("expected $set hidden, got %v", lastUpdate(mt))
+		}
+	})
+
+	mt.Run("unhide", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if err := repo.SetHidden("p1", false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := lastUpdate(mt).LookupErr("$unset", hiddenKey); err != nil {
+			t.Errorf("expected $unset hidden, got %v", lastUpdate(mt))
+		}
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if err := repo.SetHidden("p1", true); !errors.Is(err, ErrPostNotFound) {
+			t.Fatalf("expected ErrPostNotFound, got %v", err)
+		}
+	})
+
+	mt.Run("listings skip hidden posts", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		repo.GetPosts()
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		if _, err := filter.LookupErr(hiddenKey, "$ne"); err != nil {
+			t.Errorf("expected hidden filter, got %v", filter)
+		}
+	})
+}
+
+func TestKarma(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("sum", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: nil}, {Key: "karma", Value: 7}}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		karma, err := repo.Karma("u1")
+		if err != nil || karma != 7 {
+			t.Fatalf("expected karma 7, got %d (%v)", karma, err)
+		}
+		started := mt.GetStartedEvent()
+		if started.CommandName != "aggregate" {
+			t.Fatalf("expected aggregate, got %s", started.CommandName)
+		}
+		match := started.Command.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match").Document()
+		if _, err = match.LookupErr("$or"); err != nil {
+			t.Errorf("expected posts and comments of user in $match, got %v", match)
+		}
+	})
+
+	mt.Run("no posts", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if karma, err := repo.Karma("u1"); err != nil || karma != 0 {
+			t.Fatalf("expected karma 0, got %d (%v)", karma, err)
+		}
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.Karma("u1"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestPostsByLink(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("create stores hash", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		created := repo.CreatePost(NewPostRequest{Category: "news", Type: "link", Title: "t", URL: "http://www.example.com/a/?utm_source=x"}, "alice", "1")
+		if created == nil || created.LinkHash != LinkHash("https://example.com/a") {
+			t.Fatalf("expected link hash, got %+v", created)
+		}
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if doc.Lookup(linkHashKey).StringValue() != created.LinkHash {
+			t.Errorf("link hash was not stored: %v", doc)
+		}
+	})
+
+	mt.Run("same category", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+			bson.D{{Key: "id", Value: "p1"}, {Key: "category", Value: "news"}, {Key: linkHashKey, Value: "h"}}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		posts, err := repo.PostsByLink("h", "news")
+		if err != nil || len(posts) != 1 || posts[0].ID != "p1" {
+			t.Fatalf("unexpected posts %+v (%v)", posts, err)
+		}
+		started := mt.GetStartedEvent().Command
+		filter := started.Lookup("filter").Document()
+		if filter.Lookup(linkHashKey).StringValue() != "h" || filter.Lookup(categoryKey).StringValue() != "news" {
+			t.Errorf("unexpected filter %v", filter)
+		}
+		if limit := started.Lookup("limit").AsInt64(); limit != MaxDuplicates {
+			t.Errorf("expected limit %d, got %d", MaxDuplicates, limit)
+		}
+	})
+
+	mt.Run("all categories", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.PostsByLink("h", ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := mt.GetStartedEvent().Command.Lookup("filter").Document().LookupErr(categoryKey); err == nil {
+			t.Error("expected no category filter")
+		}
+	})
+}
+
+func TestSetPreview(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	lastUpdate := func(mt *mtest.T) bson.Raw {
+		return mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+	}
+
+	mt.Run("set", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		p := preview.Preview{Title: "Example", Thumbnail: "/static/thumbs/p1.jpg"}
+		if err := repo.SetPreview("p1", p); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		update := lastUpdate(mt)
+		if title := update.Lookup("u", "$set", previewKey, "title").StringValue(); title != "Example" {
+			t.Errorf("expected preview title, got %v", update)
+		}
+		// убранному модератором посту превью не ставим
+		if _, err := update.LookupErr("q", removedKey); err != nil {
+			t.Errorf("filter should skip removed posts: %v", update)
+		}
+	})
+
+	mt.Run("removed or missing post", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if err := repo.SetPreview("p1", preview.Preview{Title: "Example"}); !errors.Is(err, ErrPostNotFound) {
+			t.Fatalf("expected ErrPostNotFound, got %v", err)
+		}
+	})
+}
+
+func TestCreatePost_Image(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("media is stored", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		m := &media.Media{Key: "abc.png", ThumbnailKey: "abc_thumb.jpg", URL: "/media/abc.png", ContentType: "image/png"}
+		created := repo.CreatePost(NewPostRequest{Category: "pics", Type: "image", Title: "cat", Text: "look", URL: "https://ignored.com", Media: m}, "alice", "1")
+		if created == nil || created.Media != m || created.Text != "look" || created.URL != "" || created.LinkHash != "" {
+			t.Fatalf("unexpected post: %+v", created)
+		}
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if doc.Lookup(mediaKey, "key").StringValue() != "abc.png" {
+			t.Errorf("media was not stored: %v", doc)
+		}
+	})
+}
+
+func TestVotePoll_Mongo(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	stored := func(ballots ...bson.D) bson.D {
+		a := bson.A{}
+		for _, b := range ballots {
+			a = append(a, b)
+		}
+		return bson.D{
+			{Key: "id", Value: "p1"},
+			{Key: "type", Value: "poll"},
+			{Key: "score", Value: 1},
+			{Key: "poll", Value: bson.D{
+				{Key: "options", Value: bson.A{
+					bson.D{{Key: "text", Value: "a"}, {Key: "votes", Value: 1}},
+					bson.D{{Key: "text", Value: "b"}, {Key: "votes", Value: 0}},
+					bson.D{{Key: "text", Value: "c"}, {Key: "votes", Value: 0}},
+				}},
+				{Key: "multiple", Value: true},
+				{Key: "voters", Value: 1},
+				{Key: "ballots", Value: a},
+			}},
+		}
+	}
+	voter := bson.D{{Key: "user_id", Value: "u1"}, {Key: "choices", Value: bson.A{0}}}
+	// ответ PollChoices: от поста только id и бюллетень того, кто спросил
+	choices := func(ns string, ballots ...bson.D) bson.D {
+		a := bson.A{}
+		for _, b := range ballots {
+			a = append(a, b)
+		}
+		docs := []bson.D{}
+		if len(ballots) > 0 {
+			docs = append(docs, bson.D{{Key: "id", Value: "p1"}, {Key: "poll", Value: bson.D{{Key: "ballots", Value: a}}}})
+		}
+		return mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, docs...)
+	}
+
+	mt.Run("vote", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, stored()), choices(ns))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		post, err := repo.VotePoll("p1", "u2", []int{2, 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if post.Poll.Voters != 2 || post.Poll.Options[1].Votes != 1 || post.Poll.Options[2].Votes != 1 || post.Score != 1 {
+			t.Errorf("unexpected post: %+v", post.Poll)
+		}
+		started := mt.GetAllStartedEvents()
+		update := started[len(started)-1].Command.Lookup("updates").Array().Index(0).Value().Document()
+		// один бюллетень на юзера проверяет сама монга
+		if user := update.Lookup("q", ballotUserKey, "$ne").StringValue(); user != "u2" {
+			t.Errorf("filter should skip posts u2 already voted in: %v", update)
+		}
+		if _, err := update.LookupErr("q", removedKey); err != nil {
+			t.Errorf("filter should skip removed posts: %v", update)
+		}
+		if n := update.Lookup("u", "$inc", "poll.options.1.votes").Int32(); n != 1 {
+			t.Errorf("expected option counter to be incremented: %v", update)
+		}
+		if _, err := update.LookupErr("u", "$inc", scoreKey); err == nil {
+			t.Errorf("poll vote should not touch score: %v", update)
+		}
+		if user := update.Lookup("u", "$push", pollBallotsKey, "user_id").StringValue(); user != "u2" {
+			t.Errorf("expected ballot to be pushed: %v", update)
+		}
+	})
+
+	mt.Run("already voted", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, stored()), choices(ns, voter))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.VotePoll("p1", "u1", []int{1}); !errors.Is(err, ErrAlreadyVoted) {
+			t.Fatalf("expected ErrAlreadyVoted, got %v", err)
+		}
+	})
+
+	mt.Run("concurrent vote of the same user", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, stored()), choices(ns))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}))
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, stored()), choices(ns, voter))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.VotePoll("p1", "u1", []int{1}); !errors.Is(err, ErrAlreadyVoted) {
+			t.Fatalf("expected ErrAlreadyVoted, got %v", err)
+		}
+	})
+
+	mt.Run("ballots stay in the database", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, stored()), choices(ns, voter))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.GetPost("p1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		projection := mt.GetStartedEvent().Command.Lookup("projection").Document()
+		if projection.Lookup(pollBallotsKey).Int32() != 0 || projection.Lookup(revisionsKey).Int32() != 0 {
+			t.Errorf("expected ballots and revisions to be projected out of GetPost: %v", projection)
+		}
+
+		got, err := repo.PollChoices("u1", []string{"p1", "p2"})
+		if err != nil || len(got) != 1 || !reflect.DeepEqual(got["p1"], []int{0}) {
+			t.Fatalf("unexpected choices: %v (%v)", got, err)
+		}
+		find := mt.GetStartedEvent().Command
+		if _, err := find.LookupErr("projection", pollBallotsKey+".$"); err != nil || find.Lookup("filter", ballotUserKey).StringValue() != "u1" {
+			t.Errorf("expected only the ballot of u1 to be fetched: %v", find)
+		}
+	})
+
+	mt.Run("create", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		request := NewPostRequest{Category: "polls", Type: "poll", Title: "?", Poll: &NewPollRequest{Options: []string{"a", "b"}}}
+		created := repo.CreatePost(request, "alice", "1")
+		if created == nil || created.Poll == nil || len(created.Poll.Options) != 2 {
+			t.Fatalf("unexpected post: %+v", created)
+		}
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if text := doc.Lookup(pollKey, "options").Array().Index(1).Value().Document().Lookup("text").StringValue(); text != "b" {
+			t.Errorf("poll was not stored: %v", doc)
+		}
+		// пустой массив, а не null: иначе $push в первый голос упадет
+		if doc.Lookup(pollKey, "ballots").Type != bson.TypeArray {
+			t.Errorf("ballots should be an array: %v", doc)
+		}
+	})
+}
+
+func TestBackfillHTML(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("renders text and comments", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{
+			{Key: "id", Value: "p1"},
+			{Key: "text", Value: "**old**"},
+			{Key: "comments", Value: bson.A{bson.D{{Key: "body", Value: "a"}}, bson.D{{Key: "body", Value: "<b>"}}}},
+		}))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if err := repo.BackfillHTML(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		started := mt.GetAllStartedEvents()
+		set := started[len(started)-1].Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+		expected := map[string]string{
+			"text_html":            "<p><strong>old</strong></p>\n",
+			"comments.0.body_html": "<p>a</p>\n",
+			"comments.1.body_html": "<p>&lt;b&gt;</p>\n",
+		}
+		for key, value := range expected {
+			if got := set.Lookup(key).StringValue(); got != value {
+				t.Errorf("%s: expected %q, got %q", key, value, got)
+			}
+		}
+	})
+}
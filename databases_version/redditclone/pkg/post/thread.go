@@ -0,0 +1,145 @@
+package post
+
+import (
+	"redditclone/pkg/markdown"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/role"
+	"sort"
+)
+
+const (
+	DefaultCommentDepth = 3
+	MaxCommentDepth     = 10
+
+	deletedCommentText = "[deleted]"
+)
+
+// Комменты в посте хранятся плоским списком со ссылкой на родителя, а деревом собираются только на выдачу -
+// так добавление ответа остается одним $push, а не поиском по вложенным массивам
+
+// CommentTree собирает ответы на parentID ("" - корневые комменты) деревом не глубже depth уровней.
+// У комментов на последнем уровне в MoreReplies - сколько ответов не влезло, их догружают отдельно
+func CommentTree(comments []Comment, parentID string, depth int) []Comment {
+	depth = max(1, min(depth, MaxCommentDepth))
+	children := make(map[string][]Comment)
+	for _, c := range comments {
+		children[c.ParentID] = append(children[c.ParentID], c)
+	}
+
+	var build func(parentID string, depth int) []Comment
+	build = func(parentID string, depth int) []Comment {
+		level := make([]Comment, 0, len(children[parentID]))
+		for _, c := range children[parentID] {
+			if depth > 1 {
+				c.Replies = build(c.ID, depth-1)
+			} else {
+				c.MoreReplies = len(children[c.ID])
+			}
+			level = append(level, c)
+		}
+		return level
+	}
+	return build(parentID, depth)
+}
+
+// SortComments упорядочивает комменты по ?sort=. Сортировка устойчивая, так что при равенстве
+// остается порядок добавления, а дерево из отсортированного списка получается отсортированным на каждом уровне
+func SortComments(comments []Comment, order ranking.Sort) {
+	if order == ranking.SortNew {
+		sort.SliceStable(comments, func(i, j int) bool {
+			return comments[i].Created.After(comments[j].Created)
+		})
+		return
+	}
+	key := func(c *Comment) float64 {
+		switch order {
+		case ranking.SortTop:
+			return float64(c.Score)
+		case ranking.SortControversial:
+			return ranking.Controversy(c.Ups, c.Downs)
+		}
+		return ranking.Best(c.Ups, c.Downs)
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		return key(&comments[i]) > key(&comments[j])
+	})
+}
+
+func (p *Post) findComment(commentID string) int {
+	for i, c := range p.Comments {
+		if c.ID == commentID {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindComment - коммент поста по id, ok = false - такого нет
+func (p *Post) FindComment(commentID string) (Comment, bool) {
+	i := p.findComment(commentID)
+	if i == -1 {
+		return Comment{}, false
+	}
+	return p.Comments[i], true
+}
+
+func (p *Post) hasReplies(commentID string) bool {
+	for _, c := range p.Comments {
+		if c.ParentID == commentID {
+			return true
+		}
+	}
+	return false
+}
+
+// addComment - на удаленный коммент ответить нельзя, как и на несуществующий
+func (p *Post) addComment(comment Comment) error {
+	if comment.ParentID != "" {
+		i := p.findComment(comment.ParentID)
+		if i == -1 || p.Comments[i].Deleted {
+			return ErrCommentNotFound
+		}
+	}
+	p.Comments = append(p.Comments, comment)
+	return nil
+}
+
+// Tombstone - надгробие [deleted] на месте коммента: место в ветке остается, а автор и текст - нет
+func (c Comment) Tombstone() Comment {
+	c.Deleted = true
+	c.Body = deletedCommentText
+	c.BodyHTML = markdown.Render(deletedCommentText)
+	c.Author = Author{Username: deletedCommentText}
+	c.Edited = nil
+	return c
+}
+
+// removeComment удаляет коммент, если actor может его удалить, см. role.CanDelete. Если на него уже ответили, оставляем на его месте надгробие [deleted],
+// чтобы ветка не осталась без корня. Иначе удаляем совсем, а заодно и надгробия над ним, у которых не осталось ответов
+func (p *Post) removeComment(commentID string, actor role.Actor) error {
+	i := p.findComment(commentID)
+	if i == -1 || p.Comments[i].Deleted {
+		return ErrCommentNotFound
+	}
+	if !role.CanDelete(actor, role.Target{AuthorID: p.Comments[i].Author.ID, Community: p.Category}) {
+		return ErrUnauthorized
+	}
+	p.dropRevisions(commentID)
+
+	if p.hasReplies(commentID) {
+		p.Comments[i] = p.Comments[i].Tombstone()
+		return nil
+	}
+
+	parentID := p.Comments[i].ParentID
+	p.Comments = append(p.Comments[:i], p.Comments[i+1:]...)
+	for parentID != "" {
+		j := p.findComment(parentID)
+		if j == -1 || !p.Comments[j].Deleted || p.hasReplies(parentID) {
+			break
+		}
+		parentID = p.Comments[j].ParentID
+		p.Comments = append(p.Comments[:j], p.Comments[j+1:]...)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package post
+
+import (
+	"errors"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/role"
+	"testing"
+	"time"
+)
+
+func threadComment(id, parentID, authorID string) Comment {
+	c := Comment{ID: id, ParentID: parentID, Body: "body " + id}
+	c.Author.ID = authorID
+	return c
+}
+
+// r1 -> a -> b -> c, r1 -> d, r2
+func samplePostThread() *Post {
+	return &Post{Comments: []Comment{
+		threadComment("r1", "", "u1"),
+		threadComment("a", "r1", "u2"),
+		threadComment("b", "a", "u1"),
+		threadComment("c", "b", "u2"),
+		threadComment("d", "r1", "u3"),
+		threadComment("r2", "", "u3"),
+	}}
+}
+
+func TestCommentTree(t *testing.T) {
+	p := samplePostThread()
+
+	tree := CommentTree(p.Comments, "", 2)
+	if len(tree) != 2 || tree[0].ID != "r1" || tree[1].ID != "r2" {
+		t.Fatalf("unexpected roots: %+v", tree)
+	}
+	r1 := tree[0]
+	if len(r1.Replies) != 2 || r1.Replies[0].ID != "a" || r1.Replies[1].ID != "d" {
+		t.Fatalf("unexpected replies: %+v", r1.Replies)
+	}
+	if a := r1.Replies[0]; len(a.Replies) != 0 || a.MoreReplies != 1 {
+		t.Errorf("expected a to be cut with 1 more reply, got %+v", a)
+	}
+	if r1.Replies[1].MoreReplies != 0 {
+		t.Errorf("d has no replies, got %+v", r1.Replies[1])
+	}
+
+	sub := CommentTree(p.Comments, "a", 5)
+	if len(sub) != 1 || sub[0].ID != "b" || len(sub[0].Replies) != 1 || sub[0].Replies[0].ID != "c" {
+		t.Errorf("unexpected subtree: %+v", sub)
+	}
+
+	if flat := CommentTree(p.Comments, "", 0); len(flat) != 2 || flat[0].MoreReplies != 2 {
+		t.Errorf("depth below 1 should be clamped to 1, got %+v", flat)
+	}
+}
+
+func TestAddCommentReply(t *testing.T) {
+	p := samplePostThread()
+	if err := p.addComment(threadComment("e", "c", "u1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.addComment(threadComment("f", "missing", "u1")); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("expected ErrCommentNotFound, got %v", err)
+	}
+
+	p.Comments[p.findComment("d")].Deleted = true
+	if err := p.addComment(threadComment("g", "d", "u1")); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("expected ErrCommentNotFound for deleted parent, got %v", err)
+	}
+}
+
+func TestRemoveComment(t *testing.T) {
+	p := samplePostThread()
+
+	if err := p.removeComment("a", role.Actor{UserID: "u1"}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+
+	// у a есть ответы - остается надгробие
+	if err := p.removeComment("a", role.Actor{UserID: "u2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a := p.Comments[p.findComment("a")]
+	if !a.Deleted || a.Body != deletedCommentText || a.BodyHTML != "<p>[deleted]</p>\n" || a.Author.ID != "" {
+		t.Errorf("expected tombstone, got %+v", a)
+	}
+	if err := p.removeComment("a", role.Actor{UserID: "u2"}); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("expected ErrCommentNotFound for tombstone, got %v", err)
+	}
+
+	// b тоже становится надгробием, а после удаления c пустые надгробия b и a уходят вместе с ним
+	if err := p.removeComment("b", role.Actor{UserID: "u1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.removeComment("c", role.Actor{UserID: "u2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if p.findComment(id) != -1 {
+			t.Errorf("expected %s to be removed, got %+v", id, p.Comments)
+		}
+	}
+	if len(p.Comments) != 3 || p.findComment("r1") == -1 {
+		t.Errorf("unexpected comments left: %+v", p.Comments)
+	}
+}
+
+func TestRemoveComment_Moderator(t *testing.T) {
+	p := samplePostThread()
+	p.Category = "golang"
+
+	stranger := role.Actor{UserID: "u9", Roles: &role.Roles{Moderates: []string{"music"}}}
+	if err := p.removeComment("d", stranger); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized for moderator of another community, got %v", err)
+	}
+	moderator := role.Actor{UserID: "u9", Roles: &role.Roles{Moderates: []string{"golang"}}}
+	if err := p.removeComment("d", moderator); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.findComment("d") != -1 {
+		t.Errorf("expected d to be removed, got %+v", p.Comments)
+	}
+}
+
+func TestSortComments(t *testing.T) {
+	now := time.Now()
+	original := []Comment{
+		{ID: "few", Score: 1, Ups: 1, Created: now.Add(-3 * time.Hour)},
+		{ID: "many", Score: 8, Ups: 10, Downs: 2, Created: now.Add(-2 * time.Hour)},
+		{ID: "split", Score: 0, Ups: 5, Downs: 5, Created: now.Add(-time.Hour)},
+		{ID: "fresh", Created: now},
+	}
+	var comments []Comment
+	ids := func() string {
+		out := ""
+		for _, c := range comments {
+			out += c.ID + " "
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		order ranking.Sort
+		want  string
+	}{
+		{ranking.SortBest, "many split few fresh "},
+		{ranking.SortTop, "many few split fresh "},
+		{ranking.SortNew, "fresh split many few "},
+		{ranking.SortControversial, "split many few fresh "},
+	} {
+		comments = append([]Comment(nil), original...)
+		SortComments(comments, tc.order)
+		if got := ids(); got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.order, tc.want, got)
+		}
+	}
+}
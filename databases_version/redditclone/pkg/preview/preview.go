@@ -0,0 +1,51 @@
+package preview
+
+import (
+	"errors"
+	"time"
+)
+
+// Preview - карточка ссылки: то, что сайт сам про себя пишет в OpenGraph/Twitter-метатегах
+type Preview struct {
+	Title       string `json:"title,omitempty" bson:"title,omitempty"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	SiteName    string `json:"siteName,omitempty" bson:"site_name,omitempty"`
+	// картинка на самом сайте, как ее указали в og:image
+	Image string `json:"image,omitempty" bson:"image,omitempty"`
+	// наша уменьшенная копия картинки, пустая - скачать или разобрать ее не вышло
+	Thumbnail string    `json:"thumbnail,omitempty" bson:"thumbnail,omitempty"`
+	Fetched   time.Time `json:"fetched" bson:"fetched"`
+}
+
+const (
+	DefaultTimeout   = 10 * time.Second
+	DefaultMaxBody   = 2 << 20
+	DefaultMaxImage  = 5 << 20
+	DefaultQueueSize = 1000
+	UserAgent        = "redditclone-preview/1.0"
+
+	maxRedirects         = 5
+	maxRobots            = 512 << 10
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+)
+
+var (
+	ErrBadURL         = errors.New("bad url")
+	ErrBlocked        = errors.New("domain is blocked")
+	ErrPrivateAddress = errors.New("address is not public")
+	ErrRobots         = errors.New("disallowed by robots.txt")
+	ErrContentType    = errors.New("unsupported content type")
+	ErrTooLarge       = errors.New("response is too large")
+	ErrNoPreview      = errors.New("page has no preview metadata")
+)
+
+// Sink - куда записывается готовое превью, см. post.PostRepo.SetPreview
+type Sink interface {
+	SetPreview(postID string, p Preview) error
+}
+
+// Queue - то, что нужно хендлеру: поставить ссылку поста в очередь, не дожидаясь загрузки
+type Queue interface {
+	Enqueue(postID, rawURL string)
+}
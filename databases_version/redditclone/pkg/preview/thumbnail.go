@@ -0,0 +1,51 @@
+package preview
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ThumbnailStore сохраняет миниатюру и отдает ссылку, по которой ее раздаем
+type ThumbnailStore interface {
+	SaveThumbnail(name string, data []byte) (string, error)
+}
+
+// FileStore кладет миниатюры в папку, которую раздает статика
+type FileStore struct {
+	dir       string
+	urlPrefix string
+}
+
+func NewFileStore(dir, urlPrefix string) *FileStore {
+	return &FileStore{dir: dir, urlPrefix: urlPrefix}
+}
+
+func (s *FileStore) SaveThumbnail(name string, data []byte) (string, error) {
+	if name == "" || filepath.Base(name) != name || name[0] == '.' {
+		return "", errors.New("bad thumbnail name")
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return "", err
+	}
+	// через временный файл, чтобы статика не отдала недописанную картинку
+	tmp, err := os.CreateTemp(s.dir, ".thumb-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return "", err
+	}
+	return s.urlPrefix + "/" + name, nil
+}
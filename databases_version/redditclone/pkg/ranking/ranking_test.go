@@ -0,0 +1,92 @@
+package ranking
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHot(t *testing.T) {
+	now := time.Date(2025, 5, 5, 12, 0, 0, 0, time.UTC)
+
+	if Hot(10, now) <= Hot(1, now) {
+		t.Errorf("more votes should rank higher")
+	}
+	if Hot(1, now) <= Hot(-5, now) {
+		t.Errorf("downvoted post should rank lower")
+	}
+	// за 12.5 часов пост догоняет в 10 раз более заплюсованный
+	if Hot(1, now.Add(13*time.Hour)) <= Hot(10, now) {
+		t.Errorf("newer post should win after decay period")
+	}
+}
+
+func TestRising(t *testing.T) {
+	now := time.Date(2025, 5, 5, 12, 0, 0, 0, time.UTC)
+
+	if Rising(1, 10, now) <= Rising(1, 0, now) {
+		t.Errorf("comments should push post up")
+	}
+	if Rising(1, 0, now.Add(4*time.Hour)) <= Rising(10, 0, now) {
+		t.Errorf("rising should decay faster than hot")
+	}
+}
+
+func TestControversy(t *testing.T) {
+	if Controversy(10, 0) != 0 || Controversy(0, 10) != 0 {
+		t.Errorf("one-sided votes are not controversial")
+	}
+	if Controversy(50, 50) <= Controversy(90, 10) {
+		t.Errorf("balanced votes should be more controversial")
+	}
+	if Controversy(50, 50) <= Controversy(5, 5) {
+		t.Errorf("more votes should be more controversial")
+	}
+}
+
+func TestParse(t *testing.T) {
+	if s, err := ParseSort(""); err != nil || s != SortHot {
+		t.Errorf("expected default hot, got %v %v", s, err)
+	}
+	if _, err := ParseSort("best"); !errors.Is(err, ErrBadSort) {
+		t.Errorf("expected ErrBadSort, got %v", err)
+	}
+	if p, err := ParsePeriod(""); err != nil || p != PeriodDay {
+		t.Errorf("expected default day, got %v %v", p, err)
+	}
+	if _, err := ParsePeriod("decade"); !errors.Is(err, ErrBadPeriod) {
+		t.Errorf("expected ErrBadPeriod, got %v", err)
+	}
+
+	now := time.Now()
+	if !PeriodAll.Since(now).IsZero() {
+		t.Errorf("all should not limit period")
+	}
+	if !PeriodWeek.Since(now).Equal(now.AddDate(0, 0, -7)) {
+		t.Errorf("unexpected week start")
+	}
+}
+
+func TestBest(t *testing.T) {
+	if Best(0, 0) != 0 {
+		t.Errorf("no votes should give zero")
+	}
+	if Best(10, 0) <= Best(1, 0) {
+		t.Errorf("more evidence should rank higher at the same ratio")
+	}
+	if Best(8, 2) <= Best(2, 8) {
+		t.Errorf("mostly upvoted should rank higher")
+	}
+	if b := Best(100, 0); b <= 0 || b >= 1 {
+		t.Errorf("best should be in (0, 1), got %v", b)
+	}
+}
+
+func TestParseCommentSort(t *testing.T) {
+	if s, err := ParseCommentSort(""); err != nil || s != SortBest {
+		t.Errorf("expected best by default, got %q %v", s, err)
+	}
+	if _, err := ParseCommentSort(string(SortHot)); !errors.Is(err, ErrBadSort) {
+		t.Errorf("hot is not a comment sort, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"time"
+
+	"redditclone/pkg/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	idKey       = "id"
+	statusKey   = "status"
+	categoryKey = "category"
+	countKey    = "count"
+	createdKey  = "created"
+	versionKey  = "version"
+
+	maxUpdateAttempts = 5
+)
+
+var ErrConflict = errors.New("report is being updated concurrently")
+
+type ReportMongoRepo struct {
+	collection *mongo.Collection
+	threshold  int
+	logger     *zap.SugaredLogger
+}
+
+// NewMongoRepo - threshold жалоб прячет пост из лент, 0 - не прятать никогда
+func NewMongoRepo(collection *mongo.Collection, threshold int, logger *zap.SugaredLogger) *ReportMongoRepo {
+	return &ReportMongoRepo{
+		collection: collection,
+		threshold:  threshold,
+		logger:     logger,
+	}
+}
+
+// EnsureIndexes - один документ на пост или коммент и индекс под очередь модератора
+func (repo *ReportMongoRepo) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: idKey, Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: statusKey, Value: 1}, {Key: categoryKey, Value: 1}, {Key: countKey, Value: -1}, {Key: createdKey, Value: 1}}},
+	}
+	if _, err := repo.collection.Indexes().CreateMany(ctx, models); err != nil {
+		repo.logger.Errorf("Error creating report indexes: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *ReportMongoRepo) Get(itemID string) (*Item, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var item Item
+	err := repo.collection.FindOne(ctx, bson.M{idKey: itemID}).Decode(&item)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNoItem
+	}
+	if err != nil {
+		repo.logger.Errorf("Error finding report %s: %v", itemID, err)
+		return nil, err
+	}
+	return &item, nil
+}
+
+// updateItem - как updatePost у постов: читаем, меняем, пишем целиком с проверкой версии
+func (repo *ReportMongoRepo) updateItem(itemID string, mutate func(item *Item) error) (*Item, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		item, err := repo.Get(itemID)
+		if err != nil {
+			return nil, err
+		}
+		version := item.Version
+		if err = mutate(item); err != nil {
+			return nil, err
+		}
+		item.Version = version + 1
+
+		res, err := repo.collection.ReplaceOne(ctx, bson.M{idKey: itemID, versionKey: version}, item)
+		if err != nil {
+			repo.logger.Errorf("Error updating report %s: %v", itemID, err)
+			return nil, err
+		}
+		if res.MatchedCount == 1 {
+			return item, nil
+		}
+		repo.logger.Debugf("Report %s was updated concurrently, retrying", itemID)
+	}
+	return nil, ErrConflict
+}
+
+func (repo *ReportMongoRepo) Report(target Target, report Report) (*Item, error) {
+	itemID := ItemID(target.PostID, target.CommentID)
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		item, err := repo.updateItem(itemID, func(item *Item) error {
+			return item.add(report, repo.threshold)
+		})
+		if !errors.Is(err, ErrNoItem) {
+			return item, err
+		}
+
+		// первая жалоба. Две первые одновременно упрутся в уникальный индекс, и вторая уйдет на новый круг
+		item = newItem(target, report.Created)
+		if err = item.add(report, repo.threshold); err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err = repo.collection.InsertOne(ctx, item)
+		cancel()
+		if err == nil {
+			return item, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			repo.logger.Errorf("Error inserting report %s: %v", itemID, err)
+			return nil, err
+		}
+	}
+	return nil, ErrConflict
+}
+
+func (repo *ReportMongoRepo) Resolve(itemID string, status Status, moderator string) (*Item, error) {
+	return repo.updateItem(itemID, func(item *Item) error {
+		return item.resolve(status, moderator, time.Now().UTC())
+	})
+}
+
+func (repo *ReportMongoRepo) Queue(query QueueQuery) ([]Item, error) {
+	filter := bson.M{statusKey: StatusOpen}
+	if !query.All {
+		communities := query.Communities
+		if communities == nil {
+			communities = []string{}
+		}
+		filter[categoryKey] = bson.M{"$in": communities}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: countKey, Value: -1}, {Key: createdKey, Value: 1}}).
+		SetLimit(int64(query.limit()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	itemsFromDB, err := repo.collection.Find(ctx, filter, opts)
+	if err != nil {
+		repo.logger.Errorf("Error listing reports: %v", err)
+		return nil, err
+	}
+
+	defer utils.HandleMongoCursorClose(itemsFromDB, ctx)
+
+	items := make([]Item, 0)
+	for itemsFromDB.Next(ctx) {
+		var item Item
+		if err := itemsFromDB.Decode(&item); err != nil {
+			repo.logger.Errorf("Error decoding report: %v", err)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, itemsFromDB.Err()
+}
@@ -0,0 +1,169 @@
+package report
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.uber.org/zap"
+)
+
+var nilLogger = zap.NewNop().Sugar()
+
+func itemDoc(t *testing.T, item *Item) bson.D {
+	t.Helper()
+	raw, err := bson.Marshal(item)
+	if err != nil {
+		t.Fatalf("marshal item: %v", err)
+	}
+	var doc bson.D
+	if err = bson.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("unmarshal item: %v", err)
+	}
+	return doc
+}
+
+func replaced() bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+}
+
+func TestReport(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	target := Target{PostID: "p1", Category: "music", Title: "title"}
+
+	mt.Run("first report", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.reports", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(),
+		)
+		repo := NewMongoRepo(mt.Coll, 2, nilLogger)
+		item, err := repo.Report(target, newTestReport(t, "1"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if item.ID != "p1" || item.Count != 1 || item.Hidden || item.Status != StatusOpen {
+			t.Errorf("unexpected item: %+v", item)
+		}
+	})
+
+	mt.Run("second report hides post", func(mt *mtest.T) {
+		existing := newItem(target, now)
+		_ = existing.add(newTestReport(t, "1"), 2)
+		existing.Version = 3
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.reports", mtest.FirstBatch, itemDoc(t, existing)),
+			replaced(),
+		)
+		repo := NewMongoRepo(mt.Coll, 2, nilLogger)
+		item, err := repo.Report(target, newTestReport(t, "2"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if item.Count != 2 || !item.Hidden || item.Version != 4 {
+			t.Errorf("unexpected item: %+v", item)
+		}
+		events := mt.GetAllStartedEvents()
+		filter := events[len(events)-1].Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		if v := filter.Lookup(versionKey).AsInt64(); v != 3 {
+			t.Errorf("expected replace by version 3, got %d", v)
+		}
+	})
+
+	mt.Run("duplicate reporter", func(mt *mtest.T) {
+		existing := newItem(target, now)
+		_ = existing.add(newTestReport(t, "1"), 2)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.reports", mtest.FirstBatch, itemDoc(t, existing)))
+		repo := NewMongoRepo(mt.Coll, 2, nilLogger)
+		if _, err := repo.Report(target, newTestReport(t, "1")); !errors.Is(err, ErrAlreadyReported) {
+			t.Fatalf("expected ErrAlreadyReported, got %v", err)
+		}
+	})
+
+	mt.Run("retry on concurrent first report", func(mt *mtest.T) {
+		existing := newItem(target, now)
+		_ = existing.add(newTestReport(t, "2"), 2)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.reports", mtest.FirstBatch),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}),
+			mtest.CreateCursorResponse(0, "db.reports", mtest.FirstBatch, itemDoc(t, existing)),
+			replaced(),
+		)
+		repo := NewMongoRepo(mt.Coll, 2, nilLogger)
+		item, err := repo.Report(target, newTestReport(t, "1"))
+		if err != nil || item.Count != 2 {
+			t.Fatalf("expected 2 reports after retry, got %+v (%v)", item, err)
+		}
+	})
+}
+
+func TestResolve(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("success", func(mt *mtest.T) {
+		existing := newItem(Target{PostID: "p1"}, now)
+		_ = existing.add(newTestReport(t, "1"), 1)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.reports", mtest.FirstBatch, itemDoc(t, existing)),
+			replaced(),
+		)
+		repo := NewMongoRepo(mt.Coll, 1, nilLogger)
+		item, err := repo.Resolve("p1", StatusApproved, "mod")
+		if err != nil || item.Status != StatusApproved || item.Hidden {
+			t.Fatalf("unexpected result: %+v (%v)", item, err)
+		}
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.reports", mtest.FirstBatch))
+		repo := NewMongoRepo(mt.Coll, 1, nilLogger)
+		if _, err := repo.Resolve("p1", StatusApproved, "mod"); !errors.Is(err, ErrNoItem) {
+			t.Fatalf("expected ErrNoItem, got %v", err)
+		}
+	})
+
+	mt.Run("conflict", func(mt *mtest.T) {
+		existing := newItem(Target{PostID: "p1"}, now)
+		_ = existing.add(newTestReport(t, "1"), 1)
+		for i := 0; i < maxUpdateAttempts; i++ {
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "db.reports", mtest.FirstBatch, itemDoc(t, existing)),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			)
+		}
+		repo := NewMongoRepo(mt.Coll, 1, nilLogger)
+		if _, err := repo.Resolve("p1", StatusIgnored, "mod"); !errors.Is(err, ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
+		}
+	})
+}
+
+func TestQueue(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("moderator communities", func(mt *mtest.T) {
+		item := newItem(Target{PostID: "p1", Category: "music"}, now)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.reports", mtest.FirstBatch, itemDoc(t, item)))
+		repo := NewMongoRepo(mt.Coll, 1, nilLogger)
+		items, err := repo.Queue(QueueQuery{Communities: []string{"music"}})
+		if err != nil || len(items) != 1 || items[0].ID != "p1" {
+			t.Fatalf("unexpected result: %+v (%v)", items, err)
+		}
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		if _, err := filter.LookupErr(categoryKey, "$in"); err != nil {
+			t.Errorf("expected category filter, got %v", filter)
+		}
+	})
+
+	mt.Run("admin sees all", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.reports", mtest.FirstBatch))
+		repo := NewMongoRepo(mt.Coll, 1, nilLogger)
+		if _, err := repo.Queue(QueueQuery{All: true}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		if _, err := filter.LookupErr(categoryKey); err == nil {
+			t.Errorf("admin queue should not filter by category, got %v", filter)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package report
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestReport(t *testing.T, userID string) Report {
+	t.Helper()
+	report, err := NewReport("user "+userID, userID, "spam", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return report
+}
+
+func TestNewReport(t *testing.T) {
+	if _, err := NewReport("u", "1", "  ", now); !errors.Is(err, ErrBadReason) {
+		t.Errorf("expected ErrBadReason for blank reason, got %v", err)
+	}
+	if _, err := NewReport("u", "1", strings.Repeat("a", maxReasonLength+1), now); !errors.Is(err, ErrBadReason) {
+		t.Errorf("expected ErrBadReason for long reason, got %v", err)
+	}
+	report, err := NewReport("u", "1", " spam ", now)
+	if err != nil || report.Reason != "spam" {
+		t.Errorf("expected trimmed reason, got %+v (%v)", report, err)
+	}
+}
+
+func TestItemAdd(t *testing.T) {
+	item := newItem(Target{PostID: "p1", Category: "music", Excerpt: strings.Repeat("я", maxExcerptLength+10)}, now)
+	if len([]rune(item.Excerpt)) != maxExcerptLength {
+		t.Errorf("expected excerpt cut to %d runes, got %d", maxExcerptLength, len([]rune(item.Excerpt)))
+	}
+
+	if err := item.add(newTestReport(t, "1"), 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.Hidden {
+		t.Error("post should not be hidden below threshold")
+	}
+	if err := item.add(newTestReport(t, "1"), 2); !errors.Is(err, ErrAlreadyReported) {
+		t.Errorf("expected ErrAlreadyReported, got %v", err)
+	}
+	if err := item.add(newTestReport(t, "2"), 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.Count != 2 || !item.Hidden {
+		t.Errorf("expected 2 reports and hidden post, got %+v", item)
+	}
+
+	comment := newItem(Target{PostID: "p1", CommentID: "c1"}, now)
+	_ = comment.add(newTestReport(t, "1"), 1)
+	if comment.ID != "p1:c1" || comment.Hidden {
+		t.Errorf("comments are never hidden, got %+v", comment)
+	}
+
+	disabled := newItem(Target{PostID: "p2"}, now)
+	_ = disabled.add(newTestReport(t, "1"), 0)
+	if disabled.Hidden {
+		t.Error("threshold 0 should never hide")
+	}
+
+	held := newItem(Target{PostID: "p3"}, now)
+	hold := newTestReport(t, "1")
+	hold.Hold = true
+	_ = held.add(hold, 0)
+	if !held.Hidden {
+		t.Error("hold should hide post without threshold")
+	}
+}
+
+func TestItemResolve(t *testing.T) {
+	item := newItem(Target{PostID: "p1"}, now)
+	_ = item.add(newTestReport(t, "1"), 1)
+
+	if err := item.resolve(StatusOpen, "mod", now); !errors.Is(err, ErrBadResolution) {
+		t.Errorf("expected ErrBadResolution, got %v", err)
+	}
+	if err := item.resolve(StatusApproved, "mod", now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.Hidden || item.ResolvedBy != "mod" {
+		t.Errorf("expected unhidden item resolved by mod, got %+v", item)
+	}
+	if err := item.resolve(StatusRemoved, "mod", now); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("expected ErrNotOpen, got %v", err)
+	}
+
+	// после approve новая жалоба открывает заново, и тот же юзер может пожаловаться снова
+	if err := item.add(newTestReport(t, "1"), 5); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.Status != StatusOpen || item.Count != 1 || item.ResolvedBy != "" {
+		t.Errorf("expected reopened item, got %+v", item)
+	}
+
+	_ = item.resolve(StatusRemoved, "mod", now)
+	if err := item.add(newTestReport(t, "2"), 5); !errors.Is(err, ErrAlreadyModerated) {
+		t.Errorf("expected ErrAlreadyModerated, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package role
+
+import (
+	"database/sql"
+	"errors"
+)
+
+type RoleMySQLRepo struct {
+	db *sql.DB
+}
+
+func NewMySQLRepo(db *sql.DB) *RoleMySQLRepo {
+	return &RoleMySQLRepo{db: db}
+}
+
+func (repo *RoleMySQLRepo) Roles(userID string) (*Roles, error) {
+	rows, err := repo.db.Query("SELECT role, community FROM user_roles WHERE user_id = ? ORDER BY community", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	roles := &Roles{Moderates: make([]string, 0)}
+	for rows.Next() {
+		var role, community string
+		if err := rows.Scan(&role, &community); err != nil {
+			return nil, err
+		}
+		switch role {
+		case Admin:
+			roles.Admin = true
+		case Moderator:
+			roles.Moderates = append(roles.Moderates, community)
+		}
+	}
+	return roles, rows.Err()
+}
+
+func (repo *RoleMySQLRepo) AddModerator(community, username string) error {
+	var userID string
+	err := repo.db.QueryRow("SELECT id, username FROM users WHERE username = ?", username).Scan(&userID, &username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoUser
+	}
+	if err != nil {
+		return err
+	}
+	_, err = repo.db.Exec("INSERT IGNORE INTO user_roles (user_id, username, role, community) VALUES (?, ?, ?, ?)",
+		userID, username, Moderator, community)
+	return err
+}
+
+func (repo *RoleMySQLRepo) RemoveModerator(community, username string) error {
+	_, err := repo.db.Exec("DELETE FROM user_roles WHERE username = ? AND role = ? AND community = ?", username, Moderator, community)
+	return err
+}
+
+func (repo *RoleMySQLRepo) Moderators(community string) ([]string, error) {
+	rows, err := repo.db.Query("SELECT username FROM user_roles WHERE role = ? AND community = ? ORDER BY username", Moderator, community)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	usernames := make([]string, 0)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
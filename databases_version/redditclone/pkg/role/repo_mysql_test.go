@@ -0,0 +1,73 @@
+package role
+
+import (
+	"testing"
+
+	"redditclone/pkg/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleMySQLRepo_Roles(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+	repo := NewMySQLRepo(db)
+
+	mock.ExpectQuery("SELECT role, community FROM user_roles").
+		WithArgs("uid").
+		WillReturnRows(sqlmock.NewRows([]string{"role", "community"}).AddRow(Moderator, "golang").AddRow(Moderator, "music"))
+	roles, err := repo.Roles("uid")
+	assert.NoError(t, err)
+	assert.False(t, roles.Admin)
+	assert.True(t, roles.CanModerate("Golang"))
+	assert.False(t, roles.CanModerate("news"))
+
+	mock.ExpectQuery("SELECT role, community FROM user_roles").
+		WithArgs("admin").
+		WillReturnRows(sqlmock.NewRows([]string{"role", "community"}).AddRow(Admin, ""))
+	roles, err = repo.Roles("admin")
+	assert.NoError(t, err)
+	assert.True(t, roles.CanModerate("news"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRoleMySQLRepo_Moderators(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+	repo := NewMySQLRepo(db)
+
+	mock.ExpectQuery("SELECT id, username FROM users").
+		WithArgs("Bob").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("bid", "bob"))
+	mock.ExpectExec("INSERT IGNORE INTO user_roles").
+		WithArgs("bid", "bob", Moderator, "golang").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.AddModerator("golang", "Bob"))
+
+	mock.ExpectQuery("SELECT id, username FROM users").
+		WithArgs("ghost").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}))
+	assert.ErrorIs(t, repo.AddModerator("golang", "ghost"), ErrNoUser)
+
+	mock.ExpectQuery("SELECT username FROM user_roles").
+		WithArgs(Moderator, "golang").
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("bob"))
+	moderators, err := repo.Moderators("golang")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, moderators)
+
+	mock.ExpectExec("DELETE FROM user_roles").
+		WithArgs("bob", Moderator, "golang").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.RemoveModerator("golang", "bob"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,72 @@
+package role
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	Admin     = "admin"
+	Moderator = "moderator"
+)
+
+var ErrNoUser = errors.New("user not found")
+
+// Roles - права юзера. Админ модерирует все, модератор - только свои сообщества
+type Roles struct {
+	Admin     bool     `json:"admin"`
+	Moderates []string `json:"moderates"`
+}
+
+// IsModerator - модерирует ли юзер хоть одно сообщество, для общих модераторских страниц
+func (r *Roles) IsModerator() bool {
+	return r.Admin || len(r.Moderates) > 0
+}
+
+// CanModerate - может ли юзер убирать чужие посты и комменты в категории
+func (r *Roles) CanModerate(community string) bool {
+	if r.Admin {
+		return true
+	}
+	for _, name := range r.Moderates {
+		if strings.EqualFold(name, community) {
+			return true
+		}
+	}
+	return false
+}
+
+// Actor - кто действует: юзер и его роли. Roles == nil - ролей нет
+type Actor struct {
+	UserID string
+	Roles  *Roles
+}
+
+// Target - над чьим контентом действуют и в какой он категории
+type Target struct {
+	AuthorID  string
+	Community string
+}
+
+// CanDelete - свое удаляет автор, чужое - модератор категории или админ
+func CanDelete(actor Actor, target Target) bool {
+	if actor.UserID == target.AuthorID {
+		return true
+	}
+	return actor.Roles != nil && actor.Roles.CanModerate(target.Community)
+}
+
+// CanEdit - править можно только свое, роли тут не дают ничего: модератор чужие слова не переписывает,
+// а убирает их с причиной, см. post.Removal
+func CanEdit(actor Actor, target Target) bool {
+	return actor.UserID == target.AuthorID
+}
+
+// RoleRepo - кто админ и кто что модерирует. Админов назначают руками в базе, модераторов - админы через апи
+type RoleRepo interface {
+	Roles(userID string) (*Roles, error)
+	// AddModerator и RemoveModerator идемпотентны, как подписки
+	AddModerator(community, username string) error
+	RemoveModerator(community, username string) error
+	Moderators(community string) ([]string, error)
+}
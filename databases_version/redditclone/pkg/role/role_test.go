@@ -0,0 +1,35 @@
+package role
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	golang := Target{AuthorID: "author", Community: "golang"}
+	tests := []struct {
+		name      string
+		actor     Actor
+		canDelete bool
+		canEdit   bool
+	}{
+		{"author without roles", Actor{UserID: "author"}, true, true},
+		{"stranger", Actor{UserID: "other", Roles: &Roles{}}, false, false},
+		{"moderator of the community", Actor{UserID: "mod", Roles: &Roles{Moderates: []string{"Golang"}}}, true, false},
+		{"moderator of another community", Actor{UserID: "mod", Roles: &Roles{Moderates: []string{"music"}}}, false, false},
+		{"admin", Actor{UserID: "admin", Roles: &Roles{Admin: true}}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.canDelete, CanDelete(tt.actor, golang))
+			assert.Equal(t, tt.canEdit, CanEdit(tt.actor, golang))
+		})
+	}
+}
+
+func TestIsModerator(t *testing.T) {
+	assert.False(t, (&Roles{}).IsModerator())
+	assert.True(t, (&Roles{Moderates: []string{"golang"}}).IsModerator())
+	assert.True(t, (&Roles{Admin: true}).IsModerator())
+}
@@ -3,8 +3,9 @@ package session
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-	_ "redditclone/pkg/utils"
+	"redditclone/pkg/utils"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -26,6 +27,10 @@ func NewRedisSessionManager(redisURL string) *RedisSessionManager {
 	return &RedisSessionManager{Client: client}
 }
 
+func userSessionsKey(userID string) string {
+	return "user_sessions:" + userID
+}
+
 func (rsm *RedisSessionManager) Create(w http.ResponseWriter, userID, username string) (*Session, error) {
 	sess := newSession(userID, username)
 	data, err := json.Marshal(sess)
@@ -33,10 +38,16 @@ func (rsm *RedisSessionManager) Create(w http.ResponseWriter, userID, username s
 		return nil, err
 	}
 
-	err = rsm.Client.Set(context.Background(), sess.ID, data, SessionCookieExp).Err()
+	ctx := context.Background()
+	err = rsm.Client.Set(ctx, sess.ID, data, SessionCookieExp).Err()
 	if err != nil {
 		return nil, err
 	}
+	// помним, какие сессии у юзера, чтобы выкинуть его отовсюду при бане, см. DestroyUser.
+	// Протухшие id из набора не чистим: Del по ним просто ничего не удалит
+	if err = rsm.Client.SAdd(ctx, userSessionsKey(userID), sess.ID).Err(); err != nil {
+		return nil, err
+	}
 
 	cookie := &http.Cookie{
 		Name:    SessionCookieName,
@@ -48,16 +59,35 @@ func (rsm *RedisSessionManager) Create(w http.ResponseWriter, userID, username s
 	return sess, nil
 }
 
+// sessionIDFromRequest - сначала смотрим в Bearer-токен (клиенты апи кук не хранят), а если заголовка нет,
+// то в куку. Если заголовок есть, но токен битый - на куку не откатываемся
+func sessionIDFromRequest(r *http.Request) (string, error) {
+	sessionID, err := utils.GetSessionIDFromToken(r)
+	if err == nil {
+		return sessionID, nil
+	}
+	if !errors.Is(err, utils.ErrNoToken) {
+		return "", ErrNoSession
+	}
+
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return "", ErrNoSession
+	}
+	return cookie.Value, nil
+}
+
 func (rsm *RedisSessionManager) Check(r *http.Request) (*Session, error) {
 	// ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	// defer cancel()
 	ctx := context.Background()
-	cookie, err := r.Cookie(SessionCookieName)
+	sessionID, err := sessionIDFromRequest(r)
 	if err != nil {
-		return nil, ErrNoSession
+		return nil, err
 	}
 
-	data, err := rsm.Client.Get(ctx, cookie.Value).Bytes()
+	// сессии нет - значит ее удалили (логаут) или она протухла, токен при этом может быть еще валидным
+	data, err := rsm.Client.Get(ctx, sessionID).Bytes()
 	if err != nil {
 		return nil, ErrNoSession
 	}
@@ -72,12 +102,12 @@ func (rsm *RedisSessionManager) Check(r *http.Request) (*Session, error) {
 
 func (rsm *RedisSessionManager) Destroy(w http.ResponseWriter, r *http.Request) error {
 	ctx := context.Background()
-	cookie, err := r.Cookie(SessionCookieName)
+	sessionID, err := sessionIDFromRequest(r)
 	if err != nil {
 		return err
 	}
 
-	err = rsm.Client.Del(ctx, cookie.Value).Err()
+	err = rsm.Client.Del(ctx, sessionID).Err()
 	if err != nil {
 		return err
 	}
@@ -91,22 +121,33 @@ func (rsm *RedisSessionManager) Destroy(w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
+// DestroyUser удаляет все сессии юзера, токены с ними перестают проходить Check
+func (rsm *RedisSessionManager) DestroyUser(userID string) error {
+	ctx := context.Background()
+	key := userSessionsKey(userID)
+	sessionIDs, err := rsm.Client.SMembers(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	return rsm.Client.Del(ctx, append(sessionIDs, key)...).Err()
+}
+
 func (rsm *RedisSessionManager) UpdateCookie(w http.ResponseWriter, r *http.Request) error {
 	ctx := context.Background()
-	cookie, err := r.Cookie(SessionCookieName)
+	sessionID, err := sessionIDFromRequest(r)
 
 	if err != nil {
 		return err
 	}
 
-	err = rsm.Client.Expire(ctx, cookie.Value, SessionCookieExp).Err()
+	err = rsm.Client.Expire(ctx, sessionID, SessionCookieExp).Err()
 	if err != nil {
 		return err
 	}
 
 	updatedCookie := &http.Cookie{
 		Name:    SessionCookieName,
-		Value:   cookie.Value,
+		Value:   sessionID,
 		Path:    "/",
 		Expires: time.Now().Add(SessionCookieExp),
 	}
@@ -1,6 +1,7 @@
 package session
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"redditclone/pkg/utils"
@@ -33,4 +34,22 @@ type SessionManager interface {
 	UpdateCookie(w http.ResponseWriter, r *http.Request) error
 	Create(w http.ResponseWriter, userID, username string) (*Session, error)
 	Destroy(w http.ResponseWriter, r *http.Request) error
+	// DestroyUser - выйти из всех сессий юзера разом, например при бане
+	DestroyUser(userID string) error
+}
+
+type sessionKey string
+
+var SessionKey sessionKey = "sessionKey"
+
+func SessionFromContext(ctx context.Context) (*Session, error) {
+	sess, ok := ctx.Value(SessionKey).(*Session)
+	if !ok || sess == nil {
+		return nil, ErrNoSession
+	}
+	return sess, nil
+}
+
+func ContextWithSession(ctx context.Context, sess *Session) context.Context {
+	return context.WithValue(ctx, SessionKey, sess)
 }
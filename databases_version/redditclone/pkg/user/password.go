@@ -0,0 +1,65 @@
+package user
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// В базе пароль хранится как "<алгоритм>$<версия>$<хеш>". Строки без известного префикса считаем
+// старыми паролями открытым текстом (как в initUsers.sql) - их перехешируем при первом удачном логине
+const (
+	passwordAlgBcrypt     = "bcrypt"
+	passwordVersionBcrypt = "v1"
+	passwordSep           = "$"
+)
+
+var ErrEmptyPassword = errors.New("empty password")
+
+type PasswordHasher struct {
+	cost int
+}
+
+func NewPasswordHasher(cost int) *PasswordHasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &PasswordHasher{cost: cost}
+}
+
+func (h *PasswordHasher) prefix() string {
+	return passwordAlgBcrypt + passwordSep + passwordVersionBcrypt + passwordSep
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return h.prefix() + string(hash), nil
+}
+
+// Verify сравнивает пароль с тем, что лежит в базе. needsRehash = true, если пароль верный,
+// но хранится открытым текстом или захеширован с другой стоимостью
+func (h *PasswordHasher) Verify(stored, password string) (ok bool, needsRehash bool) {
+	hash, isHashed := strings.CutPrefix(stored, h.prefix())
+	if !isHashed {
+		if strings.HasPrefix(stored, passwordAlgBcrypt+passwordSep) {
+			// неизвестная версия - лучше не пустить, чем сравнить хеш с паролем как строку
+			return false, false
+		}
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1, true
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err != nil || cost != h.cost
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"github.com/dgrijalva/jwt-go"
 	_ "github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
 	"redditclone/pkg/utils"
+	"time"
 )
 
 var (
@@ -15,11 +17,13 @@ var (
 )
 
 type UserMySQLRepo struct {
-	db *sql.DB
+	db     *sql.DB
+	hasher *PasswordHasher
+	logger *zap.SugaredLogger
 }
 
-func NewMySQLRepo(db *sql.DB) *UserMySQLRepo {
-	return &UserMySQLRepo{db: db}
+func NewMySQLRepo(db *sql.DB, hasher *PasswordHasher, logger *zap.SugaredLogger) *UserMySQLRepo {
+	return &UserMySQLRepo{db: db, hasher: hasher, logger: logger}
 }
 
 func (repo *UserMySQLRepo) Authorize(username, password string) (*User, error) {
@@ -30,13 +34,31 @@ func (repo *UserMySQLRepo) Authorize(username, password string) (*User, error) {
 	if err != nil {
 		return nil, ErrNoUser
 	}
-	// в проде так нельзя, да, но мы не в проде
-	if user.Password != password {
+	ok, needsRehash := repo.hasher.Verify(user.Password, password)
+	if !ok {
 		return nil, ErrBadPass
 	}
+	if needsRehash {
+		// старые пароли открытым текстом переезжают на хеш при первом логине.
+		// Не получилось - юзер все равно залогинен, попробуем в следующий раз, но пароль так и лежит
+		// открытым текстом, поэтому пишем в лог как ошибку
+		if err = repo.rehashPassword(user.ID, password); err != nil {
+			repo.logger.Errorf("failed to migrate password of user %s to bcrypt: %v", user.ID, err)
+		}
+	}
+	user.Password = ""
 	return &user, nil
 }
 
+func (repo *UserMySQLRepo) rehashPassword(userID, password string) error {
+	hash, err := repo.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	_, err = repo.db.Exec("UPDATE users SET password = ? WHERE id = ?", hash, userID)
+	return err
+}
+
 func (repo *UserMySQLRepo) Register(username, password string) (*User, error) {
 	// можно было бы сделать вот так, меньше кода, но вроде бы больше оверхед
 	// Думаю, лучше так, как сделал в итоге
@@ -53,13 +75,19 @@ func (repo *UserMySQLRepo) Register(username, password string) (*User, error) {
 		return nil, ErrAlreadyExists
 	}
 
+	hash, err := repo.hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
 	user := &User{
 		Username: username,
-		Password: password,
 		ID:       utils.GenerateID(),
+		// в базе created проставится сам, тут - чтобы не перечитывать
+		Created: time.Now().UTC(),
 	}
 	_, err = repo.db.Exec("INSERT INTO users (id, username, password) VALUES (?, ?, ?)",
-		user.ID, user.Username, user.Password)
+		user.ID, user.Username, hash)
 
 	if err != nil {
 		return nil, err
@@ -67,6 +95,35 @@ func (repo *UserMySQLRepo) Register(username, password string) (*User, error) {
 	return user, nil
 }
 
+func (repo *UserMySQLRepo) GetUser(userID string) (*User, error) {
+	var user User
+	err := repo.db.
+		QueryRow("SELECT id, username, created FROM users WHERE id = ?", userID).
+		Scan(&user.ID, &user.Username, &user.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoUser
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByName - для упоминаний u/name, без пароля
+func (repo *UserMySQLRepo) GetUserByName(username string) (*User, error) {
+	var user User
+	err := repo.db.
+		QueryRow("SELECT id, username, created FROM users WHERE username = ?", username).
+		Scan(&user.ID, &user.Username, &user.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoUser
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (repo *UserMySQLRepo) checkUserExists(username string) (bool, error) {
 	var exists int
 	err := repo.db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", username).Scan(&exists)
@@ -76,14 +133,17 @@ func (repo *UserMySQLRepo) checkUserExists(username string) (bool, error) {
 	return exists > 0, nil
 }
 
-func (repo *UserMySQLRepo) GenerateUserToken(u User) *jwt.Token {
-	// просто нужно для фронта
+func (repo *UserMySQLRepo) GenerateUserToken(u User, sessionID string) *jwt.Token {
+	// юзер нужен фронту, а по sid мы потом ищем сессию в редисе - содержимому токена больше не доверяем
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user": map[string]string{
+		utils.ClaimUser: map[string]string{
 			"username": u.Username,
 			"id":       u.ID,
 		},
-		// "exp": time.Now().Add(1 * time.Hour).Unix(),
+		utils.ClaimSessionID: sessionID,
+		utils.ClaimIssuedAt:  now.Unix(),
+		utils.ClaimExpiresAt: now.Add(utils.JwtTokenExp).Unix(),
 	})
 	return token
 }
@@ -2,12 +2,20 @@ package user
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"redditclone/pkg/utils"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -15,6 +23,11 @@ const (
 	password = "password123"
 )
 
+var (
+	testHasher = NewPasswordHasher(bcrypt.MinCost)
+	nilLogger  = zap.NewNop().Sugar()
+)
+
 func TestUserMySQLRepo_Authorize_Success(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -23,7 +36,7 @@ func TestUserMySQLRepo_Authorize_Success(t *testing.T) {
 
 	defer utils.CloseDB(db)
 
-	repo := NewMySQLRepo(db)
+	repo := NewMySQLRepo(db, testHasher, nilLogger)
 
 	username := testUser
 	password := password
@@ -34,6 +47,10 @@ func TestUserMySQLRepo_Authorize_Success(t *testing.T) {
 	mock.ExpectQuery("SELECT id, username, password FROM users WHERE username = ?").
 		WithArgs(username).
 		WillReturnRows(rows)
+	// пароль в базе открытым текстом - после логина должен перехешироваться
+	mock.ExpectExec("UPDATE users SET password = \\? WHERE id = \\?").
+		WithArgs(sqlmock.AnyArg(), expectedID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	user, err := repo.Authorize(username, password)
 
@@ -41,6 +58,74 @@ func TestUserMySQLRepo_Authorize_Success(t *testing.T) {
 	assert.NotNil(t, user)
 	assert.Equal(t, expectedID, user.ID)
 	assert.Equal(t, username, user.Username)
+	assert.Empty(t, user.Password)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserMySQLRepo_Authorize_RehashError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+
+	defer utils.CloseDB(db)
+
+	core, logs := observer.New(zap.ErrorLevel)
+	repo := NewMySQLRepo(db, testHasher, zap.New(core).Sugar())
+
+	rows := sqlmock.NewRows([]string{"id", "username", "password"}).
+		AddRow("user1", testUser, password)
+	mock.ExpectQuery("SELECT id, username, password FROM users WHERE username = ?").
+		WithArgs(testUser).
+		WillReturnRows(rows)
+	mock.ExpectExec("UPDATE users SET password = \\? WHERE id = \\?").
+		WithArgs(sqlmock.AnyArg(), "user1").
+		WillReturnError(errors.New("read-only replica"))
+
+	// перехешировать не вышло, но логин все равно проходит - а неудача видна в логе
+	user, err := repo.Authorize(testUser, password)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "user1", user.ID)
+	assert.Equal(t, 1, logs.Len())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserMySQLRepo_Authorize_Hashed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+
+	defer utils.CloseDB(db)
+
+	repo := NewMySQLRepo(db, testHasher, nilLogger)
+
+	hash, err := testHasher.Hash(password)
+	assert.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"id", "username", "password"}).
+		AddRow("user1", testUser, hash)
+	mock.ExpectQuery("SELECT id, username, password FROM users WHERE username = ?").
+		WithArgs(testUser).
+		WillReturnRows(rows)
+
+	user, err := repo.Authorize(testUser, password)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "user1", user.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	rows = sqlmock.NewRows([]string{"id", "username", "password"}).
+		AddRow("user1", testUser, hash)
+	mock.ExpectQuery("SELECT id, username, password FROM users WHERE username = ?").
+		WithArgs(testUser).
+		WillReturnRows(rows)
+
+	user, err = repo.Authorize(testUser, "wrong")
+
+	assert.Nil(t, user)
+	assert.ErrorIs(t, err, ErrBadPass)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -51,7 +136,7 @@ func TestUserMySQLRepo_Authorize_UserNotFound(t *testing.T) {
 	}
 	defer utils.CloseDB(db)
 
-	repo := NewMySQLRepo(db)
+	repo := NewMySQLRepo(db, testHasher, nilLogger)
 
 	username := "unknownuser"
 	password := password
@@ -76,7 +161,7 @@ func TestUserMySQLRepo_Authorize_BadPassword(t *testing.T) {
 
 	defer utils.CloseDB(db)
 
-	repo := NewMySQLRepo(db)
+	repo := NewMySQLRepo(db, testHasher, nilLogger)
 
 	username := testUser
 	correctPasswordInDB := "correct_password"
@@ -104,7 +189,7 @@ func TestUserMySQLRepo_Authorize_DBError(t *testing.T) {
 	}
 	defer utils.CloseDB(db)
 
-	repo := NewMySQLRepo(db)
+	repo := NewMySQLRepo(db, testHasher, nilLogger)
 
 	username := testUser
 	password := password
@@ -129,7 +214,7 @@ func TestUserMySQLRepo_Register_Success(t *testing.T) {
 	}
 	defer utils.CloseDB(db)
 
-	repo := NewMySQLRepo(db)
+	repo := NewMySQLRepo(db, testHasher, nilLogger)
 
 	username := "newuser"
 	password := "newpassword"
@@ -142,7 +227,7 @@ func TestUserMySQLRepo_Register_Success(t *testing.T) {
 	// \\ - нужно для регекса
 
 	mock.ExpectExec("INSERT INTO users \\(id, username, password\\) VALUES \\(\\?, \\?, \\?\\)").
-		WithArgs(sqlmock.AnyArg(), username, password).
+		WithArgs(sqlmock.AnyArg(), username, hashOf(password)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	user, err := repo.Register(username, password)
@@ -150,7 +235,7 @@ func TestUserMySQLRepo_Register_Success(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, user)
 	assert.Equal(t, username, user.Username)
-	assert.Equal(t, password, user.Password)
+	assert.Empty(t, user.Password)
 	assert.NotEmpty(t, user.ID)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -162,7 +247,7 @@ func TestUserMySQLRepo_Register_AlreadyExists(t *testing.T) {
 	}
 	defer utils.CloseDB(db)
 
-	repo := NewMySQLRepo(db)
+	repo := NewMySQLRepo(db, testHasher, nilLogger)
 
 	username := "existinguser"
 	password := "password"
@@ -187,7 +272,7 @@ func TestUserMySQLRepo_Register_CheckExistsDBError(t *testing.T) {
 	}
 	defer utils.CloseDB(db)
 
-	repo := NewMySQLRepo(db)
+	repo := NewMySQLRepo(db, testHasher, nilLogger)
 
 	username := testUser
 	password := password
@@ -212,7 +297,7 @@ func TestUserMySQLRepo_Register_InsertDBError(t *testing.T) {
 	}
 	defer utils.CloseDB(db)
 
-	repo := NewMySQLRepo(db)
+	repo := NewMySQLRepo(db, testHasher, nilLogger)
 
 	username := "newuser"
 	password := "newpassword"
@@ -224,7 +309,7 @@ func TestUserMySQLRepo_Register_InsertDBError(t *testing.T) {
 		WillReturnRows(countRows)
 
 	mock.ExpectExec("INSERT INTO users \\(id, username, password\\) VALUES \\(\\?, \\?, \\?\\)").
-		WithArgs(sqlmock.AnyArg(), username, password).
+		WithArgs(sqlmock.AnyArg(), username, sqlmock.AnyArg()).
 		WillReturnError(dbError)
 
 	user, err := repo.Register(username, password)
@@ -234,3 +319,122 @@ func TestUserMySQLRepo_Register_InsertDBError(t *testing.T) {
 	assert.EqualError(t, err, dbError.Error())
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestUserMySQLRepo_GetUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+
+	repo := NewMySQLRepo(db, testHasher, nilLogger)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT id, username, created FROM users WHERE id = \\?").
+		WithArgs("user1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created"}).AddRow("user1", testUser, created))
+	mock.ExpectQuery("SELECT id, username, created FROM users WHERE id = \\?").
+		WithArgs("ghost").
+		WillReturnError(sql.ErrNoRows)
+
+	user, err := repo.GetUser("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, testUser, user.Username)
+	assert.Equal(t, created, user.Created)
+
+	_, err = repo.GetUser("ghost")
+	assert.ErrorIs(t, err, ErrNoUser)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserMySQLRepo_GetUserByName(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer utils.CloseDB(db)
+
+	repo := NewMySQLRepo(db, testHasher, nilLogger)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT id, username, created FROM users WHERE username = \\?").
+		WithArgs(testUser).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created"}).AddRow("user1", testUser, created))
+	mock.ExpectQuery("SELECT id, username, created FROM users WHERE username = \\?").
+		WithArgs("ghost").
+		WillReturnError(sql.ErrNoRows)
+
+	user, err := repo.GetUserByName(testUser)
+	assert.NoError(t, err)
+	assert.Equal(t, "user1", user.ID)
+
+	_, err = repo.GetUserByName("ghost")
+	assert.ErrorIs(t, err, ErrNoUser)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserMySQLRepo_GenerateUserToken_SessionID(t *testing.T) {
+	repo := NewMySQLRepo(nil, testHasher, nilLogger)
+
+	token := repo.GenerateUserToken(User{ID: "user1", Username: testUser}, "sess1")
+
+	w := httptest.NewRecorder()
+	assert.NoError(t, utils.SendJwtToken(w, token))
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	sessionID, err := utils.GetSessionIDFromToken(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "sess1", sessionID)
+
+	req.Header.Set("Authorization", "Bearer "+resp.Token+"broken")
+	_, err = utils.GetSessionIDFromToken(req)
+	assert.ErrorIs(t, err, utils.ErrBadJwt)
+
+	_, err = utils.GetSessionIDFromToken(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.ErrorIs(t, err, utils.ErrNoToken)
+}
+
+// hashOf - матчер для sqlmock: в базу должен уйти хеш именно этого пароля, а не сам пароль
+type hashOf string
+
+func (h hashOf) Match(v driver.Value) bool {
+	stored, ok := v.(string)
+	if !ok || stored == string(h) {
+		return false
+	}
+	valid, needsRehash := testHasher.Verify(stored, string(h))
+	return valid && !needsRehash
+}
+
+func TestPasswordHasher_Verify(t *testing.T) {
+	hash, err := testHasher.Hash(password)
+	assert.NoError(t, err)
+	assert.NotContains(t, hash, password)
+
+	ok, needsRehash := testHasher.Verify(hash, password)
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+
+	ok, _ = testHasher.Verify(hash, "wrong")
+	assert.False(t, ok)
+
+	ok, needsRehash = NewPasswordHasher(bcrypt.MinCost+1).Verify(hash, password)
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+
+	ok, needsRehash = testHasher.Verify("plaintext", "plaintext")
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+
+	ok, _ = testHasher.Verify("bcrypt$v9$whatever", "bcrypt$v9$whatever")
+	assert.False(t, ok)
+
+	_, err = testHasher.Hash("")
+	assert.ErrorIs(t, err, ErrEmptyPassword)
+}
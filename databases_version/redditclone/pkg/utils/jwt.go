@@ -5,14 +5,28 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
 var jwtSecret = []byte("super_secret_key")
 
+const (
+	ClaimUser      = "user"
+	ClaimSessionID = "sid"
+	ClaimIssuedAt  = "iat"
+	ClaimExpiresAt = "exp"
+
+	// токен живет дольше сессии: сессия в редисе продлевается при каждом действии,
+	// а сам токен фронт перевыпускать не умеет
+	JwtTokenExp = 24 * time.Hour
+)
+
 var (
-	ErrNoKey = errors.New("key not found")
+	ErrNoKey   = errors.New("key not found")
+	ErrNoToken = errors.New("no token provided")
+	ErrBadJwt  = errors.New("bad token")
 )
 
 func SendJwtToken(w http.ResponseWriter, token *jwt.Token) error {
@@ -45,7 +59,7 @@ func checkToken(w http.ResponseWriter, r *http.Request) (map[string]interface{},
 func getTokenFromHeader(r *http.Request) (string, error) {
 	tokenString := r.Header.Get("Authorization")
 	if tokenString == "" {
-		return "", fmt.Errorf("no token provided")
+		return "", ErrNoToken
 	}
 	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 	return tokenString, nil
@@ -82,3 +96,21 @@ func GetClaimsByKey(w http.ResponseWriter, r *http.Request, key string) (map[str
 	}
 	return claims, nil
 }
+
+// GetSessionIDFromToken достает из Bearer-токена айди сессии. Сам токен тут только проверяется на подпись и срок,
+// жива ли сессия - решает менеджер сессий
+func GetSessionIDFromToken(r *http.Request) (string, error) {
+	tokenString, err := getTokenFromHeader(r)
+	if err != nil {
+		return "", err
+	}
+	_, claims, err := parseToken(tokenString)
+	if err != nil {
+		return "", ErrBadJwt
+	}
+	sessionID, ok := claims[ClaimSessionID].(string)
+	if !ok || sessionID == "" {
+		return "", ErrNoKey
+	}
+	return sessionID, nil
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/session"
+	"redditclone/pkg/utils"
+)
+
+// Auth пускает дальше только с живой сессией: находит ее один раз, продлевает и кладет в контекст
+func Auth(sm session.SessionManager, logger *zap.SugaredLogger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := sm.Check(r)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+			return
+		}
+
+		if err = sm.UpdateCookie(w, r); err != nil {
+			logger.Errorf("failed to update cookie: %v", err)
+			// Ну не обновили и не обновили. Не выкидывать же юзера и не прерывать же его действие
+		}
+
+		next.ServeHTTP(w, r.WithContext(session.ContextWithSession(r.Context(), sess)))
+	})
+}
+
+// OptionalAuth - то же самое, но аноним тоже проходит, просто без сессии в контексте
+func OptionalAuth(sm session.SessionManager, logger *zap.SugaredLogger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := sm.Check(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err = sm.UpdateCookie(w, r); err != nil {
+			logger.Errorf("failed to update cookie: %v", err)
+		}
+
+		next.ServeHTTP(w, r.WithContext(session.ContextWithSession(r.Context(), sess)))
+	})
+}
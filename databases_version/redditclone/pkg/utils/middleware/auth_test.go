@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/session"
+	"redditclone/pkg/utils/mocks"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"go.uber.org/zap/zaptest"
+)
+
+func sessionEcho(t *testing.T, want *session.Session) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, err := session.SessionFromContext(r.Context())
+		if want == nil {
+			if err == nil {
+				t.Errorf("expected no session in context, got %+v", got)
+			}
+		} else if err != nil || got.UserID != want.UserID {
+			t.Errorf("expected session %+v, got %+v (%v)", want, got, err)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestAuth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSess := mocks.NewMockSessionManager(ctrl)
+	logger := zaptest.NewLogger(t).Sugar()
+
+	sess := &session.Session{ID: "sid", UserID: "uid", Username: "user"}
+	mockSess.EXPECT().Check(gomock.Any()).Return(sess, nil)
+	mockSess.EXPECT().UpdateCookie(gomock.Any(), gomock.Any()).Return(errors.New("no cookie"))
+
+	w := httptest.NewRecorder()
+	Auth(mockSess, logger, sessionEcho(t, sess)).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/posts", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+
+	mockSess.EXPECT().Check(gomock.Any()).Return((*session.Session)(nil), session.ErrNoSession)
+
+	w = httptest.NewRecorder()
+	Auth(mockSess, logger, sessionEcho(t, sess)).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/posts", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
+
+func TestOptionalAuth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSess := mocks.NewMockSessionManager(ctrl)
+	logger := zaptest.NewLogger(t).Sugar()
+
+	sess := &session.Session{ID: "sid", UserID: "uid", Username: "user"}
+	mockSess.EXPECT().Check(gomock.Any()).Return(sess, nil)
+	mockSess.EXPECT().UpdateCookie(gomock.Any(), gomock.Any()).Return(nil)
+
+	w := httptest.NewRecorder()
+	OptionalAuth(mockSess, logger, sessionEcho(t, sess)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/posts", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+
+	mockSess.EXPECT().Check(gomock.Any()).Return((*session.Session)(nil), session.ErrNoSession)
+
+	w = httptest.NewRecorder()
+	OptionalAuth(mockSess, logger, sessionEcho(t, nil)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/posts", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 for anonymous, got %d", w.Code)
+	}
+}
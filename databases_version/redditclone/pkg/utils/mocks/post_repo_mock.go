@@ -6,6 +6,8 @@ package mocks
 
 import (
 	post "redditclone/pkg/post"
+	preview "redditclone/pkg/preview"
+	role "redditclone/pkg/role"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -49,6 +51,35 @@ func (mr *MockPostRepoMockRecorder) AddComment(arg0, arg1, arg2, arg3 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddComment", reflect.TypeOf((*MockPostRepo)(nil).AddComment), arg0, arg1, arg2, arg3)
 }
 
+// AddReply mocks base method.
+func (m *MockPostRepo) AddReply(arg0, arg1, arg2, arg3, arg4 string) (*post.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddReply", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*post.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddReply indicates an expected call of AddReply.
+func (mr *MockPostRepoMockRecorder) AddReply(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddReply", reflect.TypeOf((*MockPostRepo)(nil).AddReply), arg0, arg1, arg2, arg3, arg4)
+}
+
+// AddViews mocks base method.
+func (m *MockPostRepo) AddViews(arg0 map[string]int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddViews", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddViews indicates an expected call of AddViews.
+func (mr *MockPostRepoMockRecorder) AddViews(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddViews", reflect.TypeOf((*MockPostRepo)(nil).AddViews), arg0)
+}
+
 // CreatePost mocks base method.
 func (m *MockPostRepo) CreatePost(arg0 post.NewPostRequest, arg1, arg2 string) *post.Post {
 	m.ctrl.T.Helper()
@@ -64,7 +95,7 @@ func (mr *MockPostRepoMockRecorder) CreatePost(arg0, arg1, arg2 interface{}) *go
 }
 
 // DeleteComment mocks base method.
-func (m *MockPostRepo) DeleteComment(arg0, arg1, arg2 string) (*post.Post, error) {
+func (m *MockPostRepo) DeleteComment(arg0, arg1 string, arg2 role.Actor) (*post.Post, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "DeleteComment", arg0, arg1, arg2)
 	ret0, _ := ret[0].(*post.Post)
@@ -79,7 +110,7 @@ func (mr *MockPostRepoMockRecorder) DeleteComment(arg0, arg1, arg2 interface{})
 }
 
 // DeletePost mocks base method.
-func (m *MockPostRepo) DeletePost(arg0, arg1 string) (bool, error) {
+func (m *MockPostRepo) DeletePost(arg0 string, arg1 role.Actor) (bool, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "DeletePost", arg0, arg1)
 	ret0, _ := ret[0].(bool)
@@ -93,6 +124,51 @@ func (mr *MockPostRepoMockRecorder) DeletePost(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePost", reflect.TypeOf((*MockPostRepo)(nil).DeletePost), arg0, arg1)
 }
 
+// EditComment mocks base method.
+func (m *MockPostRepo) EditComment(arg0, arg1 string, arg2 role.Actor, arg3 string) (*post.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EditComment", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(*post.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EditComment indicates an expected call of EditComment.
+func (mr *MockPostRepoMockRecorder) EditComment(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditComment", reflect.TypeOf((*MockPostRepo)(nil).EditComment), arg0, arg1, arg2, arg3)
+}
+
+// EditPost mocks base method.
+func (m *MockPostRepo) EditPost(arg0 string, arg1 role.Actor, arg2 post.EditPostRequest) (*post.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EditPost", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*post.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EditPost indicates an expected call of EditPost.
+func (mr *MockPostRepoMockRecorder) EditPost(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditPost", reflect.TypeOf((*MockPostRepo)(nil).EditPost), arg0, arg1, arg2)
+}
+
+// GetCommentTree mocks base method.
+func (m *MockPostRepo) GetCommentTree(arg0, arg1 string, arg2 int) ([]post.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommentTree", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]post.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommentTree indicates an expected call of GetCommentTree.
+func (mr *MockPostRepoMockRecorder) GetCommentTree(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentTree", reflect.TypeOf((*MockPostRepo)(nil).GetCommentTree), arg0, arg1, arg2)
+}
+
 // GetPost mocks base method.
 func (m *MockPostRepo) GetPost(arg0 string) (post.Post, error) {
 	m.ctrl.T.Helper()
@@ -136,6 +212,81 @@ func (mr *MockPostRepoMockRecorder) GetPostsByCategory(arg0 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsByCategory", reflect.TypeOf((*MockPostRepo)(nil).GetPostsByCategory), arg0)
 }
 
+// GetRevisions mocks base method.
+func (m *MockPostRepo) GetRevisions(arg0, arg1 string) ([]post.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevisions", arg0, arg1)
+	ret0, _ := ret[0].([]post.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRevisions indicates an expected call of GetRevisions.
+func (mr *MockPostRepoMockRecorder) GetRevisions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevisions", reflect.TypeOf((*MockPostRepo)(nil).GetRevisions), arg0, arg1)
+}
+
+// Karma mocks base method.
+func (m *MockPostRepo) Karma(arg0 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Karma", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Karma indicates an expected call of Karma.
+func (mr *MockPostRepoMockRecorder) Karma(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Karma", reflect.TypeOf((*MockPostRepo)(nil).Karma), arg0)
+}
+
+// ListPosts mocks base method.
+func (m *MockPostRepo) ListPosts(arg0 post.ListQuery) (*post.PostsPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPosts", arg0)
+	ret0, _ := ret[0].(*post.PostsPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPosts indicates an expected call of ListPosts.
+func (mr *MockPostRepoMockRecorder) ListPosts(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPosts", reflect.TypeOf((*MockPostRepo)(nil).ListPosts), arg0)
+}
+
+// PollChoices mocks base method.
+func (m *MockPostRepo) PollChoices(arg0 string, arg1 []string) (map[string][]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PollChoices", arg0, arg1)
+	ret0, _ := ret[0].(map[string][]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PollChoices indicates an expected call of PollChoices.
+func (mr *MockPostRepoMockRecorder) PollChoices(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PollChoices", reflect.TypeOf((*MockPostRepo)(nil).PollChoices), arg0, arg1)
+}
+
+// PostsByLink mocks base method.
+func (m *MockPostRepo) PostsByLink(arg0, arg1 string) ([]post.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PostsByLink", arg0, arg1)
+	ret0, _ := ret[0].([]post.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PostsByLink indicates an expected call of PostsByLink.
+func (mr *MockPostRepoMockRecorder) PostsByLink(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PostsByLink", reflect.TypeOf((*MockPostRepo)(nil).PostsByLink), arg0, arg1)
+}
+
 // PostsByUser mocks base method.
 func (m *MockPostRepo) PostsByUser(arg0 string) []post.Post {
 	m.ctrl.T.Helper()
@@ -150,8 +301,111 @@ func (mr *MockPostRepoMockRecorder) PostsByUser(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PostsByUser", reflect.TypeOf((*MockPostRepo)(nil).PostsByUser), arg0)
 }
 
+// RemoveComment mocks base method.
+func (m *MockPostRepo) RemoveComment(arg0, arg1 string, arg2 post.Removal) (*post.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveComment", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*post.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveComment indicates an expected call of RemoveComment.
+func (mr *MockPostRepoMockRecorder) RemoveComment(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveComment", reflect.TypeOf((*MockPostRepo)(nil).RemoveComment), arg0, arg1, arg2)
+}
+
+// RemovePost mocks base method.
+func (m *MockPostRepo) RemovePost(arg0 string, arg1 post.Removal) (*post.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemovePost", arg0, arg1)
+	ret0, _ := ret[0].(*post.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemovePost indicates an expected call of RemovePost.
+func (mr *MockPostRepoMockRecorder) RemovePost(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemovePost", reflect.TypeOf((*MockPostRepo)(nil).RemovePost), arg0, arg1)
+}
+
+// Search mocks base method.
+func (m *MockPostRepo) Search(arg0 post.SearchQuery) ([]post.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", arg0)
+	ret0, _ := ret[0].([]post.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockPostRepoMockRecorder) Search(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockPostRepo)(nil).Search), arg0)
+}
+
+// SetHidden mocks base method.
+func (m *MockPostRepo) SetHidden(arg0 string, arg1 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetHidden", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetHidden indicates an expected call of SetHidden.
+func (mr *MockPostRepoMockRecorder) SetHidden(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetHidden", reflect.TypeOf((*MockPostRepo)(nil).SetHidden), arg0, arg1)
+}
+
+// SetPreview mocks base method.
+func (m *MockPostRepo) SetPreview(arg0 string, arg1 preview.Preview) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPreview", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPreview indicates an expected call of SetPreview.
+func (mr *MockPostRepoMockRecorder) SetPreview(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPreview", reflect.TypeOf((*MockPostRepo)(nil).SetPreview), arg0, arg1)
+}
+
+// VoteComment mocks base method.
+func (m *MockPostRepo) VoteComment(arg0, arg1 string, arg2, arg3 int) (*post.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VoteComment", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(*post.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VoteComment indicates an expected call of VoteComment.
+func (mr *MockPostRepoMockRecorder) VoteComment(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VoteComment", reflect.TypeOf((*MockPostRepo)(nil).VoteComment), arg0, arg1, arg2, arg3)
+}
+
+// VotePoll mocks base method.
+func (m *MockPostRepo) VotePoll(arg0, arg1 string, arg2 []int) (*post.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VotePoll", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*post.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VotePoll indicates an expected call of VotePoll.
+func (mr *MockPostRepoMockRecorder) VotePoll(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VotePoll", reflect.TypeOf((*MockPostRepo)(nil).VotePoll), arg0, arg1, arg2)
+}
+
 // VotePost mocks base method.
-func (m *MockPostRepo) VotePost(arg0, arg1 string, arg2 int) (*post.Post, error) {
+func (m *MockPostRepo) VotePost(arg0 string, arg1, arg2 int) (*post.Post, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "VotePost", arg0, arg1, arg2)
 	ret0, _ := ret[0].(*post.Post)
@@ -79,6 +79,20 @@ func (mr *MockSessionManagerMockRecorder) Destroy(arg0, arg1 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Destroy", reflect.TypeOf((*MockSessionManager)(nil).Destroy), arg0, arg1)
 }
 
+// DestroyUser mocks base method.
+func (m *MockSessionManager) DestroyUser(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DestroyUser", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DestroyUser indicates an expected call of DestroyUser.
+func (mr *MockSessionManagerMockRecorder) DestroyUser(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DestroyUser", reflect.TypeOf((*MockSessionManager)(nil).DestroyUser), arg0)
+}
+
 // UpdateCookie mocks base method.
 func (m *MockSessionManager) UpdateCookie(arg0 http.ResponseWriter, arg1 *http.Request) error {
 	m.ctrl.T.Helper()
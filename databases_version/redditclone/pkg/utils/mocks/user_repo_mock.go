@@ -51,17 +51,47 @@ func (mr *MockUserRepoMockRecorder) Authorize(arg0, arg1 interface{}) *gomock.Ca
 }
 
 // GenerateUserToken mocks base method.
-func (m *MockUserRepo) GenerateUserToken(arg0 user.User) *jwt.Token {
+func (m *MockUserRepo) GenerateUserToken(arg0 user.User, arg1 string) *jwt.Token {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GenerateUserToken", arg0)
+	ret := m.ctrl.Call(m, "GenerateUserToken", arg0, arg1)
 	ret0, _ := ret[0].(*jwt.Token)
 	return ret0
 }
 
 // GenerateUserToken indicates an expected call of GenerateUserToken.
-func (mr *MockUserRepoMockRecorder) GenerateUserToken(arg0 interface{}) *gomock.Call {
+func (mr *MockUserRepoMockRecorder) GenerateUserToken(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateUserToken", reflect.TypeOf((*MockUserRepo)(nil).GenerateUserToken), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateUserToken", reflect.TypeOf((*MockUserRepo)(nil).GenerateUserToken), arg0, arg1)
+}
+
+// GetUser mocks base method.
+func (m *MockUserRepo) GetUser(arg0 string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", arg0)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockUserRepoMockRecorder) GetUser(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockUserRepo)(nil).GetUser), arg0)
+}
+
+// GetUserByName mocks base method.
+func (m *MockUserRepo) GetUserByName(arg0 string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByName", arg0)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByName indicates an expected call of GetUserByName.
+func (mr *MockUserRepoMockRecorder) GetUserByName(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByName", reflect.TypeOf((*MockUserRepo)(nil).GetUserByName), arg0)
 }
 
 // Register mocks base method.
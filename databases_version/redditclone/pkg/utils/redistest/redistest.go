@@ -0,0 +1,348 @@
+// Package redistest - редис в памяти для тестов. Команды перехватываются хуком клиента и до сети не доходят,
+// поддержаны только те, что нужны views и feed
+package redistest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Server struct {
+	mu      sync.Mutex
+	now     time.Time
+	strings map[string]string
+	sets    map[string]map[string]struct{}
+	zsets   map[string]map[string]float64
+	expires map[string]time.Time
+}
+
+// NewClient возвращает клиента, который работает с Server вместо настоящего редиса
+func NewClient() (*redis.Client, *Server) {
+	s := &Server{
+		now:     time.Now(),
+		strings: map[string]string{},
+		sets:    map[string]map[string]struct{}{},
+		zsets:   map[string]map[string]float64{},
+		expires: map[string]time.Time{},
+	}
+	client := redis.NewClient(&redis.Options{Addr: "redistest:6379"})
+	client.AddHook(s)
+	return client, s
+}
+
+// FastForward двигает часы сервера, чтобы протухли ключи с TTL
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(key)
+	v, ok := s.strings[key]
+	return v, ok
+}
+
+func (s *Server) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strings[key] = value
+}
+
+func (s *Server) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if at, ok := s.expires[key]; ok {
+		return at.Sub(s.now)
+	}
+	return 0
+}
+
+func (s *Server) Members(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedKeys(s.sets[key])
+}
+
+// ZMembers - члены zset по возрастанию score
+func (s *Server) ZMembers(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.zrange(key)
+}
+
+func (s *Server) Exists(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exists(key)
+}
+
+func (s *Server) DialHook(next redis.DialHook) redis.DialHook {
+	return func(context.Context, string, string) (net.Conn, error) {
+		return nil, fmt.Errorf("redistest: no network")
+	}
+}
+
+func (s *Server) ProcessHook(redis.ProcessHook) redis.ProcessHook {
+	return func(_ context.Context, cmd redis.Cmder) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.process(cmd)
+		return cmd.Err()
+	}
+}
+
+// ProcessPipelineHook - и для обычных пайплайнов, и для MULTI/EXEC: сервер однопоточный, так что транзакция - просто пачка
+func (s *Server) ProcessPipelineHook(redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(_ context.Context, cmds []redis.Cmder) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var first error
+		for _, cmd := range cmds {
+			s.process(cmd)
+			if err := cmd.Err(); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+}
+
+func (s *Server) process(cmd redis.Cmder) {
+	args := make([]string, len(cmd.Args()))
+	for i, arg := range cmd.Args() {
+		args[i] = fmt.Sprint(arg)
+	}
+	for _, key := range args[1:] {
+		s.expire(key)
+	}
+
+	switch cmd.Name() {
+	case "multi":
+		cmd.(*redis.StatusCmd).SetVal("OK")
+	case "exec":
+	case "get":
+		v, ok := s.strings[args[1]]
+		if !ok {
+			cmd.SetErr(redis.Nil)
+			return
+		}
+		cmd.(*redis.StringCmd).SetVal(v)
+	case "getdel":
+		v, ok := s.strings[args[1]]
+		if !ok {
+			cmd.SetErr(redis.Nil)
+			return
+		}
+		s.del(args[1])
+		cmd.(*redis.StringCmd).SetVal(v)
+	case "set":
+		s.set(cmd.(*redis.BoolCmd), args)
+	case "incr", "incrby":
+		by := int64(1)
+		if len(args) > 2 {
+			by, _ = strconv.ParseInt(args[2], 10, 64)
+		}
+		n, _ := strconv.ParseInt(s.strings[args[1]], 10, 64)
+		n += by
+		s.strings[args[1]] = strconv.FormatInt(n, 10)
+		cmd.(*redis.IntCmd).SetVal(n)
+	case "del":
+		var n int64
+		for _, key := range args[1:] {
+			if s.exists(key) {
+				n++
+			}
+			s.del(key)
+		}
+		cmd.(*redis.IntCmd).SetVal(n)
+	case "exists":
+		var n int64
+		for _, key := range args[1:] {
+			if s.exists(key) {
+				n++
+			}
+		}
+		cmd.(*redis.IntCmd).SetVal(n)
+	case "sadd":
+		set := s.sets[args[1]]
+		if set == nil {
+			set = map[string]struct{}{}
+			s.sets[args[1]] = set
+		}
+		var n int64
+		for _, m := range args[2:] {
+			if _, ok := set[m]; !ok {
+				set[m] = struct{}{}
+				n++
+			}
+		}
+		cmd.(*redis.IntCmd).SetVal(n)
+	case "srem":
+		var n int64
+		for _, m := range args[2:] {
+			if _, ok := s.sets[args[1]][m]; ok {
+				delete(s.sets[args[1]], m)
+				n++
+			}
+		}
+		s.dropEmpty(args[1])
+		cmd.(*redis.IntCmd).SetVal(n)
+	case "smembers":
+		cmd.(*redis.StringSliceCmd).SetVal(sortedKeys(s.sets[args[1]]))
+	case "sunion":
+		union := map[string]struct{}{}
+		for _, key := range args[1:] {
+			for m := range s.sets[key] {
+				union[m] = struct{}{}
+			}
+		}
+		cmd.(*redis.StringSliceCmd).SetVal(sortedKeys(union))
+	case "spop":
+		count, _ := strconv.Atoi(args[2])
+		members := sortedKeys(s.sets[args[1]])
+		if len(members) > count {
+			members = members[:count]
+		}
+		for _, m := range members {
+			delete(s.sets[args[1]], m)
+		}
+		s.dropEmpty(args[1])
+		cmd.(*redis.StringSliceCmd).SetVal(members)
+	case "zadd":
+		zset := s.zsets[args[1]]
+		if zset == nil {
+			zset = map[string]float64{}
+			s.zsets[args[1]] = zset
+		}
+		var n int64
+		for i := 2; i+1 < len(args); i += 2 {
+			score, _ := strconv.ParseFloat(args[i], 64)
+			if _, ok := zset[args[i+1]]; !ok {
+				n++
+			}
+			zset[args[i+1]] = score
+		}
+		cmd.(*redis.IntCmd).SetVal(n)
+	case "zrevrange":
+		members := s.zrange(args[1])
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+		start, stop := bounds(args[2], args[3], len(members))
+		cmd.(*redis.StringSliceCmd).SetVal(members[start:stop])
+	case "zremrangebyrank":
+		members := s.zrange(args[1])
+		start, stop := bounds(args[2], args[3], len(members))
+		for _, m := range members[start:stop] {
+			delete(s.zsets[args[1]], m)
+		}
+		s.dropEmpty(args[1])
+		cmd.(*redis.IntCmd).SetVal(int64(stop - start))
+	default:
+		cmd.SetErr(fmt.Errorf("redistest: unsupported command %q", cmd.Name()))
+	}
+}
+
+// set - только SET key value [EX s | PX ms] [NX], как его шлет SetNX
+func (s *Server) set(cmd *redis.BoolCmd, args []string) {
+	var ttl time.Duration
+	nx := false
+	for i := 3; i < len(args); i++ {
+		switch args[i] {
+		case "ex", "px":
+			n, _ := strconv.ParseInt(args[i+1], 10, 64)
+			ttl = time.Duration(n) * time.Second
+			if args[i] == "px" {
+				ttl = time.Duration(n) * time.Millisecond
+			}
+			i++
+		case "nx":
+			nx = true
+		}
+	}
+	if nx && s.exists(args[1]) {
+		cmd.SetVal(false)
+		return
+	}
+	s.del(args[1])
+	s.strings[args[1]] = args[2]
+	if ttl > 0 {
+		s.expires[args[1]] = s.now.Add(ttl)
+	}
+	cmd.SetVal(true)
+}
+
+func (s *Server) exists(key string) bool {
+	_, str := s.strings[key]
+	_, set := s.sets[key]
+	_, zset := s.zsets[key]
+	return str || set || zset
+}
+
+func (s *Server) del(key string) {
+	delete(s.strings, key)
+	delete(s.sets, key)
+	delete(s.zsets, key)
+	delete(s.expires, key)
+}
+
+func (s *Server) expire(key string) {
+	if at, ok := s.expires[key]; ok && !s.now.Before(at) {
+		s.del(key)
+	}
+}
+
+func (s *Server) dropEmpty(key string) {
+	if set, ok := s.sets[key]; ok && len(set) == 0 {
+		delete(s.sets, key)
+	}
+	if zset, ok := s.zsets[key]; ok && len(zset) == 0 {
+		delete(s.zsets, key)
+	}
+}
+
+func (s *Server) zrange(key string) []string {
+	zset := s.zsets[key]
+	members := sortedKeys(zset)
+	sort.SliceStable(members, func(i, j int) bool {
+		return zset[members[i]] < zset[members[j]]
+	})
+	return members
+}
+
+// bounds переводит редисовые start/stop с отрицательными индексами в полуинтервал для слайса длины n
+func bounds(startArg, stopArg string, n int) (int, int) {
+	start, _ := strconv.Atoi(startArg)
+	stop, _ := strconv.Atoi(stopArg)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	start = max(start, 0)
+	stop = min(stop+1, n)
+	if start >= stop {
+		return 0, 0
+	}
+	return start, stop
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,114 @@
+package views
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	seenKeyPrefix    = "views:seen:"
+	pendingKeyPrefix = "views:pending:"
+	// посты, у которых есть несброшенные просмотры
+	dirtyKey = "views:dirty"
+
+	flushBatch = 100
+)
+
+type RedisCounter struct {
+	client *redis.Client
+	window time.Duration
+}
+
+func NewRedisCounter(client *redis.Client, window time.Duration) *RedisCounter {
+	return &RedisCounter{
+		client: client,
+		window: window,
+	}
+}
+
+func (c *RedisCounter) Record(postID, viewer string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// отметка о просмотре сама протухнет через окно, SET NX - чтобы два параллельных открытия не засчитались дважды
+	fresh, err := c.client.SetNX(ctx, seenKeyPrefix+postID+":"+viewer, 1, c.window).Result()
+	if err != nil {
+		return 0, err
+	}
+	if !fresh {
+		pending, err := c.client.Get(ctx, pendingKeyPrefix+postID).Int()
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return pending, err
+	}
+
+	var incr *redis.IntCmd
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, pendingKeyPrefix+postID)
+		pipe.SAdd(ctx, dirtyKey, postID)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// Flush забирает посты из dirty пачками. Счетчик читается через GETDEL, так что просмотры,
+// пришедшие между SPOP и GETDEL, уйдут в этот же сброс, а пришедшие после - снова пометят пост в dirty
+func (c *RedisCounter) Flush(sink Sink) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for {
+		postIDs, err := c.client.SPopN(ctx, dirtyKey, flushBatch).Result()
+		if err != nil {
+			return err
+		}
+		if len(postIDs) == 0 {
+			return nil
+		}
+
+		counts := make([]*redis.StringCmd, len(postIDs))
+		_, err = c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, postID := range postIDs {
+				counts[i] = pipe.GetDel(ctx, pendingKeyPrefix+postID)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, redis.Nil) {
+			// что успели забрать - потеряем, но пост хотя бы вернем в очередь
+			c.client.SAdd(ctx, dirtyKey, postIDs)
+			return err
+		}
+
+		batch := make(map[string]int, len(postIDs))
+		for i, postID := range postIDs {
+			if n, err := counts[i].Int(); err == nil && n > 0 {
+				batch[postID] = n
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		if err := sink.AddViews(batch); err != nil {
+			c.restore(ctx, batch)
+			return err
+		}
+	}
+}
+
+// restore возвращает несброшенные просмотры обратно, чтобы они ушли в следующий раз
+func (c *RedisCounter) restore(ctx context.Context, batch map[string]int) {
+	_, _ = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for postID, n := range batch {
+			pipe.IncrBy(ctx, pendingKeyPrefix+postID, int64(n))
+			pipe.SAdd(ctx, dirtyKey, postID)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,146 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"redditclone/pkg/utils/redistest"
+)
+
+type fakeSink struct {
+	added []map[string]int
+	err   error
+}
+
+func (s *fakeSink) AddViews(views map[string]int) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.added = append(s.added, views)
+	return nil
+}
+
+func TestRecord(t *testing.T) {
+	client, server := redistest.NewClient()
+	counter := NewRedisCounter(client, DedupWindow)
+
+	for _, viewer := range []string{"user:u1", "user:u1", "ip:192.0.2.1"} {
+		if _, err := counter.Record("p1", viewer); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	pending, err := counter.Record("p1", "user:u1")
+	if err != nil || pending != 2 {
+		t.Errorf("expected repeated view within window not to count, got %d pending (%v)", pending, err)
+	}
+	if ttl := server.TTL(seenKeyPrefix + "p1:user:u1"); ttl != DedupWindow {
+		t.Errorf("expected seen mark to expire after the window, ttl %v", ttl)
+	}
+
+	server.FastForward(DedupWindow)
+	pending, err = counter.Record("p1", "user:u1")
+	if err != nil || pending != 3 {
+		t.Errorf("expected view after the window to count, got %d pending (%v)", pending, err)
+	}
+	if dirty := server.Members(dirtyKey); len(dirty) != 1 || dirty[0] != "p1" {
+		t.Errorf("expected post to be marked dirty, got %v", dirty)
+	}
+
+	pending, err = counter.Record("p2", "user:u1")
+	if err != nil || pending != 1 {
+		t.Errorf("expected viewers to be tracked per post, got %d pending (%v)", pending, err)
+	}
+}
+
+func TestRecord_SeenWithoutPending(t *testing.T) {
+	client, _ := redistest.NewClient()
+	counter := NewRedisCounter(client, DedupWindow)
+	if _, err := counter.Record("p1", "user:u1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := counter.Flush(&fakeSink{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pending, err := counter.Record("p1", "user:u1")
+	if err != nil || pending != 0 {
+		t.Errorf("expected nothing pending after flush, got %d (%v)", pending, err)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	client, server := redistest.NewClient()
+	counter := NewRedisCounter(client, DedupWindow)
+	for _, view := range [][2]string{{"p1", "a"}, {"p1", "b"}, {"p2", "a"}} {
+		if _, err := counter.Record(view[0], view[1]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// пост в dirty, а счетчик уже кто-то забрал - в сброс он попасть не должен
+	client.SAdd(t.Context(), dirtyKey, "p3")
+
+	sink := &fakeSink{}
+	if err := counter.Flush(sink); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sink.added) != 1 || len(sink.added[0]) != 2 || sink.added[0]["p1"] != 2 || sink.added[0]["p2"] != 1 {
+		t.Errorf("unexpected flushed views: %v", sink.added)
+	}
+	if server.Exists(dirtyKey) || server.Exists(pendingKeyPrefix+"p1") {
+		t.Errorf("expected dirty set and pending counters to be taken")
+	}
+
+	if err := counter.Flush(sink); err != nil || len(sink.added) != 1 {
+		t.Errorf("expected second flush to be empty, got %v (%v)", sink.added, err)
+	}
+}
+
+func TestFlush_Batches(t *testing.T) {
+	client, _ := redistest.NewClient()
+	counter := NewRedisCounter(client, DedupWindow)
+	for i := 0; i < flushBatch+1; i++ {
+		if _, err := counter.Record(fmt.Sprintf("p%d", i), "viewer"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	sink := &fakeSink{}
+	if err := counter.Flush(sink); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sink.added) != 2 || len(sink.added[0])+len(sink.added[1]) != flushBatch+1 {
+		t.Errorf("expected two batches of %d posts in total, got %d", flushBatch+1, len(sink.added))
+	}
+}
+
+func TestFlush_RestoreOnSinkError(t *testing.T) {
+	client, server := redistest.NewClient()
+	counter := NewRedisCounter(client, DedupWindow)
+	if _, err := counter.Record("p1", "a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := counter.Record("p1", "b"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sinkErr := errors.New("mongo is down")
+	if err := counter.Flush(&fakeSink{err: sinkErr}); !errors.Is(err, sinkErr) {
+		t.Fatalf("expected sink error, got %v", err)
+	}
+	if pending, _ := server.Get(pendingKeyPrefix + "p1"); pending != "2" {
+		t.Errorf("expected views to be put back, got %q pending", pending)
+	}
+
+	// просмотр, пришедший между неудачным и следующим сбросом, складывается с возвращенными
+	if _, err := counter.Record("p1", "c"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sink := &fakeSink{}
+	if err := counter.Flush(sink); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sink.added) != 1 || sink.added[0]["p1"] != 3 {
+		t.Errorf("expected restored views in the next flush, got %v", sink.added)
+	}
+}
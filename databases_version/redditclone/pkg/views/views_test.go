@@ -0,0 +1,32 @@
+package views
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"redditclone/pkg/utils/redistest"
+
+	"go.uber.org/zap"
+)
+
+func TestRun_FlushesOnStop(t *testing.T) {
+	client, _ := redistest.NewClient()
+	counter := NewRedisCounter(client, DedupWindow)
+	if _, err := counter.Record("p1", "a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sink := &fakeSink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, counter, sink, time.Hour, zap.NewNop().Sugar())
+		close(done)
+	}()
+	cancel()
+	<-done
+	if len(sink.added) != 1 || sink.added[0]["p1"] != 1 {
+		t.Errorf("expected final flush on stop, got %v", sink.added)
+	}
+}
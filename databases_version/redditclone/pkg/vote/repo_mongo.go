@@ -0,0 +1,239 @@
+package vote
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"time"
+
+	"redditclone/pkg/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	postIDKey    = "post_id"
+	commentIDKey = "comment_id"
+	userIDKey    = "user_id"
+	voteKey      = "vote"
+
+	// до голосов за комменты уникальным был (пост, юзер) - теперь он мешает голосовать за комменты того же поста
+	legacyUniqueIndex        = "post_id_1_user_id_1"
+	errCodeIndexNotFound     = 27
+	errCodeNamespaceNotFound = 26
+
+	// два первых голоса одного юзера за пост могут одновременно попытаться вставить документ -
+	// второй упрется в уникальный индекс, и со второй попытки уже просто обновит
+	maxUpsertAttempts = 2
+)
+
+type VoteMongoRepo struct {
+	collection *mongo.Collection
+	logger     *zap.SugaredLogger
+}
+
+func NewMongoRepo(collection *mongo.Collection, logger *zap.SugaredLogger) *VoteMongoRepo {
+	return &VoteMongoRepo{
+		collection: collection,
+		logger:     logger,
+	}
+}
+
+// EnsureIndexes - один голос на (пост, коммент, юзер) держит сама монга, плюс индекс под голоса юзера в ленте.
+// У голосов за пост comment_id нет, для уникального индекса это null - так что и они не задваиваются
+func (repo *VoteMongoRepo) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := repo.collection.Indexes().DropOne(ctx, legacyUniqueIndex); err != nil {
+		var cmdErr mongo.CommandError
+		if !errors.As(err, &cmdErr) || (cmdErr.Code != errCodeIndexNotFound && cmdErr.Code != errCodeNamespaceNotFound) {
+			repo.logger.Errorf("Error dropping legacy vote index: %v", err)
+			return err
+		}
+	}
+	models := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: postIDKey, Value: 1}, {Key: commentIDKey, Value: 1}, {Key: userIDKey, Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: userIDKey, Value: 1}, {Key: postIDKey, Value: 1}}},
+	}
+	if _, err := repo.collection.Indexes().CreateMany(ctx, models); err != nil {
+		repo.logger.Errorf("Error creating vote indexes: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *VoteMongoRepo) SetVote(postID, userID string, vote int) (int, error) {
+	// comment_id: null матчит и документы совсем без поля
+	return repo.setVote(bson.M{postIDKey: postID, commentIDKey: nil, userIDKey: userID}, vote)
+}
+
+func (repo *VoteMongoRepo) SetCommentVote(postID, commentID, userID string, vote int) (int, error) {
+	return repo.setVote(bson.M{postIDKey: postID, commentIDKey: commentID, userIDKey: userID}, vote)
+}
+
+func (repo *VoteMongoRepo) setVote(filter bson.M, vote int) (int, error) {
+	if !validVote(vote) {
+		return 0, ErrBadVote
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var err error
+	for attempt := 0; attempt < maxUpsertAttempts; attempt++ {
+		var previous Vote
+		// старый голос достаем тем же запросом, которым меняем - иначе между чтением и записью кто-то влезет
+		if vote == 0 {
+			err = repo.collection.FindOneAndDelete(ctx, filter).Decode(&previous)
+		} else {
+			opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+			err = repo.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{voteKey: vote}}, opts).Decode(&previous)
+		}
+		switch {
+		case err == nil:
+			return previous.Vote, nil
+		case errors.Is(err, mongo.ErrNoDocuments):
+			return 0, nil
+		case !mongo.IsDuplicateKeyError(err):
+			repo.logger.Errorf("Error setting vote: %v", err)
+			return 0, err
+		}
+	}
+	repo.logger.Errorf("Error setting vote: %v", err)
+	return 0, err
+}
+
+func (repo *VoteMongoRepo) UserVotes(userID string, postIDs []string) (map[string]int, error) {
+	votes := make(map[string]int, len(postIDs))
+	if userID == "" || len(postIDs) == 0 {
+		return votes, nil
+	}
+	filter := bson.M{userIDKey: userID, postIDKey: bson.M{"$in": postIDs}, commentIDKey: nil}
+	err := repo.findVotes(filter, func(v Vote) {
+		votes[v.PostID] = v.Vote
+	})
+	if err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+func (repo *VoteMongoRepo) UserCommentVotes(userID, postID string) (map[string]int, error) {
+	votes := make(map[string]int)
+	if userID == "" {
+		return votes, nil
+	}
+	filter := bson.M{userIDKey: userID, postIDKey: postID, commentIDKey: bson.M{"$ne": nil}}
+	err := repo.findVotes(filter, func(v Vote) {
+		votes[v.CommentID] = v.Vote
+	})
+	if err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+func (repo *VoteMongoRepo) findVotes(filter bson.M, collect func(v Vote)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	votesFromDB, err := repo.collection.Find(ctx, filter)
+	if err != nil {
+		repo.logger.Errorf("Error finding user votes: %v", err)
+		return err
+	}
+
+	defer utils.HandleMongoCursorClose(votesFromDB, ctx)
+
+	for votesFromDB.Next(ctx) {
+		var v Vote
+		if err := votesFromDB.Decode(&v); err != nil {
+			repo.logger.Errorf("Error decoding vote: %v", err)
+			continue
+		}
+		collect(v)
+	}
+	return votesFromDB.Err()
+}
+
+func (repo *VoteMongoRepo) DeletePostVotes(postID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := repo.collection.DeleteMany(ctx, bson.M{postIDKey: postID})
+	if err != nil {
+		repo.logger.Errorf("Error deleting votes of post %s: %v", postID, err)
+		return err
+	}
+	repo.logger.Debugf("Deleted %d votes of post %s", res.DeletedCount, postID)
+	return nil
+}
+
+// DeleteCommentVotes удаляет голоса за переданные комменты поста - тех, которых в посте уже нет
+func (repo *VoteMongoRepo) DeleteCommentVotes(postID string, commentIDs []string) error {
+	if len(commentIDs) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.M{postIDKey: postID, commentIDKey: bson.M{"$in": commentIDs}}
+	res, err := repo.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		repo.logger.Errorf("Error deleting votes of comments %v of post %s: %v", commentIDs, postID, err)
+		return err
+	}
+	repo.logger.Debugf("Deleted %d votes of %d comments of post %s", res.DeletedCount, len(commentIDs), postID)
+	return nil
+}
+
+// AllCounts - один $group по всем голосам сразу, группа - пара (пост, коммент). У голосов за сам пост
+// comment_id нет, в _id группы его тоже не будет
+func (repo *VoteMongoRepo) AllCounts() (map[string]Counts, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	countOf := func(vote int) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$" + voteKey, vote}}, 1, 0}}}
+	}
+	group := bson.M{
+		"_id":   bson.M{"post": "$" + postIDKey, "comment": "$" + commentIDKey},
+		"ups":   countOf(1),
+		"downs": countOf(-1),
+	}
+	groups, err := repo.collection.Aggregate(ctx, mongo.Pipeline{{{Key: "$group", Value: group}}})
+	if err != nil {
+		repo.logger.Errorf("Error counting votes: %v", err)
+		return nil, err
+	}
+
+	defer utils.HandleMongoCursorClose(groups, ctx)
+
+	counts := make(map[string]Counts)
+	for groups.Next(ctx) {
+		var group struct {
+			ID struct {
+				PostID    string `bson:"post"`
+				CommentID string `bson:"comment"`
+			} `bson:"_id"`
+			Tally `bson:",inline"`
+		}
+		if err := groups.Decode(&group); err != nil {
+			repo.logger.Errorf("Error decoding vote counts: %v", err)
+			return nil, err
+		}
+		postCounts, ok := counts[group.ID.PostID]
+		if !ok {
+			postCounts = Counts{Comments: make(map[string]Tally)}
+		}
+		if group.ID.CommentID == "" {
+			postCounts.Post = group.Tally
+		} else {
+			postCounts.Comments[group.ID.CommentID] = group.Tally
+		}
+		counts[group.ID.PostID] = postCounts
+	}
+	return counts, groups.Err()
+}
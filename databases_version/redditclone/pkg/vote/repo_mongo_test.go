@@ -0,0 +1,192 @@
+package vote
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.uber.org/zap"
+)
+
+var nilLogger = zap.NewNop().Sugar()
+
+func TestSetVote(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("change vote", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: bson.D{{Key: "post_id", Value: "p1"}, {Key: "user_id", Value: "u1"}, {Key: "vote", Value: -1}}},
+		})
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		previous, err := repo.SetVote("p1", "u1", 1)
+		if err != nil || previous != -1 {
+			t.Fatalf("expected previous -1, got %d (%v)", previous, err)
+		}
+	})
+
+	mt.Run("first vote", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}})
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		previous, err := repo.SetVote("p1", "u1", 1)
+		if err != nil || previous != 0 {
+			t.Fatalf("expected previous 0, got %d (%v)", previous, err)
+		}
+	})
+
+	mt.Run("unvote", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: bson.D{{Key: "post_id", Value: "p1"}, {Key: "user_id", Value: "u1"}, {Key: "vote", Value: 1}}},
+		})
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		previous, err := repo.SetVote("p1", "u1", 0)
+		if err != nil || previous != 1 {
+			t.Fatalf("expected previous 1, got %d (%v)", previous, err)
+		}
+		if cmd := mt.GetStartedEvent(); cmd == nil || cmd.CommandName != "findAndModify" {
+			t.Errorf("expected findAndModify, got %+v", cmd)
+		}
+	})
+
+	mt.Run("retry on duplicate key", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}),
+			bson.D{
+				{Key: "ok", Value: 1},
+				{Key: "value", Value: bson.D{{Key: "post_id", Value: "p1"}, {Key: "user_id", Value: "u1"}, {Key: "vote", Value: 1}}},
+			},
+		)
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		previous, err := repo.SetVote("p1", "u1", -1)
+		if err != nil || previous != 1 {
+			t.Fatalf("expected previous 1, got %d (%v)", previous, err)
+		}
+	})
+
+	mt.Run("bad vote", func(mt *mtest.T) {
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		if _, err := repo.SetVote("p1", "u1", 2); !errors.Is(err, ErrBadVote) {
+			t.Fatalf("expected ErrBadVote, got %v", err)
+		}
+	})
+}
+
+func TestUserVotes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("success", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, ns, mtest.FirstBatch,
+				bson.D{{Key: "post_id", Value: "p1"}, {Key: "user_id", Value: "u1"}, {Key: "vote", Value: 1}},
+				bson.D{{Key: "post_id", Value: "p3"}, {Key: "user_id", Value: "u1"}, {Key: "vote", Value: -1}},
+			),
+			mtest.CreateCursorResponse(0, ns, mtest.NextBatch),
+		)
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		votes, err := repo.UserVotes("u1", []string{"p1", "p2", "p3"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(votes) != 2 || votes["p1"] != 1 || votes["p3"] != -1 {
+			t.Errorf("unexpected votes: %v", votes)
+		}
+	})
+
+	mt.Run("anonymous", func(mt *mtest.T) {
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+		votes, err := repo.UserVotes("", []string{"p1"})
+		if err != nil || len(votes) != 0 {
+			t.Errorf("expected no votes, got %v (%v)", votes, err)
+		}
+	})
+}
+
+func TestCommentVotes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("set and list", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}})
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+				bson.D{{Key: "post_id", Value: "p1"}, {Key: "comment_id", Value: "c1"}, {Key: "user_id", Value: "u1"}, {Key: "vote", Value: -1}},
+			),
+		)
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+
+		previous, err := repo.SetCommentVote("p1", "c1", "u1", -1)
+		if err != nil || previous != 0 {
+			t.Fatalf("expected previous 0, got %d (%v)", previous, err)
+		}
+		query := mt.GetStartedEvent().Command.Lookup("query").Document()
+		if query.Lookup("comment_id").StringValue() != "c1" {
+			t.Errorf("expected comment vote filter, got %v", query)
+		}
+
+		votes, err := repo.UserCommentVotes("u1", "p1")
+		if err != nil || len(votes) != 1 || votes["c1"] != -1 {
+			t.Errorf("unexpected comment votes: %v (%v)", votes, err)
+		}
+	})
+}
+
+func TestAllCounts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("posts and comments", func(mt *mtest.T) {
+		ns := fmt.Sprintf("%s.%s", mt.DB.Name(), mt.Coll.Name())
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: bson.D{{Key: "post", Value: "p1"}}}, {Key: "ups", Value: 3}, {Key: "downs", Value: 1}},
+				bson.D{{Key: "_id", Value: bson.D{{Key: "post", Value: "p1"}, {Key: "comment", Value: "c1"}}}, {Key: "ups", Value: 0}, {Key: "downs", Value: 2}},
+				bson.D{{Key: "_id", Value: bson.D{{Key: "post", Value: "p2"}, {Key: "comment", Value: "c7"}}}, {Key: "ups", Value: 1}, {Key: "downs", Value: 0}},
+			),
+		)
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+
+		counts, err := repo.AllCounts()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		p1, p2 := counts["p1"], counts["p2"]
+		if p1.Post != (Tally{Ups: 3, Downs: 1}) || p1.Comments["c1"] != (Tally{Downs: 2}) || len(p1.Comments) != 1 {
+			t.Errorf("unexpected counts of p1: %+v", p1)
+		}
+		if p2.Post != (Tally{}) || p2.Comments["c7"] != (Tally{Ups: 1}) || len(counts) != 2 {
+			t.Errorf("unexpected counts: %+v", counts)
+		}
+		if cmd := mt.GetStartedEvent(); cmd == nil || cmd.CommandName != "aggregate" {
+			t.Errorf("expected a single aggregate, got %+v", cmd)
+		}
+	})
+}
+
+func TestDeleteCommentVotes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("only listed comments", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 3}))
+		repo := NewMongoRepo(mt.Coll, nilLogger)
+
+		if err := repo.DeleteCommentVotes("p1", []string{"c1", "c2"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		q := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		ids, _ := q.Lookup("comment_id", "$in").Array().Values()
+		if q.Lookup("post_id").StringValue() != "p1" || len(ids) != 2 {
+			t.Errorf("unexpected filter: %v", q)
+		}
+
+		// пустой список - в базу не ходим
+		if err := repo.DeleteCommentVotes("p1", nil); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if ev := mt.GetStartedEvent(); ev != nil {
+			t.Errorf("expected no command, got %s", ev.CommandName)
+		}
+	})
+}
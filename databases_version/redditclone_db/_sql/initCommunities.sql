@@ -0,0 +1,31 @@
+SET NAMES utf8;
+SET time_zone = '+00:00';
+
+DROP TABLE IF EXISTS `community_subscriptions`;
+DROP TABLE IF EXISTS `communities`;
+CREATE TABLE `communities` (
+  `name` varchar(21) NOT NULL,
+  `description` text NOT NULL,
+  `creator_id` varchar(24) NOT NULL,
+  `creator_username` varchar(255) NOT NULL,
+  `rules` text NOT NULL,
+  `created` datetime NOT NULL,
+  `subscribers` int NOT NULL DEFAULT 0,
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `community_subscriptions` (
+  `community` varchar(21) NOT NULL,
+  `user_id` varchar(24) NOT NULL,
+  PRIMARY KEY (`community`, `user_id`),
+  KEY `user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- категории, которые раньше были зашиты во фронт, - чтобы старые посты остались в существующих сообществах
+INSERT INTO `communities` (`name`, `description`, `creator_id`, `creator_username`, `rules`, `created`, `subscribers`) VALUES
+('music',       '', '', '', '[]', UTC_TIMESTAMP(), 0),
+('funny',       '', '', '', '[]', UTC_TIMESTAMP(), 0),
+('videos',      '', '', '', '[]', UTC_TIMESTAMP(), 0),
+('programming', '', '', '', '[]', UTC_TIMESTAMP(), 0),
+('news',        '', '', '', '[]', UTC_TIMESTAMP(), 0),
+('fashion',     '', '', '', '[]', UTC_TIMESTAMP(), 0);
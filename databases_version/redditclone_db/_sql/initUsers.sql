@@ -5,13 +5,54 @@ SET sql_mode = 'NO_AUTO_VALUE_ON_ZERO';
 
 DROP TABLE IF EXISTS `items`;
 DROP TABLE IF EXISTS `users`;
+DROP TABLE IF EXISTS `user_follows`;
+DROP TABLE IF EXISTS `user_roles`;
+DROP TABLE IF EXISTS `user_bans`;
 CREATE TABLE `users` (
   `id` varchar(24) NOT NULL,
   `username` varchar(255) NOT NULL,
   `password` varchar(255) NOT NULL,
+  `created` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
   PRIMARY KEY (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
 INSERT INTO `users` (`id`, `username`, `password`) VALUES
 ("ds32dd31dd33ds32dd31dd33",	'dadadada',	'bebebebe'),
 ("ds42dd41dd44ds42dd41dd44",	'bebebebe',	'dadadada');
+
+CREATE TABLE `user_follows` (
+  `follower_id` varchar(24) NOT NULL,
+  `followee_id` varchar(24) NOT NULL,
+  `followee_username` varchar(255) NOT NULL,
+  PRIMARY KEY (`follower_id`, `followee_id`),
+  KEY `followee_username` (`followee_username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- community пустой у админа, у модератора - имя сообщества, как в communities.name
+CREATE TABLE `user_roles` (
+  `user_id` varchar(24) NOT NULL,
+  `username` varchar(255) NOT NULL,
+  `role` varchar(16) NOT NULL,
+  `community` varchar(21) NOT NULL DEFAULT '',
+  PRIMARY KEY (`user_id`, `role`, `community`),
+  KEY `role_community` (`role`, `community`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- админов назначаем только тут, через апи админом не стать
+INSERT INTO `user_roles` (`user_id`, `username`, `role`, `community`) VALUES
+("ds32dd31dd33ds32dd31dd33",	'dadadada',	'admin',	'');
+
+-- category пустая - бан на весь сайт, expires NULL - бессрочный. Теневой бан бывает только на весь сайт
+CREATE TABLE `user_bans` (
+  `user_id` varchar(24) NOT NULL,
+  `username` varchar(255) NOT NULL,
+  `category` varchar(21) NOT NULL DEFAULT '',
+  `shadow` tinyint(1) NOT NULL DEFAULT 0,
+  `reason` varchar(1200) NOT NULL,
+  `banned_by` varchar(255) NOT NULL,
+  `created` datetime NOT NULL,
+  `expires` datetime DEFAULT NULL,
+  PRIMARY KEY (`user_id`, `category`),
+  KEY `username` (`username`),
+  KEY `shadow` (`shadow`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -1,36 +1,108 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
+	"os"
+	"os/signal"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/automod"
+	"redditclone/pkg/ban"
+	"redditclone/pkg/community"
+	"redditclone/pkg/feed"
+	"redditclone/pkg/follow"
 	"redditclone/pkg/handlers"
+	"redditclone/pkg/media"
+	"redditclone/pkg/notification"
 	"redditclone/pkg/post"
+	"redditclone/pkg/preview"
+	"redditclone/pkg/report"
+	"redditclone/pkg/role"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
 	"redditclone/pkg/utils/middleware"
+	"redditclone/pkg/views"
+	"redditclone/pkg/vote"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
-func configureRoutes(userHandler *handlers.UserHandler, postHandler *handlers.PostHandler, logger *zap.SugaredLogger) http.Handler {
+func configureRoutes(userHandler *handlers.UserHandler, postHandler *handlers.PostHandler, communityHandler *handlers.CommunityHandler, reportHandler *handlers.ReportHandler, banHandler *handlers.BanHandler, auditHandler *handlers.AuditHandler, automodHandler *handlers.AutomodHandler, notificationHandler *handlers.NotificationHandler, sm *session.SessionsManager, logger *zap.SugaredLogger) http.Handler {
+	// auth - только для залогиненных, optAuth - аноним тоже пройдет, но без сессии в контексте
+	auth := func(h http.HandlerFunc) http.Handler {
+		return middleware.Auth(sm, logger, h)
+	}
+	optAuth := func(h http.HandlerFunc) http.Handler {
+		return middleware.OptionalAuth(sm, logger, h)
+	}
+
 	router := mux.NewRouter().StrictSlash(true)
 	router.HandleFunc("/api/register", userHandler.Register).Methods(http.MethodPost)
 	router.HandleFunc("/api/login", userHandler.Login).Methods(http.MethodPost)
 	// router.HandleFunc("/logout", userHandler.Logout).Methods(http.MethodPost)
 
-	router.HandleFunc("/api/posts", postHandler.CreatePost).Methods(http.MethodPost)
-	router.HandleFunc("/api/posts", postHandler.ListPosts).Methods(http.MethodGet)
-	router.HandleFunc("/api/posts/{category}", postHandler.ListPostsByCategory).Methods(http.MethodGet)
-	router.HandleFunc("/api/post/{post_id}", postHandler.GetPost).Methods(http.MethodGet)
-	router.HandleFunc("/api/post/{post_id}", postHandler.AddComment).Methods(http.MethodPost)
-	router.HandleFunc("/api/post/{post_id}/{comment_id}", postHandler.DeleteComment).Methods(http.MethodDelete)
-	router.HandleFunc("/api/post/{post_id}/upvote", postHandler.UpvotePost).Methods(http.MethodGet)
-	router.HandleFunc("/api/post/{post_id}/downvote", postHandler.DownvotePost).Methods(http.MethodGet)
-	router.HandleFunc("/api/post/{post_id}/unvote", postHandler.UnvotePost).Methods(http.MethodGet)
-	router.HandleFunc("/api/post/{post_id}", postHandler.DeletePost).Methods(http.MethodDelete)
-	router.HandleFunc("/api/user/{username}", postHandler.PostsByUser).Methods(http.MethodGet)
+	router.Handle("/api/posts", auth(postHandler.CreatePost)).Methods(http.MethodPost)
+	router.Handle("/api/posts/image", auth(postHandler.CreateImagePost)).Methods(http.MethodPost)
+	router.Handle("/api/posts", optAuth(postHandler.ListPosts)).Methods(http.MethodGet)
+	router.Handle("/api/posts/{category}", optAuth(postHandler.ListPostsByCategory)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}", optAuth(postHandler.GetPost)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}", auth(postHandler.AddComment)).Methods(http.MethodPost)
+	router.Handle("/api/post/{post_id}", auth(postHandler.EditPost)).Methods(http.MethodPut)
+	router.HandleFunc("/api/post/{post_id}/revisions", postHandler.PostRevisions).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/{comment_id}", auth(postHandler.DeleteComment)).Methods(http.MethodDelete)
+	router.Handle("/api/post/{post_id}/{comment_id}", auth(postHandler.EditComment)).Methods(http.MethodPut)
+	router.HandleFunc("/api/post/{post_id}/{comment_id}/revisions", postHandler.CommentRevisions).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/{comment_id}/reply", auth(postHandler.AddReply)).Methods(http.MethodPost)
+	router.Handle("/api/post/{post_id}/{comment_id}/replies", optAuth(postHandler.CommentReplies)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/{comment_id}/upvote", auth(postHandler.UpvoteComment)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/{comment_id}/downvote", auth(postHandler.DownvoteComment)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/{comment_id}/unvote", auth(postHandler.UnvoteComment)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/upvote", auth(postHandler.UpvotePost)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/downvote", auth(postHandler.DownvotePost)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/unvote", auth(postHandler.UnvotePost)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/poll", auth(postHandler.VotePoll)).Methods(http.MethodPost)
+	router.Handle("/api/post/{post_id}", auth(postHandler.DeletePost)).Methods(http.MethodDelete)
+	router.Handle("/api/post/{post_id}/remove", auth(postHandler.RemovePost)).Methods(http.MethodPost)
+	router.Handle("/api/post/{post_id}/{comment_id}/remove", auth(postHandler.RemoveComment)).Methods(http.MethodPost)
+	router.Handle("/api/user/{username}", optAuth(postHandler.PostsByUser)).Methods(http.MethodGet)
+	router.Handle("/api/user/{username}/ban", auth(banHandler.BanUser)).Methods(http.MethodPost)
+	router.Handle("/api/user/{username}/ban", auth(banHandler.UnbanUser)).Methods(http.MethodDelete)
+	router.Handle("/api/user/{username}/bans", auth(banHandler.UserBans)).Methods(http.MethodGet)
+	router.Handle("/api/user/{username}/follow", auth(userHandler.FollowUser)).Methods(http.MethodPost)
+	router.Handle("/api/user/{username}/unfollow", auth(userHandler.UnfollowUser)).Methods(http.MethodPost)
+	router.Handle("/api/notifications", auth(notificationHandler.Inbox)).Methods(http.MethodGet)
+	router.Handle("/api/notifications/read", auth(notificationHandler.MarkRead)).Methods(http.MethodPost)
+	router.Handle("/api/notifications/preferences", auth(notificationHandler.Preferences)).Methods(http.MethodGet)
+	router.Handle("/api/notifications/preferences", auth(notificationHandler.SetPreferences)).Methods(http.MethodPost)
+	router.Handle("/api/feed", optAuth(postHandler.HomeFeed)).Methods(http.MethodGet)
+	router.Handle("/api/search", optAuth(postHandler.Search)).Methods(http.MethodGet)
+	router.Handle("/api/duplicates/{post_id}", optAuth(postHandler.Duplicates)).Methods(http.MethodGet)
+	router.Handle("/api/post/{post_id}/report", auth(reportHandler.ReportPost)).Methods(http.MethodPost)
+	router.Handle("/api/post/{post_id}/{comment_id}/report", auth(reportHandler.ReportComment)).Methods(http.MethodPost)
+	router.Handle("/api/modqueue", auth(reportHandler.ModQueue)).Methods(http.MethodGet)
+	router.Handle("/api/modqueue/{item_id}/{action}", auth(reportHandler.ResolveItem)).Methods(http.MethodPost)
+	router.Handle("/api/audit", auth(auditHandler.AuditLog)).Methods(http.MethodGet)
+	router.Handle("/api/automod/dryrun", auth(automodHandler.DryRun)).Methods(http.MethodPost)
+
+	router.Handle("/api/communities", auth(communityHandler.CreateCommunity)).Methods(http.MethodPost)
+	router.Handle("/api/communities", optAuth(communityHandler.ListCommunities)).Methods(http.MethodGet)
+	router.Handle("/api/community/{name}", optAuth(communityHandler.GetCommunity)).Methods(http.MethodGet)
+	router.Handle("/api/community/{name}/subscribe", auth(communityHandler.Subscribe)).Methods(http.MethodPost)
+	router.Handle("/api/community/{name}/unsubscribe", auth(communityHandler.Unsubscribe)).Methods(http.MethodPost)
+	router.Handle("/api/community/{name}/moderators", optAuth(communityHandler.Moderators)).Methods(http.MethodGet)
+	router.Handle("/api/community/{name}/moderators", auth(communityHandler.AddModerator)).Methods(http.MethodPost)
+	router.Handle("/api/community/{name}/moderators/{username}", auth(communityHandler.RemoveModerator)).Methods(http.MethodDelete)
 
+	router.HandleFunc("/media/{key}", postHandler.ServeMedia).Methods(http.MethodGet)
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static")))).Methods(http.MethodGet)
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "./static/html/index.html")
@@ -42,10 +114,72 @@ func configureRoutes(userHandler *handlers.UserHandler, postHandler *handlers.Po
 	return muxmwr
 }
 
+// reportThreshold - сколько жалоб прячет пост из лент, из REDDITCLONE_REPORT_THRESHOLD. 0 - не прятать никогда.
+// Не задан или не число >= 0 - report.DefaultHideThreshold
+func reportThreshold(logger *zap.SugaredLogger) int {
+	raw := os.Getenv("REDDITCLONE_REPORT_THRESHOLD")
+	if raw == "" {
+		return report.DefaultHideThreshold
+	}
+	threshold, err := strconv.Atoi(raw)
+	if err != nil || threshold < 0 {
+		logger.Warnf("Bad REDDITCLONE_REPORT_THRESHOLD %q, want a number >= 0, using %d", raw, report.DefaultHideThreshold)
+		return report.DefaultHideThreshold
+	}
+	return threshold
+}
+
+// newBlobStore - S3-совместимое хранилище, если задан REDDITCLONE_S3_ENDPOINT, иначе папка uploads
+func newBlobStore(logger *zap.SugaredLogger) media.BlobStore {
+	endpoint := os.Getenv("REDDITCLONE_S3_ENDPOINT")
+	if endpoint == "" {
+		logger.Infof("Storing uploads in ./uploads")
+		return media.NewFileStore("uploads")
+	}
+	logger.Infof("Storing uploads in S3 at %s", endpoint)
+	return media.NewS3Store(media.S3Config{
+		Endpoint:  endpoint,
+		Region:    os.Getenv("REDDITCLONE_S3_REGION"),
+		Bucket:    os.Getenv("REDDITCLONE_S3_BUCKET"),
+		AccessKey: os.Getenv("REDDITCLONE_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("REDDITCLONE_S3_SECRET_KEY"),
+	})
+}
+
+// passwordCost - стоимость bcrypt из REDDITCLONE_BCRYPT_COST. Не задана или вне [bcrypt.MinCost, bcrypt.MaxCost] - bcrypt.DefaultCost
+func passwordCost(logger *zap.SugaredLogger) int {
+	raw := os.Getenv("REDDITCLONE_BCRYPT_COST")
+	if raw == "" {
+		return bcrypt.DefaultCost
+	}
+	cost, err := strconv.Atoi(raw)
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		logger.Warnf("Bad REDDITCLONE_BCRYPT_COST %q, want %d..%d, using %d", raw, bcrypt.MinCost, bcrypt.MaxCost, bcrypt.DefaultCost)
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
+
+// loadAutomod - правила из REDDITCLONE_AUTOMOD, по умолчанию automod.yaml в рабочей папке.
+// Файла нет - работаем без автомодератора (nil), битый файл - ошибка
+func loadAutomod(logger *zap.SugaredLogger) (*automod.Engine, error) {
+	path := os.Getenv("REDDITCLONE_AUTOMOD")
+	if path == "" {
+		path = "automod.yaml"
+	}
+	engine, err := automod.Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.Infof("No automod rules at %s, automod is off", path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Loaded %d automod rules from %s", engine.Len(), path)
+	return engine, nil
+}
+
 func main() {
-	sm := session.NewSessionsManager()
-	userRepo := user.NewMemoryRepo()
-	postRepo := post.NewMemoryRepo()
 	zapLogger, err := zap.NewProduction()
 	if err != nil {
 		fmt.Println("Error initializing zap logger:", err)
@@ -61,22 +195,145 @@ func main() {
 
 	logger := zapLogger.Sugar()
 
+	sm := session.NewSessionsManager()
+	userRepo := user.NewMemoryRepo(user.NewPasswordHasher(passwordCost(logger)))
+	postRepo := post.NewMemoryRepo()
+	voteRepo := vote.NewMemoryRepo()
+	communityRepo := community.NewMemoryRepo()
+	followRepo := follow.NewMemoryRepo(userRepo)
+	// базы нет, так что админов задаем при запуске: REDDITCLONE_ADMINS=alice,bob
+	roleRepo := role.NewMemoryRepo(userRepo, strings.Split(os.Getenv("REDDITCLONE_ADMINS"), ","))
+	reportRepo := report.NewMemoryRepo(reportThreshold(logger))
+	banRepo := ban.NewMemoryRepo(userRepo)
+	auditRepo := audit.NewMemoryRepo(audit.DefaultCapacity)
+	notificationRepo := notification.NewMemoryRepo()
+	// таймлайны нужны, когда фильтр по подпискам становится дорогим запросом в базу, в памяти он и так дешевый
+	feedService := feed.NewService(postRepo, communityRepo, followRepo, nil, logger)
+
 	userHandler := &handlers.UserHandler{
 		UserRepo: userRepo,
+		Follows:  followRepo,
+		Feed:     feedService,
 		Logger:   logger,
 		Sessions: sm,
+		Audit:    auditRepo,
 	}
 
+	// битые правила - не стартуем, чтобы не остаться без автомодератора молча
+	automodEngine, err := loadAutomod(logger)
+	if err != nil {
+		logger.Errorf("Error loading automod rules: %v", err)
+		return
+	}
+	blobs := newBlobStore(logger)
+
+	// фоновые задачи останавливаем после сервера, чтобы views напоследок сбросил и то, что насчитали последние запросы
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	viewCounter := views.NewMemoryCounter(views.DedupWindow)
+	viewsDone := make(chan struct{})
+	go func() {
+		views.Run(jobs, viewCounter, postRepo, views.FlushInterval, logger)
+		close(viewsDone)
+	}()
+
+	// карточки ссылок: миниатюры лежат в статике, REDDITCLONE_PREVIEW_BLOCKED - домены через запятую, куда не ходим
+	previewFetcher := preview.NewFetcher(preview.Options{Blocked: strings.Split(os.Getenv("REDDITCLONE_PREVIEW_BLOCKED"), ",")})
+	previewWorker := preview.NewWorker(previewFetcher, preview.NewFileStore("static/thumbs", "/static/thumbs"), postRepo, preview.DefaultQueueSize, logger)
+	go previewWorker.Run(jobs, 4)
+
+	notificationWorker := notification.NewWorker(notificationRepo, userRepo, notification.DefaultQueueSize, logger)
+	go notificationWorker.Run(jobs, 2)
+
+	go sm.RunSweeper(jobs, session.SweepInterval)
+
 	postHandler := &handlers.PostHandler{
+		PostRepo:      postRepo,
+		VoteRepo:      voteRepo,
+		Communities:   communityRepo,
+		Roles:         roleRepo,
+		Bans:          banRepo,
+		Feed:          feedService,
+		Views:         viewCounter,
+		Audit:         auditRepo,
+		Automod:       automodEngine,
+		Users:         userRepo,
+		Reports:       reportRepo,
+		Previews:      previewWorker,
+		Media:         blobs,
+		Notifications: notificationWorker,
+		Logger:        logger,
+	}
+
+	communityHandler := &handlers.CommunityHandler{
+		CommunityRepo: communityRepo,
+		Roles:         roleRepo,
+		Feed:          feedService,
+		Audit:         auditRepo,
+		Logger:        logger,
+	}
+
+	reportHandler := &handlers.ReportHandler{
+		Reports:  reportRepo,
 		PostRepo: postRepo,
+		Roles:    roleRepo,
+		Audit:    auditRepo,
+		Media:    blobs,
 		Logger:   logger,
-		Sessions: sm,
+	}
+
+	banHandler := &handlers.BanHandler{
+		Bans:        banRepo,
+		Roles:       roleRepo,
+		Communities: communityRepo,
+		Sessions:    sm,
+		Audit:       auditRepo,
+		Logger:      logger,
+	}
+
+	auditHandler := &handlers.AuditHandler{
+		Audit:  auditRepo,
+		Roles:  roleRepo,
+		Logger: logger,
+	}
+
+	automodHandler := &handlers.AutomodHandler{
+		Automod: automodEngine,
+		Roles:   roleRepo,
+		Logger:  logger,
+	}
+
+	notificationHandler := &handlers.NotificationHandler{
+		Notifications: notificationRepo,
+		Logger:        logger,
 	}
 
 	port := "8080"
-	configuredRouter := configureRoutes(userHandler, postHandler, logger)
+	configuredRouter := configureRoutes(userHandler, postHandler, communityHandler, reportHandler, banHandler, auditHandler, automodHandler, notificationHandler, sm, logger)
 	fmt.Printf("Starting server at :%s", port)
-	if err := http.ListenAndServe(":"+port, configuredRouter); err != nil {
-		logger.Errorf("Server error: %v", err)
+	serve(":"+port, configuredRouter, logger)
+	stopJobs()
+	<-viewsDone
+}
+
+// serve отдает handler, пока не придет SIGINT или SIGTERM, и дожидается уже начатых запросов
+func serve(addr string, handler http.Handler, logger *zap.SugaredLogger) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Server error: %v", err)
+			stop()
+		}
+	}()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Errorf("Server shutdown error: %v", err)
 	}
 }
@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"strconv"
+	"sync"
+)
+
+// AuditMemoryRepo - кольцевой буфер последних событий: базы нет, так что самые старые
+// вытесняются новыми и пропадают вместе с процессом
+type AuditMemoryRepo struct {
+	sync.RWMutex
+	events []Event
+	// next - куда писать следующее событие, seq - сколько записано всего, из него же ID
+	next int
+	seq  uint64
+}
+
+func NewMemoryRepo(capacity int) *AuditMemoryRepo {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &AuditMemoryRepo{
+		events: make([]Event, 0, capacity),
+	}
+}
+
+func (repo *AuditMemoryRepo) Record(event Event) error {
+	repo.Lock()
+	defer repo.Unlock()
+	repo.seq++
+	event.ID = strconv.FormatUint(repo.seq, 10)
+	if len(repo.events) < cap(repo.events) {
+		repo.events = append(repo.events, event)
+		return nil
+	}
+	repo.events[repo.next] = event
+	repo.next = (repo.next + 1) % len(repo.events)
+	return nil
+}
+
+func (repo *AuditMemoryRepo) Query(query Query) ([]Event, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	repo.RLock()
+	defer repo.RUnlock()
+	events := make([]Event, 0)
+	// идем от самого нового: он перед next, а пока буфер не заполнен - в конце
+	for i := 1; i <= len(repo.events) && len(events) < query.limit(); i++ {
+		event := repo.events[(repo.next-i+len(repo.events))%len(repo.events)]
+		if query.matches(event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,346 @@
+package automod
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Action - что делать с постом или комментом, на котором сработало правило
+type Action string
+
+const (
+	// ActionReject - не создавать вовсе, автору уходит Message
+	ActionReject Action = "reject"
+	// ActionRemove - создать и сразу убрать от имени автомодератора, как RemovePost модератора
+	ActionRemove Action = "remove"
+	// ActionHold - создать, но спрятать до решения модератора: в очередь жалоб и из лент
+	ActionHold Action = "hold"
+	// ActionFlair - только поставить посту флейр
+	ActionFlair Action = "flair"
+)
+
+// severity - чем больше, тем строже. Из нескольких сработавших правил побеждает самое строгое
+var severity = map[Action]int{
+	ActionFlair:  0,
+	ActionHold:   1,
+	ActionRemove: 2,
+	ActionReject: 3,
+}
+
+type Kind string
+
+const (
+	KindPost    Kind = "post"
+	KindComment Kind = "comment"
+)
+
+const (
+	// Moderator - от чьего имени автомодератор убирает и жалуется
+	Moderator = "automod"
+	// Message уходит причиной в post.Removal и в жалобу, а там больше нельзя
+	maxMessageLength = 300
+)
+
+var ErrBadRule = errors.New("bad automod rule")
+
+// Conditions - все заданные условия должны выполниться разом, пустые не проверяются.
+// Title и Body - регулярки, регистр - через (?i). Domains ловят и поддомены.
+// Title есть только у постов, Body - текст поста или коммента
+type Conditions struct {
+	Title               string   `yaml:"title" json:"title,omitempty"`
+	Body                string   `yaml:"body" json:"body,omitempty"`
+	Domains             []string `yaml:"domains" json:"domains,omitempty"`
+	AccountAgeDaysBelow int      `yaml:"account_age_days_below" json:"accountAgeDaysBelow,omitempty"`
+	// указатель, чтобы отличать порог 0 от его отсутствия
+	KarmaBelow *int `yaml:"karma_below" json:"karmaBelow,omitempty"`
+}
+
+// Rule - одно правило. Categories пустые - на все сообщества, Type пустой - и на посты, и на комменты
+type Rule struct {
+	Name       string     `yaml:"name" json:"name"`
+	Categories []string   `yaml:"categories" json:"categories,omitempty"`
+	Type       Kind       `yaml:"type" json:"type,omitempty"`
+	Match      Conditions `yaml:"match" json:"match"`
+	Action     Action     `yaml:"action" json:"action"`
+	Message    string     `yaml:"message" json:"message,omitempty"`
+	Flair      string     `yaml:"flair" json:"flair,omitempty"`
+
+	title *regexp.Regexp
+	body  *regexp.Regexp
+}
+
+// Config - формат yaml-файла с правилами
+type Config struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+func (rule *Rule) compile() error {
+	fail := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w %q: %s", ErrBadRule, rule.Name, fmt.Sprintf(format, args...))
+	}
+	if strings.TrimSpace(rule.Name) == "" {
+		return fmt.Errorf("%w: rule without name", ErrBadRule)
+	}
+	if rule.Type != "" && rule.Type != KindPost && rule.Type != KindComment {
+		return fail("unknown type %q", rule.Type)
+	}
+	if _, ok := severity[rule.Action]; !ok {
+		return fail("unknown action %q", rule.Action)
+	}
+	if rule.Action == ActionFlair {
+		if rule.Flair == "" {
+			return fail("flair action needs flair")
+		}
+		if rule.Type != KindPost {
+			return fail("flair can only be set on posts")
+		}
+	} else if rule.Message == "" {
+		// автор и модераторы должны понимать, почему пост не виден
+		return fail("%s action needs message", rule.Action)
+	}
+	if len([]rune(rule.Message)) > maxMessageLength {
+		return fail("message is longer than %d", maxMessageLength)
+	}
+
+	match := rule.Match
+	if match.Title == "" && match.Body == "" && len(match.Domains) == 0 &&
+		match.AccountAgeDaysBelow <= 0 && match.KarmaBelow == nil {
+		return fail("no conditions")
+	}
+	if match.Title != "" && rule.Type == KindComment {
+		return fail("comments have no title")
+	}
+	if match.AccountAgeDaysBelow < 0 {
+		return fail("negative account age")
+	}
+	var err error
+	if match.Title != "" {
+		if rule.title, err = regexp.Compile(match.Title); err != nil {
+			return fail("title: %v", err)
+		}
+	}
+	if match.Body != "" {
+		if rule.body, err = regexp.Compile(match.Body); err != nil {
+			return fail("body: %v", err)
+		}
+	}
+	// копия, чтобы не трогать слайс вызывающего
+	domains := make([]string, len(match.Domains))
+	for i, domain := range match.Domains {
+		domains[i] = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+		if domains[i] == "" {
+			return fail("empty domain")
+		}
+	}
+	rule.Match.Domains = domains
+	return nil
+}
+
+func (rule *Rule) applies(kind Kind, category string) bool {
+	if rule.Type != "" && rule.Type != kind {
+		return false
+	}
+	if len(rule.Categories) == 0 {
+		return true
+	}
+	for _, c := range rule.Categories {
+		if strings.EqualFold(c, category) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *Rule) needsAuthor() bool {
+	return rule.Match.AccountAgeDaysBelow > 0 || rule.Match.KarmaBelow != nil
+}
+
+// Subject - то, что проверяем. AccountAge и Karma нужны, только если их спрашивает правило, см. NeedsAuthor
+type Subject struct {
+	Kind       Kind
+	Category   string
+	Title      string
+	Body       string
+	URL        string
+	AccountAge time.Duration
+	Karma      int
+}
+
+var linkRe = regexp.MustCompile(`https?://[^\s<>()\[\]"']+`)
+
+// hosts - домен ссылки поста и всех ссылок из текста
+func (s Subject) hosts() []string {
+	links := linkRe.FindAllString(s.Body, -1)
+	if s.URL != "" {
+		links = append(links, s.URL)
+	}
+	hosts := make([]string, 0, len(links))
+	for _, link := range links {
+		u, err := url.Parse(link)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		hosts = append(hosts, strings.ToLower(u.Hostname()))
+	}
+	return hosts
+}
+
+func matchesDomain(hosts, domains []string) bool {
+	for _, host := range hosts {
+		for _, domain := range domains {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (rule *Rule) matches(s Subject) bool {
+	match := rule.Match
+	if rule.title != nil && (s.Kind != KindPost || !rule.title.MatchString(s.Title)) {
+		return false
+	}
+	if rule.body != nil && !rule.body.MatchString(s.Body) {
+		return false
+	}
+	if len(match.Domains) > 0 && !matchesDomain(s.hosts(), match.Domains) {
+		return false
+	}
+	if match.AccountAgeDaysBelow > 0 && s.AccountAge >= time.Duration(match.AccountAgeDaysBelow)*24*time.Hour {
+		return false
+	}
+	if match.KarmaBelow != nil && s.Karma >= *match.KarmaBelow {
+		return false
+	}
+	return true
+}
+
+// Hit - сработавшее правило
+type Hit struct {
+	Rule    string `json:"rule"`
+	Action  Action `json:"action"`
+	Message string `json:"message,omitempty"`
+	Flair   string `json:"flair,omitempty"`
+}
+
+// Verdict - итог по всем правилам. Action - самое строгое из сработавших, кроме флейра, Reason - его Message.
+// Flair - от первого сработавшего правила с флейром
+type Verdict struct {
+	Hits   []Hit  `json:"hits"`
+	Action Action `json:"action,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Flair  string `json:"flair,omitempty"`
+}
+
+// Engine - набор проверенных правил. nil - правил нет, все методы на nil работают
+type Engine struct {
+	rules []Rule
+}
+
+func NewEngine(rules []Rule) (*Engine, error) {
+	engine := &Engine{rules: make([]Rule, len(rules))}
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("%w %q: duplicate name", ErrBadRule, rule.Name)
+		}
+		names[rule.Name] = true
+		engine.rules[i] = rule
+	}
+	return engine, nil
+}
+
+// Parse - правила из yaml, неизвестные поля - ошибка, чтобы опечатка не выключала правило молча
+func Parse(data []byte) (*Engine, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var config Config
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %v", ErrBadRule, err)
+	}
+	return NewEngine(config.Rules)
+}
+
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func (e *Engine) Len() int {
+	if e == nil {
+		return 0
+	}
+	return len(e.rules)
+}
+
+// Covers - есть ли хоть одно правило на такой тип: если нет, коммент можно даже не проверять
+func (e *Engine) Covers(kind Kind) bool {
+	if e == nil {
+		return false
+	}
+	for i := range e.rules {
+		if e.rules[i].Type == "" || e.rules[i].Type == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsAuthor - нужно ли ходить в базу за возрастом аккаунта и кармой автора
+func (e *Engine) NeedsAuthor(kind Kind, category string) bool {
+	if e == nil {
+		return false
+	}
+	for i := range e.rules {
+		if e.rules[i].applies(kind, category) && e.rules[i].needsAuthor() {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) Evaluate(s Subject) Verdict {
+	verdict := Verdict{Hits: make([]Hit, 0)}
+	if e == nil {
+		return verdict
+	}
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if !rule.applies(s.Kind, s.Category) || !rule.matches(s) {
+			continue
+		}
+		verdict.Hits = append(verdict.Hits, Hit{
+			Rule:    rule.Name,
+			Action:  rule.Action,
+			Message: rule.Message,
+			Flair:   rule.Flair,
+		})
+		if rule.Action == ActionFlair {
+			if verdict.Flair == "" {
+				verdict.Flair = rule.Flair
+			}
+			continue
+		}
+		if verdict.Action == "" || severity[rule.Action] > severity[verdict.Action] {
+			verdict.Action = rule.Action
+			verdict.Reason = rule.Message
+		}
+	}
+	return verdict
+}
@@ -0,0 +1,109 @@
+package ban
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// дольше десяти лет - это уже навсегда, для этого Days = 0
+	MaxDays         = 3650
+	maxReasonLength = 300
+)
+
+var (
+	ErrNoUser         = errors.New("user not found")
+	ErrNoBan          = errors.New("ban not found")
+	ErrNoReason       = errors.New("ban reason is required")
+	ErrBadDuration    = errors.New("bad ban duration")
+	ErrShadowCategory = errors.New("shadowban can only be site-wide")
+)
+
+// Ban - запрет юзеру писать: постить, комментить и голосовать. Category пустая - на весь сайт.
+// Shadow - теневой бан: писать можно, но написанное видит только сам юзер
+type Ban struct {
+	UserID   string     `json:"-"`
+	Username string     `json:"username"`
+	Category string     `json:"category"`
+	Shadow   bool       `json:"shadow"`
+	Reason   string     `json:"reason"`
+	By       string     `json:"by"`
+	Created  time.Time  `json:"created"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+// NewBanRequest - тело POST /api/user/{username}/ban. Days = 0 - бессрочно
+type NewBanRequest struct {
+	Category string `json:"category"`
+	Reason   string `json:"reason"`
+	Days     int    `json:"days"`
+	Shadow   bool   `json:"shadow"`
+}
+
+func NewBan(request NewBanRequest, by string, now time.Time) (Ban, error) {
+	reason := strings.TrimSpace(request.Reason)
+	if reason == "" || len([]rune(reason)) > maxReasonLength {
+		return Ban{}, ErrNoReason
+	}
+	if request.Days < 0 || request.Days > MaxDays {
+		return Ban{}, ErrBadDuration
+	}
+	if request.Shadow && request.Category != "" {
+		return Ban{}, ErrShadowCategory
+	}
+	ban := Ban{
+		Category: request.Category,
+		Shadow:   request.Shadow,
+		Reason:   reason,
+		By:       by,
+		Created:  now,
+	}
+	if request.Days > 0 {
+		expires := now.AddDate(0, 0, request.Days)
+		ban.Expires = &expires
+	}
+	return ban, nil
+}
+
+func (b Ban) Active(now time.Time) bool {
+	return b.Expires == nil || b.Expires.After(now)
+}
+
+// SiteWide - бан на весь сайт, после него юзера выкидывает из всех сессий
+func (b Ban) SiteWide() bool {
+	return b.Category == ""
+}
+
+// Suspension - бан, который не дает писать в category. Теневой не в счет: юзер не должен о нем узнать
+func Suspension(bans []Ban, category string, now time.Time) *Ban {
+	for i := range bans {
+		b := &bans[i]
+		if b.Shadow || !b.Active(now) {
+			continue
+		}
+		if b.SiteWide() || strings.EqualFold(b.Category, category) {
+			return b
+		}
+	}
+	return nil
+}
+
+// Shadowbanned - id юзеров в теневом бане. Их посты и комменты видят только они сами
+type Shadowbanned map[string]bool
+
+// Hides - прятать ли от viewerID написанное authorID. Аноним viewerID пустой
+func (s Shadowbanned) Hides(authorID, viewerID string) bool {
+	return s[authorID] && authorID != viewerID
+}
+
+type BanRepo interface {
+	// Ban заводит бан или заменяет прежний в той же категории, username ищется как есть
+	Ban(username string, ban Ban) (*Ban, error)
+	Unban(username, category string) error
+	// Active - действующие баны юзера, по ним проверяем каждую запись
+	Active(userID string) ([]Ban, error)
+	// List - все баны юзера вместе с истекшими, для модераторов
+	List(username string) ([]Ban, error)
+	Shadowbanned() (Shadowbanned, error)
+}
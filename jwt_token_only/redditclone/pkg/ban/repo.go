@@ -0,0 +1,107 @@
+package ban
+
+import (
+	"redditclone/pkg/user"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type BanMemoryRepo struct {
+	sync.RWMutex
+	users *user.UserMemoryRepo
+	// userID -> категория в нижнем регистре -> бан
+	bans map[string]map[string]Ban
+}
+
+func NewMemoryRepo(users *user.UserMemoryRepo) *BanMemoryRepo {
+	return &BanMemoryRepo{
+		users: users,
+		bans:  make(map[string]map[string]Ban),
+	}
+}
+
+func (repo *BanMemoryRepo) userID(username string) (string, bool) {
+	repo.users.RLock()
+	defer repo.users.RUnlock()
+	u, ok := repo.users.Users[username]
+	if !ok {
+		return "", false
+	}
+	return u.ID, true
+}
+
+func (repo *BanMemoryRepo) Ban(username string, ban Ban) (*Ban, error) {
+	userID, ok := repo.userID(username)
+	if !ok {
+		return nil, ErrNoUser
+	}
+	ban.UserID, ban.Username = userID, username
+
+	repo.Lock()
+	defer repo.Unlock()
+	if repo.bans[userID] == nil {
+		repo.bans[userID] = make(map[string]Ban)
+	}
+	repo.bans[userID][strings.ToLower(ban.Category)] = ban
+	return &ban, nil
+}
+
+func (repo *BanMemoryRepo) Unban(username, category string) error {
+	userID, ok := repo.userID(username)
+	if !ok {
+		return ErrNoBan
+	}
+	repo.Lock()
+	defer repo.Unlock()
+	key := strings.ToLower(category)
+	if _, ok := repo.bans[userID][key]; !ok {
+		return ErrNoBan
+	}
+	delete(repo.bans[userID], key)
+	return nil
+}
+
+func (repo *BanMemoryRepo) Active(userID string) ([]Ban, error) {
+	now := time.Now().UTC()
+	repo.RLock()
+	defer repo.RUnlock()
+	bans := make([]Ban, 0)
+	for _, b := range repo.bans[userID] {
+		if b.Active(now) {
+			bans = append(bans, b)
+		}
+	}
+	return bans, nil
+}
+
+func (repo *BanMemoryRepo) List(username string) ([]Ban, error) {
+	bans := make([]Ban, 0)
+	userID, ok := repo.userID(username)
+	if !ok {
+		return bans, nil
+	}
+	repo.RLock()
+	for _, b := range repo.bans[userID] {
+		bans = append(bans, b)
+	}
+	repo.RUnlock()
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Created.After(bans[j].Created)
+	})
+	return bans, nil
+}
+
+func (repo *BanMemoryRepo) Shadowbanned() (Shadowbanned, error) {
+	now := time.Now().UTC()
+	repo.RLock()
+	defer repo.RUnlock()
+	shadowbanned := make(Shadowbanned)
+	for userID, bans := range repo.bans {
+		if b, ok := bans[""]; ok && b.Shadow && b.Active(now) {
+			shadowbanned[userID] = true
+		}
+	}
+	return shadowbanned, nil
+}
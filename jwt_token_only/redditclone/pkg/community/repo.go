@@ -0,0 +1,130 @@
+package community
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// категории, которые раньше были зашиты во фронт, - чтобы по ним можно было постить сразу после старта
+var defaultCommunities = []string{"music", "funny", "videos", "programming", "news", "fashion"}
+
+type CommunityMemoryRepo struct {
+	sync.RWMutex
+	// ключ - имя в нижнем регистре, чтобы Music и music были одним сообществом
+	Communities map[string]*Community
+	// имя в нижнем регистре -> userID подписчиков
+	Subscriptions map[string]map[string]bool
+}
+
+func NewMemoryRepo() *CommunityMemoryRepo {
+	repo := &CommunityMemoryRepo{
+		Communities:   make(map[string]*Community),
+		Subscriptions: make(map[string]map[string]bool),
+	}
+	now := time.Now().UTC()
+	for _, name := range defaultCommunities {
+		repo.Communities[name] = &Community{Name: name, Rules: []string{}, Created: now}
+		repo.Subscriptions[name] = make(map[string]bool)
+	}
+	return repo
+}
+
+// Create заводит сообщество, и создатель сразу же на него подписан
+func (repo *CommunityMemoryRepo) Create(request NewCommunityRequest, username, userID string) (*Community, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	key := strings.ToLower(request.Name)
+	repo.Lock()
+	defer repo.Unlock()
+	if _, ok := repo.Communities[key]; ok {
+		return nil, ErrAlreadyExists
+	}
+	c := &Community{
+		Name:        request.Name,
+		Description: request.Description,
+		Creator:     Creator{Username: username, ID: userID},
+		Rules:       append([]string{}, request.Rules...),
+		Created:     time.Now().UTC(),
+		Subscribers: 1,
+	}
+	repo.Communities[key] = c
+	repo.Subscriptions[key] = map[string]bool{userID: true}
+
+	created := *c
+	created.Subscribed = true
+	return &created, nil
+}
+
+func (repo *CommunityMemoryRepo) Get(name string) (*Community, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	c, ok := repo.Communities[strings.ToLower(name)]
+	if !ok {
+		return nil, ErrNoCommunity
+	}
+	found := *c
+	return &found, nil
+}
+
+func (repo *CommunityMemoryRepo) List() ([]Community, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	communities := make([]Community, 0, len(repo.Communities))
+	for _, c := range repo.Communities {
+		communities = append(communities, *c)
+	}
+	sort.Slice(communities, func(i, j int) bool {
+		if communities[i].Subscribers != communities[j].Subscribers {
+			return communities[i].Subscribers > communities[j].Subscribers
+		}
+		return communities[i].Name < communities[j].Name
+	})
+	return communities, nil
+}
+
+func (repo *CommunityMemoryRepo) Subscribe(name, userID string) (*Community, error) {
+	return repo.setSubscription(name, userID, true)
+}
+
+func (repo *CommunityMemoryRepo) Unsubscribe(name, userID string) (*Community, error) {
+	return repo.setSubscription(name, userID, false)
+}
+
+func (repo *CommunityMemoryRepo) setSubscription(name, userID string, subscribe bool) (*Community, error) {
+	key := strings.ToLower(name)
+	repo.Lock()
+	defer repo.Unlock()
+	c, ok := repo.Communities[key]
+	if !ok {
+		return nil, ErrNoCommunity
+	}
+	subscribers := repo.Subscriptions[key]
+	if subscribers[userID] != subscribe {
+		if subscribe {
+			subscribers[userID] = true
+			c.Subscribers++
+		} else {
+			delete(subscribers, userID)
+			c.Subscribers--
+		}
+	}
+	updated := *c
+	updated.Subscribed = subscribe
+	return &updated, nil
+}
+
+func (repo *CommunityMemoryRepo) UserSubscriptions(userID string) ([]string, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	names := make([]string, 0)
+	for key, subscribers := range repo.Subscriptions {
+		if subscribers[userID] {
+			names = append(names, repo.Communities[key].Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,165 @@
+package feed
+
+import (
+	"redditclone/pkg/community"
+	"redditclone/pkg/follow"
+	"redditclone/pkg/post"
+	"redditclone/pkg/ranking"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// с такого количества подписок лента читается из готового таймлайна, а не фильтром по всем источникам сразу
+	TimelineThreshold = 50
+	// сколько последних постов держим в таймлайне
+	TimelineSize = 1000
+)
+
+// Feed - персональная лента: посты из сообществ, на которые юзер подписан, и от авторов, на которых он подписан
+type Feed interface {
+	// Page - страница ленты. Анонимам и тем, у кого подписок нет, отдается общая лента
+	Page(userID string, query post.ListQuery) (*post.PostsPage, error)
+	// Publish раскладывает новый пост по таймлайнам
+	Publish(p *post.Post)
+	// SourcesChanged - юзер подписался или отписался, его таймлайн больше не годится
+	SourcesChanged(userID string)
+}
+
+// Sources - откуда юзеру идут посты
+type Sources struct {
+	Communities []string
+	Authors     []string
+}
+
+func (s Sources) Len() int {
+	return len(s.Communities) + len(s.Authors)
+}
+
+// Timeline - fan-out-on-write для тех, у кого подписок много: новые посты раскладываются по таймлайнам
+// при публикации, и лента потом читается по готовому списку id, а не $in по сотням источников
+type Timeline interface {
+	// Posts - id постов таймлайна от новых к старым. ok = false - таймлайна нет, его надо собрать
+	Posts(userID string) (ids []string, ok bool, err error)
+	// Build сохраняет собранный таймлайн и запоминает источники юзера, чтобы Publish знал, кому раскладывать
+	Build(userID string, sources Sources, posts []post.Post) error
+	Publish(p *post.Post) error
+	Drop(userID string) error
+}
+
+// Service собирает ленту на чтении из PostRepo (fan-out-on-read). Если задан Timeline,
+// то тем, у кого подписок не меньше TimelineThreshold, лента идет из него
+type Service struct {
+	posts       post.PostRepo
+	communities community.CommunityRepo
+	follows     follow.FollowRepo
+	timeline    Timeline
+	logger      *zap.SugaredLogger
+}
+
+func NewService(posts post.PostRepo, communities community.CommunityRepo, follows follow.FollowRepo, timeline Timeline, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		posts:       posts,
+		communities: communities,
+		follows:     follows,
+		timeline:    timeline,
+		logger:      logger,
+	}
+}
+
+func (s *Service) sources(userID string) (Sources, error) {
+	var sources Sources
+	var err error
+	if sources.Communities, err = s.communities.UserSubscriptions(userID); err != nil {
+		return sources, err
+	}
+	if sources.Authors, err = s.follows.Following(userID); err != nil {
+		return sources, err
+	}
+	return sources, nil
+}
+
+func (s *Service) Page(userID string, query post.ListQuery) (*post.PostsPage, error) {
+	if userID == "" {
+		return s.posts.ListPosts(query)
+	}
+	sources, err := s.sources(userID)
+	if err != nil {
+		return nil, err
+	}
+	if sources.Len() == 0 {
+		return s.posts.ListPosts(query)
+	}
+
+	if s.timeline != nil && sources.Len() >= TimelineThreshold {
+		ids, err := s.timelinePosts(userID, sources)
+		if err == nil {
+			if len(ids) == 0 {
+				return &post.PostsPage{Posts: []post.Post{}}, nil
+			}
+			query.IDs = ids
+			return s.posts.ListPosts(query)
+		}
+		// таймлайн - только кеш, без него лента просто собирается подольше
+		s.logger.Errorf("Error reading timeline of %s: %v", userID, err)
+	}
+
+	query.Feed = &post.FeedFilter{Categories: sources.Communities, Authors: sources.Authors}
+	return s.posts.ListPosts(query)
+}
+
+// timelinePosts достает таймлайн, а если его нет - собирает из последних TimelineSize постов источников
+func (s *Service) timelinePosts(userID string, sources Sources) ([]string, error) {
+	ids, ok, err := s.timeline.Posts(userID)
+	if err != nil || ok {
+		return ids, err
+	}
+
+	posts := make([]post.Post, 0, TimelineSize)
+	query := post.ListQuery{
+		Feed:  &post.FeedFilter{Categories: sources.Communities, Authors: sources.Authors},
+		Sort:  ranking.SortNew,
+		Limit: post.MaxPageLimit,
+	}
+	for len(posts) < TimelineSize {
+		page, err := s.posts.ListPosts(query)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, page.Posts...)
+		if page.After == "" {
+			break
+		}
+		query.After = page.After
+	}
+	if len(posts) > TimelineSize {
+		posts = posts[:TimelineSize]
+	}
+	if err = s.timeline.Build(userID, sources, posts); err != nil {
+		return nil, err
+	}
+
+	ids = make([]string, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
+
+func (s *Service) Publish(p *post.Post) {
+	if s.timeline == nil {
+		return
+	}
+	if err := s.timeline.Publish(p); err != nil {
+		s.logger.Errorf("Error publishing post %s to timelines: %v", p.ID, err)
+	}
+}
+
+func (s *Service) SourcesChanged(userID string) {
+	if s.timeline == nil {
+		return
+	}
+	if err := s.timeline.Drop(userID); err != nil {
+		s.logger.Errorf("Error dropping timeline of %s: %v", userID, err)
+	}
+}
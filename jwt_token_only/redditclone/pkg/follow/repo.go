@@ -0,0 +1,59 @@
+package follow
+
+import (
+	"redditclone/pkg/user"
+	"sort"
+	"sync"
+)
+
+type FollowMemoryRepo struct {
+	sync.RWMutex
+	users *user.UserMemoryRepo
+	// followerID -> username -> true
+	Follows map[string]map[string]bool
+}
+
+func NewMemoryRepo(users *user.UserMemoryRepo) *FollowMemoryRepo {
+	return &FollowMemoryRepo{
+		users:   users,
+		Follows: make(map[string]map[string]bool),
+	}
+}
+
+func (repo *FollowMemoryRepo) Follow(followerID, username string) error {
+	repo.users.RLock()
+	u, ok := repo.users.Users[username]
+	repo.users.RUnlock()
+	if !ok {
+		return ErrNoUser
+	}
+	if u.ID == followerID {
+		return ErrSelfFollow
+	}
+
+	repo.Lock()
+	defer repo.Unlock()
+	if repo.Follows[followerID] == nil {
+		repo.Follows[followerID] = make(map[string]bool)
+	}
+	repo.Follows[followerID][username] = true
+	return nil
+}
+
+func (repo *FollowMemoryRepo) Unfollow(followerID, username string) error {
+	repo.Lock()
+	defer repo.Unlock()
+	delete(repo.Follows[followerID], username)
+	return nil
+}
+
+func (repo *FollowMemoryRepo) Following(followerID string) ([]string, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	usernames := make([]string, 0, len(repo.Follows[followerID]))
+	for username := range repo.Follows[followerID] {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/post"
+	"redditclone/pkg/role"
+	"redditclone/pkg/utils"
+	"strconv"
+	"time"
+)
+
+// clientIP - адрес клиента без порта
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// recordAudit дописывает событие в журнал. Само действие к этому моменту уже выполнено,
+// так что ошибку журнала только логируем
+func recordAudit(repo audit.AuditRepo, logger *zap.SugaredLogger, r *http.Request, event audit.Event) {
+	event.IP = clientIP(r)
+	if err := repo.Record(event); err != nil {
+		logger.Errorf("failed to record audit event %s on %s: %v", event.Action, event.Target, err)
+	}
+}
+
+// contentSnapshot - пост или, если commentID не пустой, один его коммент.
+// Пост кладем без комментов: у каждого коммента в журнале свои события
+func contentSnapshot(p post.Post, commentID string) json.RawMessage {
+	if commentID == "" {
+		p.Comments = nil
+		return audit.Snapshot(p)
+	}
+	if comment, ok := p.FindComment(commentID); ok {
+		return audit.Snapshot(comment)
+	}
+	return nil
+}
+
+type AuditHandler struct {
+	Audit  audit.AuditRepo
+	Roles  role.RoleRepo
+	Logger *zap.SugaredLogger
+}
+
+func parseAuditQuery(r *http.Request) (audit.Query, error) {
+	values := r.URL.Query()
+	query := audit.Query{Actor: values.Get("actor"), Target: values.Get("target")}
+	var err error
+	if from := values.Get("from"); from != "" {
+		if query.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return query, errors.New("bad from")
+		}
+	}
+	if to := values.Get("to"); to != "" {
+		if query.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return query, errors.New("bad to")
+		}
+	}
+	if limit := values.Get(paramLimit); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, audit.ErrBadLimit
+		}
+	}
+	return query, query.Validate()
+}
+
+// AuditLog - GET /api/audit?actor=&target=&from=&to=&limit=, время в RFC3339.
+// Админ видит весь журнал, модератор - только события своих сообществ
+func (h *AuditHandler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	_, userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	roles, ok := requireModerator(w, h.Roles, h.Logger, userID, "only moderators can see audit log")
+	if !ok {
+		return
+	}
+
+	query, err := parseAuditQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	query.All = roles.Admin
+	query.Communities = roles.Moderates
+	events, err := h.Audit.Query(query)
+	if err != nil {
+		h.Logger.Errorf("failed to query audit log: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/post"
+	"redditclone/pkg/role"
+	"redditclone/pkg/utils"
+	"time"
+)
+
+// loadRoles - роли юзера для проверок прав, см. role.Roles. ok = false - ответ уже записан
+func loadRoles(w http.ResponseWriter, roles role.RoleRepo, logger *zap.SugaredLogger, userID string) (*role.Roles, bool) {
+	userRoles, err := roles.Roles(userID)
+	if err != nil {
+		logger.Errorf("failed to get roles of %s: %v", userID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		return nil, false
+	}
+	return userRoles, true
+}
+
+// requireModerator - роли юзера, если он модерирует хоть что-то, см. role.Roles.IsModerator.
+// Остальным 403 с текстом forbidden. ok = false - ответ уже записан
+func requireModerator(w http.ResponseWriter, roles role.RoleRepo, logger *zap.SugaredLogger, userID, forbidden string) (*role.Roles, bool) {
+	userRoles, ok := loadRoles(w, roles, logger, userID)
+	if !ok {
+		return nil, false
+	}
+	if !userRoles.IsModerator() {
+		utils.WriteJSON(w, http.StatusForbidden, map[string]interface{}{"message": forbidden})
+		return nil, false
+	}
+	return userRoles, true
+}
+
+type removalRequest struct {
+	Reason string `json:"reason"`
+}
+
+// moderatorRemoval проверяет, что текущий юзер может модерировать категорию поста, и собирает Removal.
+// Пост до удаления отдаем для журнала. ok = false - ответ уже записан
+func (h *PostHandler) moderatorRemoval(w http.ResponseWriter, r *http.Request, postID string) (p post.Post, removal post.Removal, moderatorID string, ok bool) {
+	username, userID, ok := sessionUser(w, r)
+	if !ok {
+		return p, removal, "", false
+	}
+
+	var req removalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		return p, removal, "", false
+	}
+	removal, err := post.NewRemoval(username, req.Reason, time.Now().UTC())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return p, removal, "", false
+	}
+
+	p, err = h.PostRepo.GetPost(postID)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		return p, removal, "", false
+	}
+	roles, ok := loadRoles(w, h.Roles, h.Logger, userID)
+	if !ok {
+		return p, removal, "", false
+	}
+	if !roles.CanModerate(p.Category) {
+		utils.WriteJSON(w, http.StatusForbidden, map[string]interface{}{"message": "only moderators can remove content"})
+		return p, removal, "", false
+	}
+	return p, removal, userID, true
+}
+
+func (h *PostHandler) writeRemoveError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, post.ErrPostNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+	case errors.Is(err, post.ErrCommentNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "comment not found"})
+	case errors.Is(err, post.ErrRemoved):
+		utils.WriteJSON(w, http.StatusConflict, map[string]interface{}{"message": "already removed"})
+	default:
+		h.Logger.Errorf("failed to remove content: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+	}
+}
+
+// RemovePost - POST /api/post/{post_id}/remove: {"reason"}, только для модераторов категории и админов
+func (h *PostHandler) RemovePost(w http.ResponseWriter, r *http.Request) {
+	postID := mux.Vars(r)[paramPostID]
+	before, removal, moderatorID, ok := h.moderatorRemoval(w, r, postID)
+	if !ok {
+		return
+	}
+	removedPost, err := h.PostRepo.RemovePost(postID, removal)
+	if err != nil {
+		h.writeRemoveError(w, err)
+		return
+	}
+	deleteMedia(r.Context(), h.Media, h.Logger, before.Media)
+	event := audit.NewEvent(audit.ActionPostRemove, removal.Moderator, moderatorID, audit.PostTarget(postID), removal.Created)
+	event.Category = before.Category
+	event.Before = contentSnapshot(before, "")
+	event.After = contentSnapshot(*removedPost, "")
+	recordAudit(h.Audit, h.Logger, r, event)
+	h.fillPostVotes(r, removedPost)
+	utils.WriteJSON(w, http.StatusOK, removedPost)
+	h.Logger.Infof("Post %s removed by moderator %s: %s", postID, removal.Moderator, removal.Reason)
+}
+
+// RemoveComment - POST /api/post/{post_id}/{comment_id}/remove: {"reason"}
+func (h *PostHandler) RemoveComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	postID := vars[paramPostID]
+	commentID := vars[paramCommentID]
+	before, removal, moderatorID, ok := h.moderatorRemoval(w, r, postID)
+	if !ok {
+		return
+	}
+	removedPost, err := h.PostRepo.RemoveComment(postID, commentID, removal)
+	if err != nil {
+		h.writeRemoveError(w, err)
+		return
+	}
+	event := audit.NewEvent(audit.ActionCommentRemove, removal.Moderator, moderatorID, audit.CommentTarget(postID, commentID), removal.Created)
+	event.Category = before.Category
+	event.Before = contentSnapshot(before, commentID)
+	event.After = contentSnapshot(*removedPost, commentID)
+	recordAudit(h.Audit, h.Logger, r, event)
+	h.fillPostVotes(r, removedPost)
+	utils.WriteJSON(w, http.StatusOK, removedPost)
+	h.Logger.Infof("Comment %s of post %s removed by moderator %s: %s", commentID, postID, removal.Moderator, removal.Reason)
+}
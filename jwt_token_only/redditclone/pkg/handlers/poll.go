@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"redditclone/pkg/post"
+	"redditclone/pkg/utils"
+	"strings"
+	"time"
+)
+
+type pollVoteRequest struct {
+	// номера вариантов с нуля, больше одного - только в опросах с multiple
+	Choices []int `json:"choices"`
+}
+
+// fillPolls открывает результаты опросов тем, кто уже проголосовал, и всем - после закрытия. userID пустой - аноним
+func fillPolls(userID string, posts ...*post.Post) {
+	now := time.Now().UTC()
+	for _, p := range posts {
+		if p.Poll != nil {
+			p.Poll.View(p.Poll.ChoicesOf(userID), now)
+		}
+	}
+}
+
+// postBody - текст поста для автомодератора: у опроса это еще и варианты
+func postBody(request post.NewPostRequest) string {
+	if request.Type != "poll" || request.Poll == nil {
+		return request.Text
+	}
+	return strings.Join(append([]string{request.Text}, request.Poll.Options...), "\n")
+}
+
+// VotePoll - POST /api/post/{post_id}/poll. К апвоутам поста отношения не имеет, переголосовать нельзя
+func (h *PostHandler) VotePoll(w http.ResponseWriter, r *http.Request) {
+	_, userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	postID := mux.Vars(r)[paramPostID]
+	var request pollVoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		return
+	}
+	if !h.checkBan(w, userID, postID, "") {
+		return
+	}
+
+	votedPost, err := h.PostRepo.VotePoll(postID, userID, request.Choices)
+	switch {
+	case errors.Is(err, post.ErrPostNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		return
+	case errors.Is(err, post.ErrNotPoll), errors.Is(err, post.ErrBadBallot):
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	case errors.Is(err, post.ErrPollClosed), errors.Is(err, post.ErrRemoved):
+		utils.WriteJSON(w, http.StatusForbidden, map[string]interface{}{"message": err.Error()})
+		return
+	case errors.Is(err, post.ErrAlreadyVoted):
+		utils.WriteJSON(w, http.StatusConflict, map[string]interface{}{"message": err.Error()})
+		return
+	case err != nil:
+		h.Logger.Errorf("failed to vote poll of post %s: %v", postID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error voting poll"})
+		return
+	}
+	if !h.visiblePost(w, r, votedPost) {
+		return
+	}
+	h.fillPostVotes(r, votedPost)
+	utils.WriteJSON(w, http.StatusOK, votedPost)
+	h.Logger.Infof("Voted poll by %s, %s, %v", userID, postID, request.Choices)
+}
@@ -6,55 +6,243 @@ import (
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"net/http"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/automod"
+	"redditclone/pkg/ban"
+	"redditclone/pkg/community"
+	"redditclone/pkg/feed"
+	"redditclone/pkg/media"
+	"redditclone/pkg/notification"
 	"redditclone/pkg/post"
+	"redditclone/pkg/preview"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/report"
+	"redditclone/pkg/role"
 	"redditclone/pkg/session"
+	"redditclone/pkg/user"
 	"redditclone/pkg/utils"
+	"redditclone/pkg/views"
+	"redditclone/pkg/vote"
+	"strconv"
+	"time"
 )
 
 const (
+	paramLimit         = "limit"
+	paramAfter         = "after"
+	paramBefore        = "before"
+	paramSort          = "sort"
+	paramPeriod        = "t"
 	paramCategory      = "category"
 	paramPostID        = "post_id"
-	paramUser          = "user"
-	paramID            = "id"
+	paramCommentID     = "comment_id"
+	paramDepth         = "depth"
 	paramUsername      = "username"
 	paramUpvoteScore   = 1
 	paramUnvoteScore   = 0
 	paramDownvoteScore = -1
 )
 
+var (
+	errBadPageParams = errors.New("bad pagination params")
+	errBadDepth      = errors.New("bad depth")
+)
+
+// Сессию хендлеры берут из контекста - ее туда кладет middleware.Auth, см. configureRoutes
 type PostHandler struct {
-	PostRepo post.PostRepo
-	Logger   *zap.SugaredLogger
-	Sessions *session.SessionsManager
+	PostRepo    post.PostRepo
+	VoteRepo    vote.VoteRepo
+	Communities community.CommunityRepo
+	Feed        feed.Feed
+	Roles       role.RoleRepo
+	Bans        ban.BanRepo
+	Views       views.Counter
+	Audit       audit.AuditRepo
+	// Automod nil - правил нет. Users и Reports нужны ему: возраст аккаунта и очередь для придержанного
+	Automod *automod.Engine
+	Users   user.UserRepo
+	Reports report.ReportRepo
+	// Previews грузит карточки ссылок в фоне, nil - без превью
+	Previews preview.Queue
+	// Media - файлы image-постов, nil - загрузка картинок выключена
+	Media media.BlobStore
+	// Notifications рассылает уведомления в фоне, nil - уведомления выключены
+	Notifications notification.Queue
+	Logger        *zap.SugaredLogger
 }
 
-func (h *PostHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
-	posts := h.PostRepo.GetPosts()
-	utils.WriteJSON(w, http.StatusOK, posts)
+// fillUserVotes проставляет постам голос текущего юзера и открывает ему результаты опросов, см. fillPolls.
+// Анонимам и при ошибке оставляем 0 - из-за этого ленту отдавать не перестаем
+func (h *PostHandler) fillUserVotes(r *http.Request, posts ...*post.Post) {
+	var userID string
+	if currentSession, err := session.SessionFromContext(r.Context()); err == nil {
+		userID = currentSession.UserID
+	}
+	fillPolls(userID, posts...)
+	if userID == "" || len(posts) == 0 {
+		return
+	}
+	postIDs := make([]string, 0, len(posts))
+	for _, p := range posts {
+		postIDs = append(postIDs, p.ID)
+	}
+	votes, err := h.VoteRepo.UserVotes(userID, postIDs)
+	if err != nil {
+		h.Logger.Errorf("failed to get votes of %s: %v", userID, err)
+		return
+	}
+	for _, p := range posts {
+		p.Vote = votes[p.ID]
+	}
 }
 
-func (h *PostHandler) ListPostsByCategory(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	category := vars[paramCategory]
-	posts := h.PostRepo.GetPostsByCategory(category)
-	utils.WriteJSON(w, http.StatusOK, posts)
+// fillPostVotes - для выдачи одного поста: голос юзера и за сам пост, и за каждый его коммент
+func (h *PostHandler) fillPostVotes(r *http.Request, p *post.Post) {
+	h.fillUserVotes(r, p)
+	h.fillCommentVotes(r, p.ID, p.Comments)
 }
 
-func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
-	userData, err := utils.GetClaimsByKey(r, paramUser)
+func (h *PostHandler) fillCommentVotes(r *http.Request, postID string, comments []post.Comment) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil || len(comments) == 0 {
+		return
+	}
+	userID := currentSession.UserID
+	votes, err := h.VoteRepo.UserCommentVotes(userID, postID)
+	if err != nil {
+		h.Logger.Errorf("failed to get comment votes of %s: %v", userID, err)
+		return
+	}
+	setCommentVotes(comments, votes)
+}
+
+func setCommentVotes(comments []post.Comment, votes map[string]int) {
+	for i := range comments {
+		comments[i].Vote = votes[comments[i].ID]
+		setCommentVotes(comments[i].Replies, votes)
+	}
+}
+
+func postPointers(posts []post.Post) []*post.Post {
+	pointers := make([]*post.Post, 0, len(posts))
+	for i := range posts {
+		pointers = append(pointers, &posts[i])
+	}
+	return pointers
+}
+
+// parseListQuery разбирает ?limit=&after=&before=&sort=&t=. paged = false, если ничего из этого не передали -
+// тогда отдаем ленту целиком голым массивом, как ждет фронт
+func parseListQuery(r *http.Request) (query post.ListQuery, paged bool, err error) {
+	values := r.URL.Query()
+	if query.Sort, err = ranking.ParseSort(values.Get(paramSort)); err != nil {
+		return query, true, err
+	}
+	if query.Period, err = ranking.ParsePeriod(values.Get(paramPeriod)); err != nil {
+		return query, true, err
+	}
+	query.After = values.Get(paramAfter)
+	query.Before = values.Get(paramBefore)
+	if query.After != "" && query.Before != "" {
+		return query, true, errBadPageParams
+	}
+
+	if limit := values.Get(paramLimit); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 || query.Limit > post.MaxPageLimit {
+			return query, true, errBadPageParams
+		}
+	}
 
+	paged = values.Has(paramLimit) || values.Has(paramSort) || values.Has(paramPeriod) ||
+		query.After != "" || query.Before != ""
+	return query, paged, nil
+}
+
+// parseDepth - ?depth= для дерева комментов, ok = false, если параметра нет
+func parseDepth(r *http.Request) (depth int, ok bool, err error) {
+	values := r.URL.Query()
+	if !values.Has(paramDepth) {
+		return post.DefaultCommentDepth, false, nil
+	}
+	depth, err = strconv.Atoi(values.Get(paramDepth))
+	if err != nil || depth <= 0 || depth > post.MaxCommentDepth {
+		return 0, true, errBadDepth
+	}
+	return depth, true, nil
+}
+
+func (h *PostHandler) writePostsPage(w http.ResponseWriter, r *http.Request, query post.ListQuery) {
+	page, err := h.PostRepo.ListPosts(query)
+	h.writePage(w, r, page, err)
+}
+
+func (h *PostHandler) writePage(w http.ResponseWriter, r *http.Request, page *post.PostsPage, err error) {
 	if err != nil {
-		if errors.Is(err, utils.ErrUnauthorized) {
-			utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		if errors.Is(err, post.ErrBadCursor) {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "bad cursor"})
+			return
 		}
+		h.Logger.Errorf("failed to list posts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error listing posts"})
+		return
+	}
+	page.Posts = h.hideShadowbanned(r, page.Posts)
+	h.fillUserVotes(r, postPointers(page.Posts)...)
+	utils.WriteJSON(w, http.StatusOK, page)
+}
+
+func (h *PostHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
+	query, paged, err := parseListQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	if paged {
+		h.writePostsPage(w, r, query)
 		return
 	}
+	posts := h.hideShadowbannedPointers(r, h.PostRepo.GetPosts())
+	h.fillUserVotes(r, posts...)
+	utils.WriteJSON(w, http.StatusOK, posts)
+}
+
+// HomeFeed - GET /api/feed, всегда страницей. Аноним получает общую ленту
+func (h *PostHandler) HomeFeed(w http.ResponseWriter, r *http.Request) {
+	query, _, err := parseListQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	var userID string
+	if currentSession, err := session.SessionFromContext(r.Context()); err == nil {
+		userID = currentSession.UserID
+	}
+	page, err := h.Feed.Page(userID, query)
+	h.writePage(w, r, page, err)
+}
 
-	username, ok1 := userData[paramUsername].(string)
-	userID, ok2 := userData[paramID].(string)
+func (h *PostHandler) ListPostsByCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	category := vars[paramCategory]
+	query, paged, err := parseListQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	if paged {
+		query.Category = category
+		h.writePostsPage(w, r, query)
+		return
+	}
+	posts := h.hideShadowbanned(r, h.PostRepo.GetPostsByCategory(category))
+	h.fillUserVotes(r, postPointers(posts)...)
+	utils.WriteJSON(w, http.StatusOK, posts)
+}
 
-	if !ok1 || !ok2 || username == "" || userID == "" {
-		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
+	username, userID, ok := sessionUser(w, r)
+	if !ok {
 		return
 	}
 
@@ -65,19 +253,102 @@ func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		h.Logger.Errorf("ERROR with json decoding: %v", errDecoder)
 		return
 	}
+	if request.Type == "image" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "image posts are uploaded as multipart to /api/posts/image"})
+		return
+	}
+	if request.Type == "poll" {
+		if err := request.Poll.Validate(time.Now().UTC()); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+			return
+		}
+	}
+	h.createPost(w, r, username, userID, request, nil)
+}
+
+// createPost - общая часть CreatePost и CreateImagePost. img сохраняется только после всех проверок,
+// чтобы от отклоненных постов не оставались файлы
+func (h *PostHandler) createPost(w http.ResponseWriter, r *http.Request, username, userID string, request post.NewPostRequest, img *media.Image) {
+	// категория - это сообщество, и постить можно только в существующее, под его каноничным именем
+	target, err := h.Communities.Get(request.Category)
+	if err != nil {
+		if errors.Is(err, community.ErrNoCommunity) {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "community not found"})
+			return
+		}
+		h.Logger.Errorf("failed to get community %s: %v", request.Category, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error creating post"})
+		return
+	}
+	request.Category = target.Name
+	if !h.checkBan(w, userID, "", target.Name) {
+		return
+	}
+	if !h.checkDuplicate(w, r, request) {
+		return
+	}
+	verdict, ok := h.automodVerdict(w, automod.Subject{
+		Kind:     automod.KindPost,
+		Category: request.Category,
+		Title:    request.Title,
+		Body:     postBody(request),
+		URL:      request.URL,
+	}, userID)
+	if !ok {
+		return
+	}
+	request.Flair = verdict.Flair
+	// убранному автомодератором посту картинка не нужна
+	if img != nil && verdict.Action != automod.ActionRemove {
+		id, err := utils.GenerateID()
+		if err == nil {
+			request.Media, err = media.Save(r.Context(), h.Media, id, img)
+		}
+		if err != nil {
+			h.Logger.Errorf("failed to save upload by %s: %v", username, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error creating post"})
+			return
+		}
+	}
 	newPost, err := h.PostRepo.CreatePost(request, username, userID)
 	if err != nil {
+		deleteMedia(r.Context(), h.Media, h.Logger, request.Media)
 		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error creating post"})
 		return
 	}
+	if _, err = h.VoteRepo.SetVote(newPost.ID, userID, 1); err != nil {
+		h.Logger.Errorf("failed to save author vote for post %s: %v", newPost.ID, err)
+	}
+	newPost = h.applyAutomod(r, newPost, "", verdict)
+	// убранное и придержанное подписчикам не рассылаем
+	if newPost.Removed == nil && !newPost.Hidden {
+		h.Feed.Publish(newPost)
+		h.notifyPost(newPost, username, userID)
+	}
+	if newPost.Type == "link" && newPost.Removed == nil && h.Previews != nil {
+		h.Previews.Enqueue(newPost.ID, newPost.URL)
+	}
+	newPost.Vote = 1
 	utils.WriteJSON(w, http.StatusCreated, *newPost)
 
 	h.Logger.Infof("created post by %s: %v", username, *newPost)
 }
 
+// GetPost - без ?depth= комменты плоским списком, как ждет фронт, с ним - деревом.
+// ?sort= упорядочивает комменты, без него - в порядке добавления
 func (h *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars[paramPostID]
+	depth, threaded, err := parseDepth(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	commentSort, err := ranking.ParseCommentSort(r.URL.Query().Get(paramSort))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
 	postByID, err := h.PostRepo.GetPost(id)
 	if err != nil {
 		if errors.Is(err, post.ErrPostNotFound) {
@@ -85,24 +356,41 @@ func (h *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if !h.visiblePost(w, r, &postByID) {
+		return
+	}
+	h.recordView(r, &postByID)
+	h.fillPostVotes(r, &postByID)
+	if r.URL.Query().Has(paramSort) {
+		post.SortComments(postByID.Comments, commentSort)
+	}
+	if threaded {
+		postByID.Comments = post.CommentTree(postByID.Comments, "", depth)
+	}
 	utils.WriteJSON(w, http.StatusOK, postByID)
 }
 
-func (h *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
-	userData, err := utils.GetClaimsByKey(r, paramUser)
-
+// recordView засчитывает просмотр и добавляет к Views то, что счетчик еще не сбросил в пост.
+// Залогиненных различаем по юзеру, анонимов - по IP
+func (h *PostHandler) recordView(r *http.Request, p *post.Post) {
+	pending, err := h.Views.Record(p.ID, viewerKey(r))
 	if err != nil {
-		if errors.Is(err, utils.ErrUnauthorized) {
-			utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
-		}
+		h.Logger.Errorf("failed to record view of post %s: %v", p.ID, err)
 		return
 	}
+	p.Views += pending
+}
 
-	username, ok1 := userData[paramUsername].(string)
-	userID, ok2 := userData[paramID].(string)
+func viewerKey(r *http.Request) string {
+	if currentSession, err := session.SessionFromContext(r.Context()); err == nil {
+		return "user:" + currentSession.UserID
+	}
+	return "ip:" + clientIP(r)
+}
 
-	if !ok1 || !ok2 || username == "" || userID == "" {
-		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+func (h *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
+	username, userID, ok := sessionUser(w, r)
+	if !ok {
 		return
 	}
 
@@ -112,48 +400,137 @@ func (h *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Comment string `json:"comment"`
 	}
-	if err = json.NewDecoder(r.Body).Decode(&req); err != nil || req.Comment == "" {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Comment == "" {
 		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
 		h.Logger.Errorf("ERROR with json decoding: %v", err)
 		return
 	}
+	if !h.checkBan(w, userID, id, "") {
+		return
+	}
+	verdict, ok := h.automodComment(w, id, userID, req.Comment)
+	if !ok {
+		return
+	}
 	commentedPost, err := h.PostRepo.AddComment(id, username, userID, req.Comment)
 	if err != nil {
-		if errors.Is(err, post.ErrPostNotFound) {
+		switch {
+		case errors.Is(err, post.ErrPostNotFound):
 			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
-		}
-		if errors.Is(err, utils.ErrGenerateID) {
+		default:
+			h.Logger.Errorf("failed to comment post %s: %v", id, err)
 			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error creating comment"})
 		}
 		return
 	}
+	commentID := lastCommentID(commentedPost)
+	commentedPost = h.applyAutomod(r, commentedPost, commentID, verdict)
+	h.notifyComment(commentedPost, commentID, username, userID)
+	if !h.visiblePost(w, r, commentedPost) {
+		return
+	}
+	h.fillPostVotes(r, commentedPost)
 	utils.WriteJSON(w, http.StatusCreated, *commentedPost)
 	h.Logger.Infof("commented post by %s: %s", username, req.Comment)
 }
 
-func (h *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
-	userData, err := utils.GetClaimsByKey(r, paramUser)
+func (h *PostHandler) AddReply(w http.ResponseWriter, r *http.Request) {
+	username, userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
 
+	vars := mux.Vars(r)
+	postID := vars[paramPostID]
+	parentID := vars[paramCommentID]
+
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Comment == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		h.Logger.Errorf("ERROR with json decoding: %v", err)
+		return
+	}
+	if !h.checkBan(w, userID, postID, "") {
+		return
+	}
+	verdict, ok := h.automodComment(w, postID, userID, req.Comment)
+	if !ok {
+		return
+	}
+	repliedPost, err := h.PostRepo.AddReply(postID, parentID, username, userID, req.Comment)
 	if err != nil {
-		if errors.Is(err, utils.ErrUnauthorized) {
-			utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		switch {
+		case errors.Is(err, post.ErrPostNotFound):
+			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		case errors.Is(err, post.ErrCommentNotFound):
+			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "comment not found"})
+		default:
+			h.Logger.Errorf("failed to reply to comment %s: %v", parentID, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error creating comment"})
 		}
 		return
 	}
+	commentID := lastCommentID(repliedPost)
+	repliedPost = h.applyAutomod(r, repliedPost, commentID, verdict)
+	h.notifyComment(repliedPost, commentID, username, userID)
+	if !h.visiblePost(w, r, repliedPost) {
+		return
+	}
+	h.fillPostVotes(r, repliedPost)
+	utils.WriteJSON(w, http.StatusCreated, *repliedPost)
+	h.Logger.Infof("replied to comment %s by %s: %s", parentID, username, req.Comment)
+}
 
-	username, ok1 := userData[paramUsername].(string)
-	userID, ok2 := userData[paramID].(string)
+// CommentReplies - догрузка ветки, которая не влезла в ?depth= поста
+func (h *PostHandler) CommentReplies(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	postID := vars[paramPostID]
+	commentID := vars[paramCommentID]
+	depth, _, err := parseDepth(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	replies, err := h.PostRepo.GetCommentTree(postID, commentID, depth)
+	if err != nil {
+		switch {
+		case errors.Is(err, post.ErrPostNotFound):
+			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		case errors.Is(err, post.ErrCommentNotFound):
+			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "comment not found"})
+		default:
+			h.Logger.Errorf("failed to get replies to comment %s: %v", commentID, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error getting replies"})
+		}
+		return
+	}
+	shadowbanned, viewerID := h.shadowbanned(r)
+	replies = hideShadowbannedComments(replies, shadowbanned, viewerID)
+	h.fillCommentVotes(r, postID, replies)
+	utils.WriteJSON(w, http.StatusOK, replies)
+}
 
-	if !ok1 || !ok2 || username == "" || userID == "" {
-		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+func (h *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	username, userID, ok := sessionUser(w, r)
+	if !ok {
 		return
 	}
 
 	vars := mux.Vars(r)
 	postID := vars[paramPostID]
-	commentID := vars["comment_id"]
+	commentID := vars[paramCommentID]
 
-	editedPost, err := h.PostRepo.DeleteComment(postID, commentID, userID)
+	roles, ok := loadRoles(w, h.Roles, h.Logger, userID)
+	if !ok {
+		return
+	}
+
+	// снимок для журнала: после удаления тела коммента уже не будет
+	before, _ := h.PostRepo.GetPost(postID)
+	editedPost, err := h.PostRepo.DeleteComment(postID, commentID, role.Actor{UserID: userID, Roles: roles})
 	if err != nil {
 		if errors.Is(err, post.ErrPostNotFound) {
 			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
@@ -167,36 +544,209 @@ func (h *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	event := audit.NewEvent(audit.ActionCommentDelete, username, userID, audit.CommentTarget(postID, commentID), time.Now().UTC())
+	event.Category = editedPost.Category
+	event.Before = contentSnapshot(before, commentID)
+	recordAudit(h.Audit, h.Logger, r, event)
+
+	if !h.visiblePost(w, r, editedPost) {
+		return
+	}
+	h.fillPostVotes(r, editedPost)
 	utils.WriteJSON(w, http.StatusOK, editedPost)
 	h.Logger.Infof("Deleted comment by %s: comment: %s, post: %s", username, commentID, postID)
 }
 
-func (h *PostHandler) votePost(w http.ResponseWriter, r *http.Request, action int) {
-	userData, err := utils.GetClaimsByKey(r, paramUser)
+// EditPost - PUT /api/post/{post_id}: {"title", "text"}, пустое поле не меняется
+func (h *PostHandler) EditPost(w http.ResponseWriter, r *http.Request) {
+	username, userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	postID := vars[paramPostID]
+
+	var req post.EditPostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		h.Logger.Errorf("ERROR with json decoding: %v", err)
+		return
+	}
+	if !h.checkBan(w, userID, postID, "") {
+		return
+	}
+	verdict, ok := h.automodEdit(w, postID, userID, req)
+	if !ok {
+		return
+	}
+	editedPost, err := h.PostRepo.EditPost(postID, role.Actor{UserID: userID}, req)
+	if err != nil {
+		h.writeEditError(w, err)
+		return
+	}
+	editedPost = h.applyAutomod(r, editedPost, "", verdict)
+	if !h.visiblePost(w, r, editedPost) {
+		return
+	}
+	h.fillPostVotes(r, editedPost)
+	utils.WriteJSON(w, http.StatusOK, editedPost)
+	h.Logger.Infof("Edited post by %s: %s", username, postID)
+}
+
+func (h *PostHandler) EditComment(w http.ResponseWriter, r *http.Request) {
+	username, userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	postID := vars[paramPostID]
+	commentID := vars[paramCommentID]
+
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Comment == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		h.Logger.Errorf("ERROR with json decoding: %v", err)
+		return
+	}
+	if !h.checkBan(w, userID, postID, "") {
+		return
+	}
+	verdict, ok := h.automodComment(w, postID, userID, req.Comment)
+	if !ok {
+		return
+	}
+	editedPost, err := h.PostRepo.EditComment(postID, commentID, role.Actor{UserID: userID}, req.Comment)
+	if err != nil {
+		h.writeEditError(w, err)
+		return
+	}
+	editedPost = h.applyAutomod(r, editedPost, commentID, verdict)
+	if !h.visiblePost(w, r, editedPost) {
+		return
+	}
+	h.fillPostVotes(r, editedPost)
+	utils.WriteJSON(w, http.StatusOK, editedPost)
+	h.Logger.Infof("Edited comment by %s: comment: %s, post: %s", username, commentID, postID)
+}
 
+func (h *PostHandler) writeEditError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, post.ErrPostNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+	case errors.Is(err, post.ErrCommentNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "comment not found"})
+	case errors.Is(err, post.ErrUnauthorized):
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]interface{}{"message": "unauthorized"})
+	case errors.Is(err, post.ErrEditWindowClosed), errors.Is(err, post.ErrPollVoted), errors.Is(err, post.ErrRemoved):
+		utils.WriteJSON(w, http.StatusForbidden, map[string]interface{}{"message": err.Error()})
+	case errors.Is(err, post.ErrNothingToEdit), errors.Is(err, post.ErrURLNotEditable):
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+	default:
+		h.Logger.Errorf("failed to edit: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error editing"})
+	}
+}
+
+// PostRevisions - прежние версии поста, от старых к новым
+func (h *PostHandler) PostRevisions(w http.ResponseWriter, r *http.Request) {
+	h.writeRevisions(w, r, mux.Vars(r)[paramPostID], "")
+}
+
+func (h *PostHandler) CommentRevisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	h.writeRevisions(w, r, vars[paramPostID], vars[paramCommentID])
+}
+
+func (h *PostHandler) writeRevisions(w http.ResponseWriter, r *http.Request, postID, commentID string) {
+	if !h.revisionsVisible(w, r, postID, commentID) {
+		return
+	}
+	revisions, err := h.PostRepo.GetRevisions(postID, commentID)
 	if err != nil {
-		if errors.Is(err, utils.ErrUnauthorized) {
-			utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		switch {
+		case errors.Is(err, post.ErrPostNotFound):
+			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		case errors.Is(err, post.ErrCommentNotFound):
+			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "comment not found"})
+		default:
+			h.Logger.Errorf("failed to get revisions of post %s: %v", postID, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error getting revisions"})
 		}
 		return
 	}
+	utils.WriteJSON(w, http.StatusOK, revisions)
+}
 
-	userID, ok := userData[paramID].(string)
-	if !ok || userID == "" {
-		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+// revisionsVisible - прежние версии видны тем же, кому виден сам пост или коммент, см. visiblePost.
+// Пост достаем, только если есть кого прятать. ok = false - ответ уже записан
+func (h *PostHandler) revisionsVisible(w http.ResponseWriter, r *http.Request, postID, commentID string) bool {
+	shadowbanned, viewerID := h.shadowbanned(r)
+	if len(shadowbanned) == 0 {
+		return true
+	}
+	p, err := h.PostRepo.GetPost(postID)
+	switch {
+	case errors.Is(err, post.ErrPostNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		return false
+	case err != nil:
+		h.Logger.Errorf("failed to get post %s: %v", postID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error getting revisions"})
+		return false
+	}
+	if shadowbanned.Hides(p.Author.ID, viewerID) {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		return false
+	}
+	if comment := findComment(&p, commentID); comment != nil && shadowbanned.Hides(comment.Author.ID, viewerID) {
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "comment not found"})
+		return false
+	}
+	return true
+}
+
+func (h *PostHandler) votePost(w http.ResponseWriter, r *http.Request, action int) {
+	_, userID, ok := sessionUser(w, r)
+	if !ok {
 		return
 	}
 
 	vars := mux.Vars(r)
 	postID := vars[paramPostID]
+	if !h.checkBan(w, userID, postID, "") {
+		return
+	}
 
-	votedPost, err := h.PostRepo.VotePost(postID, userID, action)
+	previous, err := h.VoteRepo.SetVote(postID, userID, action)
 	if err != nil {
-		if errors.Is(err, post.ErrPostNotFound) {
+		h.Logger.Errorf("failed to save vote for post %s: %v", postID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error voting post"})
+		return
+	}
+	votedPost, err := h.PostRepo.VotePost(postID, previous, action)
+	if err != nil {
+		// счетчики не обновились - возвращаем старый голос, иначе они разъедутся с хранилищем голосов
+		if _, rollbackErr := h.VoteRepo.SetVote(postID, userID, previous); rollbackErr != nil {
+			h.Logger.Errorf("failed to roll back vote for post %s: %v", postID, rollbackErr)
+		}
+		switch {
+		case errors.Is(err, post.ErrPostNotFound):
 			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		default:
+			h.Logger.Errorf("failed to vote for post %s: %v", postID, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error voting post"})
 		}
 		return
 	}
+	if !h.visiblePost(w, r, votedPost) {
+		return
+	}
+	votedPost.Vote = action
+	fillPolls(userID, votedPost)
 	utils.WriteJSON(w, http.StatusOK, votedPost)
 	h.Logger.Infof("Voted post by %s, %s, %d", userID, postID, action)
 }
@@ -213,26 +763,77 @@ func (h *PostHandler) UnvotePost(w http.ResponseWriter, r *http.Request) {
 	h.votePost(w, r, paramUnvoteScore)
 }
 
-func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
-	userData, err := utils.GetClaimsByKey(r, paramUser)
+func (h *PostHandler) voteComment(w http.ResponseWriter, r *http.Request, action int) {
+	_, userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
 
+	vars := mux.Vars(r)
+	postID := vars[paramPostID]
+	commentID := vars[paramCommentID]
+	if !h.checkBan(w, userID, postID, "") {
+		return
+	}
+
+	previous, err := h.VoteRepo.SetCommentVote(postID, commentID, userID, action)
 	if err != nil {
-		if errors.Is(err, utils.ErrUnauthorized) {
-			utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		h.Logger.Errorf("failed to save vote for comment %s: %v", commentID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error voting comment"})
+		return
+	}
+	votedPost, err := h.PostRepo.VoteComment(postID, commentID, previous, action)
+	if err != nil {
+		if _, rollbackErr := h.VoteRepo.SetCommentVote(postID, commentID, userID, previous); rollbackErr != nil {
+			h.Logger.Errorf("failed to roll back vote for comment %s: %v", commentID, rollbackErr)
+		}
+		switch {
+		case errors.Is(err, post.ErrPostNotFound):
+			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+		case errors.Is(err, post.ErrCommentNotFound):
+			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "comment not found"})
+		default:
+			h.Logger.Errorf("failed to vote for comment %s: %v", commentID, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error voting comment"})
 		}
 		return
 	}
+	if !h.visiblePost(w, r, votedPost) {
+		return
+	}
+	h.fillPostVotes(r, votedPost)
+	utils.WriteJSON(w, http.StatusOK, votedPost)
+	h.Logger.Infof("Voted comment by %s, %s, %d", userID, commentID, action)
+}
+
+func (h *PostHandler) UpvoteComment(w http.ResponseWriter, r *http.Request) {
+	h.voteComment(w, r, paramUpvoteScore)
+}
+
+func (h *PostHandler) DownvoteComment(w http.ResponseWriter, r *http.Request) {
+	h.voteComment(w, r, paramDownvoteScore)
+}
 
-	userID, ok := userData[paramID].(string)
-	if !ok || userID == "" {
-		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+func (h *PostHandler) UnvoteComment(w http.ResponseWriter, r *http.Request) {
+	h.voteComment(w, r, paramUnvoteScore)
+}
+
+func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
+	username, userID, ok := sessionUser(w, r)
+	if !ok {
 		return
 	}
 
 	vars := mux.Vars(r)
 	postID := vars[paramPostID]
 
-	isPostRemoved, err := h.PostRepo.DeletePost(postID, userID)
+	roles, ok := loadRoles(w, h.Roles, h.Logger, userID)
+	if !ok {
+		return
+	}
+
+	before, _ := h.PostRepo.GetPost(postID)
+	isPostRemoved, err := h.PostRepo.DeletePost(postID, role.Actor{UserID: userID, Roles: roles})
 
 	if err != nil {
 		if errors.Is(err, post.ErrPostNotFound) {
@@ -245,6 +846,14 @@ func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if isPostRemoved {
+		if err = h.VoteRepo.DeletePostVotes(postID); err != nil {
+			h.Logger.Errorf("failed to delete votes of post %s: %v", postID, err)
+		}
+		deleteMedia(r.Context(), h.Media, h.Logger, before.Media)
+		event := audit.NewEvent(audit.ActionPostDelete, username, userID, audit.PostTarget(postID), time.Now().UTC())
+		event.Category = before.Category
+		event.Before = contentSnapshot(before, "")
+		recordAudit(h.Audit, h.Logger, r, event)
 		utils.WriteJSON(w, http.StatusNoContent, map[string]string{"message": "success"})
 		h.Logger.Infof("Deleted post by %s: post: %s", userID, postID)
 	} else {
@@ -255,8 +864,19 @@ func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 func (h *PostHandler) PostsByUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	username := vars[paramUsername]
+	query, paged, err := parseListQuery(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	if paged {
+		query.Author = username
+		h.writePostsPage(w, r, query)
+		return
+	}
 
-	posts := h.PostRepo.PostsByUser(username)
+	posts := h.hideShadowbanned(r, h.PostRepo.PostsByUser(username))
+	h.fillUserVotes(r, postPointers(posts)...)
 
 	utils.WriteJSON(w, http.StatusOK, posts)
 }
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/media"
+	"redditclone/pkg/post"
+	"redditclone/pkg/report"
+	"redditclone/pkg/role"
+	"redditclone/pkg/session"
+	"redditclone/pkg/utils"
+	"strconv"
+	"time"
+)
+
+type ReportHandler struct {
+	Reports  report.ReportRepo
+	PostRepo post.PostRepo
+	Roles    role.RoleRepo
+	Audit    audit.AuditRepo
+	// Media - чтобы вместе с постом убрать и его картинку
+	Media  media.BlobStore
+	Logger *zap.SugaredLogger
+}
+
+type reportRequest struct {
+	Reason string `json:"reason"`
+}
+
+// sessionUser - username и id из сессии, которую положил middleware.Auth. ok = false - ответ уже записан
+func sessionUser(w http.ResponseWriter, r *http.Request) (username, userID string, ok bool) {
+	currentSession, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, map[string]string{"message": "unauthorized"})
+		return "", "", false
+	}
+	return currentSession.Username, currentSession.UserID, true
+}
+
+func (h *ReportHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, post.ErrPostNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "post not found"})
+	case errors.Is(err, post.ErrCommentNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "comment not found"})
+	case errors.Is(err, report.ErrNoItem):
+		utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": err.Error()})
+	case errors.Is(err, report.ErrBadReason), errors.Is(err, report.ErrBadResolution):
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+	case errors.Is(err, report.ErrAlreadyReported), errors.Is(err, report.ErrAlreadyModerated),
+		errors.Is(err, report.ErrNotOpen), errors.Is(err, post.ErrRemoved):
+		utils.WriteJSON(w, http.StatusConflict, map[string]interface{}{"message": err.Error()})
+	default:
+		h.Logger.Errorf("report error: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+	}
+}
+
+// reportTarget ищет пост или коммент, на который жалуются. На удаленное и уже убранное модератором жаловаться незачем
+func reportTarget(p post.Post, commentID string) (report.Target, error) {
+	target := report.Target{PostID: p.ID, CommentID: commentID, Category: p.Category, Title: p.Title}
+	if commentID == "" {
+		if p.Removed != nil {
+			return target, post.ErrRemoved
+		}
+		target.Excerpt = p.Text
+		if p.Type == "link" {
+			target.Excerpt = p.URL
+		}
+		return target, nil
+	}
+	for _, comment := range p.Comments {
+		if comment.ID != commentID {
+			continue
+		}
+		if comment.Deleted {
+			break
+		}
+		if comment.Removed != nil {
+			return target, post.ErrRemoved
+		}
+		target.Excerpt = comment.Body
+		return target, nil
+	}
+	return target, post.ErrCommentNotFound
+}
+
+func (h *ReportHandler) report(w http.ResponseWriter, r *http.Request, postID, commentID string) {
+	username, userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req reportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid payload"})
+		return
+	}
+	newReport, err := report.NewReport(username, userID, req.Reason, time.Now().UTC())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	p, err := h.PostRepo.GetPost(postID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	target, err := reportTarget(p, commentID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	item, err := h.Reports.Report(target, newReport)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	// жалоба уже записана, так что если спрятать не вышло - пост просто повисит в лентах до модератора
+	if item.Hidden && !p.Hidden {
+		if err = h.PostRepo.SetHidden(postID, true); err != nil {
+			h.Logger.Errorf("failed to hide reported post %s: %v", postID, err)
+		}
+	}
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{"message": "reported"})
+	h.Logger.Infof("%s reported %s: %s", username, item.ID, newReport.Reason)
+}
+
+// ReportPost - POST /api/post/{post_id}/report: {"reason"}
+func (h *ReportHandler) ReportPost(w http.ResponseWriter, r *http.Request) {
+	h.report(w, r, mux.Vars(r)[paramPostID], "")
+}
+
+// ReportComment - POST /api/post/{post_id}/{comment_id}/report: {"reason"}
+func (h *ReportHandler) ReportComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	h.report(w, r, vars[paramPostID], vars[paramCommentID])
+}
+
+// moderatorRoles - роли текущего юзера. ok = false - ответ уже записан
+func (h *ReportHandler) moderatorRoles(w http.ResponseWriter, r *http.Request) (username, userID string, roles *role.Roles, ok bool) {
+	username, userID, ok = sessionUser(w, r)
+	if !ok {
+		return "", "", nil, false
+	}
+	roles, ok = requireModerator(w, h.Roles, h.Logger, userID, "only moderators can see reports")
+	if !ok {
+		return "", "", nil, false
+	}
+	return username, userID, roles, true
+}
+
+// ModQueue - GET /api/modqueue?limit=: открытые жалобы. Админ видит все, модератор - по своим сообществам
+func (h *ReportHandler) ModQueue(w http.ResponseWriter, r *http.Request) {
+	_, _, roles, ok := h.moderatorRoles(w, r)
+	if !ok {
+		return
+	}
+	query := report.QueueQuery{All: roles.Admin, Communities: roles.Moderates}
+	if limit := r.URL.Query().Get(paramLimit); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "bad limit"})
+			return
+		}
+	}
+	items, err := h.Reports.Queue(query)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, items)
+}
+
+// ResolveItem - POST /api/modqueue/{item_id}/{action}, action - approve, remove или ignore.
+// Для remove можно передать {"reason"}, иначе берется причина первой жалобы
+func (h *ReportHandler) ResolveItem(w http.ResponseWriter, r *http.Request) {
+	username, userID, roles, ok := h.moderatorRoles(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	var status report.Status
+	switch vars["action"] {
+	case "approve":
+		status = report.StatusApproved
+	case "remove":
+		status = report.StatusRemoved
+	case "ignore":
+		status = report.StatusIgnored
+	default:
+		h.writeError(w, report.ErrBadResolution)
+		return
+	}
+
+	item, err := h.Reports.Get(vars["item_id"])
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if !roles.CanModerate(item.Category) {
+		utils.WriteJSON(w, http.StatusForbidden, map[string]interface{}{"message": "only moderators can resolve reports"})
+		return
+	}
+	if item.Status != report.StatusOpen {
+		h.writeError(w, report.ErrNotOpen)
+		return
+	}
+
+	if status == report.StatusRemoved {
+		var req reportRequest
+		// тело необязательное
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Reason == "" && len(item.Reports) > 0 {
+			req.Reason = item.Reports[0].Reason
+		}
+		removal, err := post.NewRemoval(username, req.Reason, time.Now().UTC())
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+			return
+		}
+		action, target := audit.ActionPostRemove, audit.PostTarget(item.PostID)
+		var removedPost *post.Post
+		var removedMedia *media.Media
+		if item.CommentID == "" {
+			if h.Media != nil {
+				if before, err := h.PostRepo.GetPost(item.PostID); err == nil {
+					removedMedia = before.Media
+				}
+			}
+			removedPost, err = h.PostRepo.RemovePost(item.PostID, removal)
+		} else {
+			action, target = audit.ActionCommentRemove, audit.CommentTarget(item.PostID, item.CommentID)
+			removedPost, err = h.PostRepo.RemoveComment(item.PostID, item.CommentID, removal)
+		}
+		// убрать могли и напрямую, мимо очереди - тогда просто закрываем жалобу, событие уже записала та ручка
+		if err != nil && !errors.Is(err, post.ErrRemoved) {
+			h.writeError(w, err)
+			return
+		}
+		if err == nil {
+			deleteMedia(r.Context(), h.Media, h.Logger, removedMedia)
+			event := audit.NewEvent(action, username, userID, target, removal.Created)
+			event.Category = item.Category
+			// что было до удаления - в выдержке жалобы
+			event.After = contentSnapshot(*removedPost, item.CommentID)
+			recordAudit(h.Audit, h.Logger, r, event)
+		}
+	}
+
+	before := *item
+	item, err = h.Reports.Resolve(item.ID, status, username)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	event := audit.NewEvent(audit.ActionReportResolve, username, userID, audit.ReportTarget(item.ID), time.Now().UTC())
+	event.Category = item.Category
+	event.Before = audit.Snapshot(before)
+	event.After = audit.Snapshot(item)
+	recordAudit(h.Audit, h.Logger, r, event)
+	if before.Hidden {
+		if err = h.PostRepo.SetHidden(item.PostID, false); err != nil && !errors.Is(err, post.ErrPostNotFound) {
+			h.Logger.Errorf("failed to unhide post %s: %v", item.PostID, err)
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, item)
+	h.Logger.Infof("Report %s resolved as %s by %s", item.ID, item.Status, username)
+}
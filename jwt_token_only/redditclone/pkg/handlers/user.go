@@ -3,17 +3,25 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"net/http"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/feed"
+	"redditclone/pkg/follow"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
 	"redditclone/pkg/utils"
+	"time"
 )
 
 type UserHandler struct {
 	UserRepo user.UserRepo
+	Follows  follow.FollowRepo
+	Feed     feed.Feed
 	Logger   *zap.SugaredLogger
 	Sessions *session.SessionsManager
+	Audit    audit.AuditRepo
 }
 
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -51,19 +59,23 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = utils.SendJwtToken(w, h.UserRepo.GenerateUserToken(*u))
-	if err != nil {
-		h.Logger.Errorf("failed to send JWT token: %v", err)
-		return
-	}
-	h.Logger.Infof("Registered user %s", request.Username)
-
-	sess, errCreate := h.Sessions.Create(w, u.ID)
+	// сессию заводим до токена: в токен кладется ее id
+	sess, errCreate := h.Sessions.Create(w, u.ID, u.Username)
 	if errCreate != nil {
 		h.Logger.Errorf("failed to create session: %v", errCreate)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error creating session"})
 		return
 	}
 	h.Logger.Infof("created session for %v", sess.UserID)
+
+	err = utils.SendJwtToken(w, h.UserRepo.GenerateUserToken(*u, sess.ID))
+	if err != nil {
+		h.Logger.Errorf("failed to send JWT token: %v", err)
+		h.Sessions.Destroy(sess.ID)
+		return
+	}
+	recordAudit(h.Audit, h.Logger, r, audit.NewEvent(audit.ActionRegister, u.Username, u.ID, audit.UserTarget(u.Username), time.Now().UTC()))
+	h.Logger.Infof("Registered user %s", request.Username)
 }
 
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -74,6 +86,10 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 	u, err := h.UserRepo.Authorize(request.Username, request.Password)
 	if err != nil {
+		// подбор паролей тоже видно по журналу
+		if errors.Is(err, user.ErrNoUser) || errors.Is(err, user.ErrBadPass) {
+			recordAudit(h.Audit, h.Logger, r, audit.NewEvent(audit.ActionLoginFailed, request.Username, "", audit.UserTarget(request.Username), time.Now().UTC()))
+		}
 		if errors.Is(err, user.ErrNoUser) {
 			utils.WriteJSON(w, http.StatusUnauthorized, map[string]interface{}{"message": "user not found"})
 		}
@@ -83,29 +99,70 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sess, errCreate := h.Sessions.Create(w, u.ID)
+	sess, errCreate := h.Sessions.Create(w, u.ID, u.Username)
 	if errCreate != nil {
 		h.Logger.Errorf("failed to create session: %v", errCreate)
+		utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "error creating session"})
 		return
 	}
 	h.Logger.Infof("created session for %v", sess.UserID)
 
-	err = utils.SendJwtToken(w, h.UserRepo.GenerateUserToken(*u))
+	err = utils.SendJwtToken(w, h.UserRepo.GenerateUserToken(*u, sess.ID))
 	if err != nil {
 		h.Logger.Errorf("failed to send JWT token: %v", err)
-		err := h.Sessions.DestroyCurrent(w, r)
-		if err != nil {
-			h.Logger.Errorf("failed to destroy session: %v", err)
-		}
+		h.Sessions.Destroy(sess.ID)
 		return
 	}
+	recordAudit(h.Audit, h.Logger, r, audit.NewEvent(audit.ActionLogin, u.Username, u.ID, audit.UserTarget(u.Username), time.Now().UTC()))
 	h.Logger.Infof("Logged in user %s", request.Username)
 }
 
 func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	err := h.Sessions.DestroyCurrent(w, r)
+	sess, err := session.SessionFromContext(r.Context())
 	if err != nil {
 		return
 	}
+	if err = h.Sessions.DestroyCurrent(w, r); err != nil {
+		return
+	}
+	recordAudit(h.Audit, h.Logger, r, audit.NewEvent(audit.ActionLogout, sess.Username, sess.UserID, audit.UserTarget(sess.Username), time.Now().UTC()))
 	http.Redirect(w, r, "/", http.StatusFound)
 }
+
+func (h *UserHandler) FollowUser(w http.ResponseWriter, r *http.Request) {
+	h.setFollow(w, r, true)
+}
+
+func (h *UserHandler) UnfollowUser(w http.ResponseWriter, r *http.Request) {
+	h.setFollow(w, r, false)
+}
+
+func (h *UserHandler) setFollow(w http.ResponseWriter, r *http.Request, follows bool) {
+	_, userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	username := mux.Vars(r)[paramUsername]
+	var err error
+	if follows {
+		err = h.Follows.Follow(userID, username)
+	} else {
+		err = h.Follows.Unfollow(userID, username)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, follow.ErrNoUser):
+			utils.WriteJSON(w, http.StatusNotFound, map[string]interface{}{"message": "user not found"})
+		case errors.Is(err, follow.ErrSelfFollow):
+			utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		default:
+			h.Logger.Errorf("failed to change follow of %s to %s: %v", userID, username, err)
+			utils.WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "internal error"})
+		}
+		return
+	}
+	h.Feed.SourcesChanged(userID)
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"username": username, "following": follows})
+	h.Logger.Infof("%s follows %s: %v", userID, username, follows)
+}
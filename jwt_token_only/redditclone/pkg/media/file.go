@@ -0,0 +1,69 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// FileStore - файлы в локальной папке. Тип содержимого отдельно не храним, он следует из расширения ключа
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+func (s *FileStore) Put(_ context.Context, key string, blob Blob) error {
+	if !ValidKey(key) {
+		return ErrBadKey
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	// через временный файл, чтобы не отдать недописанное
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(blob.Data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, key))
+}
+
+func (s *FileStore) Get(_ context.Context, key string) (Blob, error) {
+	if !ValidKey(key) {
+		return Blob{}, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Blob{}, ErrNotFound
+	}
+	if err != nil {
+		return Blob{}, err
+	}
+	return Blob{Data: data, ContentType: mime.TypeByExtension(filepath.Ext(key))}, nil
+}
+
+func (s *FileStore) Delete(_ context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrBadKey
+	}
+	if err := os.Remove(filepath.Join(s.dir, key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
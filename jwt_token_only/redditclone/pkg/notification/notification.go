@@ -0,0 +1,157 @@
+package notification
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DefaultInboxLimit = 50
+	DefaultQueueSize  = 1000
+
+	// больше упоминаний в одном тексте не рассылаем, чтобы коммент не превращался в спам по всем юзерам
+	MaxMentions = 10
+
+	maxExcerptLength = 200
+	maxUsername      = 32
+)
+
+type Kind string
+
+const (
+	KindComment Kind = "comment" // коммент к твоему посту
+	KindReply   Kind = "reply"   // ответ на твой коммент
+	KindMention Kind = "mention" // u/username в посте или комменте
+)
+
+var ErrBadKind = errors.New("bad notification kind")
+
+// как userLinkRe в markdown: упоминание - то же, что становится ссылкой на профиль
+var mentionRe = regexp.MustCompile(`/?u/([A-Za-z0-9_\-]+)`)
+
+// Notification - запись во входящих. Непрочитанная копит события одного вида по одному посту:
+// Actor - последний, кто отметился, Count - сколько всего было
+type Notification struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	Kind      Kind      `json:"kind"`
+	PostID    string    `json:"postId"`
+	CommentID string    `json:"commentId,omitempty"`
+	Category  string    `json:"category"`
+	Title     string    `json:"title"`
+	Excerpt   string    `json:"excerpt"`
+	Actor     string    `json:"actor"`
+	Count     int       `json:"count"`
+	Read      bool      `json:"read"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+}
+
+// Event - что случилось и кому об этом сказать
+type Event struct {
+	Kind      Kind
+	UserID    string
+	Actor     string
+	PostID    string
+	CommentID string
+	Category  string
+	Title     string
+	Excerpt   string
+	Created   time.Time
+}
+
+func (e Event) excerpt() string {
+	excerpt := []rune(e.Excerpt)
+	if len(excerpt) > maxExcerptLength {
+		excerpt = excerpt[:maxExcerptLength]
+	}
+	return string(excerpt)
+}
+
+// apply - событие в непрочитанное уведомление: новое (Count = 0) или уже накопленное
+func (n *Notification) apply(event Event) {
+	if n.Count == 0 {
+		n.UserID = event.UserID
+		n.Kind = event.Kind
+		n.PostID = event.PostID
+		n.Created = event.Created
+	}
+	n.CommentID = event.CommentID
+	n.Category = event.Category
+	n.Title = event.Title
+	n.Excerpt = event.excerpt()
+	n.Actor = event.Actor
+	n.Count++
+	n.Updated = event.Created
+}
+
+type Inbox struct {
+	Notifications []Notification `json:"notifications"`
+	Unread        int            `json:"unread"`
+}
+
+// Preferences - какие уведомления юзер хочет получать. Пока не настраивал - все
+type Preferences struct {
+	Comments bool `json:"comments"`
+	Replies  bool `json:"replies"`
+	Mentions bool `json:"mentions"`
+}
+
+func DefaultPreferences() Preferences {
+	return Preferences{Comments: true, Replies: true, Mentions: true}
+}
+
+func (p Preferences) Allows(kind Kind) bool {
+	switch kind {
+	case KindComment:
+		return p.Comments
+	case KindReply:
+		return p.Replies
+	case KindMention:
+		return p.Mentions
+	}
+	return false
+}
+
+type NotificationRepo interface {
+	// Notify кладет событие во входящие, если юзер такие не отключил. Пока уведомление того же вида
+	// к тому же посту не прочитано, новое не заводится - растет его Count
+	Notify(event Event) error
+	// Inbox - последние обновленные сначала и сколько всего непрочитанных
+	Inbox(userID string, limit int) (*Inbox, error)
+	// MarkRead отмечает прочитанными ids, без ids - все. Возвращает, сколько отметили
+	MarkRead(userID string, ids []string) (int, error)
+	Preferences(userID string) (Preferences, error)
+	SetPreferences(userID string, prefs Preferences) error
+}
+
+// Mentions - кого упомянули в тексте: u/name или /u/name не посреди слова и не внутри пути, как их
+// видит markdown. Без повторов, не больше MaxMentions
+func Mentions(text string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range mentionRe.FindAllStringSubmatchIndex(text, -1) {
+		prev, _ := utf8.DecodeLastRuneInString(text[:m[0]])
+		if m[0] > 0 && (unicode.IsLetter(prev) || unicode.IsDigit(prev) || prev == '_' || prev == '/') {
+			continue
+		}
+		name := text[m[2]:m[3]]
+		if len(name) > maxUsername || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+		if len(names) == MaxMentions {
+			break
+		}
+	}
+	return names
+}
+
+func validKind(kind Kind) bool {
+	return kind == KindComment || kind == KindReply || kind == KindMention
+}
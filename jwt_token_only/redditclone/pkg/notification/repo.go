@@ -0,0 +1,106 @@
+package notification
+
+import (
+	"redditclone/pkg/utils"
+	"sort"
+	"sync"
+)
+
+type NotificationMemoryRepo struct {
+	sync.RWMutex
+	// входящие по id юзера, в порядке добавления
+	inbox       map[string][]*Notification
+	preferences map[string]Preferences
+}
+
+func NewMemoryRepo() *NotificationMemoryRepo {
+	return &NotificationMemoryRepo{
+		inbox:       make(map[string][]*Notification),
+		preferences: make(map[string]Preferences),
+	}
+}
+
+func (repo *NotificationMemoryRepo) Notify(event Event) error {
+	if !validKind(event.Kind) {
+		return ErrBadKind
+	}
+	repo.Lock()
+	defer repo.Unlock()
+	if !repo.preferencesOf(event.UserID).Allows(event.Kind) {
+		return nil
+	}
+	for _, n := range repo.inbox[event.UserID] {
+		if !n.Read && n.Kind == event.Kind && n.PostID == event.PostID {
+			n.apply(event)
+			return nil
+		}
+	}
+	id, err := utils.GenerateID()
+	if err != nil {
+		return err
+	}
+	n := &Notification{ID: id}
+	n.apply(event)
+	repo.inbox[event.UserID] = append(repo.inbox[event.UserID], n)
+	return nil
+}
+
+func (repo *NotificationMemoryRepo) Inbox(userID string, limit int) (*Inbox, error) {
+	if limit <= 0 || limit > DefaultInboxLimit {
+		limit = DefaultInboxLimit
+	}
+	repo.RLock()
+	defer repo.RUnlock()
+	inbox := &Inbox{Notifications: make([]Notification, 0, len(repo.inbox[userID]))}
+	for _, n := range repo.inbox[userID] {
+		inbox.Notifications = append(inbox.Notifications, *n)
+		if !n.Read {
+			inbox.Unread++
+		}
+	}
+	sort.SliceStable(inbox.Notifications, func(i, j int) bool {
+		return inbox.Notifications[i].Updated.After(inbox.Notifications[j].Updated)
+	})
+	if len(inbox.Notifications) > limit {
+		inbox.Notifications = inbox.Notifications[:limit]
+	}
+	return inbox, nil
+}
+
+func (repo *NotificationMemoryRepo) MarkRead(userID string, ids []string) (int, error) {
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	repo.Lock()
+	defer repo.Unlock()
+	marked := 0
+	for _, n := range repo.inbox[userID] {
+		if !n.Read && (len(ids) == 0 || selected[n.ID]) {
+			n.Read = true
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (repo *NotificationMemoryRepo) Preferences(userID string) (Preferences, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	return repo.preferencesOf(userID), nil
+}
+
+func (repo *NotificationMemoryRepo) SetPreferences(userID string, prefs Preferences) error {
+	repo.Lock()
+	defer repo.Unlock()
+	repo.preferences[userID] = prefs
+	return nil
+}
+
+// preferencesOf - под блокировкой
+func (repo *NotificationMemoryRepo) preferencesOf(userID string) Preferences {
+	if prefs, ok := repo.preferences[userID]; ok {
+		return prefs
+	}
+	return DefaultPreferences()
+}
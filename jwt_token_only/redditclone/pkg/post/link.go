@@ -0,0 +1,78 @@
+package post
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// MaxDuplicates - больше повторов одной ссылки не отдаем
+const MaxDuplicates = 100
+
+var ErrBadURL = errors.New("bad url")
+
+// trackingParams - параметры, которые не меняют, куда ведет ссылка, а только метят, откуда по ней пришли.
+// Плюс все utm_*
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"yclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"igshid":  true,
+	"ref_src": true,
+}
+
+// CanonicalURL приводит ссылку к виду, по которому ищутся повторы: http и https не различаем,
+// хост в нижнем регистре без www. и порта по умолчанию, без слешей в конце пути, без якоря и меток
+// трекинга, остальные параметры - по алфавиту. Путь и значения параметров регистр сохраняют
+func CanonicalURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err == nil && u.Host == "" && !strings.Contains(rawURL, "://") {
+		// example.com/a без схемы url.Parse считает путем
+		u, err = url.Parse("http://" + rawURL)
+	}
+	if err != nil || u.Host == "" {
+		return "", ErrBadURL
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", ErrBadURL
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	host = strings.TrimPrefix(host, "www.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+
+	query := u.Query()
+	for param := range query {
+		if trackingParams[strings.ToLower(param)] || strings.HasPrefix(strings.ToLower(param), "utm_") {
+			query.Del(param)
+		}
+	}
+
+	canonical := "https://" + host + strings.TrimRight(u.EscapedPath(), "/")
+	if len(query) > 0 {
+		// Encode сортирует по ключу
+		canonical += "?" + query.Encode()
+	}
+	return canonical, nil
+}
+
+// LinkHash - хеш канонической ссылки, по нему индекс повторов. Пустой - ссылка не разбирается
+func LinkHash(rawURL string) string {
+	canonical, err := CanonicalURL(rawURL)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,188 @@
+package post
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"redditclone/pkg/ranking"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 25
+	MaxPageLimit     = 100
+)
+
+var ErrBadCursor = errors.New("bad cursor")
+
+// ListQuery - выборка постов для ленты. Пустые Category/Author - без фильтра.
+// Feed - персональная лента: посты из любого сообщества или от любого автора из списков.
+// IDs - только эти посты, так лента читается из готового таймлайна, см. feed.Timeline.
+// After/Before - курсоры из предыдущего ответа, одновременно оба не передаются.
+// Period учитывается только для top
+type ListQuery struct {
+	Category string
+	Author   string
+	Feed     *FeedFilter
+	IDs      []string
+	Sort     ranking.Sort
+	Period   ranking.Period
+	Limit    int
+	After    string
+	Before   string
+}
+
+type FeedFilter struct {
+	Categories []string
+	Authors    []string
+}
+
+func (f *FeedFilter) matches(p *Post) bool {
+	for _, category := range f.Categories {
+		if p.Category == category {
+			return true
+		}
+	}
+	for _, author := range f.Authors {
+		if p.Author.Username == author {
+			return true
+		}
+	}
+	return false
+}
+
+// PostsPage - страница ленты. After - курсор для следующей страницы,
+// Before - для предыдущей. Пустой курсор - дальше в эту сторону ничего нет
+type PostsPage struct {
+	Posts  []Post `json:"posts"`
+	After  string `json:"after,omitempty"`
+	Before string `json:"before,omitempty"`
+}
+
+// лента отсортирована по (ключ сортировки, id) по убыванию, курсор - это позиция поста в ней.
+// Для new ключ - время создания, для остальных - ранг. Наружу отдаем base64 от json,
+// чтобы клиенты не пытались его собирать сами
+type cursor struct {
+	Sort    ranking.Sort `json:"s"`
+	Key     float64      `json:"k,omitempty"`
+	Created time.Time    `json:"c"`
+	ID      string       `json:"i"`
+}
+
+func encodeCursor(p Post, sort ranking.Sort) string {
+	c := cursor{Sort: sort, Created: p.Created, ID: p.ID}
+	if sort != ranking.SortNew {
+		c.Key = p.sortKey(sort)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor - курсор от другой сортировки тоже считаем битым, позиция в ленте у него другая
+func decodeCursor(s string, sort ranking.Sort) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrBadCursor
+	}
+	if err = json.Unmarshal(data, &c); err != nil || c.ID == "" || c.Sort != sort {
+		return c, ErrBadCursor
+	}
+	return c, nil
+}
+
+func (q ListQuery) sort() ranking.Sort {
+	if q.Sort == "" {
+		return ranking.SortHot
+	}
+	return q.Sort
+}
+
+func (q ListQuery) limit() int {
+	if q.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	if q.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return q.Limit
+}
+
+// since - посты старше этого момента в выборку не попадают: top за период и rising только по свежим
+func (q ListQuery) since(now time.Time) time.Time {
+	switch q.sort() {
+	case ranking.SortTop:
+		period := q.Period
+		if period == "" {
+			period = ranking.PeriodDay
+		}
+		return period.Since(now)
+	case ranking.SortRising:
+		return now.Add(-ranking.RisingWindow)
+	}
+	return time.Time{}
+}
+
+// precedes - стоит ли a в ленте раньше b
+func precedes(a, b *Post, sort ranking.Sort) bool {
+	if sort == ranking.SortNew {
+		if !a.Created.Equal(b.Created) {
+			return a.Created.After(b.Created)
+		}
+		return a.ID > b.ID
+	}
+	ka, kb := a.sortKey(sort), b.sortKey(sort)
+	if ka != kb {
+		return ka > kb
+	}
+	return a.ID > b.ID
+}
+
+// cursorPost - пост-заглушка, стоящий в ленте ровно на месте курсора
+func cursorPost(c cursor) *Post {
+	p := &Post{ID: c.ID, Created: c.Created}
+	switch c.Sort {
+	case ranking.SortTop:
+		p.Score = int(c.Key)
+	case ranking.SortRising:
+		p.Rising = c.Key
+	case ranking.SortControversial:
+		p.Controversial = c.Key
+	default:
+		p.Hot = c.Key
+	}
+	return p
+}
+
+// newPostsPage собирает страницу из выборки в порядке ленты. В выборке на один пост больше лимита,
+// если в сторону запроса есть еще посты - так узнаем, нужен ли курсор, без отдельного count
+func newPostsPage(posts []Post, q ListQuery, hasMore bool) *PostsPage {
+	page := &PostsPage{Posts: posts}
+	if len(posts) == 0 {
+		return page
+	}
+	first, last := posts[0], posts[len(posts)-1]
+	sort := q.sort()
+
+	switch {
+	case q.Before != "":
+		// листаем назад: раз пришли с курсором, то страница после этой точно есть
+		page.After = encodeCursor(last, sort)
+		if hasMore {
+			page.Before = encodeCursor(first, sort)
+		}
+	case q.After != "":
+		page.Before = encodeCursor(first, sort)
+		if hasMore {
+			page.After = encodeCursor(last, sort)
+		}
+	default:
+		if hasMore {
+			page.After = encodeCursor(last, sort)
+		}
+	}
+	return page
+}
@@ -0,0 +1,167 @@
+package post
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	MinPollOptions = 2
+	MaxPollOptions = 10
+	// дольше опрос не висит: закрытие - единственный способ показать результаты тем, кто не голосовал
+	MaxPollDuration = 31 * 24 * time.Hour
+
+	maxPollOptionLength = 100
+)
+
+var (
+	ErrBadPoll      = errors.New("poll needs 2 to 10 distinct options of up to 100 characters")
+	ErrBadPollClose = errors.New("poll must close in the future and within 31 days")
+	ErrNotPoll      = errors.New("post is not a poll")
+	ErrPollClosed   = errors.New("poll is closed")
+	ErrAlreadyVoted = errors.New("already voted in this poll")
+	ErrBadBallot    = errors.New("bad poll choices")
+)
+
+// NewPollRequest - опрос в NewPostRequest у постов с типом "poll". Closes не задан - опрос открыт, пока пост жив
+type NewPollRequest struct {
+	Options  []string   `json:"options"`
+	Multiple bool       `json:"multiple"`
+	Closes   *time.Time `json:"closes"`
+}
+
+// Validate проверяет опрос и заодно нормализует его: обрезает пробелы у вариантов и переводит время в UTC
+func (r *NewPollRequest) Validate(now time.Time) error {
+	if r == nil || len(r.Options) < MinPollOptions || len(r.Options) > MaxPollOptions {
+		return ErrBadPoll
+	}
+	seen := make(map[string]bool, len(r.Options))
+	for i, option := range r.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || len([]rune(option)) > maxPollOptionLength || seen[option] {
+			return ErrBadPoll
+		}
+		seen[option] = true
+		r.Options[i] = option
+	}
+	if r.Closes != nil {
+		closes := r.Closes.UTC()
+		if !closes.After(now) || closes.Sub(now) > MaxPollDuration {
+			return ErrBadPollClose
+		}
+		r.Closes = &closes
+	}
+	return nil
+}
+
+func (r *NewPollRequest) poll() *Poll {
+	options := make([]PollOption, 0, len(r.Options))
+	for _, option := range r.Options {
+		options = append(options, PollOption{Text: option})
+	}
+	return &Poll{Options: options, Multiple: r.Multiple, Closes: r.Closes, Ballots: []Ballot{}}
+}
+
+type Poll struct {
+	Options  []PollOption `json:"options"`
+	Multiple bool         `json:"multiple"`
+	Closes   *time.Time   `json:"closes,omitempty"`
+	// сколько юзеров проголосовало, в отличие от раскладки по вариантам видно всем
+	Voters int `json:"voters"`
+	// бюллетени: по ним не дают проголосовать второй раз и показывают юзеру, что он выбрал
+	Ballots []Ballot `json:"-"`
+
+	// заполняются в хендлере под того, кто запрашивает пост, см. View. Results - голоса по вариантам,
+	// Choices - что выбрал он сам
+	Results []int `json:"results,omitempty"`
+	Choices []int `json:"choices,omitempty"`
+}
+
+type PollOption struct {
+	Text string `json:"text"`
+	// наружу только через Poll.Results, иначе результаты видно до голосования
+	Votes int `json:"-"`
+}
+
+type Ballot struct {
+	UserID  string    `bson:"user_id"`
+	Choices []int     `bson:"choices"`
+	Created time.Time `bson:"created"`
+}
+
+func (p *Poll) Closed(now time.Time) bool {
+	return p.Closes != nil && !now.Before(*p.Closes)
+}
+
+func (p *Poll) ballot(userID string) *Ballot {
+	for i := range p.Ballots {
+		if p.Ballots[i].UserID == userID {
+			return &p.Ballots[i]
+		}
+	}
+	return nil
+}
+
+// ChoicesOf - что userID выбрал в опросе, nil - не голосовал
+func (p *Poll) ChoicesOf(userID string) []int {
+	if b := p.ballot(userID); b != nil {
+		return b.Choices
+	}
+	return nil
+}
+
+// View показывает опрос тому, кто выбрал choices (nil - не голосовал или аноним):
+// результаты - только проголосовавшим или после закрытия
+func (p *Poll) View(choices []int, now time.Time) {
+	p.Results, p.Choices = nil, choices
+	if p.Choices == nil && !p.Closed(now) {
+		return
+	}
+	p.Results = make([]int, 0, len(p.Options))
+	for _, option := range p.Options {
+		p.Results = append(p.Results, option.Votes)
+	}
+}
+
+// checkBallot сортирует choices - в бюллетене варианты лежат по порядку
+func (p *Poll) checkBallot(userID string, choices []int, now time.Time) error {
+	if p.Closed(now) {
+		return ErrPollClosed
+	}
+	if len(choices) == 0 || (len(choices) > 1 && !p.Multiple) {
+		return ErrBadBallot
+	}
+	sort.Ints(choices)
+	for i, choice := range choices {
+		if choice < 0 || choice >= len(p.Options) || (i > 0 && choices[i-1] == choice) {
+			return ErrBadBallot
+		}
+	}
+	if p.ballot(userID) != nil {
+		return ErrAlreadyVoted
+	}
+	return nil
+}
+
+// votePoll - голос в опросе. С VotePost не связан: ни счет поста, ни vote.VoteRepo он не трогает.
+// Переголосовать нельзя
+func (p *Post) votePoll(userID string, choices []int, now time.Time) (Ballot, error) {
+	if p.Poll == nil {
+		return Ballot{}, ErrNotPoll
+	}
+	if p.Removed != nil {
+		return Ballot{}, ErrRemoved
+	}
+	if err := p.Poll.checkBallot(userID, choices, now); err != nil {
+		return Ballot{}, err
+	}
+	ballot := Ballot{UserID: userID, Choices: choices, Created: now}
+	p.Poll.Ballots = append(p.Poll.Ballots, ballot)
+	p.Poll.Voters++
+	for _, choice := range choices {
+		p.Poll.Options[choice].Votes++
+	}
+	return ballot, nil
+}
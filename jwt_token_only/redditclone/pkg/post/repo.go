@@ -2,7 +2,12 @@ package post
 
 import (
 	"errors"
+	"redditclone/pkg/markdown"
+	"redditclone/pkg/preview"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/role"
 	"redditclone/pkg/utils"
+	"sort"
 	"sync"
 	"time"
 )
@@ -16,11 +21,33 @@ var (
 type PostMemoryRepo struct {
 	sync.RWMutex
 	Posts map[string]*Post
+	index *searchIndex
+	// links - id постов по хешу ссылки, чтобы не перебирать все посты ради повторов
+	links map[string]map[string]bool
 }
 
 func NewMemoryRepo() *PostMemoryRepo {
 	return &PostMemoryRepo{
 		Posts: make(map[string]*Post),
+		index: newSearchIndex(),
+		links: make(map[string]map[string]bool),
+	}
+}
+
+func (repo *PostMemoryRepo) addLink(p *Post) {
+	if p.LinkHash == "" {
+		return
+	}
+	if repo.links[p.LinkHash] == nil {
+		repo.links[p.LinkHash] = make(map[string]bool)
+	}
+	repo.links[p.LinkHash][p.ID] = true
+}
+
+func (repo *PostMemoryRepo) removeLink(linkHash, postID string) {
+	delete(repo.links[linkHash], postID)
+	if len(repo.links[linkHash]) == 0 {
+		delete(repo.links, linkHash)
 	}
 }
 
@@ -29,8 +56,14 @@ func (repo *PostMemoryRepo) GetPosts() []*Post {
 	defer repo.RUnlock()
 	posts := make([]*Post, 0, len(repo.Posts))
 	for _, post := range repo.Posts {
-		posts = append(posts, post)
+		if !post.Hidden {
+			posts = append(posts, post.clone())
+		}
 	}
+	// старые ручки без пагинации отдают все посты, но хотя бы в порядке hot, а не как лежат в мапе
+	sort.Slice(posts, func(i, j int) bool {
+		return precedes(posts[i], posts[j], ranking.SortHot)
+	})
 	return posts
 }
 
@@ -39,10 +72,13 @@ func (repo *PostMemoryRepo) GetPostsByCategory(category string) []Post {
 	defer repo.RUnlock()
 	posts := make([]Post, 0)
 	for _, post := range repo.Posts {
-		if post.Category == category {
-			posts = append(posts, *post)
+		if post.Category == category && !post.Hidden {
+			posts = append(posts, *post.clone())
 		}
 	}
+	sort.Slice(posts, func(i, j int) bool {
+		return precedes(&posts[i], &posts[j], ranking.SortHot)
+	})
 	return posts
 }
 
@@ -55,27 +91,38 @@ func (repo *PostMemoryRepo) CreatePost(request NewPostRequest, username, userID
 	}
 	createdTime := time.Now().UTC()
 	newPost := &Post{
-		ID:               postID,
-		Author:           Author{Username: username, ID: userID},
-		Category:         request.Category,
-		Type:             request.Type,
-		Title:            request.Title,
-		Score:            1,
-		Views:            1,
-		Votes:            []Vote{{User: userID, Vote: 1}},
-		Comments:         []Comment{},
-		Created:          createdTime,
-		UpvotePercentage: 100,
+		ID:       postID,
+		Author:   Author{Username: username, ID: userID},
+		Category: request.Category,
+		Type:     request.Type,
+		Title:    request.Title,
+		Flair:    request.Flair,
+		Views:    1,
+		Comments: []Comment{},
+		Created:  createdTime,
 	}
+	// сам голос автора записывает хендлер в vote.VoteRepo, тут только счетчики
+	newPost.applyVote(0, 1)
 
 	if request.Type == "link" {
 		newPost.URL = request.URL
+		newPost.LinkHash = LinkHash(request.URL)
 	} else {
 		newPost.Text = request.Text
+		newPost.TextHTML = markdown.Render(request.Text)
+	}
+	if request.Type == "image" {
+		newPost.Media = request.Media
 	}
+	if request.Type == "poll" && request.Poll != nil {
+		newPost.Poll = request.Poll.poll()
+	}
+	newPost.refreshRank()
 
 	repo.Posts[postID] = newPost
-	return newPost, nil
+	repo.index.add(newPost)
+	repo.addLink(newPost)
+	return newPost.clone(), nil
 }
 
 func (repo *PostMemoryRepo) GetPost(id string) (Post, error) {
@@ -86,12 +133,18 @@ func (repo *PostMemoryRepo) GetPost(id string) (Post, error) {
 		return Post{}, ErrPostNotFound // делать указатель на пост в возвращаемом значении неудобно + inconsistent относительно того, что в других функциях
 	}
 
-	copyPost := *post
-
-	return copyPost, nil
+	return *post.clone(), nil
 }
 
 func (repo *PostMemoryRepo) AddComment(postID, username, userID, comment string) (*Post, error) {
+	return repo.addComment(postID, "", username, userID, comment)
+}
+
+func (repo *PostMemoryRepo) AddReply(postID, parentID, username, userID, comment string) (*Post, error) {
+	return repo.addComment(postID, parentID, username, userID, comment)
+}
+
+func (repo *PostMemoryRepo) addComment(postID, parentID, username, userID, comment string) (*Post, error) {
 	repo.Lock()
 	defer repo.Unlock()
 	commentedPost, ok := repo.Posts[postID]
@@ -103,139 +156,236 @@ func (repo *PostMemoryRepo) AddComment(postID, username, userID, comment string)
 		return nil, err
 	}
 	newComment := Comment{
-		ID:      commentID,
-		Body:    comment,
-		Created: time.Now().UTC(),
+		ID:       commentID,
+		Body:     comment,
+		BodyHTML: markdown.Render(comment),
+		Created:  time.Now().UTC(),
 		Author: Author{
 			Username: username,
 			ID:       userID,
 		},
+		ParentID: parentID,
+	}
+	if err = commentedPost.addComment(newComment); err != nil {
+		return nil, err
 	}
-	commentedPost.Comments = append(commentedPost.Comments, newComment)
-	// repo.Posts[postID] = commentedPost
-	return commentedPost, nil
+	commentedPost.refreshRank()
+	repo.index.add(commentedPost)
+	return commentedPost.clone(), nil
 }
 
-func (repo *PostMemoryRepo) DeleteComment(postID, commentID, userID string) (*Post, error) {
+func (repo *PostMemoryRepo) DeleteComment(postID, commentID string, actor role.Actor) (*Post, error) {
 	repo.Lock()
 	defer repo.Unlock()
 	removedCommentPost, ok := repo.Posts[postID]
 	if !ok {
 		return nil, ErrPostNotFound
 	}
-	if removedCommentPost.Author.ID != userID {
-		return nil, ErrUnauthorized
+	if err := removedCommentPost.removeComment(commentID, actor); err != nil {
+		return nil, err
 	}
-	newComments := []Comment{}
-	found := false
-	for _, c := range removedCommentPost.Comments {
-		if c.ID == commentID {
-			found = true
-			continue
-		}
-		newComments = append(newComments, c)
+	removedCommentPost.refreshRank()
+	repo.index.add(removedCommentPost)
+	return removedCommentPost.clone(), nil
+}
+
+// GetCommentTree - ответы на коммент parentID деревом, для догрузки глубоких веток
+func (repo *PostMemoryRepo) GetCommentTree(postID, parentID string, depth int) ([]Comment, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	post, ok := repo.Posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
 	}
-	if !found {
+	if parentID != "" && post.findComment(parentID) == -1 {
 		return nil, ErrCommentNotFound
 	}
-	removedCommentPost.Comments = newComments
-	// repo.Posts[postID] = removedCommentPost
-	return removedCommentPost, nil
+	return CommentTree(post.Comments, parentID, depth), nil
 }
 
-func (repo *PostMemoryRepo) VotePost(postID, userID string, action int) (*Post, error) {
+// VotePost пересчитывает счетчики поста, когда голос юзера поменялся с oldVote на newVote.
+// Сам голос к этому моменту уже записан в vote.VoteRepo
+func (repo *PostMemoryRepo) VotePost(postID string, oldVote, newVote int) (*Post, error) {
 	repo.Lock()
 	defer repo.Unlock()
 	votedPost, ok := repo.Posts[postID]
 	if !ok {
 		return nil, ErrPostNotFound
 	}
+	votedPost.applyVote(oldVote, newVote)
+	votedPost.refreshRank()
 
-	var existingVote *Vote
-	var existingIndex = -1
-	for i, v := range votedPost.Votes {
-		if v.User == userID {
-			existingVote = &votedPost.Votes[i]
-			existingIndex = i
-			break
-		}
-	}
-
-	switch action {
-	case 1:
-		{
-			if existingVote != nil {
-				if existingVote.Vote == 1 {
-					// Ничего не меняем
-				} else {
-					// Изменение с даунвоута на апвоут.
-					votedPost.Score += 2
-					votedPost.Votes[existingIndex].Vote = 1
-				}
-			} else {
-				votedPost.Score++
-				votedPost.Votes = append(votedPost.Votes, Vote{User: userID, Vote: 1})
-			}
-		}
-	case -1:
-		{
-			if existingVote != nil {
-				if existingVote.Vote == -1 {
-					// Ничего не меняем
-				} else {
-					// Изменение с апвоута на даунвоут.
-					votedPost.Score -= 2
-					votedPost.Votes[existingIndex].Vote = -1
-				}
-			} else {
-				votedPost.Score--
-				votedPost.Votes = append(votedPost.Votes, Vote{User: userID, Vote: -1})
-			}
+	return votedPost.clone(), nil
+}
+
+// VoteComment - то же, что VotePost, но для счетчиков коммента
+func (repo *PostMemoryRepo) VoteComment(postID, commentID string, oldVote, newVote int) (*Post, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	votedPost, ok := repo.Posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
+	}
+	i := votedPost.findComment(commentID)
+	if i == -1 || votedPost.Comments[i].Deleted {
+		return nil, ErrCommentNotFound
+	}
+	votedPost.Comments[i].applyVote(oldVote, newVote)
+
+	return votedPost.clone(), nil
+}
+
+func (repo *PostMemoryRepo) EditPost(postID string, actor role.Actor, request EditPostRequest) (*Post, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	editedPost, ok := repo.Posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
+	}
+	if err := editedPost.edit(request, actor, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	repo.index.add(editedPost)
+	return editedPost.clone(), nil
+}
+
+func (repo *PostMemoryRepo) EditComment(postID, commentID string, actor role.Actor, body string) (*Post, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	editedPost, ok := repo.Posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
+	}
+	if _, err := editedPost.editComment(commentID, actor, body, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	repo.index.add(editedPost)
+	return editedPost.clone(), nil
+}
+
+func (repo *PostMemoryRepo) RemovePost(postID string, removal Removal) (*Post, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	removedPost, ok := repo.Posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
+	}
+	linkHash := removedPost.LinkHash
+	if err := removedPost.remove(removal); err != nil {
+		return nil, err
+	}
+	repo.index.add(removedPost)
+	repo.removeLink(linkHash, postID)
+	return removedPost.clone(), nil
+}
+
+func (repo *PostMemoryRepo) RemoveComment(postID, commentID string, removal Removal) (*Post, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	removedPost, ok := repo.Posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
+	}
+	if _, err := removedPost.removeCommentAsModerator(commentID, removal); err != nil {
+		return nil, err
+	}
+	repo.index.add(removedPost)
+	return removedPost.clone(), nil
+}
+
+func (repo *PostMemoryRepo) SetHidden(postID string, hidden bool) error {
+	repo.Lock()
+	defer repo.Unlock()
+	hiddenPost, ok := repo.Posts[postID]
+	if !ok {
+		return ErrPostNotFound
+	}
+	hiddenPost.Hidden = hidden
+	return nil
+}
+
+// SetPreview заменяет карточку целиком, а не правит старую: выданные наружу копии поста делят с нами указатель
+func (repo *PostMemoryRepo) SetPreview(postID string, p preview.Preview) error {
+	repo.Lock()
+	defer repo.Unlock()
+	previewPost, ok := repo.Posts[postID]
+	if !ok || previewPost.Removed != nil {
+		return ErrPostNotFound
+	}
+	previewPost.Preview = &p
+	return nil
+}
+
+// VotePoll - проверка, что юзер еще не голосовал, и запись бюллетеня под одной блокировкой
+func (repo *PostMemoryRepo) VotePoll(postID, userID string, choices []int) (*Post, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	votedPost, ok := repo.Posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
+	}
+	if _, err := votedPost.votePoll(userID, choices, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return votedPost.clone(), nil
+}
+
+// Karma - перебором всех постов: индекса по авторам нет
+func (repo *PostMemoryRepo) Karma(userID string) (int, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	karma := 0
+	for _, p := range repo.Posts {
+		if p.Author.ID == userID {
+			karma += p.Score
 		}
-	case 0:
-		{
-			if existingVote != nil {
-				switch existingVote.Vote {
-				case 1:
-					votedPost.Score--
-				case -1:
-					votedPost.Score++
-				}
-				votedPost.Votes = append(votedPost.Votes[:existingIndex], votedPost.Votes[existingIndex+1:]...)
+		for _, comment := range p.Comments {
+			if comment.Author.ID == userID {
+				karma += comment.Score
 			}
 		}
 	}
-	// Можно подсчитать сразу в процессе поиска голоса от юзера, а потом, в зависимости от действия,
-	// менять переменные totalVotes и upvotes, но я решил отдельно вынести
-	totalVotes := len(votedPost.Votes)
-	upvotes := 0
-	for _, v := range votedPost.Votes {
-		if v.Vote == 1 {
-			upvotes++
-		}
-	}
+	return karma, nil
+}
 
-	if totalVotes == 0 {
-		votedPost.UpvotePercentage = 100
-	} else {
-		votedPost.UpvotePercentage = int((float64(upvotes) / float64(totalVotes)) * 100)
+// GetRevisions - прежние версии поста (commentID == "") или одного его коммента
+func (repo *PostMemoryRepo) GetRevisions(postID, commentID string) ([]Revision, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	post, ok := repo.Posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
 	}
+	return post.revisions(commentID)
+}
 
-	return votedPost, nil
+// AddViews прибавляет накопленные просмотры пачкой, см. views.Counter. Удаленные к этому времени посты пропускаем
+func (repo *PostMemoryRepo) AddViews(views map[string]int) error {
+	repo.Lock()
+	defer repo.Unlock()
+	for postID, n := range views {
+		if viewedPost, ok := repo.Posts[postID]; ok {
+			viewedPost.Views += n
+		}
+	}
+	return nil
 }
 
-func (repo *PostMemoryRepo) DeletePost(postID, userID string) (bool, error) {
+func (repo *PostMemoryRepo) DeletePost(postID string, actor role.Actor) (bool, error) {
 	repo.Lock()
 	defer repo.Unlock()
-	if _, ok := repo.Posts[postID]; !ok {
+	post, ok := repo.Posts[postID]
+	if !ok {
 		return false, ErrPostNotFound
 	}
 
-	if repo.Posts[postID].Author.ID != userID {
+	if !role.CanDelete(actor, role.Target{AuthorID: post.Author.ID, Community: post.Category}) {
 		return false, ErrUnauthorized
 	}
 
+	repo.removeLink(repo.Posts[postID].LinkHash, postID)
 	delete(repo.Posts, postID)
+	repo.index.remove(postID)
 	return true, nil
 }
 
@@ -245,8 +395,145 @@ func (repo *PostMemoryRepo) PostsByUser(username string) []Post {
 	posts := make([]Post, 0)
 	for _, post := range repo.Posts {
 		if post.Author.Username == username {
-			posts = append(posts, *post)
+			posts = append(posts, *post.clone())
 		}
 	}
+	sort.Slice(posts, func(i, j int) bool {
+		return precedes(&posts[i], &posts[j], ranking.SortHot)
+	})
 	return posts
 }
+
+func (repo *PostMemoryRepo) PostsByLink(linkHash, category string) ([]Post, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	posts := make([]Post, 0, len(repo.links[linkHash]))
+	for postID := range repo.links[linkHash] {
+		p := repo.Posts[postID]
+		if category == "" || p.Category == category {
+			posts = append(posts, *p.clone())
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return precedes(&posts[i], &posts[j], ranking.SortNew)
+	})
+	if len(posts) > MaxDuplicates {
+		posts = posts[:MaxDuplicates]
+	}
+	return posts, nil
+}
+
+func (repo *PostMemoryRepo) ListPosts(query ListQuery) (*PostsPage, error) {
+	if query.After != "" && query.Before != "" {
+		return nil, ErrBadCursor
+	}
+	order := query.sort()
+	var from *Post
+	for _, cursorStr := range []string{query.After, query.Before} {
+		if cursorStr == "" {
+			continue
+		}
+		c, err := decodeCursor(cursorStr, order)
+		if err != nil {
+			return nil, err
+		}
+		from = cursorPost(c)
+	}
+	since := query.since(time.Now())
+	var ids map[string]bool
+	if query.IDs != nil {
+		ids = make(map[string]bool, len(query.IDs))
+		for _, id := range query.IDs {
+			ids[id] = true
+		}
+	}
+
+	repo.RLock()
+	feed := make([]*Post, 0, len(repo.Posts))
+	for _, post := range repo.Posts {
+		if post.Hidden {
+			continue
+		}
+		if query.Category != "" && post.Category != query.Category {
+			continue
+		}
+		if query.Author != "" && post.Author.Username != query.Author {
+			continue
+		}
+		if query.Feed != nil && !query.Feed.matches(post) {
+			continue
+		}
+		if ids != nil && !ids[post.ID] {
+			continue
+		}
+		if post.Created.Before(since) {
+			continue
+		}
+		feed = append(feed, post)
+	}
+	sort.Slice(feed, func(i, j int) bool {
+		return precedes(feed[i], feed[j], order)
+	})
+
+	limit := query.limit()
+	start, end := 0, len(feed)
+	switch {
+	case query.After != "":
+		start = sort.Search(len(feed), func(i int) bool {
+			return precedes(from, feed[i], order)
+		})
+	case query.Before != "":
+		end = sort.Search(len(feed), func(i int) bool {
+			return !precedes(feed[i], from, order)
+		})
+	}
+
+	hasMore := end-start > limit
+	if hasMore {
+		if query.Before != "" {
+			start = end - limit
+		} else {
+			end = start + limit
+		}
+	}
+
+	posts := make([]Post, 0, end-start)
+	for _, post := range feed[start:end] {
+		posts = append(posts, *post.clone())
+	}
+	repo.RUnlock()
+
+	return newPostsPage(posts, query, hasMore), nil
+}
+
+// Search ищет по обратному индексу: пост находится, только если в нем есть каждое слово запроса
+// целиком или началом слова. Равные по релевантности - от новых к старым
+func (repo *PostMemoryRepo) Search(query SearchQuery) ([]Post, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+	repo.RLock()
+	defer repo.RUnlock()
+	scores := repo.index.search(query.Text)
+	found := make([]*Post, 0, len(scores))
+	for postID := range scores {
+		if post, ok := repo.Posts[postID]; ok && !post.Hidden && query.matches(post) {
+			found = append(found, post)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if scores[found[i].ID] != scores[found[j].ID] {
+			return scores[found[i].ID] > scores[found[j].ID]
+		}
+		return precedes(found[i], found[j], ranking.SortNew)
+	})
+	if limit := query.limit(); len(found) > limit {
+		found = found[:limit]
+	}
+
+	posts := make([]Post, 0, len(found))
+	for _, post := range found {
+		posts = append(posts, *post.clone())
+	}
+	return posts, nil
+}
@@ -0,0 +1,502 @@
+package post
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"redditclone/pkg/media"
+	"redditclone/pkg/preview"
+	"redditclone/pkg/role"
+	"redditclone/pkg/vote"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVotePostConcurrent(t *testing.T) {
+	repo := NewMemoryRepo()
+	votes := vote.NewMemoryRepo()
+	created, err := repo.CreatePost(NewPostRequest{Category: "music", Type: "text", Title: "t", Text: "x"}, "author", "author-id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = votes.SetVote(created.ID, "author-id", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const voters = 50
+	const rounds = 20
+	var wg sync.WaitGroup
+	for i := 0; i < voters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			userID := fmt.Sprintf("user%d", i)
+			for r := 0; r < rounds; r++ {
+				// вперемешку голосуем и читаем, как хендлеры: сериализация идет уже без лока
+				action := []int{1, -1, 0}[(i+r)%3]
+				previous, err := votes.SetVote(created.ID, userID, action)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				voted, err := repo.VotePost(created.ID, previous, action)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				if _, err = json.Marshal(voted); err != nil {
+					t.Errorf("marshal failed: %v", err)
+				}
+				got, err := repo.GetPost(created.ID)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				_, _ = json.Marshal(got)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	post, err := repo.GetPost(created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sum, ups, downs := 0, 0, 0
+	for _, v := range votes.Votes[created.ID] {
+		sum += v
+		switch v {
+		case 1:
+			ups++
+		case -1:
+			downs++
+		}
+	}
+	if post.Score != sum || post.Ups != ups || post.Downs != downs {
+		t.Errorf("counters %d/%d/%d do not match votes %d/%d/%d", post.Score, post.Ups, post.Downs, sum, ups, downs)
+	}
+	wantPercentage := 100
+	if ups+downs > 0 {
+		wantPercentage = int(float64(ups) / float64(ups+downs) * 100)
+	}
+	if post.UpvotePercentage != wantPercentage {
+		t.Errorf("expected upvote percentage %d, got %d", wantPercentage, post.UpvotePercentage)
+	}
+}
+
+func TestListPostsFeedFilter(t *testing.T) {
+	repo := NewMemoryRepo()
+	ids := make(map[string]string)
+	for _, p := range []struct{ category, author string }{
+		{"music", "alice"}, {"news", "bob"}, {"news", "carol"},
+	} {
+		created, err := repo.CreatePost(NewPostRequest{Category: p.category, Type: "text", Title: "t", Text: "x"}, p.author, p.author+"-id")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids[p.author] = created.ID
+	}
+
+	page, err := repo.ListPosts(ListQuery{Feed: &FeedFilter{Categories: []string{"music"}, Authors: []string{"bob"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Posts) != 2 {
+		t.Errorf("expected posts of music and bob, got %+v", page.Posts)
+	}
+	for _, p := range page.Posts {
+		if p.Author.Username == "carol" {
+			t.Errorf("carol is not in the feed")
+		}
+	}
+
+	page, err = repo.ListPosts(ListQuery{IDs: []string{ids["carol"]}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Posts) != 1 || page.Posts[0].ID != ids["carol"] {
+		t.Errorf("unexpected posts: %+v", page.Posts)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	repo := NewMemoryRepo()
+	golang, err := repo.CreatePost(NewPostRequest{Category: "programming", Type: "text", Title: "Golang generics", Text: "type parameters"}, "alice", "alice-id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	link, err := repo.CreatePost(NewPostRequest{Category: "news", Type: "link", Title: "Release notes", URL: "https://www.go.dev/doc"}, "bob", "bob-id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	search := func(query SearchQuery) []string {
+		t.Helper()
+		posts, err := repo.Search(query)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids := make([]string, 0, len(posts))
+		for _, p := range posts {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	if ids := search(SearchQuery{Text: "gener"}); len(ids) != 1 || ids[0] != golang.ID {
+		t.Errorf("prefix search: %v", ids)
+	}
+	if ids := search(SearchQuery{Text: "GOLANG parameters"}); len(ids) != 1 {
+		t.Errorf("all words should match: %v", ids)
+	}
+	if ids := search(SearchQuery{Text: "golang release"}); len(ids) != 0 {
+		t.Errorf("no post has both words: %v", ids)
+	}
+	if ids := search(SearchQuery{Text: "go.dev"}); len(ids) != 1 || ids[0] != link.ID {
+		t.Errorf("host search: %v", ids)
+	}
+	if ids := search(SearchQuery{Text: "go", Category: "news", Type: "link"}); len(ids) != 1 || ids[0] != link.ID {
+		t.Errorf("filtered search: %v", ids)
+	}
+	// слово в заголовке весит больше, чем в комменте
+	if _, err = repo.AddComment(link.ID, "carol", "carol-id", "generics finally"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := search(SearchQuery{Text: "generics"}); len(ids) != 2 || ids[0] != golang.ID {
+		t.Errorf("ranking: %v", ids)
+	}
+
+	commented, _ := repo.GetPost(link.ID)
+	if _, err = repo.DeleteComment(link.ID, commented.Comments[0].ID, role.Actor{UserID: "carol-id"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := search(SearchQuery{Text: "finally"}); len(ids) != 0 {
+		t.Errorf("deleted comment is still indexed: %v", ids)
+	}
+	if _, err = repo.DeletePost(golang.ID, role.Actor{UserID: "alice-id"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := search(SearchQuery{Text: "generics"}); len(ids) != 0 {
+		t.Errorf("deleted post is still indexed: %v", ids)
+	}
+	if len(repo.index.postings["generics"]) != 0 || len(repo.index.docs) != 1 {
+		t.Errorf("index is not cleaned up: %+v", repo.index)
+	}
+
+	if _, err = repo.Search(SearchQuery{Text: "  "}); !errors.Is(err, ErrEmptySearch) {
+		t.Errorf("expected ErrEmptySearch, got %v", err)
+	}
+}
+
+func TestRemovePostAndComment(t *testing.T) {
+	repo := NewMemoryRepo()
+	created, err := repo.CreatePost(NewPostRequest{Category: "news", Type: "link", Title: "Cheap pills", URL: "https://spam.com"}, "spammer", "spammer-id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	commented, err := repo.AddComment(created.ID, "spammer", "spammer-id", "buy now")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	removal, err := NewRemoval("mod", "spam", time.Now().UTC())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	removed, err := repo.RemoveComment(created.ID, commented.Comments[0].ID, removal)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c := removed.Comments[0]; c.Removed == nil || c.Body != "[removed: spam]" {
+		t.Errorf("unexpected comment: %+v", c)
+	}
+	removed, err = repo.RemovePost(created.ID, removal)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed.Removed == nil || removed.URL != "" || removed.Title != "Cheap pills" {
+		t.Errorf("unexpected post: %+v", removed)
+	}
+	if _, err = repo.RemovePost(created.ID, removal); !errors.Is(err, ErrRemoved) {
+		t.Errorf("expected ErrRemoved, got %v", err)
+	}
+	if _, err = repo.EditPost(created.ID, role.Actor{UserID: "spammer-id"}, EditPostRequest{Title: "Fine"}); !errors.Is(err, ErrRemoved) {
+		t.Errorf("author should not edit a removed post, got %v", err)
+	}
+
+	// убранное не должно находиться поиском ни по ссылке, ни по комменту
+	for _, text := range []string{"spam.com", "buy"} {
+		if posts, _ := repo.Search(SearchQuery{Text: text}); len(posts) != 0 {
+			t.Errorf("%q still finds removed content: %+v", text, posts)
+		}
+	}
+}
+
+func TestSetHidden(t *testing.T) {
+	repo := NewMemoryRepo()
+	hidden, err := repo.CreatePost(NewPostRequest{Category: "news", Type: "text", Title: "Reported golang post", Text: "text"}, "u", "uid")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	visible, err := repo.CreatePost(NewPostRequest{Category: "news", Type: "text", Title: "Fine golang post", Text: "text"}, "u", "uid")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = repo.SetHidden(hidden.ID, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if posts := repo.GetPosts(); len(posts) != 1 || posts[0].ID != visible.ID {
+		t.Errorf("expected only visible post in GetPosts, got %d posts", len(posts))
+	}
+	if posts := repo.GetPostsByCategory("news"); len(posts) != 1 {
+		t.Errorf("expected only visible post by category, got %d posts", len(posts))
+	}
+	if page, err := repo.ListPosts(ListQuery{}); err != nil || len(page.Posts) != 1 {
+		t.Errorf("expected only visible post in ListPosts, got %+v (%v)", page, err)
+	}
+	if found, err := repo.Search(SearchQuery{Text: "golang"}); err != nil || len(found) != 1 {
+		t.Errorf("expected only visible post in search, got %d (%v)", len(found), err)
+	}
+	// по ссылке спрятанный пост открывается, иначе модератору нечего проверять
+	if _, err = repo.GetPost(hidden.ID); err != nil {
+		t.Errorf("hidden post should still be reachable by id: %v", err)
+	}
+
+	if err = repo.SetHidden(hidden.ID, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if posts := repo.GetPosts(); len(posts) != 2 {
+		t.Errorf("expected both posts after unhide, got %d", len(posts))
+	}
+	if err = repo.SetHidden("missing", true); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("expected ErrPostNotFound, got %v", err)
+	}
+}
+
+func TestFindComment(t *testing.T) {
+	repo := NewMemoryRepo()
+	created, err := repo.CreatePost(NewPostRequest{Category: "news", Type: "text", Title: "Title", Text: "text"}, "alice", "alice-id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	commented, err := repo.AddComment(created.ID, "bob", "bob-id", "first!")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	comment, ok := commented.FindComment(commented.Comments[0].ID)
+	if !ok || comment.Body != "first!" || comment.Author.Username != "bob" {
+		t.Errorf("unexpected comment: %+v (%v)", comment, ok)
+	}
+	if _, ok = commented.FindComment("missing"); ok {
+		t.Error("expected no comment for unknown id")
+	}
+}
+
+func TestKarma(t *testing.T) {
+	repo := NewMemoryRepo()
+	created, err := repo.CreatePost(NewPostRequest{Category: "news", Type: "text", Title: "Title", Text: "text"}, "alice", "alice-id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	commented, err := repo.AddComment(created.ID, "alice", "alice-id", "mine")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = repo.AddComment(created.ID, "bob", "bob-id", "not mine"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = repo.VoteComment(created.ID, commented.Comments[0].ID, 0, -1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = repo.VotePost(created.ID, 0, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// пост: голос автора и еще один, коммент: минус один
+	if karma, _ := repo.Karma("alice-id"); karma != 1 {
+		t.Errorf("expected karma 1, got %d", karma)
+	}
+	if karma, _ := repo.Karma("nobody"); karma != 0 {
+		t.Errorf("expected karma 0, got %d", karma)
+	}
+}
+
+func TestPostsByLink(t *testing.T) {
+	repo := NewMemoryRepo()
+	link := func(category, url, userID string) *Post {
+		created, err := repo.CreatePost(NewPostRequest{Category: category, Type: "link", Title: "Title", URL: url}, userID, userID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return created
+	}
+	first := link("news", "https://example.com/a", "alice")
+	second := link("news", "http://www.example.com/a/?utm_source=feed", "bob")
+	other := link("tech", "https://example.com/a#top", "carol")
+	link("news", "https://example.com/b", "dave")
+
+	posts, err := repo.PostsByLink(first.LinkHash, "news")
+	if err != nil || len(posts) != 2 {
+		t.Fatalf("expected 2 posts in news, got %d (%v)", len(posts), err)
+	}
+	if all, _ := repo.PostsByLink(first.LinkHash, ""); len(all) != 3 {
+		t.Errorf("expected 3 posts in all communities, got %d", len(all))
+	}
+
+	if _, err = repo.RemovePost(second.ID, Removal{Moderator: "mod", Reason: "spam"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = repo.DeletePost(other.ID, role.Actor{UserID: "carol"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	all, _ := repo.PostsByLink(first.LinkHash, "")
+	if len(all) != 1 || all[0].ID != first.ID {
+		t.Errorf("removed and deleted posts should not be duplicates, got %+v", all)
+	}
+}
+
+func TestSetPreview(t *testing.T) {
+	repo := NewMemoryRepo()
+	created, err := repo.CreatePost(NewPostRequest{Category: "news", Type: "link", Title: "Title", URL: "https://example.com"}, "alice", "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := repo.SetPreview(created.ID, preview.Preview{Title: "Example"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, _ := repo.GetPost(created.ID)
+	if got.Preview == nil || got.Preview.Title != "Example" {
+		t.Errorf("preview is not saved: %+v", got.Preview)
+	}
+
+	if _, err := repo.RemovePost(created.ID, Removal{Moderator: "mod", Reason: "spam"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ = repo.GetPost(created.ID); got.Preview != nil {
+		t.Errorf("removal should drop preview: %+v", got.Preview)
+	}
+	if err := repo.SetPreview(created.ID, preview.Preview{Title: "late"}); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("expected ErrPostNotFound for removed post, got %v", err)
+	}
+	if err := repo.SetPreview("nope", preview.Preview{}); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("expected ErrPostNotFound, got %v", err)
+	}
+}
+
+func TestCreateImagePost(t *testing.T) {
+	repo := NewMemoryRepo()
+	m := &media.Media{Key: "abc.png", ThumbnailKey: "abc_thumb.jpg", URL: "/media/abc.png"}
+	created, err := repo.CreatePost(NewPostRequest{Category: "pics", Type: "image", Title: "cat", Text: "look", Media: m}, "alice", "1")
+	if err != nil || created.Media != m || created.Text != "look" || created.LinkHash != "" {
+		t.Fatalf("unexpected post: %+v, %v", created, err)
+	}
+	// медиа у поста только при загрузке: в текстовый пост его не подсунуть
+	text, _ := repo.CreatePost(NewPostRequest{Category: "pics", Type: "text", Title: "t", Media: m}, "alice", "1")
+	if text.Media != nil {
+		t.Errorf("text post should not get media: %+v", text.Media)
+	}
+
+	removed, err := repo.RemovePost(created.ID, Removal{Moderator: "mod", Reason: "nsfw"})
+	if err != nil || removed.Media != nil {
+		t.Errorf("removal should drop media: %+v, %v", removed, err)
+	}
+}
+
+func TestVotePoll(t *testing.T) {
+	repo := NewMemoryRepo()
+	request := NewPostRequest{Category: "polls", Type: "poll", Title: "?", Poll: &NewPollRequest{Options: []string{"a", "b", "c"}, Multiple: true}}
+	created, err := repo.CreatePost(request, "alice", "1")
+	if err != nil || created.Poll == nil || len(created.Poll.Options) != 3 {
+		t.Fatalf("unexpected post: %+v, %v", created, err)
+	}
+
+	// один юзер жмет много раз параллельно - засчитывается один бюллетень, чужие голоса не теряются
+	var wg sync.WaitGroup
+	var accepted int32
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.VotePoll(created.ID, "bob", []int{0, 2}); err == nil {
+				atomic.AddInt32(&accepted, 1)
+			} else if !errors.Is(err, ErrAlreadyVoted) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			if _, err := repo.VotePoll(created.ID, fmt.Sprintf("u%d", i), []int{1}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Errorf("expected exactly one ballot of bob, got %d", accepted)
+	}
+
+	got, _ := repo.GetPost(created.ID)
+	got.Poll.View(got.Poll.ChoicesOf("bob"), time.Now())
+	if got.Poll.Voters != 21 || !reflect.DeepEqual(got.Poll.Results, []int{1, 20, 1}) || !reflect.DeepEqual(got.Poll.Choices, []int{0, 2}) {
+		t.Errorf("unexpected poll: %+v", got.Poll)
+	}
+	if got.Score != 1 || got.Ups != 1 {
+		t.Errorf("poll votes should not touch post score: %+v", got)
+	}
+	// View правит только копию
+	if stored, _ := repo.GetPost(created.ID); stored.Poll.Results != nil {
+		t.Errorf("stored poll should not be touched by View: %+v", stored.Poll)
+	}
+
+	text, _ := repo.CreatePost(NewPostRequest{Category: "polls", Type: "text", Title: "t"}, "alice", "1")
+	if _, err := repo.VotePoll(text.ID, "bob", []int{0}); !errors.Is(err, ErrNotPoll) {
+		t.Errorf("expected ErrNotPoll, got %v", err)
+	}
+	if _, err := repo.VotePoll("nope", "bob", []int{0}); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("expected ErrPostNotFound, got %v", err)
+	}
+	if _, err := repo.RemovePost(created.ID, Removal{Moderator: "mod", Reason: "spam"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := repo.VotePoll(created.ID, "carol", []int{0}); !errors.Is(err, ErrNotPoll) {
+		t.Errorf("removed post has no poll anymore, got %v", err)
+	}
+}
+
+func TestRenderedHTML(t *testing.T) {
+	repo := NewMemoryRepo()
+	created, err := repo.CreatePost(NewPostRequest{Category: "news", Type: "text", Title: "t", Text: "**hi** <script>alert(1)</script>"}, "alice", "1")
+	if err != nil || created.TextHTML != "<p><strong>hi</strong> &lt;script&gt;alert(1)&lt;/script&gt;</p>\n" {
+		t.Fatalf("unexpected post: %q, %v", created.TextHTML, err)
+	}
+	link, _ := repo.CreatePost(NewPostRequest{Category: "news", Type: "link", Title: "t", URL: "https://x.com"}, "alice", "1")
+	if link.TextHTML != "" {
+		t.Errorf("link post should have no text: %q", link.TextHTML)
+	}
+
+	commented, err := repo.AddComment(created.ID, "bob", "2", "[x](javascript:alert(1)) u/alice")
+	if err != nil || commented.Comments[0].BodyHTML != `<p>x <a href="/u/alice">u/alice</a></p>`+"\n" {
+		t.Fatalf("unexpected comment: %q, %v", commented.Comments[0].BodyHTML, err)
+	}
+	commentID := commented.Comments[0].ID
+
+	edited, err := repo.EditPost(created.ID, role.Actor{UserID: "1"}, EditPostRequest{Text: ">!spoiler!<"})
+	if err != nil || edited.TextHTML != `<p><span class="md-spoiler">spoiler</span></p>`+"\n" {
+		t.Errorf("unexpected edit: %q, %v", edited.TextHTML, err)
+	}
+	edited, err = repo.EditComment(created.ID, commentID, role.Actor{UserID: "2"}, "~~old~~")
+	if err != nil || edited.Comments[0].BodyHTML != "<p><del>old</del></p>\n" {
+		t.Errorf("unexpected comment edit: %q, %v", edited.Comments[0].BodyHTML, err)
+	}
+
+	removed, err := repo.RemovePost(created.ID, Removal{Moderator: "mod", Reason: "spam"})
+	if err != nil || removed.TextHTML != "<p>[removed: spam]</p>\n" {
+		t.Errorf("unexpected removal: %q, %v", removed.TextHTML, err)
+	}
+}
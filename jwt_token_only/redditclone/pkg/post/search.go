@@ -0,0 +1,69 @@
+package post
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrEmptySearch    = errors.New("search query is empty")
+	ErrBadSearchRange = errors.New("bad date range")
+)
+
+// SearchQuery - поиск по заголовку, тексту, хосту ссылки и комментам.
+// Остальные поля - фильтры, пустые не применяются. From включительно, To - нет
+type SearchQuery struct {
+	Text     string
+	Category string
+	Author   string
+	Type     string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+func (q SearchQuery) validate() error {
+	if len(tokenize(q.Text)) == 0 {
+		return ErrEmptySearch
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return ErrBadSearchRange
+	}
+	return nil
+}
+
+func (q SearchQuery) limit() int {
+	return ListQuery{Limit: q.Limit}.limit()
+}
+
+// matches - подходит ли пост под фильтры, сам текст тут не проверяется
+func (q SearchQuery) matches(p *Post) bool {
+	switch {
+	case q.Category != "" && p.Category != q.Category,
+		q.Author != "" && p.Author.Username != q.Author,
+		q.Type != "" && p.Type != q.Type,
+		!q.From.IsZero() && p.Created.Before(q.From),
+		!q.To.IsZero() && !p.Created.Before(q.To):
+		return false
+	}
+	return true
+}
+
+// tokenize режет текст на слова в нижнем регистре, все, что не буква и не цифра, - разделитель
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// urlHost - хост ссылки без www., по нему ищутся ссылки с одного сайта
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
@@ -0,0 +1,109 @@
+package post
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// совпадение в заголовке важнее, чем в тексте, хосте или комменте
+	titleWeight = 3
+	bodyWeight  = 1
+	// слово целиком ценнее, чем совпадение только по началу
+	exactMatchBonus = 2
+)
+
+// searchIndex - обратный индекс для поиска в памяти: слово -> посты, где оно встречается, с весом.
+// Слова еще лежат отсортированным списком, чтобы искать по префиксу бинарным поиском.
+// Своей блокировки нет, его защищает мьютекс PostMemoryRepo
+type searchIndex struct {
+	terms    []string
+	postings map[string]map[string]int
+	// postID -> слово -> вес, чтобы убирать пост из индекса, не перебирая весь словарь
+	docs map[string]map[string]int
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[string]int),
+		docs:     make(map[string]map[string]int),
+	}
+}
+
+// add индексирует пост заново целиком: проще, чем высчитывать, какие слова ушли после правки или удаления коммента
+func (idx *searchIndex) add(p *Post) {
+	idx.remove(p.ID)
+	weights := make(map[string]int)
+	addText := func(text string, weight int) {
+		for _, term := range tokenize(text) {
+			weights[term] += weight
+		}
+	}
+	addText(p.Title, titleWeight)
+	addText(p.Text, bodyWeight)
+	addText(urlHost(p.URL), bodyWeight)
+	for _, comment := range p.Comments {
+		if !comment.Deleted {
+			addText(comment.Body, bodyWeight)
+		}
+	}
+
+	for term, weight := range weights {
+		postings, ok := idx.postings[term]
+		if !ok {
+			postings = make(map[string]int)
+			idx.postings[term] = postings
+			i := sort.SearchStrings(idx.terms, term)
+			idx.terms = append(idx.terms, "")
+			copy(idx.terms[i+1:], idx.terms[i:])
+			idx.terms[i] = term
+		}
+		postings[p.ID] = weight
+	}
+	idx.docs[p.ID] = weights
+}
+
+func (idx *searchIndex) remove(postID string) {
+	for term := range idx.docs[postID] {
+		postings := idx.postings[term]
+		delete(postings, postID)
+		if len(postings) > 0 {
+			continue
+		}
+		delete(idx.postings, term)
+		i := sort.SearchStrings(idx.terms, term)
+		idx.terms = append(idx.terms[:i], idx.terms[i+1:]...)
+	}
+	delete(idx.docs, postID)
+}
+
+// search - посты, где каждое слово запроса встречается целиком или как начало слова, со счетом релевантности
+func (idx *searchIndex) search(text string) map[string]int {
+	var scores map[string]int
+	for _, token := range tokenize(text) {
+		tokenScores := make(map[string]int)
+		for i := sort.SearchStrings(idx.terms, token); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], token); i++ {
+			term := idx.terms[i]
+			bonus := 1
+			if term == token {
+				bonus = exactMatchBonus
+			}
+			for postID, weight := range idx.postings[term] {
+				tokenScores[postID] += weight * bonus
+			}
+		}
+
+		if scores == nil {
+			scores = tokenScores
+			continue
+		}
+		for postID, score := range scores {
+			if tokenScore, ok := tokenScores[postID]; ok {
+				scores[postID] = score + tokenScore
+			} else {
+				delete(scores, postID)
+			}
+		}
+	}
+	return scores
+}
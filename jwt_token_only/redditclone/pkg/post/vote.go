@@ -0,0 +1,38 @@
+package post
+
+// applyVote переносит голос юзера со старого на новый в счетчиках поста: 1 - апвоут, -1 - даунвоут, 0 - нет голоса.
+// Сами голоса лежат в отдельном хранилище, см. vote.VoteRepo - тут только денормализованные счетчики
+func (p *Post) applyVote(oldVote, newVote int) {
+	p.Score += newVote - oldVote
+	p.countVote(oldVote, -1)
+	p.countVote(newVote, 1)
+	p.refreshUpvotePercentage()
+}
+
+func (p *Post) countVote(vote, delta int) {
+	countVote(&p.Ups, &p.Downs, vote, delta)
+}
+
+func (c *Comment) applyVote(oldVote, newVote int) {
+	c.Score += newVote - oldVote
+	countVote(&c.Ups, &c.Downs, oldVote, -1)
+	countVote(&c.Ups, &c.Downs, newVote, 1)
+}
+
+func countVote(ups, downs *int, vote, delta int) {
+	switch vote {
+	case 1:
+		*ups += delta
+	case -1:
+		*downs += delta
+	}
+}
+
+func (p *Post) refreshUpvotePercentage() {
+	totalVotes := p.Ups + p.Downs
+	if totalVotes <= 0 {
+		p.UpvotePercentage = 100
+		return
+	}
+	p.UpvotePercentage = int((float64(p.Ups) / float64(totalVotes)) * 100)
+}
@@ -0,0 +1,418 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"redditclone/pkg/media"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type Options struct {
+	Timeout  time.Duration
+	MaxBody  int64
+	MaxImage int64
+	// Blocked - домены, куда не ходим, вместе с поддоменами
+	Blocked []string
+}
+
+// Fetcher ходит на чужие сайты от имени сервера, поэтому пускает только на публичные адреса:
+// иначе ссылкой на http://127.0.0.1:6379 или 169.254.169.254 можно было бы читать внутреннюю сеть
+type Fetcher struct {
+	client  *http.Client
+	options Options
+	blocked []string
+	// allowIP - проверка адреса после резолва, тесты подменяют ее, чтобы ходить в httptest
+	allowIP func(ip net.IP) bool
+}
+
+func NewFetcher(options Options) *Fetcher {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	if options.MaxBody <= 0 {
+		options.MaxBody = DefaultMaxBody
+	}
+	if options.MaxImage <= 0 {
+		options.MaxImage = DefaultMaxImage
+	}
+	f := &Fetcher{options: options, allowIP: publicIP}
+	for _, domain := range options.Blocked {
+		domain = strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), "."), "www.")
+		if domain != "" {
+			f.blocked = append(f.blocked, domain)
+		}
+	}
+
+	dialer := &net.Dialer{
+		Timeout: options.Timeout,
+		// Control вызывается уже с адресом после резолва, так что подмена DNS между проверкой и запросом не поможет
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !f.allowIP(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+			return nil
+		},
+	}
+	f.client = &http.Client{
+		Timeout: options.Timeout,
+		Transport: &http.Transport{
+			// прокси из окружения не берем: через него проверка адресов не работала бы
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   options.Timeout,
+			ResponseHeaderTimeout: options.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if err := f.checkURL(req.URL); err != nil {
+				return err
+			}
+			// robots.txt проверяли только у исходного хоста, а редирект мог увести на чужой и на закрытый путь.
+			// Сам robots.txt тоже бывает с редиректом - его не проверяем, иначе хосты могли бы гонять нас по кругу
+			if req.URL.Host == via[len(via)-1].URL.Host || req.Context().Value(robotsKey) != nil {
+				return nil
+			}
+			return f.robotsAllow(req.Context(), req.URL)
+		},
+	}
+	return f
+}
+
+var reservedNets = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10", // CGNAT
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"240.0.0.0/4",
+	"64:ff9b::/96", // NAT64 ведет на те же IPv4
+	"2001:db8::/32",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Fetcher) checkURL(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return ErrBadURL
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, domain := range f.blocked {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return ErrBlocked
+		}
+	}
+	return nil
+}
+
+// get скачивает rawURL не больше limit байт. truncate - что делать с остатком: от страницы
+// хватит и начала, метатеги в head, а обрезанная картинка не нужна
+func (f *Fetcher) get(ctx context.Context, u *url.URL, limit int64, truncate bool, accept func(mediaType string) bool) ([]byte, *url.URL, error) {
+	if err := f.checkURL(u); err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, ErrBadURL
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, u.Host)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !accept(mediaType) {
+		return nil, nil, fmt.Errorf("%w: %q", ErrContentType, resp.Header.Get("Content-Type"))
+	}
+	if resp.ContentLength > limit && !truncate {
+		return nil, nil, ErrTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(body)) > limit {
+		if !truncate {
+			return nil, nil, ErrTooLarge
+		}
+		body = body[:limit]
+	}
+	return body, resp.Request.URL, nil
+}
+
+func isHTML(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+func isImage(mediaType string) bool {
+	return mediaType == "image/jpeg" || mediaType == "image/png" || mediaType == "image/gif"
+}
+
+// Page скачивает страницу и достает из нее превью. Картинку не качает, только ссылку на нее
+func (f *Fetcher) Page(ctx context.Context, rawURL string) (Preview, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return Preview{}, ErrBadURL
+	}
+	if err := f.robotsAllow(ctx, u); err != nil {
+		return Preview{}, err
+	}
+	body, final, err := f.get(ctx, u, f.options.MaxBody, true, isHTML)
+	if err != nil {
+		return Preview{}, err
+	}
+	p := parseMeta(body, final)
+	if p.Title == "" && p.Description == "" && p.Image == "" {
+		return Preview{}, ErrNoPreview
+	}
+	return p, nil
+}
+
+// Image скачивает картинку превью целиком и сразу ужимает в миниатюру
+func (f *Fetcher) Image(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrBadURL
+	}
+	if err := f.robotsAllow(ctx, u); err != nil {
+		return nil, err
+	}
+	body, _, err := f.get(ctx, u, f.options.MaxImage, false, isImage)
+	if err != nil {
+		return nil, err
+	}
+	thumb, err := media.Thumbnail(body, media.ThumbnailSize)
+	switch {
+	case errors.Is(err, media.ErrUnsupported):
+		return nil, fmt.Errorf("%w: %v", ErrContentType, err)
+	case errors.Is(err, media.ErrTooLarge):
+		return nil, ErrTooLarge
+	}
+	return thumb, err
+}
+
+type robotsKeyType struct{}
+
+// robotsKey помечает контекст запроса за robots.txt, см. CheckRedirect
+var robotsKey robotsKeyType
+
+// robotsAllow - урезанный robots.txt: группа для нашего агента или для *, Allow/Disallow с * и $,
+// побеждает самое длинное правило. Нет файла - можно все
+func (f *Fetcher) robotsAllow(ctx context.Context, u *url.URL) error {
+	if err := f.checkURL(u); err != nil {
+		return err
+	}
+	robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	body, _, err := f.get(context.WithValue(ctx, robotsKey, true), robotsURL, maxRobots, true, func(mediaType string) bool {
+		return mediaType == "text/plain"
+	})
+	if err != nil {
+		if errors.Is(err, ErrPrivateAddress) || errors.Is(err, ErrBlocked) || errors.Is(err, ErrBadURL) {
+			return err
+		}
+		// 404, html-заглушка вместо robots.txt и тому подобное
+		return nil
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if !robotsRules(string(body)).allows(path) {
+		return ErrRobots
+	}
+	return nil
+}
+
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+type robotsGroup []robotsRule
+
+func (g robotsGroup) allows(path string) bool {
+	best, allowed := -1, true
+	for _, rule := range g {
+		if rule.length < best || !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > best || rule.allow {
+			best, allowed = rule.length, rule.allow
+		}
+	}
+	return allowed
+}
+
+// robotsRules выбирает правила для нас: группа со своим агентом важнее группы *
+func robotsRules(robots string) robotsGroup {
+	agent := strings.ToLower(strings.SplitN(UserAgent, "/", 2)[0])
+	var own, wildcard, current robotsGroup
+	var agents []string
+	inRules := false
+	flush := func() {
+		for _, a := range agents {
+			if a == "*" {
+				wildcard = append(wildcard, current...)
+			} else if strings.Contains(agent, a) {
+				own = append(own, current...)
+			}
+		}
+	}
+	for _, line := range strings.Split(robots, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if inRules {
+				flush()
+				agents, current, inRules = nil, nil, false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				// пустой Disallow - можно все
+				continue
+			}
+			current = append(current, robotsRule{allow: key == "allow", length: len(value), pattern: robotsPattern(value)})
+		}
+	}
+	flush()
+	if own != nil {
+		return own
+	}
+	return wildcard
+}
+
+func robotsPattern(value string) *regexp.Regexp {
+	anchored := strings.HasSuffix(value, "$")
+	value = strings.TrimSuffix(value, "$")
+	pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(value), `\*`, ".*")
+	if anchored {
+		pattern += "$"
+	}
+	return regexp.MustCompile(pattern)
+}
+
+var (
+	metaTagRe   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attributeRe = regexp.MustCompile(`(?is)([a-z:_-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+	titleTagRe  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// parseMeta достает og:*, потом twitter:*, потом обычные description и title.
+// Настоящий html-парсер тут не нужен: метатеги - одиночные теги с атрибутами
+func parseMeta(body []byte, base *url.URL) Preview {
+	if end := strings.Index(strings.ToLower(string(body)), "</head>"); end >= 0 {
+		body = body[:end]
+	}
+	meta := make(map[string]string)
+	for _, tag := range metaTagRe.FindAll(body, -1) {
+		attributes := make(map[string]string)
+		for _, m := range attributeRe.FindAllSubmatch(tag, -1) {
+			attributes[strings.ToLower(string(m[1]))] = strings.Trim(string(m[2]), `"'`)
+		}
+		key := attributes["property"]
+		if key == "" {
+			key = attributes["name"]
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if _, seen := meta[key]; key != "" && !seen {
+			meta[key] = clean(attributes["content"])
+		}
+	}
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if meta[key] != "" {
+				return meta[key]
+			}
+		}
+		return ""
+	}
+
+	p := Preview{
+		Title:       first("og:title", "twitter:title"),
+		Description: first("og:description", "twitter:description", "description"),
+		SiteName:    first("og:site_name"),
+	}
+	if p.Title == "" {
+		if m := titleTagRe.FindSubmatch(body); m != nil {
+			p.Title = clean(string(m[1]))
+		}
+	}
+	p.Title = truncate(p.Title, maxTitleLength)
+	p.Description = truncate(p.Description, maxDescriptionLength)
+	if image := first("og:image:secure_url", "og:image", "og:image:url", "twitter:image", "twitter:image:src"); image != "" {
+		if u, err := base.Parse(image); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			p.Image = u.String()
+		}
+	}
+	return p
+}
+
+func clean(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
@@ -0,0 +1,100 @@
+package preview
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type job struct {
+	postID string
+	url    string
+}
+
+// Worker грузит превью в фоне: пост создается сразу, карточка ссылки появляется у него позже
+type Worker struct {
+	fetcher *Fetcher
+	store   ThumbnailStore
+	sink    Sink
+	logger  *zap.SugaredLogger
+	jobs    chan job
+	now     func() time.Time
+}
+
+func NewWorker(fetcher *Fetcher, store ThumbnailStore, sink Sink, queueSize int, logger *zap.SugaredLogger) *Worker {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	return &Worker{
+		fetcher: fetcher,
+		store:   store,
+		sink:    sink,
+		logger:  logger,
+		jobs:    make(chan job, queueSize),
+		now:     time.Now,
+	}
+}
+
+// Enqueue не блокирует: если очередь забита, пост просто останется без превью
+func (w *Worker) Enqueue(postID, rawURL string) {
+	if w == nil {
+		return
+	}
+	select {
+	case w.jobs <- job{postID: postID, url: rawURL}:
+	default:
+		w.logger.Warnf("Preview queue is full, skipping post %s", postID)
+	}
+}
+
+// Run разбирает очередь в workers горутин, пока не отменят ctx. Недоделанное в очереди теряется
+func (w *Worker) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < max(1, workers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case j := <-w.jobs:
+					if err := w.Unfurl(ctx, j.postID, j.url); err != nil {
+						w.logger.Infof("No preview for post %s (%s): %v", j.postID, j.url, err)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Unfurl - одна ссылка целиком: страница, миниатюра, запись в пост.
+// Без миниатюры превью все равно сохраняется - заголовка и описания уже достаточно
+func (w *Worker) Unfurl(ctx context.Context, postID, rawURL string) error {
+	// страница, robots.txt и картинка со своим robots.txt - на все вместе
+	ctx, cancel := context.WithTimeout(ctx, 4*w.fetcher.options.Timeout)
+	defer cancel()
+
+	p, err := w.fetcher.Page(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+	if p.Image != "" && w.store != nil {
+		data, err := w.fetcher.Image(ctx, p.Image)
+		if err == nil {
+			p.Thumbnail, err = w.store.SaveThumbnail(postID+".jpg", data)
+		}
+		if err != nil {
+			w.logger.Infof("No thumbnail for post %s (%s): %v", postID, p.Image, err)
+		}
+	}
+	p.Fetched = w.now()
+	if err := w.sink.SetPreview(postID, p); err != nil {
+		return err
+	}
+	w.logger.Debugf("Saved preview for post %s", postID)
+	return nil
+}
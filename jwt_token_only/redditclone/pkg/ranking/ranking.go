@@ -0,0 +1,138 @@
+package ranking
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Формулы как у реддита: hot/rising не зависят от момента запроса (время поста просто сдвигает
+// логарифм активности), поэтому их можно посчитать один раз при записи и сортировать по индексу
+const (
+	SortHot           Sort = "hot"
+	SortTop           Sort = "top"
+	SortNew           Sort = "new"
+	SortRising        Sort = "rising"
+	SortControversial Sort = "controversial"
+	// только для комментов
+	SortBest Sort = "best"
+
+	PeriodDay   Period = "day"
+	PeriodWeek  Period = "week"
+	PeriodMonth Period = "month"
+	PeriodYear  Period = "year"
+	PeriodAll   Period = "all"
+
+	// за столько секунд пост "дорожает" на один порядок голосов
+	hotDecay    = 45000
+	risingDecay = 10800
+	// коммент в rising весит как два голоса
+	commentWeight = 2
+
+	RisingWindow = 24 * time.Hour
+
+	// z для 95% доверительного интервала в Best
+	bestZ = 1.96
+)
+
+var redditEpoch = time.Date(2005, 12, 8, 7, 46, 43, 0, time.UTC)
+
+var (
+	ErrBadSort   = errors.New("bad sort")
+	ErrBadPeriod = errors.New("bad period")
+)
+
+type Sort string
+
+type Period string
+
+func ParseSort(s string) (Sort, error) {
+	switch Sort(s) {
+	case "":
+		return SortHot, nil
+	case SortHot, SortTop, SortNew, SortRising, SortControversial:
+		return Sort(s), nil
+	}
+	return "", ErrBadSort
+}
+
+// ParseCommentSort - у комментов свой набор сортировок, по умолчанию best
+func ParseCommentSort(s string) (Sort, error) {
+	switch Sort(s) {
+	case "":
+		return SortBest, nil
+	case SortBest, SortTop, SortNew, SortControversial:
+		return Sort(s), nil
+	}
+	return "", ErrBadSort
+}
+
+func ParsePeriod(s string) (Period, error) {
+	switch Period(s) {
+	case "":
+		return PeriodDay, nil
+	case PeriodDay, PeriodWeek, PeriodMonth, PeriodYear, PeriodAll:
+		return Period(s), nil
+	}
+	return "", ErrBadPeriod
+}
+
+// Since - с какого момента брать посты для top за период. Нулевое время - без ограничения
+func (p Period) Since(now time.Time) time.Time {
+	switch p {
+	case PeriodDay:
+		return now.Add(-24 * time.Hour)
+	case PeriodWeek:
+		return now.AddDate(0, 0, -7)
+	case PeriodMonth:
+		return now.AddDate(0, -1, 0)
+	case PeriodYear:
+		return now.AddDate(-1, 0, 0)
+	}
+	return time.Time{}
+}
+
+func logActivity(activity int) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(activity)), 1))
+	switch {
+	case activity > 0:
+		return order
+	case activity < 0:
+		return -order
+	}
+	return 0
+}
+
+func Hot(score int, created time.Time) float64 {
+	seconds := created.Sub(redditEpoch).Seconds()
+	return logActivity(score) + seconds/hotDecay
+}
+
+// Rising - тот же hot, но с комментами и гораздо быстрее затухает, так что наверх
+// вылезают свежие посты, которые активно обсуждают
+func Rising(score, comments int, created time.Time) float64 {
+	seconds := created.Sub(redditEpoch).Seconds()
+	return logActivity(score+commentWeight*comments) + seconds/risingDecay
+}
+
+// Controversy - много голосов и примерно поровну в обе стороны
+func Controversy(ups, downs int) float64 {
+	if ups <= 0 || downs <= 0 {
+		return 0
+	}
+	magnitude := float64(ups + downs)
+	balance := float64(min(ups, downs)) / float64(max(ups, downs))
+	return math.Pow(magnitude, balance)
+}
+
+// Best - нижняя граница доверительного интервала Уилсона для доли апвоутов: коммент с 10 из 10 выше,
+// чем с 1 из 1, хотя доля у них одинаковая
+func Best(ups, downs int) float64 {
+	n := float64(ups + downs)
+	if n == 0 {
+		return 0
+	}
+	p := float64(ups) / n
+	z2 := bestZ * bestZ
+	return (p + z2/(2*n) - bestZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
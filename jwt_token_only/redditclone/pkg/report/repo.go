@@ -0,0 +1,105 @@
+package report
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ReportMemoryRepo struct {
+	sync.RWMutex
+	items     map[string]*Item
+	threshold int
+}
+
+// NewMemoryRepo - threshold жалоб прячет пост из лент, 0 - не прятать никогда
+func NewMemoryRepo(threshold int) *ReportMemoryRepo {
+	return &ReportMemoryRepo{
+		items:     make(map[string]*Item),
+		threshold: threshold,
+	}
+}
+
+func (it *Item) clone() *Item {
+	c := *it
+	c.Reports = append([]Report(nil), it.Reports...)
+	return &c
+}
+
+func (repo *ReportMemoryRepo) Report(target Target, report Report) (*Item, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	itemID := ItemID(target.PostID, target.CommentID)
+	item, ok := repo.items[itemID]
+	if !ok {
+		item = newItem(target, report.Created)
+	}
+	if err := item.add(report, repo.threshold); err != nil {
+		return nil, err
+	}
+	repo.items[itemID] = item
+	return item.clone(), nil
+}
+
+func (repo *ReportMemoryRepo) Get(itemID string) (*Item, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	item, ok := repo.items[itemID]
+	if !ok {
+		return nil, ErrNoItem
+	}
+	return item.clone(), nil
+}
+
+func (repo *ReportMemoryRepo) Resolve(itemID string, status Status, moderator string) (*Item, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	item, ok := repo.items[itemID]
+	if !ok {
+		return nil, ErrNoItem
+	}
+	if err := item.resolve(status, moderator, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return item.clone(), nil
+}
+
+func (repo *ReportMemoryRepo) Queue(query QueueQuery) ([]Item, error) {
+	repo.RLock()
+	queue := make([]*Item, 0)
+	for _, item := range repo.items {
+		if item.Status == StatusOpen && (query.All || moderates(query.Communities, item.Category)) {
+			queue = append(queue, item)
+		}
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		if queue[i].Count != queue[j].Count {
+			return queue[i].Count > queue[j].Count
+		}
+		if !queue[i].Created.Equal(queue[j].Created) {
+			return queue[i].Created.Before(queue[j].Created)
+		}
+		return queue[i].ID < queue[j].ID
+	})
+	if limit := query.limit(); len(queue) > limit {
+		queue = queue[:limit]
+	}
+
+	items := make([]Item, 0, len(queue))
+	for _, item := range queue {
+		items = append(items, *item.clone())
+	}
+	repo.RUnlock()
+	return items, nil
+}
+
+// moderates - сообщества модератора хранятся в нижнем регистре, категории постов - как их назвали
+func moderates(communities []string, category string) bool {
+	for _, community := range communities {
+		if strings.EqualFold(community, category) {
+			return true
+		}
+	}
+	return false
+}
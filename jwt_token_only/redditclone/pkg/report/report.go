@@ -0,0 +1,167 @@
+package report
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// столько открытых жалоб - и пост пропадает из лент до решения модератора
+	DefaultHideThreshold = 5
+
+	DefaultQueueLimit = 100
+
+	maxReasonLength  = 300
+	maxExcerptLength = 200
+)
+
+type Status string
+
+const (
+	StatusOpen     Status = "open"
+	StatusApproved Status = "approved"
+	StatusRemoved  Status = "removed"
+	StatusIgnored  Status = "ignored"
+)
+
+var (
+	ErrNoItem           = errors.New("report not found")
+	ErrAlreadyReported  = errors.New("already reported")
+	ErrNotOpen          = errors.New("report is already resolved")
+	ErrBadReason        = errors.New("report reason is required")
+	ErrBadResolution    = errors.New("bad resolution")
+	ErrAlreadyModerated = errors.New("content is already removed")
+)
+
+// Target - на что жалуются. CommentID пустой - на сам пост
+type Target struct {
+	PostID    string
+	CommentID string
+	Category  string
+	// что показать модератору в очереди, чтобы не ходить за каждым постом
+	Title   string
+	Excerpt string
+}
+
+type Report struct {
+	ReporterID string    `json:"-"`
+	Reporter   string    `json:"reporter"`
+	Reason     string    `json:"reason"`
+	Created    time.Time `json:"created"`
+	// Hold прячет пост сразу, без порога жалоб: так автомодератор придерживает пост до модератора
+	Hold bool `json:"hold,omitempty"`
+}
+
+// NewReport проверяет причину, как модераторскую в post.NewRemoval
+func NewReport(reporter, reporterID, reason string, now time.Time) (Report, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len([]rune(reason)) > maxReasonLength {
+		return Report{}, ErrBadReason
+	}
+	return Report{ReporterID: reporterID, Reporter: reporter, Reason: reason, Created: now}, nil
+}
+
+// Item - все жалобы на один пост или коммент. После решения модератора жалобы остаются для истории,
+// а новая жалоба открывает его заново с чистого листа
+type Item struct {
+	ID         string    `json:"id"`
+	PostID     string    `json:"postId"`
+	CommentID  string    `json:"commentId,omitempty"`
+	Category   string    `json:"category"`
+	Title      string    `json:"title"`
+	Excerpt    string    `json:"excerpt"`
+	Reports    []Report  `json:"reports"`
+	Count      int       `json:"count"`
+	Status     Status    `json:"status"`
+	Hidden     bool      `json:"hidden"`
+	ResolvedBy string    `json:"resolvedBy,omitempty"`
+	Created    time.Time `json:"created"`
+	Updated    time.Time `json:"updated"`
+}
+
+// QueueQuery - какие открытые жалобы показать: админу все, модератору - по его сообществам
+type QueueQuery struct {
+	All         bool
+	Communities []string
+	Limit       int
+}
+
+func (q QueueQuery) limit() int {
+	if q.Limit <= 0 || q.Limit > DefaultQueueLimit {
+		return DefaultQueueLimit
+	}
+	return q.Limit
+}
+
+type ReportRepo interface {
+	// Report добавляет жалобу, один юзер жалуется на одно и то же один раз
+	Report(target Target, report Report) (*Item, error)
+	Get(itemID string) (*Item, error)
+	// Queue - открытые жалобы, сначала те, на которые жалуются больше
+	Queue(query QueueQuery) ([]Item, error)
+	Resolve(itemID string, status Status, moderator string) (*Item, error)
+}
+
+func ItemID(postID, commentID string) string {
+	if commentID == "" {
+		return postID
+	}
+	return postID + ":" + commentID
+}
+
+func newItem(target Target, now time.Time) *Item {
+	excerpt := []rune(target.Excerpt)
+	if len(excerpt) > maxExcerptLength {
+		excerpt = excerpt[:maxExcerptLength]
+	}
+	return &Item{
+		ID:        ItemID(target.PostID, target.CommentID),
+		PostID:    target.PostID,
+		CommentID: target.CommentID,
+		Category:  target.Category,
+		Title:     target.Title,
+		Excerpt:   string(excerpt),
+		Reports:   []Report{},
+		Status:    StatusOpen,
+		Created:   now,
+	}
+}
+
+// add - новая жалоба. Убранное модератором обжаловать уже нечего, решенное открывается заново
+func (it *Item) add(report Report, threshold int) error {
+	switch it.Status {
+	case StatusRemoved:
+		return ErrAlreadyModerated
+	case StatusApproved, StatusIgnored:
+		it.Status = StatusOpen
+		it.Reports = []Report{}
+		it.Count = 0
+		it.ResolvedBy = ""
+	}
+	for _, r := range it.Reports {
+		if r.ReporterID == report.ReporterID {
+			return ErrAlreadyReported
+		}
+	}
+	it.Reports = append(it.Reports, report)
+	it.Count = len(it.Reports)
+	it.Updated = report.Created
+	// прячем только посты: в лентах бывают только они
+	it.Hidden = it.CommentID == "" && (it.Hidden || report.Hold || threshold > 0 && it.Count >= threshold)
+	return nil
+}
+
+func (it *Item) resolve(status Status, moderator string, now time.Time) error {
+	if status != StatusApproved && status != StatusRemoved && status != StatusIgnored {
+		return ErrBadResolution
+	}
+	if it.Status != StatusOpen {
+		return ErrNotOpen
+	}
+	it.Status = status
+	it.Hidden = false
+	it.ResolvedBy = moderator
+	it.Updated = now
+	return nil
+}
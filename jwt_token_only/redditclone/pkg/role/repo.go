@@ -0,0 +1,94 @@
+package role
+
+import (
+	"redditclone/pkg/user"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type RoleMemoryRepo struct {
+	sync.RWMutex
+	users *user.UserMemoryRepo
+	// админы по username: юзеры живут только в памяти, и их id заранее не известны
+	admins map[string]bool
+	// сообщество в нижнем регистре -> usernames модераторов
+	moderators map[string]map[string]bool
+}
+
+func NewMemoryRepo(users *user.UserMemoryRepo, admins []string) *RoleMemoryRepo {
+	repo := &RoleMemoryRepo{
+		users:      users,
+		admins:     make(map[string]bool, len(admins)),
+		moderators: make(map[string]map[string]bool),
+	}
+	for _, username := range admins {
+		if username != "" {
+			repo.admins[username] = true
+		}
+	}
+	return repo
+}
+
+func (repo *RoleMemoryRepo) Roles(userID string) (*Roles, error) {
+	var username string
+	repo.users.RLock()
+	for _, u := range repo.users.Users {
+		if u.ID == userID {
+			username = u.Username
+			break
+		}
+	}
+	repo.users.RUnlock()
+
+	roles := &Roles{Moderates: make([]string, 0)}
+	if username == "" {
+		return roles, nil
+	}
+	repo.RLock()
+	defer repo.RUnlock()
+	roles.Admin = repo.admins[username]
+	for community, usernames := range repo.moderators {
+		if usernames[username] {
+			roles.Moderates = append(roles.Moderates, community)
+		}
+	}
+	sort.Strings(roles.Moderates)
+	return roles, nil
+}
+
+func (repo *RoleMemoryRepo) AddModerator(community, username string) error {
+	repo.users.RLock()
+	_, ok := repo.users.Users[username]
+	repo.users.RUnlock()
+	if !ok {
+		return ErrNoUser
+	}
+
+	key := strings.ToLower(community)
+	repo.Lock()
+	defer repo.Unlock()
+	if repo.moderators[key] == nil {
+		repo.moderators[key] = make(map[string]bool)
+	}
+	repo.moderators[key][username] = true
+	return nil
+}
+
+func (repo *RoleMemoryRepo) RemoveModerator(community, username string) error {
+	repo.Lock()
+	defer repo.Unlock()
+	delete(repo.moderators[strings.ToLower(community)], username)
+	return nil
+}
+
+func (repo *RoleMemoryRepo) Moderators(community string) ([]string, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	usernames := make([]string, 0, len(repo.moderators[strings.ToLower(community)]))
+	for username := range repo.moderators[strings.ToLower(community)] {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
@@ -1,12 +1,17 @@
 package session
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"redditclone/pkg/utils"
 	"sync"
 	"time"
 )
 
+// SweepInterval - как часто RunSweeper выкидывает протухшие сессии, до которых Check так и не дошел
+const SweepInterval = time.Hour
+
 type SessionsManager struct {
 	data map[string]*Session
 	sync.RWMutex
@@ -18,30 +23,56 @@ func NewSessionsManager() *SessionsManager {
 	}
 }
 
-func (sm *SessionsManager) Check(r *http.Request) (*Session, error) {
-	sessionCookie, err := r.Cookie("session_id")
+// sessionIDFromRequest - сначала смотрим в Bearer-токен (фронт ходит с ним), а если заголовка нет,
+// то в куку. Если заголовок есть, но токен битый - на куку не откатываемся
+func sessionIDFromRequest(r *http.Request) (string, error) {
+	sessionID, err := utils.GetSessionIDFromToken(r)
+	if err == nil {
+		return sessionID, nil
+	}
+	if !errors.Is(err, utils.ErrNoToken) {
+		return "", ErrNoAuth
+	}
 
-	if errors.Is(err, http.ErrNoCookie) {
-		return nil, ErrNoAuth
+	sessionCookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return "", ErrNoAuth
 	}
+	return sessionCookie.Value, nil
+}
 
-	if err != nil || sessionCookie == nil {
+// Check находит живую сессию запроса. Токен без сессии (вышли, забанили, перезапустили сервер) не проходит,
+// протухшую сессию заодно удаляем
+func (sm *SessionsManager) Check(r *http.Request) (*Session, error) {
+	sessionID, err := sessionIDFromRequest(r)
+	if err != nil {
 		return nil, err
 	}
 
-	sm.RLock()
-	defer sm.RUnlock()
-	sess, ok := sm.data[sessionCookie.Value]
+	sm.Lock()
+	defer sm.Unlock()
+	return sm.alive(sessionID, time.Now())
+}
 
+// alive - живая сессия по id, протухшая удаляется. Вызывать под Lock
+func (sm *SessionsManager) alive(sessionID string, now time.Time) (*Session, error) {
+	sess, ok := sm.data[sessionID]
 	if !ok {
 		return nil, ErrNoAuth
 	}
-
+	if now.After(sess.expires) {
+		delete(sm.data, sessionID)
+		return nil, ErrNoAuth
+	}
 	return sess, nil
 }
 
-func (sm *SessionsManager) Create(w http.ResponseWriter, userID string) (*Session, error) {
-	sess := NewSession(userID)
+func (sm *SessionsManager) Create(w http.ResponseWriter, userID, username string) (*Session, error) {
+	sess := NewSession(userID, username)
+	if sess == nil {
+		return nil, utils.ErrGenerateID
+	}
+	sess.expires = time.Now().Add(SessionCookieExp)
 
 	sm.Lock()
 	defer sm.Unlock()
@@ -50,26 +81,98 @@ func (sm *SessionsManager) Create(w http.ResponseWriter, userID string) (*Sessio
 	cookie := &http.Cookie{
 		Name:    SessionCookieName,
 		Value:   sess.ID,
-		Expires: time.Now().Add(SessionCookieExp),
+		Expires: sess.expires,
 		Path:    "/",
 	}
 	http.SetCookie(w, cookie)
 	return sess, nil
 }
 
-// оставил это из примера, но у нас в логике нет logout, мы вообще этот запрос не обрабатываем никак
-func (sm *SessionsManager) DestroyCurrent(w http.ResponseWriter, r *http.Request) error {
-	sess, err := SessionFromContext(r.Context())
+// UpdateCookie продлевает сессию запроса еще на SessionCookieExp. Уже протухшую не продлевает
+func (sm *SessionsManager) UpdateCookie(w http.ResponseWriter, r *http.Request) error {
+	sessionID, err := sessionIDFromRequest(r)
 	if err != nil {
 		return err
 	}
 
 	sm.Lock()
-	delete(sm.data, sess.ID)
+	now := time.Now()
+	sess, err := sm.alive(sessionID, now)
+	if err != nil {
+		sm.Unlock()
+		return err
+	}
+	sess.expires = now.Add(SessionCookieExp)
+	expires := sess.expires
 	sm.Unlock()
 
+	updatedCookie := &http.Cookie{
+		Name:    SessionCookieName,
+		Value:   sessionID,
+		Path:    "/",
+		Expires: expires,
+	}
+	http.SetCookie(w, updatedCookie)
+	return nil
+}
+
+// Destroy удаляет одну сессию по id, например если токен к ней так и не отдали
+func (sm *SessionsManager) Destroy(sessionID string) {
+	sm.Lock()
+	defer sm.Unlock()
+	delete(sm.data, sessionID)
+}
+
+// DestroyUser удаляет все сессии юзера, токены с ними перестают проходить Check
+func (sm *SessionsManager) DestroyUser(userID string) {
+	sm.Lock()
+	defer sm.Unlock()
+	for id, sess := range sm.data {
+		if sess.UserID == userID {
+			delete(sm.data, id)
+		}
+	}
+}
+
+// Sweep удаляет сессии, протухшие к now: юзер, который просто не вернулся, до Check не дойдет
+func (sm *SessionsManager) Sweep(now time.Time) int {
+	sm.Lock()
+	defer sm.Unlock()
+	swept := 0
+	for id, sess := range sm.data {
+		if now.After(sess.expires) {
+			delete(sm.data, id)
+			swept++
+		}
+	}
+	return swept
+}
+
+// RunSweeper зовет Sweep каждые every, пока не отменят ctx
+func (sm *SessionsManager) RunSweeper(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			sm.Sweep(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// DestroyCurrent - выход из сессии, которую в контекст положил middleware.Auth
+func (sm *SessionsManager) DestroyCurrent(w http.ResponseWriter, r *http.Request) error {
+	sess, err := SessionFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	sm.Destroy(sess.ID)
+
 	cookie := http.Cookie{
-		Name:    "session_id",
+		Name:    SessionCookieName,
 		Expires: time.Now().AddDate(0, 0, -1),
 		Path:    "/",
 	}
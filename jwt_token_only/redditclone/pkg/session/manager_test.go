@@ -0,0 +1,113 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/utils"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// signedToken - токен как у логина, подписанный тем же ключом, что проверяет Check
+func signedToken(t *testing.T, sessionID string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		utils.ClaimSessionID: sessionID,
+		utils.ClaimExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+	rec := httptest.NewRecorder()
+	if err := utils.SendJwtToken(rec, token); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return body.Token
+}
+
+func request(token, cookie string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: cookie})
+	}
+	return r
+}
+
+func TestCheck_TokenBeforeCookie(t *testing.T) {
+	sm := NewSessionsManager()
+	fromToken, _ := sm.Create(httptest.NewRecorder(), "u1", "alice")
+	fromCookie, _ := sm.Create(httptest.NewRecorder(), "u2", "bob")
+
+	sess, err := sm.Check(request(signedToken(t, fromToken.ID), fromCookie.ID))
+	if err != nil || sess.ID != fromToken.ID {
+		t.Errorf("expected session from token, got %+v (%v)", sess, err)
+	}
+
+	sess, err = sm.Check(request("", fromCookie.ID))
+	if err != nil || sess.ID != fromCookie.ID {
+		t.Errorf("expected session from cookie, got %+v (%v)", sess, err)
+	}
+
+	// битый токен - на куку не откатываемся
+	if _, err = sm.Check(request("garbage", fromCookie.ID)); !errors.Is(err, ErrNoAuth) {
+		t.Errorf("expected ErrNoAuth for bad token, got %v", err)
+	}
+}
+
+func TestCheck_Expired(t *testing.T) {
+	sm := NewSessionsManager()
+	expired, _ := sm.Create(httptest.NewRecorder(), "u1", "alice")
+	forgotten, _ := sm.Create(httptest.NewRecorder(), "u2", "bob")
+	alive, _ := sm.Create(httptest.NewRecorder(), "u3", "carol")
+	expired.expires = time.Now().Add(-time.Minute)
+	forgotten.expires = time.Now().Add(-time.Minute)
+
+	if _, err := sm.Check(request("", expired.ID)); !errors.Is(err, ErrNoAuth) {
+		t.Errorf("expected ErrNoAuth for expired session, got %v", err)
+	}
+	if _, ok := sm.data[expired.ID]; ok {
+		t.Errorf("expected expired session to be removed by Check")
+	}
+
+	if err := sm.UpdateCookie(httptest.NewRecorder(), request("", forgotten.ID)); !errors.Is(err, ErrNoAuth) {
+		t.Errorf("expected expired session not to be extended, got %v", err)
+	}
+
+	// до этой сессии никто не дошел - ее убирает Sweep
+	forgotten, _ = sm.Create(httptest.NewRecorder(), "u2", "bob")
+	forgotten.expires = time.Now().Add(-time.Minute)
+	if swept := sm.Sweep(time.Now()); swept != 1 {
+		t.Errorf("expected 1 swept session, got %d", swept)
+	}
+	if _, err := sm.Check(request("", alive.ID)); err != nil || len(sm.data) != 1 {
+		t.Errorf("expected only the alive session to stay, got %d sessions (%v)", len(sm.data), err)
+	}
+}
+
+func TestDestroyUser(t *testing.T) {
+	sm := NewSessionsManager()
+	phone, _ := sm.Create(httptest.NewRecorder(), "u1", "alice")
+	laptop, _ := sm.Create(httptest.NewRecorder(), "u1", "alice")
+	other, _ := sm.Create(httptest.NewRecorder(), "u2", "bob")
+
+	sm.DestroyUser("u1")
+
+	for _, id := range []string{phone.ID, laptop.ID} {
+		if _, err := sm.Check(request(signedToken(t, id), "")); !errors.Is(err, ErrNoAuth) {
+			t.Errorf("expected token of destroyed session to fail, got %v", err)
+		}
+	}
+	if sess, err := sm.Check(request("", other.ID)); err != nil || sess.UserID != "u2" {
+		t.Errorf("expected other user to stay logged in, got %+v (%v)", sess, err)
+	}
+}
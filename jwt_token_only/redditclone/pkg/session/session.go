@@ -18,11 +18,14 @@ var (
 )
 
 type Session struct {
-	ID     string
-	UserID string
+	ID       string
+	UserID   string
+	Username string
+	// expires двигает UpdateCookie, протухшую сессию Check не пускает
+	expires time.Time
 }
 
-func NewSession(userID string) *Session {
+func NewSession(userID, username string) *Session {
 	randID := make([]byte, 16)
 	_, err := rand.Read(randID)
 	if err != nil {
@@ -30,8 +33,9 @@ func NewSession(userID string) *Session {
 	}
 
 	return &Session{
-		ID:     fmt.Sprintf("%x", randID),
-		UserID: userID,
+		ID:       fmt.Sprintf("%x", randID),
+		UserID:   userID,
+		Username: username,
 	}
 }
 
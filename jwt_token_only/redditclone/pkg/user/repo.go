@@ -4,6 +4,7 @@ import (
 	"errors"
 	"redditclone/pkg/utils"
 	"sync"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -16,26 +17,44 @@ var (
 
 type UserMemoryRepo struct {
 	sync.RWMutex
-	Users map[string]*User
+	Users  map[string]*User
+	hasher *PasswordHasher
 }
 
-func NewMemoryRepo() *UserMemoryRepo {
+func NewMemoryRepo(hasher *PasswordHasher) *UserMemoryRepo {
 	return &UserMemoryRepo{
-		Users: make(map[string]*User),
+		Users:  make(map[string]*User),
+		hasher: hasher,
 	}
 }
 
 func (repo *UserMemoryRepo) Authorize(username, password string) (*User, error) {
+	// bcrypt долгий, так что сверяем под RLock, чтобы не стопорить остальные логины и регистрации
 	repo.RLock()
-	defer repo.RUnlock()
 	u, ok := repo.Users[username]
 	if !ok {
+		repo.RUnlock()
 		return nil, ErrNoUser
 	}
-	if u.Password != password {
+	stored := u.Password
+	result := &User{ID: u.ID, Username: u.Username}
+	repo.RUnlock()
+
+	ok, needsRehash := repo.hasher.Verify(stored, password)
+	if !ok {
 		return nil, ErrBadPass
 	}
-	return u, nil
+	if needsRehash {
+		if hash, err := repo.hasher.Hash(password); err == nil {
+			repo.Lock()
+			// пока хешировали, пароль могли поменять - тогда наш хеш уже устарел
+			if u.Password == stored {
+				u.Password = hash
+			}
+			repo.Unlock()
+		}
+	}
+	return result, nil
 }
 
 func (repo *UserMemoryRepo) Register(username, password string) (*User, error) {
@@ -48,22 +67,54 @@ func (repo *UserMemoryRepo) Register(username, password string) (*User, error) {
 	if err != nil {
 		return nil, err
 	}
+	hash, err := repo.hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
 	u := &User{
 		Username: username,
-		Password: password,
+		Password: hash,
 		ID:       newUserID,
+		Created:  time.Now().UTC(),
 	}
 	repo.Users[username] = u
-	return u, nil
+	return &User{ID: u.ID, Username: u.Username, Created: u.Created}, nil
+}
+
+// GetUser - юзеры лежат по логину, так что по id ищем перебором
+func (repo *UserMemoryRepo) GetUser(userID string) (*User, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	for _, u := range repo.Users {
+		if u.ID == userID {
+			return &User{ID: u.ID, Username: u.Username, Created: u.Created}, nil
+		}
+	}
+	return nil, ErrNoUser
+}
+
+// GetUserByName - для упоминаний u/name, без пароля
+func (repo *UserMemoryRepo) GetUserByName(username string) (*User, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	u, ok := repo.Users[username]
+	if !ok {
+		return nil, ErrNoUser
+	}
+	return &User{ID: u.ID, Username: u.Username, Created: u.Created}, nil
 }
 
-func (repo *UserMemoryRepo) GenerateUserToken(u User) *jwt.Token {
+func (repo *UserMemoryRepo) GenerateUserToken(u User, sessionID string) *jwt.Token {
+	// юзер нужен фронту, а по sid мы потом ищем сессию в менеджере - содержимому токена больше не доверяем
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user": map[string]string{
+		utils.ClaimUser: map[string]string{
 			"username": u.Username,
 			"id":       u.ID,
 		},
-		// "exp": time.Now().Add(1 * time.Hour).Unix(),
+		utils.ClaimSessionID: sessionID,
+		utils.ClaimIssuedAt:  now.Unix(),
+		utils.ClaimExpiresAt: now.Add(utils.JwtTokenExp).Unix(),
 	})
 	return token
 }
@@ -1,11 +1,16 @@
 package user
 
-import "github.com/dgrijalva/jwt-go"
+import (
+	"github.com/dgrijalva/jwt-go"
+	"time"
+)
 
 type User struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
-	Password string `json:"password,omitempty"`
+	Password string `json:"-"` // то, что лежит в репо (хеш), наружу не отдаем никогда
+	// когда зарегистрирован, по нему автомодератор считает возраст аккаунта
+	Created time.Time `json:"created"`
 }
 
 type UserRequest struct {
@@ -16,5 +21,8 @@ type UserRequest struct {
 type UserRepo interface {
 	Authorize(login, password string) (*User, error)
 	Register(login, password string) (*User, error)
-	GenerateUserToken(u User) *jwt.Token
+	GenerateUserToken(u User, sessionID string) *jwt.Token
+	// GetUser - юзер по id без пароля
+	GetUser(userID string) (*User, error)
+	GetUserByName(username string) (*User, error)
 }
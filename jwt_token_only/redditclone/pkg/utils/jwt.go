@@ -5,15 +5,27 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
 var jwtSecret = []byte("super_secret_key")
 
+const (
+	ClaimUser      = "user"
+	ClaimSessionID = "sid"
+	ClaimIssuedAt  = "iat"
+	ClaimExpiresAt = "exp"
+
+	// столько же живет кука сессии, дальше сессию все равно надо заводить заново
+	JwtTokenExp = 72 * time.Hour
+)
+
 var (
-	ErrNoKey        = errors.New("key not found")
-	ErrUnauthorized = errors.New("unauthorized")
+	ErrNoKey   = errors.New("key not found")
+	ErrNoToken = errors.New("no token provided")
+	ErrBadJwt  = errors.New("bad token")
 )
 
 func SendJwtToken(w http.ResponseWriter, token *jwt.Token) error {
@@ -29,22 +41,10 @@ func SendJwtToken(w http.ResponseWriter, token *jwt.Token) error {
 	return nil
 }
 
-func checkTokenAndGetClaims(r *http.Request) (map[string]interface{}, error) {
-	tokenString, err := getTokenFromHeader(r)
-	if err != nil {
-		return map[string]interface{}{}, ErrUnauthorized
-	}
-	_, userClaims, err := parseToken(tokenString)
-	if err != nil {
-		return map[string]interface{}{}, ErrUnauthorized
-	}
-	return userClaims, nil
-}
-
 func getTokenFromHeader(r *http.Request) (string, error) {
 	tokenString := r.Header.Get("Authorization")
 	if tokenString == "" {
-		return "", fmt.Errorf("no token provided")
+		return "", ErrNoToken
 	}
 	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 	return tokenString, nil
@@ -69,15 +69,20 @@ func parseToken(tokenString string) (*jwt.Token, jwt.MapClaims, error) {
 	return token, claims, nil
 }
 
-func GetClaimsByKey(r *http.Request, key string) (map[string]interface{}, error) {
-	userClaims, err := checkTokenAndGetClaims(r)
+// GetSessionIDFromToken достает из Bearer-токена айди сессии. Сам токен тут только проверяется на подпись и срок,
+// жива ли сессия - решает менеджер сессий
+func GetSessionIDFromToken(r *http.Request) (string, error) {
+	tokenString, err := getTokenFromHeader(r)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-
-	claims, ok := userClaims[key].(map[string]interface{})
-	if !ok {
-		return nil, ErrNoKey
+	_, claims, err := parseToken(tokenString)
+	if err != nil {
+		return "", ErrBadJwt
+	}
+	sessionID, ok := claims[ClaimSessionID].(string)
+	if !ok || sessionID == "" {
+		return "", ErrNoKey
 	}
-	return claims, nil
+	return sessionID, nil
 }
@@ -0,0 +1,63 @@
+package views
+
+import (
+	"sync"
+	"time"
+)
+
+type MemoryCounter struct {
+	sync.Mutex
+	window time.Duration
+	// postID + зритель -> когда засчитали последний просмотр
+	seen map[string]time.Time
+	// postID -> сколько просмотров еще не сброшено в пост
+	pending map[string]int
+}
+
+func NewMemoryCounter(window time.Duration) *MemoryCounter {
+	return &MemoryCounter{
+		window:  window,
+		seen:    make(map[string]time.Time),
+		pending: make(map[string]int),
+	}
+}
+
+func (c *MemoryCounter) Record(postID, viewer string) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+	key := postID + ":" + viewer
+	now := time.Now()
+	if at, ok := c.seen[key]; ok && now.Sub(at) < c.window {
+		return c.pending[postID], nil
+	}
+	c.seen[key] = now
+	c.pending[postID]++
+	return c.pending[postID], nil
+}
+
+// Flush заодно чистит протухшие отметки о просмотрах, иначе seen рос бы бесконечно
+func (c *MemoryCounter) Flush(sink Sink) error {
+	c.Lock()
+	batch := c.pending
+	c.pending = make(map[string]int)
+	now := time.Now()
+	for key, at := range c.seen {
+		if now.Sub(at) >= c.window {
+			delete(c.seen, key)
+		}
+	}
+	c.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := sink.AddViews(batch); err != nil {
+		c.Lock()
+		for postID, n := range batch {
+			c.pending[postID] += n
+		}
+		c.Unlock()
+		return err
+	}
+	return nil
+}
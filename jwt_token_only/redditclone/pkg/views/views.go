@@ -0,0 +1,48 @@
+package views
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Повторный просмотр того же зрителя в пределах окна не считается
+const (
+	DedupWindow   = 30 * time.Minute
+	FlushInterval = 10 * time.Second
+)
+
+// Counter копит просмотры у себя и только раз в FlushInterval сбрасывает их в посты -
+// иначе популярный пост получал бы запись в базу на каждое открытие
+type Counter interface {
+	// Record засчитывает просмотр поста зрителем viewer, если тот не смотрел его последние DedupWindow.
+	// Возвращает, сколько просмотров поста еще не сброшено - их надо прибавить к Views при выдаче
+	Record(postID, viewer string) (int, error)
+	// Flush отдает накопленное в sink. Если sink не справился, просмотры остаются до следующего раза
+	Flush(sink Sink) error
+}
+
+// Sink - куда сбрасываются просмотры: postID -> сколько прибавить, см. post.PostRepo.AddViews
+type Sink interface {
+	AddViews(views map[string]int) error
+}
+
+// Run сбрасывает просмотры каждые every, пока не отменят ctx, и еще раз напоследок
+func Run(ctx context.Context, counter Counter, sink Sink, every time.Duration, logger *zap.SugaredLogger) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := counter.Flush(sink); err != nil {
+				logger.Errorf("Error flushing views: %v", err)
+			}
+		case <-ctx.Done():
+			if err := counter.Flush(sink); err != nil {
+				logger.Errorf("Error flushing views: %v", err)
+			}
+			return
+		}
+	}
+}
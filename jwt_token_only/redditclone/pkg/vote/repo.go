@@ -0,0 +1,93 @@
+package vote
+
+import "sync"
+
+type VoteMemoryRepo struct {
+	sync.RWMutex
+	// postID -> userID -> голос
+	Votes map[string]map[string]int
+	// postID -> commentID -> userID -> голос
+	CommentVotes map[string]map[string]map[string]int
+}
+
+func NewMemoryRepo() *VoteMemoryRepo {
+	return &VoteMemoryRepo{
+		Votes:        make(map[string]map[string]int),
+		CommentVotes: make(map[string]map[string]map[string]int),
+	}
+}
+
+func (repo *VoteMemoryRepo) SetVote(postID, userID string, vote int) (int, error) {
+	if !validVote(vote) {
+		return 0, ErrBadVote
+	}
+	repo.Lock()
+	defer repo.Unlock()
+	postVotes, ok := repo.Votes[postID]
+	if !ok {
+		postVotes = make(map[string]int)
+		repo.Votes[postID] = postVotes
+	}
+	return setVote(postVotes, userID, vote), nil
+}
+
+func (repo *VoteMemoryRepo) SetCommentVote(postID, commentID, userID string, vote int) (int, error) {
+	if !validVote(vote) {
+		return 0, ErrBadVote
+	}
+	repo.Lock()
+	defer repo.Unlock()
+	postComments, ok := repo.CommentVotes[postID]
+	if !ok {
+		postComments = make(map[string]map[string]int)
+		repo.CommentVotes[postID] = postComments
+	}
+	commentVotes, ok := postComments[commentID]
+	if !ok {
+		commentVotes = make(map[string]int)
+		postComments[commentID] = commentVotes
+	}
+	return setVote(commentVotes, userID, vote), nil
+}
+
+func setVote(votes map[string]int, userID string, vote int) int {
+	previous := votes[userID]
+	if vote == 0 {
+		delete(votes, userID)
+	} else {
+		votes[userID] = vote
+	}
+	return previous
+}
+
+func (repo *VoteMemoryRepo) UserVotes(userID string, postIDs []string) (map[string]int, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	votes := make(map[string]int, len(postIDs))
+	for _, postID := range postIDs {
+		if vote, ok := repo.Votes[postID][userID]; ok {
+			votes[postID] = vote
+		}
+	}
+	return votes, nil
+}
+
+func (repo *VoteMemoryRepo) UserCommentVotes(userID, postID string) (map[string]int, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+	votes := make(map[string]int)
+	for commentID, commentVotes := range repo.CommentVotes[postID] {
+		if vote, ok := commentVotes[userID]; ok {
+			votes[commentID] = vote
+		}
+	}
+	return votes, nil
+}
+
+func (repo *VoteMemoryRepo) DeletePostVotes(postID string) error {
+	repo.Lock()
+	defer repo.Unlock()
+	delete(repo.Votes, postID)
+	delete(repo.CommentVotes, postID)
+	return nil
+}
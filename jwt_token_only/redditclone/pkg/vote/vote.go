@@ -0,0 +1,30 @@
+package vote
+
+import "errors"
+
+var ErrBadVote = errors.New("bad vote")
+
+// Vote - голос юзера за пост или за коммент к нему (тогда заполнен CommentID). Раньше голоса лежали массивом
+// прямо в посте, но у популярных постов документ рос бесконечно, а список всех проголосовавших уходил в каждую ленту
+type Vote struct {
+	PostID    string `json:"postId" bson:"post_id"`
+	CommentID string `json:"commentId,omitempty" bson:"comment_id,omitempty"`
+	UserID    string `json:"userId" bson:"user_id"`
+	Vote      int    `json:"vote" bson:"vote"`
+}
+
+type VoteRepo interface {
+	// SetVote ставит голос (1, -1, 0 - снять) и возвращает предыдущий, 0 - если не голосовал
+	SetVote(postID, userID string, vote int) (int, error)
+	SetCommentVote(postID, commentID, userID string, vote int) (int, error)
+	// UserVotes - голоса юзера за переданные посты, постов без голоса в мапе нет
+	UserVotes(userID string, postIDs []string) (map[string]int, error)
+	// UserCommentVotes - голоса юзера за комменты поста, commentID -> голос
+	UserCommentVotes(userID, postID string) (map[string]int, error)
+	// DeletePostVotes удаляет голоса и за пост, и за все его комменты
+	DeletePostVotes(postID string) error
+}
+
+func validVote(vote int) bool {
+	return vote == 1 || vote == -1 || vote == 0
+}